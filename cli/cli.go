@@ -0,0 +1,379 @@
+// Package cli implements migrator commands which run a single operation and exit, without starting the HTTP server
+// commands can be used in Kubernetes Jobs, init containers, and CI pipelines
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/metrics"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// exit codes returned by Run
+const (
+	// ExitOK means command succeeded, there are no pending migrations and no checksum drift
+	ExitOK = 0
+	// ExitFailure means command failed, also returned when tenants failed in per-tenant transactions
+	ExitFailure = 1
+	// ExitPending means there are pending migrations
+	ExitPending = 2
+	// ExitDrift means applied migrations were modified in source
+	ExitDrift = 3
+)
+
+const usage = `usage: migrator [-configFile migrator.yaml] <command> [flags]
+
+commands:
+  apply                   apply pending migrations (createVersion)
+  status                  report pending migrations and checksum drift
+  verify                  report applied migrations modified in source
+  plan                    list migrations which apply would run per schema
+  tenants create <name>   create a new tenant and apply tenant migrations
+
+run migrator <command> -h to list flags of a command
+exit codes: 0 ok, 1 failure, 2 pending migrations, 3 checksum drift
+`
+
+// command is a parsed command together with its common flags
+type command struct {
+	ctx            context.Context
+	name           string
+	flags          *flag.FlagSet
+	stdout         io.Writer
+	stderr         io.Writer
+	config         *config.Config
+	newCoordinator coordinator.Factory
+	target         string
+	json           bool
+}
+
+// Run executes command passed in args, for example []string{"apply", "-dryRun"}
+// output is written to stdout, errors are written to stderr, returned value is the exit code of the process
+func Run(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer, config *config.Config, newCoordinator coordinator.Factory) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return ExitFailure
+	}
+
+	name := args[0]
+	args = args[1:]
+	if name == "tenants" {
+		if len(args) == 0 || args[0] != "create" {
+			fmt.Fprint(stderr, "usage: migrator tenants create [flags] <name>\n")
+			return ExitFailure
+		}
+		name = "tenants create"
+		args = args[1:]
+	}
+
+	cmd := &command{ctx: ctx, name: name, stdout: stdout, stderr: stderr, config: config, newCoordinator: newCoordinator}
+	cmd.flags = flag.NewFlagSet("migrator "+name, flag.ContinueOnError)
+	cmd.flags.SetOutput(stderr)
+	cmd.flags.StringVar(&cmd.target, "target", "", "name of the target, the default target is used when empty")
+	cmd.flags.BoolVar(&cmd.json, "json", false, "print output as JSON")
+
+	switch name {
+	case "apply":
+		return cmd.apply(args)
+	case "status":
+		return cmd.status(args)
+	case "verify":
+		return cmd.verify(args)
+	case "plan":
+		return cmd.plan(args)
+	case "tenants create":
+		return cmd.createTenant(args)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return ExitOK
+	default:
+		fmt.Fprintf(stderr, "unknown command: %v\n%v", name, usage)
+		return ExitFailure
+	}
+}
+
+func (cmd *command) parse(args []string) bool {
+	return cmd.flags.Parse(args) == nil
+}
+
+// coordinator returns Coordinator of the target selected with -target flag
+func (cmd *command) coordinator() (coordinator.Coordinator, error) {
+	targetConfig, err := cmd.config.GetTarget(cmd.target)
+	if err != nil {
+		return nil, err
+	}
+	return cmd.newCoordinator(cmd.ctx, targetConfig, metrics.NewNoop()), nil
+}
+
+func (cmd *command) apply(args []string) int {
+	versionName := cmd.flags.String("versionName", "", "name of the version, defaults to apply-<UTC timestamp>")
+	selector := cmd.flags.String("selector", "", "label selector, tenant migrations are applied only to matching tenants")
+	dryRun := cmd.flags.Bool("dryRun", false, "run migrations in a transaction which is rolled back")
+	sync := cmd.flags.Bool("sync", false, "record migrations as applied without executing them")
+	planHash := cmd.flags.String("planHash", "", "hash returned by plan, apply fails when the plan changed since then")
+	if !cmd.parse(args) {
+		return ExitFailure
+	}
+	if *versionName == "" {
+		*versionName = "apply-" + time.Now().UTC().Format("20060102150405")
+	}
+
+	c, err := cmd.coordinator()
+	if err != nil {
+		return cmd.fail(err)
+	}
+	defer c.Dispose()
+
+	results, err := c.CreateVersion(*versionName, action(*sync), *dryRun, *selector, *planHash)
+	if err != nil {
+		return cmd.fail(err)
+	}
+	return cmd.printResults(results)
+}
+
+func (cmd *command) createTenant(args []string) int {
+	versionName := cmd.flags.String("versionName", "", "name of the version, defaults to create-tenant-<name>")
+	labels := cmd.flags.String("labels", "", "comma-separated tenant labels, for example region=eu,canary=true")
+	dryRun := cmd.flags.Bool("dryRun", false, "run migrations in a transaction which is rolled back")
+	sync := cmd.flags.Bool("sync", false, "record migrations as applied without executing them")
+	if !cmd.parse(args) {
+		return ExitFailure
+	}
+	if cmd.flags.NArg() != 1 {
+		fmt.Fprint(cmd.stderr, "usage: migrator tenants create [flags] <name>\n")
+		cmd.flags.PrintDefaults()
+		return ExitFailure
+	}
+	tenant := cmd.flags.Arg(0)
+	if *versionName == "" {
+		*versionName = "create-tenant-" + tenant
+	}
+	tenantLabels, err := parseTenantLabels(*labels)
+	if err != nil {
+		return cmd.fail(err)
+	}
+
+	c, err := cmd.coordinator()
+	if err != nil {
+		return cmd.fail(err)
+	}
+	defer c.Dispose()
+
+	results, err := c.CreateTenant(*versionName, action(*sync), *dryRun, tenant, tenantLabels)
+	if err != nil {
+		return cmd.fail(err)
+	}
+	return cmd.printResults(results)
+}
+
+func (cmd *command) verify(args []string) int {
+	if !cmd.parse(args) {
+		return ExitFailure
+	}
+
+	c, err := cmd.coordinator()
+	if err != nil {
+		return cmd.fail(err)
+	}
+	defer c.Dispose()
+
+	mismatches, err := c.VerifyChecksums()
+	if err != nil {
+		return cmd.fail(err)
+	}
+
+	if cmd.json {
+		cmd.printJSON(mismatches)
+	} else {
+		cmd.printMismatches(mismatches, true)
+	}
+	if len(mismatches) > 0 {
+		return ExitDrift
+	}
+	return ExitOK
+}
+
+func (cmd *command) plan(args []string) int {
+	selector := cmd.flags.String("selector", "", "label selector, tenant migrations are planned only for matching tenants")
+	if !cmd.parse(args) {
+		return ExitFailure
+	}
+
+	c, err := cmd.coordinator()
+	if err != nil {
+		return cmd.fail(err)
+	}
+	defer c.Dispose()
+
+	plan, err := c.Plan(*selector)
+	if err != nil {
+		return cmd.fail(err)
+	}
+
+	if cmd.json {
+		cmd.printJSON(plan)
+	} else {
+		cmd.printPlan(plan)
+	}
+	if plan.Pending() > 0 {
+		return ExitPending
+	}
+	return ExitOK
+}
+
+// status is returned by status command
+type status struct {
+	Pending            int32                    `json:"pending"`
+	Plan               *types.Plan              `json:"plan"`
+	ChecksumMismatches []types.ChecksumMismatch `json:"checksumMismatches"`
+}
+
+func (cmd *command) status(args []string) int {
+	selector := cmd.flags.String("selector", "", "label selector, only matching tenants are checked for pending tenant migrations")
+	if !cmd.parse(args) {
+		return ExitFailure
+	}
+
+	c, err := cmd.coordinator()
+	if err != nil {
+		return cmd.fail(err)
+	}
+	defer c.Dispose()
+
+	mismatches, err := c.VerifyChecksums()
+	if err != nil {
+		return cmd.fail(err)
+	}
+	plan, err := c.Plan(*selector)
+	if err != nil {
+		return cmd.fail(err)
+	}
+
+	if cmd.json {
+		cmd.printJSON(status{Pending: plan.Pending(), Plan: plan, ChecksumMismatches: mismatches})
+	} else {
+		fmt.Fprintf(cmd.stdout, "Pending migrations: %v\n", plan.Pending())
+		cmd.printMismatches(mismatches, false)
+	}
+
+	// drift must be fixed before pending migrations can be applied
+	if len(mismatches) > 0 {
+		return ExitDrift
+	}
+	if plan.Pending() > 0 {
+		return ExitPending
+	}
+	return ExitOK
+}
+
+// fail prints error and returns its exit code, modified source migrations are reported as checksum drift
+func (cmd *command) fail(err error) int {
+	fmt.Fprintf(cmd.stderr, "Error: %v\n", err)
+	var checksumMismatch *types.ChecksumMismatchError
+	if errors.As(err, &checksumMismatch) {
+		return ExitDrift
+	}
+	return ExitFailure
+}
+
+func (cmd *command) printJSON(v interface{}) {
+	encoder := json.NewEncoder(cmd.stdout)
+	encoder.SetIndent("", "  ")
+	// values are built by migrator and always serialise
+	_ = encoder.Encode(v)
+}
+
+// printResults prints summary and version, tenants which failed in per-tenant transactions cause ExitFailure
+func (cmd *command) printResults(results *types.CreateResults) int {
+	summary := results.Summary
+	if cmd.json {
+		cmd.printJSON(struct {
+			Summary *types.Summary `json:"summary"`
+			Version *types.Version `json:"version,omitempty"`
+		}{summary, results.Version})
+	} else {
+		if results.Version != nil {
+			fmt.Fprintf(cmd.stdout, "Version: %v (ID %v)\n", results.Version.Name, results.Version.ID)
+		} else {
+			fmt.Fprint(cmd.stdout, "Version: not created\n")
+		}
+		fmt.Fprintf(cmd.stdout, "Tenants: %v\n", summary.Tenants)
+		fmt.Fprintf(cmd.stdout, "Migrations: %v (single %v, tenant %v)\n", summary.MigrationsGrandTotal, summary.SingleMigrations, summary.TenantMigrationsTotal)
+		fmt.Fprintf(cmd.stdout, "Scripts: %v (single %v, tenant %v, skipped on-change %v)\n", summary.ScriptsGrandTotal, summary.SingleScripts, summary.TenantScriptsTotal, summary.ScriptsSkipped)
+		for _, f := range summary.FailedTenants {
+			fmt.Fprintf(cmd.stdout, "Failed tenant %v: %v\n", f.Tenant, f.Error)
+		}
+		fmt.Fprintf(cmd.stdout, "Duration: %.3fs\n", summary.Duration)
+	}
+	if len(summary.FailedTenants) > 0 {
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+func (cmd *command) printPlan(plan *types.Plan) {
+	for _, group := range []struct {
+		title   string
+		schemas []types.SchemaPlan
+	}{{"Single schemas", plan.SingleSchemas}, {"Tenants", plan.Tenants}} {
+		if len(group.schemas) == 0 {
+			continue
+		}
+		fmt.Fprintf(cmd.stdout, "%v:\n", group.title)
+		for _, s := range group.schemas {
+			fmt.Fprintf(cmd.stdout, "  %v:\n", s.Schema)
+			for _, m := range s.Migrations {
+				fmt.Fprintf(cmd.stdout, "    %v (%v, checksum %v)\n", m.File, m.MigrationType, m.CheckSum)
+			}
+		}
+	}
+	fmt.Fprintf(cmd.stdout, "Pending migrations: %v\n", plan.Pending())
+	fmt.Fprintf(cmd.stdout, "Plan hash: %v\n", plan.Hash)
+}
+
+// printMismatches prints modified files, diffs are printed only when requested
+func (cmd *command) printMismatches(mismatches []types.ChecksumMismatch, diffs bool) {
+	if len(mismatches) == 0 {
+		fmt.Fprint(cmd.stdout, "Checksum drift: none\n")
+		return
+	}
+	fmt.Fprintf(cmd.stdout, "Checksum drift: %v modified migrations\n", len(mismatches))
+	for _, m := range mismatches {
+		fmt.Fprintf(cmd.stdout, "  %v (applied %v, source %v)\n", m.File, m.AppliedCheckSum, m.SourceCheckSum)
+		if diffs {
+			fmt.Fprint(cmd.stdout, m.Diff)
+		}
+	}
+}
+
+func action(sync bool) types.Action {
+	if sync {
+		return types.ActionSync
+	}
+	return types.ActionApply
+}
+
+// parseTenantLabels parses comma-separated key=value pairs, labels are validated by coordinator
+func parseTenantLabels(labels string) ([]types.TenantLabel, error) {
+	tenantLabels := []types.TenantLabel{}
+	if strings.TrimSpace(labels) == "" {
+		return tenantLabels, nil
+	}
+	for _, pair := range strings.Split(labels, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, &types.InvalidArgumentError{Argument: "labels", Err: fmt.Errorf("label %q is not in key=value format", pair)}
+		}
+		tenantLabels = append(tenantLabels, types.TenantLabel{Key: key, Value: value})
+	}
+	return tenantLabels, nil
+}
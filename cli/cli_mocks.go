@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/metrics"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+type mockedCoordinator struct {
+	// pending adds a tenant migration to the plan
+	pending bool
+	// drift adds a checksum mismatch
+	drift bool
+	// failedTenant adds a failed tenant to summaries
+	failedTenant bool
+	// fail makes all operations return an error
+	fail error
+	// arguments passed to the last CreateVersion or CreateTenant call
+	versionName string
+	action      types.Action
+	dryRun      bool
+	selector    string
+	planHash    string
+	tenant      string
+	labels      []types.TenantLabel
+	// config passed to factory
+	config *config.Config
+}
+
+func newMockedCoordinatorFactory(m *mockedCoordinator) coordinator.Factory {
+	return func(ctx context.Context, config *config.Config, metrics metrics.Metrics) coordinator.Coordinator {
+		m.config = config
+		return m
+	}
+}
+
+func (m *mockedCoordinator) summary() *types.Summary {
+	summary := &types.Summary{VersionID: 12, Tenants: 2, TenantMigrations: 1, TenantMigrationsTotal: 2, MigrationsGrandTotal: 2}
+	if m.failedTenant {
+		summary.FailedTenants = []types.TenantFailure{{Tenant: "def", Error: "trouble maker"}}
+	}
+	return summary
+}
+
+func (m *mockedCoordinator) CreateVersion(versionName string, action types.Action, dryRun bool, selector string, planHash string) (*types.CreateResults, error) {
+	if m.fail != nil {
+		return nil, m.fail
+	}
+	m.versionName, m.action, m.dryRun, m.selector, m.planHash = versionName, action, dryRun, selector, planHash
+	return &types.CreateResults{Summary: m.summary(), Version: &types.Version{ID: 12, Name: versionName}}, nil
+}
+
+func (m *mockedCoordinator) CreateTenant(versionName string, action types.Action, dryRun bool, tenant string, labels []types.TenantLabel) (*types.CreateResults, error) {
+	if m.fail != nil {
+		return nil, m.fail
+	}
+	m.versionName, m.action, m.dryRun, m.tenant, m.labels = versionName, action, dryRun, tenant, labels
+	return &types.CreateResults{Summary: m.summary(), Version: &types.Version{ID: 12, Name: versionName}}, nil
+}
+
+func (m *mockedCoordinator) Plan(selector string) (*types.Plan, error) {
+	if m.fail != nil {
+		return nil, m.fail
+	}
+	m.selector = selector
+	plan := &types.Plan{
+		Hash:          "0a1b2c",
+		SingleSchemas: []types.SchemaPlan{{Schema: "config", Migrations: []types.PlannedMigration{{File: "config/views.sql", MigrationType: types.MigrationTypeSingleScript, CheckSum: "abc"}}}},
+		Tenants:       []types.SchemaPlan{},
+	}
+	if m.pending {
+		plan.Tenants = append(plan.Tenants, types.SchemaPlan{Schema: "abc", Migrations: []types.PlannedMigration{{File: "tenants/202001010000.sql", MigrationType: types.MigrationTypeTenantMigration, CheckSum: "def"}}})
+	}
+	return plan, nil
+}
+
+func (m *mockedCoordinator) VerifyChecksums() ([]types.ChecksumMismatch, error) {
+	if m.fail != nil {
+		return nil, m.fail
+	}
+	mismatches := []types.ChecksumMismatch{}
+	if m.drift {
+		mismatches = append(mismatches, types.ChecksumMismatch{File: "tenants/201901010000.sql", SourceCheckSum: "123", AppliedCheckSum: "456", Diff: "--- tenants/201901010000.sql\tapplied\n+++ tenants/201901010000.sql\tsource\n"})
+	}
+	return mismatches, nil
+}
+
+func (m *mockedCoordinator) Dispose() {
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) GetTenants(string) ([]types.Tenant, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) SetTenantLabels(string, []types.TenantLabel) (*types.Tenant, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) GetVersions() ([]types.Version, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) GetVersionsByFile(string) ([]types.Version, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) GetVersionByID(int32) (*types.Version, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) GetDBMigrationByID(int32) (*types.DBMigration, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) GetSourceMigrations(*coordinator.SourceMigrationFilters) ([]types.Migration, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) GetSourceMigrationByFile(string) (*types.Migration, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) VerifySourceMigrationsCheckSums() (bool, []types.Migration, error) {
+	return false, nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) SchemaDrift() ([]types.SchemaDrift, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) VersionSchemaDiff(int32, int32) ([]types.SchemaSnapshotDiff, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) CreateVersionJob(string, types.Action, bool, string, string) (*types.Job, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) CreateTenantJob(string, types.Action, bool, string, []types.TenantLabel) (*types.Job, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) GetJobByID(int32) (*types.Job, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) Baseline(string, []string, bool) (*types.CreateResults, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) RollbackVersion(int32, bool) (*types.CreateResults, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) ArchiveTenant(string) (*types.CreateResults, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) DropTenant(string, bool) (*types.CreateResults, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) RenameTenant(string, string) (*types.CreateResults, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) RepairChecksums([]string, string) ([]types.ChecksumRepair, error) {
+	return nil, errors.New("not implemented")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) HealthCheck() types.HealthResponse {
+	return types.HealthResponse{}
+}
@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+func newTestConfig() *config.Config {
+	return &config.Config{
+		Driver:     "postgres",
+		DataSource: "user=postgres dbname=migrator",
+		Targets: map[string]*config.Target{
+			"orders": {Driver: "mysql", DataSource: "root@/orders", BaseLocation: "orders"},
+		},
+	}
+}
+
+func run(m *mockedCoordinator, args ...string) (int, string, string) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	code := Run(context.TODO(), args, stdout, stderr, newTestConfig(), newMockedCoordinatorFactory(m))
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunNoCommand(t *testing.T) {
+	code, _, stderr := run(&mockedCoordinator{})
+	assert.Equal(t, ExitFailure, code)
+	assert.Contains(t, stderr, "usage: migrator")
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	code, _, stderr := run(&mockedCoordinator{}, "migrate")
+	assert.Equal(t, ExitFailure, code)
+	assert.Contains(t, stderr, "unknown command: migrate")
+}
+
+func TestApply(t *testing.T) {
+	m := &mockedCoordinator{}
+	code, stdout, _ := run(m, "apply", "-versionName", "commit-sha", "-selector", "region=eu", "-dryRun", "-planHash", "0a1b2c")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "commit-sha", m.versionName)
+	assert.Equal(t, "region=eu", m.selector)
+	assert.Equal(t, "0a1b2c", m.planHash)
+	assert.Equal(t, types.ActionApply, m.action)
+	assert.True(t, m.dryRun)
+	assert.Contains(t, stdout, "Version: commit-sha (ID 12)")
+	assert.Contains(t, stdout, "Migrations: 2 (single 0, tenant 2)")
+}
+
+func TestApplyDefaultVersionName(t *testing.T) {
+	m := &mockedCoordinator{}
+	code, _, _ := run(m, "apply", "-sync")
+	assert.Equal(t, ExitOK, code)
+	assert.True(t, strings.HasPrefix(m.versionName, "apply-"))
+	assert.Equal(t, types.ActionSync, m.action)
+}
+
+func TestApplyJSON(t *testing.T) {
+	code, stdout, _ := run(&mockedCoordinator{}, "apply", "-json")
+	assert.Equal(t, ExitOK, code)
+
+	var output struct {
+		Summary types.Summary
+		Version types.Version
+	}
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &output))
+	assert.Equal(t, int32(2), output.Summary.MigrationsGrandTotal)
+	assert.Equal(t, int32(12), output.Version.ID)
+}
+
+func TestApplyFailedTenants(t *testing.T) {
+	code, stdout, _ := run(&mockedCoordinator{failedTenant: true}, "apply")
+	assert.Equal(t, ExitFailure, code)
+	assert.Contains(t, stdout, "Failed tenant def: trouble maker")
+}
+
+func TestApplyError(t *testing.T) {
+	code, _, stderr := run(&mockedCoordinator{fail: errors.New("trouble maker")}, "apply")
+	assert.Equal(t, ExitFailure, code)
+	assert.Equal(t, "Error: trouble maker\n", stderr)
+
+	code, _, _ = run(&mockedCoordinator{fail: &types.ChecksumMismatchError{Migrations: []types.Migration{{File: "tenants/201901010000.sql"}}}}, "apply")
+	assert.Equal(t, ExitDrift, code)
+}
+
+func TestApplyTarget(t *testing.T) {
+	m := &mockedCoordinator{}
+	code, _, _ := run(m, "apply", "-target", "orders")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "mysql", m.config.Driver)
+
+	code, _, stderr := run(m, "apply", "-target", "payments")
+	assert.Equal(t, ExitFailure, code)
+	assert.Contains(t, stderr, "target payments is not configured")
+}
+
+func TestApplyInvalidFlag(t *testing.T) {
+	code, _, stderr := run(&mockedCoordinator{}, "apply", "-force")
+	assert.Equal(t, ExitFailure, code)
+	assert.Contains(t, stderr, "flag provided but not defined: -force")
+}
+
+func TestCreateTenant(t *testing.T) {
+	m := &mockedCoordinator{}
+	code, stdout, _ := run(m, "tenants", "create", "-labels", "region=eu, canary=true", "abc")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "abc", m.tenant)
+	assert.Equal(t, "create-tenant-abc", m.versionName)
+	assert.Equal(t, []types.TenantLabel{{Key: "region", Value: "eu"}, {Key: "canary", Value: "true"}}, m.labels)
+	assert.Contains(t, stdout, "Version: create-tenant-abc (ID 12)")
+}
+
+func TestCreateTenantInvalidArguments(t *testing.T) {
+	code, _, stderr := run(&mockedCoordinator{}, "tenants", "create")
+	assert.Equal(t, ExitFailure, code)
+	assert.Contains(t, stderr, "usage: migrator tenants create")
+
+	code, _, stderr = run(&mockedCoordinator{}, "tenants", "delete", "abc")
+	assert.Equal(t, ExitFailure, code)
+	assert.Contains(t, stderr, "usage: migrator tenants create")
+
+	code, _, stderr = run(&mockedCoordinator{}, "tenants", "create", "-labels", "region", "abc")
+	assert.Equal(t, ExitFailure, code)
+	assert.Contains(t, stderr, `invalid labels: label "region" is not in key=value format`)
+}
+
+func TestVerify(t *testing.T) {
+	code, stdout, _ := run(&mockedCoordinator{}, "verify")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "Checksum drift: none\n", stdout)
+
+	code, stdout, _ = run(&mockedCoordinator{drift: true}, "verify")
+	assert.Equal(t, ExitDrift, code)
+	assert.Contains(t, stdout, "tenants/201901010000.sql (applied 456, source 123)")
+	assert.Contains(t, stdout, "+++ tenants/201901010000.sql\tsource")
+
+	code, stdout, _ = run(&mockedCoordinator{drift: true}, "verify", "-json")
+	assert.Equal(t, ExitDrift, code)
+	var mismatches []types.ChecksumMismatch
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &mismatches))
+	assert.Len(t, mismatches, 1)
+}
+
+func TestPlan(t *testing.T) {
+	// scripts are applied by every version and are not pending
+	m := &mockedCoordinator{}
+	code, stdout, _ := run(m, "plan", "-selector", "region=eu")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "region=eu", m.selector)
+	assert.Contains(t, stdout, "config/views.sql (SingleScript, checksum abc)")
+
+	code, stdout, _ = run(&mockedCoordinator{pending: true}, "plan")
+	assert.Equal(t, ExitPending, code)
+	assert.Equal(t, "Single schemas:\n  config:\n    config/views.sql (SingleScript, checksum abc)\nTenants:\n  abc:\n    tenants/202001010000.sql (TenantMigration, checksum def)\nPending migrations: 1\nPlan hash: 0a1b2c\n", stdout)
+
+	code, stdout, _ = run(&mockedCoordinator{pending: true}, "plan", "-json")
+	assert.Equal(t, ExitPending, code)
+	var plan types.Plan
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &plan))
+	assert.Equal(t, "abc", plan.Tenants[0].Schema)
+}
+
+func TestStatus(t *testing.T) {
+	code, stdout, _ := run(&mockedCoordinator{}, "status")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "Pending migrations: 0\nChecksum drift: none\n", stdout)
+
+	code, _, _ = run(&mockedCoordinator{pending: true}, "status")
+	assert.Equal(t, ExitPending, code)
+
+	// drift takes precedence over pending migrations
+	code, stdout, _ = run(&mockedCoordinator{pending: true, drift: true}, "status", "-json")
+	assert.Equal(t, ExitDrift, code)
+	var output status
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &output))
+	assert.Equal(t, int32(1), output.Pending)
+	assert.Len(t, output.ChecksumMismatches, 1)
+
+	code, _, stderr := run(&mockedCoordinator{fail: errors.New("trouble maker")}, "status")
+	assert.Equal(t, ExitFailure, code)
+	assert.Equal(t, "Error: trouble maker\n", stderr)
+}
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
+	"time"
 
 	"gopkg.in/go-playground/validator.v9"
 	"gopkg.in/yaml.v3"
@@ -11,15 +14,17 @@ import (
 
 // Config represents Migrator's yaml configuration file
 type Config struct {
-	BaseLocation      string   `yaml:"baseLocation" validate:"required"`
-	Driver            string   `yaml:"driver" validate:"required"`
-	DataSource        string   `yaml:"dataSource" validate:"required"`
+	BaseLocation      string   `yaml:"baseLocation" validate:"required_without=Targets"`
+	Driver            string   `yaml:"driver" validate:"required_without=Targets"`
+	DataSource        string   `yaml:"dataSource" validate:"required_without=Targets"`
 	TenantSelect      string   `yaml:"tenantSelect,omitempty"`
 	TenantInsert      string   `yaml:"tenantInsert,omitempty"`
+	TenantDelete      string   `yaml:"tenantDelete,omitempty"`
+	TenantRename      string   `yaml:"tenantRename,omitempty"`
 	TenantSelectSQL   string   `yaml:"tenantSelectSQL,omitempty"` // Deprecated: use TenantSelect instead
 	TenantInsertSQL   string   `yaml:"tenantInsertSQL,omitempty"` // Deprecated: use TenantInsert instead
 	SchemaPlaceHolder string   `yaml:"schemaPlaceHolder,omitempty"`
-	SingleMigrations  []string `yaml:"singleMigrations" validate:"min=1"`
+	SingleMigrations  []string `yaml:"singleMigrations" validate:"required_without=Targets,omitempty,min=1"`
 	TenantMigrations  []string `yaml:"tenantMigrations,omitempty"`
 	SingleScripts     []string `yaml:"singleScripts,omitempty"`
 	TenantScripts     []string `yaml:"tenantScripts,omitempty"`
@@ -29,6 +34,206 @@ type Config struct {
 	WebHookHeaders    []string `yaml:"webHookHeaders,omitempty"`
 	WebHookTemplate   string   `yaml:"webHookTemplate,omitempty"`
 	LogLevel          string   `yaml:"logLevel,omitempty" validate:"logLevel"`
+	LockTimeout       string   `yaml:"lockTimeout,omitempty" validate:"duration"`
+	// LockLeaseTTL is how long MongoDB lock lease is valid, the lease is extended while the lock is held
+	// and expires only when the migrator instance holding it crashed
+	LockLeaseTTL string `yaml:"lockLeaseTTL,omitempty" validate:"duration"`
+	// PerTenantTransactions commits every tenant in a separate transaction, a failed tenant does not roll back other tenants
+	PerTenantTransactions bool `yaml:"perTenantTransactions,omitempty"`
+	// TenantConcurrency is the number of tenants migrated in parallel, values greater than 1 imply per-tenant transactions
+	TenantConcurrency int `yaml:"tenantConcurrency,omitempty" validate:"min=0"`
+	// OutOfOrder defines what happens when a pending migration sorts before already applied migrations: allow (default), warn, or reject
+	OutOfOrder string `yaml:"outOfOrder,omitempty" validate:"outOfOrder"`
+	// MigrationTimeout limits how long a single migration can run, can be overridden with "-- migrator: timeout=5m" directive
+	// on PostgreSQL it is also set as statement_timeout
+	MigrationTimeout string `yaml:"migrationTimeout,omitempty" validate:"duration"`
+	// DBLockTimeout limits how long a migration waits for a DB lock held by other sessions (lock_timeout on PostgreSQL)
+	DBLockTimeout string `yaml:"dbLockTimeout,omitempty" validate:"duration"`
+	// OnChangeScripts lists script directories (from singleScripts or tenantScripts) which scripts are applied only when their checksum changed
+	OnChangeScripts []string `yaml:"onChangeScripts,omitempty"`
+	// SchemaSnapshots captures objects of single schemas and one representative tenant after every createVersion
+	SchemaSnapshots bool `yaml:"schemaSnapshots,omitempty"`
+	// MaxOpenConns is the maximum number of open connections in the shared connection pool, 0 means unlimited
+	MaxOpenConns int `yaml:"maxOpenConns,omitempty" validate:"min=0"`
+	// MaxIdleConns is the maximum number of idle connections kept in the shared connection pool, 0 means database/sql default (2)
+	MaxIdleConns int `yaml:"maxIdleConns,omitempty" validate:"min=0"`
+	// ConnMaxLifetime is the maximum amount of time a connection may be reused, 0 means connections are reused forever
+	ConnMaxLifetime string `yaml:"connMaxLifetime,omitempty" validate:"duration"`
+	// ConnectRetries is the number of times migrator retries connecting to DB at startup
+	ConnectRetries int `yaml:"connectRetries,omitempty" validate:"min=0"`
+	// ConnectRetryBackoff is the delay before the first connect retry, the delay doubles with every retry
+	ConnectRetryBackoff string `yaml:"connectRetryBackoff,omitempty" validate:"duration"`
+	// Templates renders migrations with text/template, disabled by default so that literal "{{" in existing migrations is not parsed
+	Templates bool `yaml:"templates,omitempty"`
+	// Variables are available in migrations rendered by text/template as {{.Vars.name}}
+	Variables map[string]string `yaml:"variables,omitempty"`
+	// Targets are additional named databases managed by migrator, top-level settings are available as the default target
+	Targets map[string]*Target `yaml:"targets,omitempty" validate:"omitempty,dive,keys,required,ne=default,endkeys,required"`
+}
+
+// Target represents a named database managed by migrator
+// migration and script directories which are not set are inherited from the top-level configuration,
+// all other top-level settings (timeouts, webhooks, connection pool, etc.) apply to all targets
+type Target struct {
+	BaseLocation      string   `yaml:"baseLocation" validate:"required"`
+	Driver            string   `yaml:"driver" validate:"required"`
+	DataSource        string   `yaml:"dataSource" validate:"required"`
+	TenantSelect      string   `yaml:"tenantSelect,omitempty"`
+	TenantInsert      string   `yaml:"tenantInsert,omitempty"`
+	TenantDelete      string   `yaml:"tenantDelete,omitempty"`
+	TenantRename      string   `yaml:"tenantRename,omitempty"`
+	SchemaPlaceHolder string   `yaml:"schemaPlaceHolder,omitempty"`
+	SingleMigrations  []string `yaml:"singleMigrations,omitempty"`
+	TenantMigrations  []string `yaml:"tenantMigrations,omitempty"`
+	SingleScripts     []string `yaml:"singleScripts,omitempty"`
+	TenantScripts     []string `yaml:"tenantScripts,omitempty"`
+}
+
+// DefaultTarget is the name of the target defined by top-level driver, dataSource and baseLocation
+const DefaultTarget = "default"
+
+// HasDefaultTarget returns false only when configuration defines named targets and no top-level driver
+func (c *Config) HasDefaultTarget() bool {
+	return c.Driver != "" || len(c.Targets) == 0
+}
+
+// GetTargetNames returns sorted names of targets defined in targets section
+func (c *Config) GetTargetNames() []string {
+	names := make([]string, 0, len(c.Targets))
+	for name := range c.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetTarget returns configuration of a target, empty name and DefaultTarget return the top-level configuration
+func (c *Config) GetTarget(name string) (*Config, error) {
+	if name == "" || name == DefaultTarget {
+		if !c.HasDefaultTarget() {
+			return nil, fmt.Errorf("default target is not configured")
+		}
+		return c, nil
+	}
+	target, ok := c.Targets[name]
+	if !ok {
+		return nil, fmt.Errorf("target %v is not configured", name)
+	}
+
+	targetConfig := *c
+	targetConfig.Targets = nil
+	targetConfig.BaseLocation = target.BaseLocation
+	targetConfig.Driver = target.Driver
+	targetConfig.DataSource = target.DataSource
+	// tenant statements are driver-specific and are never inherited
+	targetConfig.TenantSelect = target.TenantSelect
+	targetConfig.TenantInsert = target.TenantInsert
+	targetConfig.TenantDelete = target.TenantDelete
+	targetConfig.TenantRename = target.TenantRename
+	targetConfig.TenantSelectSQL = ""
+	targetConfig.TenantInsertSQL = ""
+	targetConfig.SchemaPlaceHolder = target.SchemaPlaceHolder
+	if target.SingleMigrations != nil {
+		targetConfig.SingleMigrations = target.SingleMigrations
+	}
+	if target.TenantMigrations != nil {
+		targetConfig.TenantMigrations = target.TenantMigrations
+	}
+	if target.SingleScripts != nil {
+		targetConfig.SingleScripts = target.SingleScripts
+	}
+	if target.TenantScripts != nil {
+		targetConfig.TenantScripts = target.TenantScripts
+	}
+	return &targetConfig, nil
+}
+
+// out-of-order policies, see Config.OutOfOrder
+const (
+	OutOfOrderAllow  = "allow"
+	OutOfOrderWarn   = "warn"
+	OutOfOrderReject = "reject"
+)
+
+// DefaultLockTimeout is used when lockTimeout is not set in the configuration file
+const DefaultLockTimeout = time.Minute
+
+// GetLockTimeout returns how long migrator waits for a lock held by another migrator instance
+func (c *Config) GetLockTimeout() time.Duration {
+	if c.LockTimeout == "" {
+		return DefaultLockTimeout
+	}
+	// lockTimeout is validated when config is loaded
+	timeout, _ := time.ParseDuration(c.LockTimeout)
+	return timeout
+}
+
+// DefaultLockLeaseTTL is used when lockLeaseTTL is not set in the configuration file
+const DefaultLockLeaseTTL = 15 * time.Minute
+
+// GetLockLeaseTTL returns how long MongoDB lock lease is valid without being extended
+func (c *Config) GetLockLeaseTTL() time.Duration {
+	// lockLeaseTTL is validated when config is loaded
+	ttl, _ := time.ParseDuration(c.LockLeaseTTL)
+	if ttl <= 0 {
+		return DefaultLockLeaseTTL
+	}
+	return ttl
+}
+
+// GetMigrationTimeout returns how long a single migration can run, 0 means no timeout
+func (c *Config) GetMigrationTimeout() time.Duration {
+	// migrationTimeout is validated when config is loaded
+	timeout, _ := time.ParseDuration(c.MigrationTimeout)
+	return timeout
+}
+
+// GetDBLockTimeout returns how long a migration waits for a DB lock, 0 means DB default
+func (c *Config) GetDBLockTimeout() time.Duration {
+	// dbLockTimeout is validated when config is loaded
+	timeout, _ := time.ParseDuration(c.DBLockTimeout)
+	return timeout
+}
+
+// GetConnMaxLifetime returns the maximum amount of time a connection may be reused, 0 means no limit
+func (c *Config) GetConnMaxLifetime() time.Duration {
+	// connMaxLifetime is validated when config is loaded
+	lifetime, _ := time.ParseDuration(c.ConnMaxLifetime)
+	return lifetime
+}
+
+// DefaultConnectRetryBackoff is used when connectRetryBackoff is not set in the configuration file
+const DefaultConnectRetryBackoff = time.Second
+
+// GetConnectRetryBackoff returns the delay before the first connect retry
+func (c *Config) GetConnectRetryBackoff() time.Duration {
+	if c.ConnectRetryBackoff == "" {
+		return DefaultConnectRetryBackoff
+	}
+	// connectRetryBackoff is validated when config is loaded
+	backoff, _ := time.ParseDuration(c.ConnectRetryBackoff)
+	return backoff
+}
+
+// GetTenantConcurrency returns the number of tenants migrated in parallel, by default tenants are migrated sequentially
+func (c *Config) GetTenantConcurrency() int {
+	if c.TenantConcurrency < 1 {
+		return 1
+	}
+	return c.TenantConcurrency
+}
+
+// IsPerTenantTransactions returns true if every tenant should be committed in a separate transaction
+func (c *Config) IsPerTenantTransactions() bool {
+	return c.PerTenantTransactions || c.GetTenantConcurrency() > 1
+}
+
+// GetOutOfOrder returns out-of-order policy, by default out-of-order migrations are allowed
+func (c *Config) GetOutOfOrder() string {
+	if c.OutOfOrder == "" {
+		return OutOfOrderAllow
+	}
+	return c.OutOfOrder
 }
 
 // GetTenantSelect returns tenant select query/statement with backward compatibility
@@ -95,9 +300,7 @@ func FromBytes(contents []byte) (*Config, error) {
 		return nil, err
 	}
 
-	validate := validator.New()
-	validate.RegisterValidation("logLevel", validateLogLevel)
-	if err := validate.Struct(config); err != nil {
+	if err := config.Validate(); err != nil {
 		return nil, err
 	}
 
@@ -106,7 +309,26 @@ func FromBytes(contents []byte) (*Config, error) {
 	return &config, nil
 }
 
-func substituteEnvVariables(config *Config) {
+// Validate checks required options and formats of option values, it is used for configs which are built in code
+func (c *Config) Validate() error {
+	validate := validator.New()
+	validate.RegisterValidation("logLevel", validateLogLevel)
+	validate.RegisterValidation("duration", validateDuration)
+	validate.RegisterValidation("outOfOrder", validateOutOfOrder)
+	if err := validate.Struct(c); err != nil {
+		return err
+	}
+	// every target must be a complete configuration once top-level settings are inherited
+	for _, name := range c.GetTargetNames() {
+		targetConfig, _ := c.GetTarget(name)
+		if err := validate.Struct(targetConfig); err != nil {
+			return fmt.Errorf("invalid target %v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func substituteEnvVariables(config interface{}) {
 	val := reflect.ValueOf(config).Elem()
 	for i := 0; i < val.NumField(); i++ {
 		valueField := val.Field(i)
@@ -123,6 +345,17 @@ func substituteEnvVariables(config *Config) {
 					ss[i] = substituteEnvVariable(ss[i])
 				}
 				valueField.Set(reflect.ValueOf(ss))
+			case reflect.Map:
+				switch m := valueField.Interface().(type) {
+				case map[string]string:
+					for k, v := range m {
+						m[k] = substituteEnvVariable(v)
+					}
+				case map[string]*Target:
+					for _, target := range m {
+						substituteEnvVariables(target)
+					}
+				}
 			}
 		}
 	}
@@ -142,3 +375,17 @@ func validateLogLevel(fl validator.FieldLevel) bool {
 	value := fl.Field().String()
 	return value == "" || value == "DEBUG" || value == "INFO" || value == "ERROR" || value == "PANIC"
 }
+
+func validateDuration(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	if value == "" {
+		return true
+	}
+	_, err := time.ParseDuration(value)
+	return err == nil
+}
+
+func validateOutOfOrder(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	return value == "" || value == OutOfOrderAllow || value == OutOfOrderWarn || value == OutOfOrderReject
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/go-playground/validator.v9"
@@ -120,3 +121,294 @@ logLevel: ABC`
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), `Error:Field validation for 'LogLevel' failed on the 'logLevel' tag`)
 }
+
+func TestCustomValidatorLockTimeoutError(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+lockTimeout: 10 minutes`
+
+	_, err := FromBytes([]byte(config))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `Error:Field validation for 'LockTimeout' failed on the 'duration' tag`)
+}
+
+func TestGetLockTimeout(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+lockTimeout: 90s`
+
+	c, err := FromBytes([]byte(config))
+	assert.Nil(t, err)
+	assert.Equal(t, 90*time.Second, c.GetLockTimeout())
+
+	c.LockTimeout = ""
+	assert.Equal(t, DefaultLockTimeout, c.GetLockTimeout())
+}
+
+func TestGetLockLeaseTTL(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: mongodb
+dataSource: mongodb://localhost:27017
+singleMigrations:
+    - ref
+lockLeaseTTL: 2m`
+
+	c, err := FromBytes([]byte(config))
+	assert.Nil(t, err)
+	assert.Equal(t, 2*time.Minute, c.GetLockLeaseTTL())
+
+	c.LockLeaseTTL = ""
+	assert.Equal(t, DefaultLockLeaseTTL, c.GetLockLeaseTTL())
+}
+
+func TestGetMigrationAndDBLockTimeouts(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+migrationTimeout: 10m
+dbLockTimeout: 5s`
+
+	c, err := FromBytes([]byte(config))
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Minute, c.GetMigrationTimeout())
+	assert.Equal(t, 5*time.Second, c.GetDBLockTimeout())
+
+	c.MigrationTimeout = ""
+	c.DBLockTimeout = ""
+	assert.Equal(t, time.Duration(0), c.GetMigrationTimeout())
+	assert.Equal(t, time.Duration(0), c.GetDBLockTimeout())
+}
+
+func TestConnectionPoolSettings(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+maxOpenConns: 10
+maxIdleConns: 5
+connMaxLifetime: 30m
+connectRetries: 3
+connectRetryBackoff: 2s`
+
+	c, err := FromBytes([]byte(config))
+	assert.Nil(t, err)
+	assert.Equal(t, 10, c.MaxOpenConns)
+	assert.Equal(t, 5, c.MaxIdleConns)
+	assert.Equal(t, 30*time.Minute, c.GetConnMaxLifetime())
+	assert.Equal(t, 3, c.ConnectRetries)
+	assert.Equal(t, 2*time.Second, c.GetConnectRetryBackoff())
+
+	c.ConnMaxLifetime = ""
+	c.ConnectRetryBackoff = ""
+	assert.Equal(t, time.Duration(0), c.GetConnMaxLifetime())
+	assert.Equal(t, DefaultConnectRetryBackoff, c.GetConnectRetryBackoff())
+}
+
+func TestConnectionPoolSettingsInvalid(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+connMaxLifetime: forever`
+
+	_, err := FromBytes([]byte(config))
+	assert.NotNil(t, err)
+}
+
+func TestGetTenantConcurrency(t *testing.T) {
+	c := &Config{}
+	assert.Equal(t, 1, c.GetTenantConcurrency())
+	assert.False(t, c.IsPerTenantTransactions())
+
+	c.PerTenantTransactions = true
+	assert.True(t, c.IsPerTenantTransactions())
+
+	c.PerTenantTransactions = false
+	c.TenantConcurrency = 8
+	assert.Equal(t, 8, c.GetTenantConcurrency())
+	assert.True(t, c.IsPerTenantTransactions())
+}
+
+func TestCustomValidatorOutOfOrderError(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+outOfOrder: ignore`
+
+	_, err := FromBytes([]byte(config))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `Error:Field validation for 'OutOfOrder' failed on the 'outOfOrder' tag`)
+}
+
+func TestGetOutOfOrder(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+outOfOrder: reject`
+
+	c, err := FromBytes([]byte(config))
+	assert.Nil(t, err)
+	assert.Equal(t, OutOfOrderReject, c.GetOutOfOrder())
+
+	c.OutOfOrder = ""
+	assert.Equal(t, OutOfOrderAllow, c.GetOutOfOrder())
+}
+
+func TestVariablesWithEnv(t *testing.T) {
+	t.Setenv("MIGRATOR_TEST_TABLESPACE", "fast_ssd")
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+variables:
+    tablespace: ${MIGRATOR_TEST_TABLESPACE}
+    role: app_user`
+
+	c, err := FromBytes([]byte(config))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"tablespace": "fast_ssd", "role": "app_user"}, c.Variables)
+}
+
+func TestTargets(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+tenantSelect: select name from public.tenants
+singleMigrations:
+    - ref
+tenantMigrations:
+    - tenants
+lockTimeout: 30s
+targets:
+  documents:
+    baseLocation: /opt/app/mongodb
+    driver: mongodb
+    dataSource: mongodb://${MONGO_HOST}:27017
+    tenantSelect: customers.name
+    tenantMigrations:
+      - customers`
+
+	os.Setenv("MONGO_HOST", "mongo.local")
+	defer os.Unsetenv("MONGO_HOST")
+
+	c, err := FromBytes([]byte(config))
+	assert.Nil(t, err)
+	assert.True(t, c.HasDefaultTarget())
+	assert.Equal(t, []string{"documents"}, c.GetTargetNames())
+
+	defaultTarget, err := c.GetTarget("")
+	assert.Nil(t, err)
+	assert.Same(t, c, defaultTarget)
+	defaultTarget, err = c.GetTarget(DefaultTarget)
+	assert.Nil(t, err)
+	assert.Same(t, c, defaultTarget)
+
+	documents, err := c.GetTarget("documents")
+	assert.Nil(t, err)
+	assert.Equal(t, "mongodb", documents.Driver)
+	assert.Equal(t, "mongodb://mongo.local:27017", documents.DataSource)
+	assert.Equal(t, "/opt/app/mongodb", documents.BaseLocation)
+	assert.Equal(t, "customers.name", documents.GetTenantSelect())
+	// directories are inherited when not set
+	assert.Equal(t, []string{"ref"}, documents.SingleMigrations)
+	assert.Equal(t, []string{"customers"}, documents.TenantMigrations)
+	// other settings apply to all targets
+	assert.Equal(t, 30*time.Second, documents.GetLockTimeout())
+	assert.Nil(t, documents.Targets)
+	// top-level configuration is not modified
+	assert.Equal(t, "postgres", c.Driver)
+
+	_, err = c.GetTarget("xyz")
+	assert.Equal(t, "target xyz is not configured", err.Error())
+}
+
+func TestTargetsWithoutDefaultTarget(t *testing.T) {
+	config := `targets:
+  orders:
+    baseLocation: /opt/app/orders
+    driver: postgres
+    dataSource: user=p dbname=orders host=localhost
+    singleMigrations:
+      - ref`
+
+	c, err := FromBytes([]byte(config))
+	assert.Nil(t, err)
+	assert.False(t, c.HasDefaultTarget())
+
+	_, err = c.GetTarget("")
+	assert.Equal(t, "default target is not configured", err.Error())
+
+	orders, err := c.GetTarget("orders")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ref"}, orders.SingleMigrations)
+}
+
+func TestTargetsInvalid(t *testing.T) {
+	// target without singleMigrations and nothing to inherit
+	config := `targets:
+  orders:
+    baseLocation: /opt/app/orders
+    driver: postgres
+    dataSource: user=p dbname=orders host=localhost`
+
+	_, err := FromBytes([]byte(config))
+	assert.Contains(t, err.Error(), "invalid target orders")
+
+	// target without driver
+	config = `targets:
+  orders:
+    baseLocation: /opt/app/orders
+    dataSource: user=p dbname=orders host=localhost
+    singleMigrations:
+      - ref`
+
+	_, err = FromBytes([]byte(config))
+	assert.NotNil(t, err)
+
+	// default is reserved for the top-level target
+	config = `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+targets:
+  default:
+    baseLocation: /opt/app/orders
+    driver: postgres
+    dataSource: user=p dbname=orders host=localhost`
+
+	_, err = FromBytes([]byte(config))
+	assert.NotNil(t, err)
+
+	// neither top-level nor named targets
+	config = `port: 8080`
+
+	_, err = FromBytes([]byte(config))
+	assert.NotNil(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	config := &Config{BaseLocation: "migrations", Driver: "sqlite", DataSource: "migrator.db", SingleMigrations: []string{"ref"}}
+	assert.Nil(t, config.Validate())
+
+	config.LockTimeout = "5 minutes"
+	assert.NotNil(t, config.Validate())
+
+	config = &Config{BaseLocation: "migrations", Driver: "sqlite"}
+	assert.NotNil(t, config.Validate())
+}
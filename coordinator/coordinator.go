@@ -2,8 +2,17 @@ package coordinator
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/pmezard/go-difflib/difflib"
 
 	"github.com/lukaszbudnik/migrator/common"
 	"github.com/lukaszbudnik/migrator/config"
@@ -24,58 +33,125 @@ type SourceMigrationFilters struct {
 
 // Coordinator interface abstracts all operations performed by migrator
 type Coordinator interface {
-	GetTenants() []types.Tenant
-	GetVersions() []types.Version
-	GetVersionsByFile(string) []types.Version
+	GetTenants(string) ([]types.Tenant, error)
+	SetTenantLabels(string, []types.TenantLabel) (*types.Tenant, error)
+	GetVersions() ([]types.Version, error)
+	GetVersionsByFile(string) ([]types.Version, error)
 	GetVersionByID(int32) (*types.Version, error)
 	GetDBMigrationByID(int32) (*types.DBMigration, error)
-	GetSourceMigrations(*SourceMigrationFilters) []types.Migration
+	GetSourceMigrations(*SourceMigrationFilters) ([]types.Migration, error)
 	GetSourceMigrationByFile(string) (*types.Migration, error)
-	VerifySourceMigrationsCheckSums() (bool, []types.Migration)
-	CreateVersion(string, types.Action, bool) *types.CreateResults
-	CreateTenant(string, types.Action, bool, string) *types.CreateResults
+	VerifySourceMigrationsCheckSums() (bool, []types.Migration, error)
+	VerifyChecksums() ([]types.ChecksumMismatch, error)
+	SchemaDrift() ([]types.SchemaDrift, error)
+	VersionSchemaDiff(int32, int32) ([]types.SchemaSnapshotDiff, error)
+	Plan(string) (*types.Plan, error)
+	CreateVersion(string, types.Action, bool, string, string) (*types.CreateResults, error)
+	CreateTenant(string, types.Action, bool, string, []types.TenantLabel) (*types.CreateResults, error)
+	CreateVersionJob(string, types.Action, bool, string, string) (*types.Job, error)
+	CreateTenantJob(string, types.Action, bool, string, []types.TenantLabel) (*types.Job, error)
+	GetJobByID(int32) (*types.Job, error)
+	Baseline(string, []string, bool) (*types.CreateResults, error)
+	RollbackVersion(int32, bool) (*types.CreateResults, error)
+	ArchiveTenant(string) (*types.CreateResults, error)
+	DropTenant(string, bool) (*types.CreateResults, error)
+	RenameTenant(string, string) (*types.CreateResults, error)
+	RepairChecksums([]string, string) ([]types.ChecksumRepair, error)
 	HealthCheck() types.HealthResponse
 	Dispose()
 }
 
 // coordinator struct is a struct for coordinator implementation
 type coordinator struct {
-	ctx       context.Context
-	connector db.Connector
-	loader    loader.Loader
-	notifier  notifications.Notifier
-	config    *config.Config
-	metrics   metrics.Metrics
+	ctx          context.Context
+	connector    db.Connector
+	loader       loader.Loader
+	notifier     notifications.Notifier
+	config       *config.Config
+	metrics      metrics.Metrics
+	newConnector db.Factory
+	newLoader    loader.Factory
+	newNotifier  notifications.Factory
 }
 
+var (
+	// jobProgressInterval is how often progress of a running job is stored in DB
+	jobProgressInterval = time.Second
+	// jobHeartbeatInterval is how often owner of a running job stores its heartbeat in DB when progress did not change
+	jobHeartbeatInterval = 10 * time.Second
+	// jobStaleTimeout is how old the heartbeat of a running job can be before the job is considered abandoned
+	jobStaleTimeout = time.Minute
+	// jobOwner identifies the migrator instance which runs jobs
+	jobOwner = func() string {
+		hostname, _ := os.Hostname()
+		return fmt.Sprintf("%v:%v", hostname, os.Getpid())
+	}()
+)
+
 // Factory is a factory method for creating Coorginator instance
 type Factory func(ctx context.Context, config *config.Config, metrics metrics.Metrics) Coordinator
 
 // New creates instance of Coordinator
+// when config defines only named targets the returned Coordinator can be used only for health checks
 func New(ctx context.Context, config *config.Config, metrics metrics.Metrics, newConnector db.Factory, newLoader loader.Factory, newNotifier notifications.Factory) Coordinator {
-	connector := newConnector(ctx, config)
-	loader := newLoader(ctx, config)
-	notifier := newNotifier(ctx, config)
 	coordinator := &coordinator{
-		connector: connector,
-		loader:    loader,
-		notifier:  notifier,
-		config:    config,
-		ctx:       ctx,
-		metrics:   metrics,
+		notifier:     newNotifier(ctx, config),
+		config:       config,
+		ctx:          ctx,
+		metrics:      metrics,
+		newConnector: newConnector,
+		newLoader:    newLoader,
+		newNotifier:  newNotifier,
+	}
+	if config == nil || config.HasDefaultTarget() {
+		coordinator.connector = newConnector(ctx, config)
+		coordinator.loader = newLoader(ctx, config)
 	}
 	return coordinator
 }
 
-func (c *coordinator) GetTenants() []types.Tenant {
-	return c.connector.GetTenants()
+// GetTenants returns tenants together with their labels, when selector is not empty only matching tenants are returned
+func (c *coordinator) GetTenants(selector string) ([]types.Tenant, error) {
+	labelSelector, err := parseLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	return c.getTenants(labelSelector)
+}
+
+func (c *coordinator) getTenants(selector types.LabelSelector) ([]types.Tenant, error) {
+	tenants, err := c.connector.GetTenants()
+	if err != nil {
+		return nil, err
+	}
+	labels, err := c.connector.GetTenantLabels()
+	if err != nil {
+		return nil, err
+	}
+	return selector.SelectTenants(tenants, labels), nil
+}
+
+// SetTenantLabels replaces all labels of an existing tenant
+func (c *coordinator) SetTenantLabels(tenant string, labels []types.TenantLabel) (*types.Tenant, error) {
+	if err := types.ValidateTenantLabels(labels); err != nil {
+		return nil, &types.InvalidArgumentError{Argument: "labels", Err: err}
+	}
+	t, err := c.findTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.connector.SetTenantLabels(tenant, labels); err != nil {
+		return nil, err
+	}
+	t.Labels = labels
+	return t, nil
 }
 
-func (c *coordinator) GetVersions() []types.Version {
+func (c *coordinator) GetVersions() ([]types.Version, error) {
 	return c.connector.GetVersions()
 }
 
-func (c *coordinator) GetVersionsByFile(file string) []types.Version {
+func (c *coordinator) GetVersionsByFile(file string) ([]types.Version, error) {
 	return c.connector.GetVersionsByFile(file)
 }
 
@@ -83,20 +159,38 @@ func (c *coordinator) GetVersionByID(ID int32) (*types.Version, error) {
 	return c.connector.GetVersionByID(ID)
 }
 
-func (c *coordinator) GetSourceMigrations(filters *SourceMigrationFilters) []types.Migration {
-	allSourceMigrations := c.loader.GetSourceMigrations()
+// GetSourceMigrations returns source migrations matching filters, pending migrations which sort before applied migrations are marked as OutOfOrder
+func (c *coordinator) GetSourceMigrations(filters *SourceMigrationFilters) ([]types.Migration, error) {
+	allSourceMigrations, err := c.loader.GetSourceMigrations()
+	if err != nil {
+		return nil, err
+	}
+	appliedMigrations, err := c.GetAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	// key is Migration.File
+	outOfOrder := map[string]bool{}
+	for _, m := range c.outOfOrderMigrations(allSourceMigrations, appliedMigrations) {
+		outOfOrder[m.File] = true
+	}
+	for i := range allSourceMigrations {
+		allSourceMigrations[i].OutOfOrder = outOfOrder[allSourceMigrations[i].File]
+	}
 	filteredMigrations := c.filterMigrations(allSourceMigrations, filters)
-	return filteredMigrations
+	return filteredMigrations, nil
 }
 
 func (c *coordinator) GetSourceMigrationByFile(file string) (*types.Migration, error) {
-	allSourceMigrations := c.loader.GetSourceMigrations()
 	filters := SourceMigrationFilters{
 		File: &file,
 	}
-	filteredMigrations := c.filterMigrations(allSourceMigrations, &filters)
+	filteredMigrations, err := c.GetSourceMigrations(&filters)
+	if err != nil {
+		return nil, err
+	}
 	if len(filteredMigrations) == 0 {
-		return nil, fmt.Errorf("source migration not found: %v", file)
+		return nil, &types.NotFoundError{Resource: "source migration", ID: file}
 	}
 	return &filteredMigrations[0], nil
 }
@@ -105,7 +199,7 @@ func (c *coordinator) GetDBMigrationByID(ID int32) (*types.DBMigration, error) {
 	return c.connector.GetDBMigrationByID(ID)
 }
 
-func (c *coordinator) GetAppliedMigrations() []types.DBMigration {
+func (c *coordinator) GetAppliedMigrations() ([]types.DBMigration, error) {
 	return c.connector.GetAppliedMigrations()
 }
 
@@ -114,89 +208,839 @@ func (c *coordinator) GetAppliedMigrations() []types.DBMigration {
 // returns bool indicating if offending (i.e., modified) disk migrations were found
 // if bool is false the function returns a slice of offending migrations
 // if bool is true the slice of effending migrations is empty
-func (c *coordinator) VerifySourceMigrationsCheckSums() (bool, []types.Migration) {
-	sourceMigrations := c.GetSourceMigrations(nil)
-	appliedMigrations := c.GetAppliedMigrations()
-
-	flattenedAppliedMigration := c.flattenAppliedMigrations(appliedMigrations)
-
-	intersect := c.intersect(sourceMigrations, flattenedAppliedMigration)
+func (c *coordinator) VerifySourceMigrationsCheckSums() (bool, []types.Migration, error) {
+	sourceMigrations, err := c.loader.GetSourceMigrations()
+	if err != nil {
+		return false, nil, err
+	}
+	appliedMigrations, err := c.GetAppliedMigrations()
+	if err != nil {
+		return false, nil, err
+	}
 
 	var offendingMigrations []types.Migration
 	var result = true
-	for _, t := range intersect {
+	for _, t := range c.modifiedMigrations(sourceMigrations, appliedMigrations) {
+		offendingMigrations = append(offendingMigrations, t.source)
+		result = false
+	}
+	return result, offendingMigrations, nil
+}
+
+// VerifyChecksums returns modified source migrations together with their applied checksums,
+// versions in which they were applied, and unified diffs between applied and source contents
+func (c *coordinator) VerifyChecksums() ([]types.ChecksumMismatch, error) {
+	sourceMigrations, err := c.loader.GetSourceMigrations()
+	if err != nil {
+		return nil, err
+	}
+	appliedMigrations, err := c.GetAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches := []types.ChecksumMismatch{}
+	for _, t := range c.modifiedMigrations(sourceMigrations, appliedMigrations) {
+		versions, err := c.connector.GetVersionsByFile(t.source.File)
+		if err != nil {
+			return nil, err
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(t.applied.Contents),
+			B:        difflib.SplitLines(t.source.Contents),
+			FromFile: t.source.File,
+			FromDate: "applied",
+			ToFile:   t.source.File,
+			ToDate:   "source",
+			Context:  3,
+		})
+		if err != nil {
+			return nil, err
+		}
+		mismatches = append(mismatches, types.ChecksumMismatch{
+			File:            t.source.File,
+			SourceCheckSum:  t.source.CheckSum,
+			AppliedCheckSum: t.applied.CheckSum,
+			Versions:        versions,
+			Diff:            diff,
+		})
+	}
+	return mismatches, nil
+}
+
+// SchemaDrift groups active tenants by fingerprints of their schemas and returns objects which differ from the majority
+// groups are sorted by the number of tenants, the first group is the majority
+func (c *coordinator) SchemaDrift() ([]types.SchemaDrift, error) {
+	tenants, err := c.connector.GetTenants()
+	if err != nil {
+		return nil, err
+	}
+	schemas := []string{}
+	for _, t := range c.filterActiveTenants(tenants) {
+		schemas = append(schemas, t.Name)
+	}
+	fingerprints, err := c.connector.GetSchemaFingerprints(schemas)
+	if err != nil {
+		return nil, err
+	}
+	return c.computeSchemaDrift(fingerprints), nil
+}
+
+// computeSchemaDrift groups schemas by fingerprints, when groups have the same number of tenants the first one is the majority
+func (c *coordinator) computeSchemaDrift(fingerprints []types.SchemaFingerprint) []types.SchemaDrift {
+	groups := []types.SchemaDrift{}
+	objects := map[string][]types.SchemaObject{}
+	for _, f := range fingerprints {
+		i := 0
+		for i < len(groups) && groups[i].Fingerprint != f.Fingerprint {
+			i++
+		}
+		if i == len(groups) {
+			groups = append(groups, types.SchemaDrift{Fingerprint: f.Fingerprint, Tenants: []string{}, Objects: int32(len(f.Objects)), Differences: []types.SchemaObjectDiff{}})
+			objects[f.Fingerprint] = f.Objects
+		}
+		groups[i].Tenants = append(groups[i].Tenants, f.Schema)
+	}
+
+	if len(groups) == 0 {
+		return groups
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Tenants) > len(groups[j].Tenants)
+	})
+	groups[0].Majority = true
+	majority := objects[groups[0].Fingerprint]
+	for i := 1; i < len(groups); i++ {
+		groups[i].Differences = c.diffSchemaObjects(majority, objects[groups[i].Fingerprint])
+	}
+
+	return groups
+}
+
+// VersionSchemaDiff returns structural changes between schema snapshots captured by two versions
+// single schemas are compared by name, tenant snapshots are compared with each other even if different tenants were captured
+// only schemas which changed are returned
+func (c *coordinator) VersionSchemaDiff(from int32, to int32) ([]types.SchemaSnapshotDiff, error) {
+	fromSnapshots, err := c.getSchemaSnapshots(from)
+	if err != nil {
+		return nil, err
+	}
+	toSnapshots, err := c.getSchemaSnapshots(to)
+	if err != nil {
+		return nil, err
+	}
+
+	key := func(s types.SchemaSnapshot) string {
+		if s.MigrationType == types.MigrationTypeTenantMigration {
+			return ""
+		}
+		return s.Schema
+	}
+	fromByKey := map[string]types.SchemaSnapshot{}
+	for _, s := range fromSnapshots {
+		fromByKey[key(s)] = s
+	}
+	toByKey := map[string]types.SchemaSnapshot{}
+	for _, s := range toSnapshots {
+		toByKey[key(s)] = s
+	}
+
+	diffs := []types.SchemaSnapshotDiff{}
+	appendDiff := func(f *types.SchemaSnapshot, t *types.SchemaSnapshot) {
+		diff := types.SchemaSnapshotDiff{}
+		var fromObjects, toObjects []types.SchemaObject
+		if f != nil {
+			diff.MigrationType, diff.FromSchema, fromObjects = f.MigrationType, &f.Schema, f.Objects
+		}
+		if t != nil {
+			diff.MigrationType, diff.ToSchema, toObjects = t.MigrationType, &t.Schema, t.Objects
+		}
+		if f != nil && t != nil && f.Fingerprint == t.Fingerprint {
+			return
+		}
+		diff.Differences = c.diffSchemaObjects(fromObjects, toObjects)
+		diffs = append(diffs, diff)
+	}
+	for _, s := range fromSnapshots {
+		f := s
+		if t, ok := toByKey[key(s)]; ok {
+			appendDiff(&f, &t)
+		} else {
+			appendDiff(&f, nil)
+		}
+	}
+	for _, s := range toSnapshots {
+		t := s
+		if _, ok := fromByKey[key(s)]; !ok {
+			appendDiff(nil, &t)
+		}
+	}
+
+	return diffs, nil
+}
+
+// getSchemaSnapshots returns schema snapshots of a given version, versions without snapshots are reported as not found
+func (c *coordinator) getSchemaSnapshots(ID int32) ([]types.SchemaSnapshot, error) {
+	version, err := c.connector.GetVersionByID(ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(version.SchemaSnapshot) == 0 {
+		return nil, &types.NotFoundError{Resource: "schema snapshot", ID: fmt.Sprint(ID)}
+	}
+	return version.SchemaSnapshot, nil
+}
+
+// diffSchemaObjects returns objects which are missing, extra, or have different definitions in actual schema objects
+func (c *coordinator) diffSchemaObjects(expected []types.SchemaObject, actual []types.SchemaObject) []types.SchemaObjectDiff {
+	type key struct {
+		objectType string
+		name       string
+	}
+	// names of some objects may not be unique (for example system-named constraints), their definitions are joined
+	definitions := func(objects []types.SchemaObject) (map[key]string, []key) {
+		result := map[key]string{}
+		keys := []key{}
+		for _, o := range objects {
+			k := key{o.Type, o.Name}
+			if d, ok := result[k]; ok {
+				result[k] = d + ", " + o.Definition
+				continue
+			}
+			result[k] = o.Definition
+			keys = append(keys, k)
+		}
+		return result, keys
+	}
+
+	expectedDefinitions, expectedKeys := definitions(expected)
+	actualDefinitions, actualKeys := definitions(actual)
+
+	keys := append([]key{}, expectedKeys...)
+	for _, k := range actualKeys {
+		if _, ok := expectedDefinitions[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].objectType != keys[j].objectType {
+			return keys[i].objectType < keys[j].objectType
+		}
+		return keys[i].name < keys[j].name
+	})
+
+	diffs := []types.SchemaObjectDiff{}
+	for _, k := range keys {
+		e, expectedOK := expectedDefinitions[k]
+		a, actualOK := actualDefinitions[k]
+		if expectedOK && actualOK && e == a {
+			continue
+		}
+		diff := types.SchemaObjectDiff{Type: k.objectType, Name: k.name}
+		if expectedOK {
+			diff.Expected = &e
+		}
+		if actualOK {
+			diff.Actual = &a
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// modifiedMigrations returns source migrations which CheckSum differs from applied DB migrations, scripts are skipped
+func (c *coordinator) modifiedMigrations(sourceMigrations []types.Migration, appliedMigrations []types.DBMigration) []migrationPair {
+	flattenedAppliedMigration := c.flattenAppliedMigrations(appliedMigrations)
+
+	modified := []migrationPair{}
+	for _, t := range c.intersect(sourceMigrations, flattenedAppliedMigration) {
 		if t.source.MigrationType == types.MigrationTypeSingleScript || t.source.MigrationType == types.MigrationTypeTenantScript {
 			continue
 		}
 		if t.source.CheckSum != t.applied.CheckSum {
-			offendingMigrations = append(offendingMigrations, t.source)
-			result = false
+			modified = append(modified, t)
 		}
 	}
-	return result, offendingMigrations
+	return modified
+}
+
+// verifyCheckSums returns ChecksumMismatchError when applied migrations were modified
+func (c *coordinator) verifyCheckSums() error {
+	verified, offendingMigrations, err := c.VerifySourceMigrationsCheckSums()
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return &types.ChecksumMismatchError{Migrations: offendingMigrations}
+	}
+	return nil
 }
 
-func (c *coordinator) CreateVersion(versionName string, action types.Action, dryRun bool) *types.CreateResults {
-	sourceMigrations := c.GetSourceMigrations(nil)
-	appliedMigrations := c.GetAppliedMigrations()
+// CreateVersion applies pending source migrations, when selector is not empty tenant migrations are applied only to matching tenants
+// pending migrations are computed per schema so that a version rolled out to a subset of tenants can be later applied to the rest of them
+// when planHash is not empty the connector recomputes the plan under migrator lock and returns PlanChangedError if its hash differs
+func (c *coordinator) CreateVersion(versionName string, action types.Action, dryRun bool, selector string, planHash string) (*types.CreateResults, error) {
+	labelSelector, err := parseLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.verifyCheckSums(); err != nil {
+		return nil, err
+	}
 
-	migrationsToApply := c.computeMigrationsToApply(sourceMigrations, appliedMigrations)
+	sourceMigrations, err := c.loader.GetSourceMigrations()
+	if err != nil {
+		return nil, err
+	}
+	appliedMigrations, err := c.GetAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	tenants, err := c.getTenants(labelSelector)
+	if err != nil {
+		return nil, err
+	}
+	tenants = c.filterActiveTenants(tenants)
+
+	if err := c.checkOutOfOrder(sourceMigrations, appliedMigrations); err != nil {
+		return nil, err
+	}
+
+	migrationsToApply := c.computeMigrationsToApply(sourceMigrations, appliedMigrations, tenants)
 	common.LogInfo(c.ctx, "Found migrations to apply: %d", len(migrationsToApply))
 
-	summary, version := c.connector.CreateVersion(versionName, action, migrationsToApply, dryRun)
+	var planCheck *types.PlanCheck
+	if planHash != "" {
+		// the plan is recomputed by the connector under migrator lock
+		planCheck = &types.PlanCheck{Hash: planHash, SourceMigrations: sourceMigrations}
+	}
+
+	summary, version, err := c.connector.CreateVersion(versionName, action, migrationsToApply, labelSelector, dryRun, planCheck)
+	if err != nil {
+		return nil, err
+	}
 
 	c.recordVersionMetrics(summary)
 
 	c.sendNotification(summary)
 
-	return &types.CreateResults{Summary: summary, Version: version}
+	return &types.CreateResults{Summary: summary, Version: version}, nil
+}
+
+// Plan returns migrations which CreateVersion would apply to every schema, nothing is applied and no version is created
+// when selector is not empty tenant migrations are planned only for matching tenants
+func (c *coordinator) Plan(selector string) (*types.Plan, error) {
+	labelSelector, err := parseLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceMigrations, err := c.loader.GetSourceMigrations()
+	if err != nil {
+		return nil, err
+	}
+	appliedMigrations, err := c.GetAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	tenants, err := c.getTenants(labelSelector)
+	if err != nil {
+		return nil, err
+	}
+	tenants = c.filterActiveTenants(tenants)
+
+	if err := c.checkOutOfOrder(sourceMigrations, appliedMigrations); err != nil {
+		return nil, err
+	}
+
+	migrationsToApply := c.computeMigrationsToApply(sourceMigrations, appliedMigrations, tenants)
+	return c.plan(sourceMigrations, migrationsToApply, tenants)
 }
 
-func (c *coordinator) CreateTenant(versionName string, action types.Action, dryRun bool, tenant string) *types.CreateResults {
-	sourceMigrations := c.GetSourceMigrations(nil)
+// plan computes schemas to which migrations would be applied and returns them together with the plan hash
+func (c *coordinator) plan(sourceMigrations []types.Migration, migrationsToApply []types.Migration, tenants []types.Tenant) (*types.Plan, error) {
+	schemasToApply, err := c.connector.PlanMigrations(migrationsToApply, tenants)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewPlan(sourceMigrations, migrationsToApply, schemasToApply, tenants), nil
+}
+
+// CreateTenant creates new tenant, applies all tenant migrations to it and sets its labels
+func (c *coordinator) CreateTenant(versionName string, action types.Action, dryRun bool, tenant string, labels []types.TenantLabel) (*types.CreateResults, error) {
+	if err := types.ValidateTenantLabels(labels); err != nil {
+		return nil, &types.InvalidArgumentError{Argument: "labels", Err: err}
+	}
+
+	if err := c.verifyCheckSums(); err != nil {
+		return nil, err
+	}
+
+	sourceMigrations, err := c.loader.GetSourceMigrations()
+	if err != nil {
+		return nil, err
+	}
 
 	// filter only tenant schemas
 	migrationsToApply := c.filterTenantMigrations(sourceMigrations)
 	common.LogInfo(c.ctx, "Migrations to apply for new tenant: %d", len(migrationsToApply))
 
-	summary, version := c.connector.CreateTenant(tenant, versionName, action, migrationsToApply, dryRun)
+	summary, version, err := c.connector.CreateTenant(tenant, versionName, action, migrationsToApply, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun && len(labels) > 0 {
+		if err := c.connector.SetTenantLabels(tenant, labels); err != nil {
+			return nil, err
+		}
+	}
 
 	c.recordTenantMetrics(summary)
 
 	c.sendNotification(summary)
 
-	return &types.CreateResults{Summary: summary, Version: version}
+	return &types.CreateResults{Summary: summary, Version: version}, nil
+}
+
+// CreateVersionJob validates arguments, records a queued job and runs CreateVersion in the background
+func (c *coordinator) CreateVersionJob(versionName string, action types.Action, dryRun bool, selector string, planHash string) (*types.Job, error) {
+	if _, err := parseLabelSelector(selector); err != nil {
+		return nil, err
+	}
+	return c.startJob(types.JobOperationCreateVersion, versionName, func(coordinator Coordinator) (*types.CreateResults, error) {
+		return coordinator.CreateVersion(versionName, action, dryRun, selector, planHash)
+	})
+}
+
+// CreateTenantJob validates arguments, records a queued job and runs CreateTenant in the background
+func (c *coordinator) CreateTenantJob(versionName string, action types.Action, dryRun bool, tenant string, labels []types.TenantLabel) (*types.Job, error) {
+	if err := types.ValidateTenantLabels(labels); err != nil {
+		return nil, &types.InvalidArgumentError{Argument: "labels", Err: err}
+	}
+	return c.startJob(types.JobOperationCreateTenant, versionName, func(coordinator Coordinator) (*types.CreateResults, error) {
+		return coordinator.CreateTenant(versionName, action, dryRun, tenant, labels)
+	})
+}
+
+// GetJobByID returns a job, jobs are stored in DB so that they can be read by any migrator instance
+// a running job which heartbeat is older than jobStaleTimeout is marked as failed, its owner was most likely killed
+func (c *coordinator) GetJobByID(ID int32) (*types.Job, error) {
+	job, err := c.connector.GetJobByID(ID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != types.JobStatusRunning || job.Heartbeat == nil || time.Since(job.Heartbeat.Time) <= jobStaleTimeout {
+		return job, nil
+	}
+
+	var owner string
+	if job.Owner != nil {
+		owner = *job.Owner
+	}
+	message := fmt.Sprintf("job abandoned, owner %v stopped storing heartbeats, last heartbeat at %v", owner, job.Heartbeat.Time.Format(time.RFC3339))
+	common.LogError(c.ctx, "Job %v: %v", ID, message)
+	// owner could have stored a heartbeat in the meantime, such job is left running
+	if err := c.connector.FailStaleJob(ID, time.Now().UTC().Add(-jobStaleTimeout), message); err != nil {
+		return nil, err
+	}
+	return c.connector.GetJobByID(ID)
+}
+
+func (c *coordinator) startJob(operation string, name string, run func(Coordinator) (*types.CreateResults, error)) (*types.Job, error) {
+	job, err := c.connector.CreateJob(operation, name)
+	if err != nil {
+		return nil, err
+	}
+	common.LogInfo(c.ctx, "Job %v queued: %v %v", job.ID, operation, name)
+	background := *job
+	go c.runJob(&background, run)
+	return job, nil
+}
+
+// runJob runs a job with its own connector, loader, and notifier as the ones of the request are disposed when the request completes
+// progress is stored every jobProgressInterval by a separate goroutine so that migrations never wait for job updates
+// the same goroutine stores heartbeat at least every jobHeartbeatInterval so that pollers can tell a running job from an abandoned one
+func (c *coordinator) runJob(job *types.Job, run func(Coordinator) (*types.CreateResults, error)) {
+	ctx := context.WithoutCancel(c.ctx)
+	jobConnector := c.newConnector(ctx, c.config)
+	defer jobConnector.Dispose()
+
+	var (
+		mutex   sync.Mutex
+		changed bool
+	)
+	updateJob := func() {
+		job.Heartbeat = &graphql.Time{Time: time.Now().UTC()}
+		if err := jobConnector.UpdateJob(job); err != nil {
+			common.LogError(ctx, "Failed to update job %v: %v", job.ID, err)
+		}
+	}
+
+	job.Owner = &jobOwner
+	job.Status = types.JobStatusRunning
+	updateJob()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(jobProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				mutex.Lock()
+				if changed || time.Since(job.Heartbeat.Time) >= jobHeartbeatInterval {
+					updateJob()
+					changed = false
+				}
+				mutex.Unlock()
+			}
+		}
+	}()
+
+	progressCtx := db.WithProgress(ctx, func(applied, total int32) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		job.Applied = applied
+		job.Total = total
+		changed = true
+	})
+
+	results, err := c.runJobSafely(progressCtx, run)
+
+	close(done)
+	<-stopped
+
+	if err != nil {
+		common.LogError(ctx, "Job %v failed: %v", job.ID, err)
+		job.Status = types.JobStatusFailed
+		message := err.Error()
+		job.Error = &message
+	} else {
+		common.LogInfo(ctx, "Job %v succeeded", job.ID)
+		job.Status = types.JobStatusSucceeded
+		job.Summary = results.Summary
+	}
+	updateJob()
+}
+
+// runJobSafely creates a coordinator which reports progress to ctx and runs the job, panics are returned as errors so that the job does not stay running forever
+func (c *coordinator) runJobSafely(ctx context.Context, run func(Coordinator) (*types.CreateResults, error)) (results *types.CreateResults, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	coordinator := New(ctx, c.config, c.metrics, c.newConnector, c.newLoader, c.newNotifier)
+	defer coordinator.Dispose()
+	return run(coordinator)
+}
+
+// Baseline records source migrations up to and including upTo as applied without executing them (sync action)
+// newer source migrations stay pending, scripts are skipped as they are applied by every version anyway
+// when tenants is empty tenant migrations are recorded for all active tenants
+// baseline is refused when migrations which sort after upTo were already applied
+func (c *coordinator) Baseline(upTo string, tenants []string, dryRun bool) (*types.CreateResults, error) {
+	if err := c.verifyCheckSums(); err != nil {
+		return nil, err
+	}
+
+	sourceMigrations, err := c.loader.GetSourceMigrations()
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	baselineMigrations := []types.Migration{}
+	for _, m := range sourceMigrations {
+		if m.MigrationType == types.MigrationTypeSingleScript || m.MigrationType == types.MigrationTypeTenantScript {
+			continue
+		}
+		if m.Name == upTo {
+			found = true
+		}
+		if m.Name <= upTo {
+			baselineMigrations = append(baselineMigrations, m)
+		}
+	}
+	if !found {
+		return nil, &types.NotFoundError{Resource: "source migration", ID: upTo}
+	}
+
+	appliedMigrations, err := c.GetAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	after := []string{}
+	seen := map[string]bool{}
+	for _, m := range appliedMigrations {
+		if m.MigrationType == types.MigrationTypeSingleScript || m.MigrationType == types.MigrationTypeTenantScript {
+			continue
+		}
+		if m.Name > upTo && !seen[m.File] {
+			seen[m.File] = true
+			after = append(after, m.File)
+		}
+	}
+	if len(after) > 0 {
+		return nil, &types.InvalidArgumentError{Argument: "upTo", Err: fmt.Errorf("migrations which sort after %v were already applied: %v", upTo, strings.Join(after, ", "))}
+	}
+
+	baselineTenants, err := c.baselineTenants(tenants)
+	if err != nil {
+		return nil, err
+	}
+
+	migrationsToApply := c.computeMigrationsToApply(baselineMigrations, appliedMigrations, baselineTenants)
+	common.LogInfo(c.ctx, "Found migrations to baseline: %d", len(migrationsToApply))
+
+	summary, version, err := c.connector.Baseline(fmt.Sprintf("Baseline up to %v", upTo), migrationsToApply, baselineTenants, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	c.recordVersionMetrics(summary)
+
+	c.sendNotification(summary)
+
+	return &types.CreateResults{Summary: summary, Version: version}, nil
 }
 
+// baselineTenants returns active tenants when names is empty, otherwise tenants with given names which must exist and must not be archived
+func (c *coordinator) baselineTenants(names []string) ([]types.Tenant, error) {
+	tenants, err := c.connector.GetTenants()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return c.filterActiveTenants(tenants), nil
+	}
+	byName := map[string]types.Tenant{}
+	for _, t := range tenants {
+		byName[t.Name] = t
+	}
+	selected := []types.Tenant{}
+	for _, name := range names {
+		t, ok := byName[name]
+		if !ok {
+			return nil, &types.NotFoundError{Resource: "tenant", ID: name}
+		}
+		if t.Archived {
+			return nil, &types.InvalidArgumentError{Argument: "tenants", Err: fmt.Errorf("tenant %v is archived", name)}
+		}
+		selected = append(selected, t)
+	}
+	return selected, nil
+}
+
+// ArchiveTenant archives tenant, archived tenants are skipped by createVersion but their schemas and history are kept
+func (c *coordinator) ArchiveTenant(name string) (*types.CreateResults, error) {
+	tenant, err := c.findTenant(name)
+	if err != nil {
+		return nil, err
+	}
+	if tenant.Archived {
+		return nil, &types.InvalidArgumentError{Argument: "name", Err: fmt.Errorf("tenant already archived: %v", name)}
+	}
+
+	summary, version, err := c.connector.ArchiveTenant(name, fmt.Sprintf("Archive tenant %v", name))
+	if err != nil {
+		return nil, err
+	}
+
+	c.sendNotification(summary)
+
+	return &types.CreateResults{Summary: summary, Version: version}, nil
+}
+
+// DropTenant drops tenant schema and removes the tenant together with its DB migrations
+func (c *coordinator) DropTenant(name string, dryRun bool) (*types.CreateResults, error) {
+	if _, err := c.findTenant(name); err != nil {
+		return nil, err
+	}
+
+	summary, version, err := c.connector.DropTenant(name, fmt.Sprintf("Drop tenant %v", name), dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	c.sendNotification(summary)
+
+	return &types.CreateResults{Summary: summary, Version: version}, nil
+}
+
+// RenameTenant renames tenant schema and the tenant in all migrator tables
+func (c *coordinator) RenameTenant(from string, to string) (*types.CreateResults, error) {
+	if _, err := c.findTenant(from); err != nil {
+		return nil, err
+	}
+	if _, err := c.findTenant(to); err == nil {
+		return nil, &types.InvalidArgumentError{Argument: "to", Err: fmt.Errorf("tenant already exists: %v", to)}
+	}
+
+	summary, version, err := c.connector.RenameTenant(from, to, fmt.Sprintf("Rename tenant %v to %v", from, to))
+	if err != nil {
+		return nil, err
+	}
+
+	c.sendNotification(summary)
+
+	return &types.CreateResults{Summary: summary, Version: version}, nil
+}
+
+// findTenant returns tenant with a given name or NotFoundError
+func (c *coordinator) findTenant(name string) (*types.Tenant, error) {
+	tenants, err := c.connector.GetTenants()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tenants {
+		if t.Name == name {
+			return &t, nil
+		}
+	}
+	return nil, &types.NotFoundError{Resource: "tenant", ID: name}
+}
+
+// filterActiveTenants returns tenants which are not archived
+func (c *coordinator) filterActiveTenants(tenants []types.Tenant) []types.Tenant {
+	active := []types.Tenant{}
+	for _, t := range tenants {
+		if !t.Archived {
+			active = append(active, t)
+		}
+	}
+	return active
+}
+
+// RollbackVersion executes down migrations of all DB migrations recorded in a given version (in reverse order)
+// and removes the version from DB
+// scripts without down migrations are skipped, migrations without down migrations cause an error
+// only the latest version can be rolled back, this is checked by connector under migrator lock
+func (c *coordinator) RollbackVersion(ID int32, dryRun bool) (*types.CreateResults, error) {
+	version, err := c.connector.GetVersionByID(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceMigrations, err := c.loader.GetSourceMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	migrationsToRollback, err := c.computeMigrationsToRollback(version, sourceMigrations)
+	if err != nil {
+		return nil, err
+	}
+	common.LogInfo(c.ctx, "Found migrations to roll back: %d", len(migrationsToRollback))
+
+	summary, err := c.connector.RollbackVersion(version, migrationsToRollback, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	c.sendNotification(summary)
+
+	return &types.CreateResults{Summary: summary, Version: version}, nil
+}
+
+// RepairChecksums replaces contents and checksums of applied DB migrations with the ones of source migrations
+// files are source migration files to repair, if files is nil all modified migrations are repaired
+func (c *coordinator) RepairChecksums(files []string, reason string) ([]types.ChecksumRepair, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, &types.InvalidArgumentError{Argument: "reason", Err: errors.New("reason for checksum repair must not be empty")}
+	}
+
+	sourceMigrations, err := c.loader.GetSourceMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var migrationsToRepair []types.Migration
+	if files == nil {
+		appliedMigrations, err := c.GetAppliedMigrations()
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range c.modifiedMigrations(sourceMigrations, appliedMigrations) {
+			migrationsToRepair = append(migrationsToRepair, t.source)
+		}
+	} else {
+		// key is Migration.File
+		sources := map[string]types.Migration{}
+		for _, m := range sourceMigrations {
+			sources[m.File] = m
+		}
+		for _, file := range files {
+			m, ok := sources[file]
+			if !ok {
+				return nil, &types.NotFoundError{Resource: "source migration", ID: file}
+			}
+			migrationsToRepair = append(migrationsToRepair, m)
+		}
+	}
+	common.LogInfo(c.ctx, "Migrations to repair: %d", len(migrationsToRepair))
+
+	return c.connector.RepairChecksums(migrationsToRepair, reason)
+}
+
+// HealthCheck checks DB and loader of the default target and of every named target
+// checks of named targets are suffixed with target name, for example "DB orders"
 func (c *coordinator) HealthCheck() types.HealthResponse {
-	checks := []types.HealthChecks{}
-	response := types.HealthResponse{Status: types.HealthStatusUp}
+	response := types.HealthResponse{Status: types.HealthStatusUp, Checks: []types.HealthChecks{}}
+
+	if c.connector != nil {
+		c.healthCheckTarget(&response, "", c.connector, c.loader)
+	}
+
+	for _, name := range c.targetNames() {
+		// target names come from config thus target config is always found
+		targetConfig, _ := c.config.GetTarget(name)
+		connector := c.newConnector(c.ctx, targetConfig)
+		loader := c.newLoader(c.ctx, targetConfig)
+		c.healthCheckTarget(&response, " "+name, connector, loader)
+		connector.Dispose()
+	}
 
+	return response
+}
+
+func (c *coordinator) targetNames() []string {
+	if c.config == nil {
+		return nil
+	}
+	return c.config.GetTargetNames()
+}
+
+func (c *coordinator) healthCheckTarget(response *types.HealthResponse, suffix string, connector db.Connector, loader loader.Loader) {
 	// DB check
-	err := c.connector.HealthCheck()
+	err := connector.HealthCheck()
 	if err == nil {
-		checks = append(checks, types.HealthChecks{Name: "DB", Status: types.HealthStatusUp})
+		response.Checks = append(response.Checks, types.HealthChecks{Name: "DB" + suffix, Status: types.HealthStatusUp})
 	} else {
-		checks = append(checks, types.HealthChecks{Name: "DB", Status: types.HealthStatusDown, Data: &types.HealthData{Details: err.Error()}})
+		response.Checks = append(response.Checks, types.HealthChecks{Name: "DB" + suffix, Status: types.HealthStatusDown, Data: &types.HealthData{Details: err.Error()}})
 		response.Status = types.HealthStatusDown
 	}
 
 	// Loader check
-	err = c.loader.HealthCheck()
+	err = loader.HealthCheck()
 	if err == nil {
-		checks = append(checks, types.HealthChecks{Name: "Loader", Status: types.HealthStatusUp})
+		response.Checks = append(response.Checks, types.HealthChecks{Name: "Loader" + suffix, Status: types.HealthStatusUp})
 	} else {
-		checks = append(checks, types.HealthChecks{Name: "Loader", Status: types.HealthStatusDown, Data: &types.HealthData{Details: err.Error()}})
+		response.Checks = append(response.Checks, types.HealthChecks{Name: "Loader" + suffix, Status: types.HealthStatusDown, Data: &types.HealthData{Details: err.Error()}})
 		response.Status = types.HealthStatusDown
 	}
-
-	response.Checks = checks
-
-	return response
 }
 
 func (c *coordinator) Dispose() {
-	c.connector.Dispose()
+	if c.connector != nil {
+		c.connector.Dispose()
+	}
 }
 
 func (c *coordinator) flattenAppliedMigrations(appliedMigrations []types.DBMigration) []types.Migration {
@@ -211,61 +1055,143 @@ func (c *coordinator) flattenAppliedMigrations(appliedMigrations []types.DBMigra
 	return flattened
 }
 
-// intersect returns the elements from source and applied
-func (c *coordinator) intersect(sourceMigrations []types.Migration, flattenedAppliedMigrations []types.Migration) []struct {
+// migrationPair contains source migration and the corresponding applied migration
+type migrationPair struct {
 	source  types.Migration
 	applied types.Migration
-} {
+}
+
+// intersect returns the elements from source and applied
+func (c *coordinator) intersect(sourceMigrations []types.Migration, flattenedAppliedMigrations []types.Migration) []migrationPair {
 	// key is Migration.File
 	existsInDB := map[string]types.Migration{}
 	for _, m := range flattenedAppliedMigrations {
 		existsInDB[m.File] = m
 	}
-	intersect := []struct {
-		source  types.Migration
-		applied types.Migration
-	}{}
+	intersect := []migrationPair{}
 	for _, m := range sourceMigrations {
 		if db, ok := existsInDB[m.File]; ok {
-			intersect = append(intersect, struct {
-				source  types.Migration
-				applied types.Migration
-			}{m, db})
+			intersect = append(intersect, migrationPair{m, db})
 		}
 	}
 	return intersect
 }
 
-// difference returns the elements on disk which are not yet in DB
-// the exceptions are MigrationTypeSingleScript and MigrationTypeTenantScript which are always run
-func (c *coordinator) difference(sourceMigrations []types.Migration, flattenedAppliedMigrations []types.Migration) []types.Migration {
-	// key is Migration.File
-	existsInDB := map[string]bool{}
-	for _, m := range flattenedAppliedMigrations {
+// difference returns the elements on disk which are not yet applied to all schemas in DB
+// single schema migrations are applied to one schema, tenant migrations are applied to every tenant
+// tenant migration which failed for some tenants (for example when tenants are committed in separate transactions) is returned again
+func (c *coordinator) difference(sourceMigrations []types.Migration, appliedMigrations []types.DBMigration, tenants []types.Tenant) []types.Migration {
+	// key is Migration.File, value is a set of schemas
+	existsInDB := map[string]map[string]bool{}
+	for _, m := range appliedMigrations {
 		if m.MigrationType != types.MigrationTypeSingleScript && m.MigrationType != types.MigrationTypeTenantScript {
-			existsInDB[m.File] = true
+			if _, ok := existsInDB[m.File]; !ok {
+				existsInDB[m.File] = map[string]bool{}
+			}
+			existsInDB[m.File][m.Schema] = true
 		}
 	}
 	diff := []types.Migration{}
 	for _, m := range sourceMigrations {
-		if _, ok := existsInDB[m.File]; !ok {
+		schemas, ok := existsInDB[m.File]
+		if !ok {
 			diff = append(diff, m)
+			continue
+		}
+		if m.MigrationType == types.MigrationTypeTenantMigration {
+			for _, t := range tenants {
+				if !schemas[t.Name] {
+					diff = append(diff, m)
+					break
+				}
+			}
 		}
 	}
 	return diff
 }
 
-// computeMigrationsToApply computes which source migrations should be applied to DB based on migrations already present in DB
-func (c *coordinator) computeMigrationsToApply(sourceMigrations []types.Migration, appliedMigrations []types.DBMigration) []types.Migration {
-	flattenedAppliedMigrations := c.flattenAppliedMigrations(appliedMigrations)
+// outOfOrderMigrations returns source migrations which were not applied to any schema yet
+// and which sort before the most recent applied migration, scripts are skipped
+func (c *coordinator) outOfOrderMigrations(sourceMigrations []types.Migration, appliedMigrations []types.DBMigration) []types.Migration {
+	// key is Migration.File
+	existsInDB := map[string]bool{}
+	var lastApplied string
+	for _, m := range appliedMigrations {
+		if m.MigrationType == types.MigrationTypeSingleScript || m.MigrationType == types.MigrationTypeTenantScript {
+			continue
+		}
+		existsInDB[m.File] = true
+		if m.Name > lastApplied {
+			lastApplied = m.Name
+		}
+	}
+	outOfOrder := []types.Migration{}
+	for _, m := range sourceMigrations {
+		if m.MigrationType == types.MigrationTypeSingleScript || m.MigrationType == types.MigrationTypeTenantScript {
+			continue
+		}
+		if !existsInDB[m.File] && m.Name < lastApplied {
+			outOfOrder = append(outOfOrder, m)
+		}
+	}
+	return outOfOrder
+}
+
+// checkOutOfOrder applies out-of-order policy, returns OutOfOrderError when policy is reject and out-of-order migrations were found
+func (c *coordinator) checkOutOfOrder(sourceMigrations []types.Migration, appliedMigrations []types.DBMigration) error {
+	policy := c.config.GetOutOfOrder()
+	if policy == config.OutOfOrderAllow {
+		return nil
+	}
+	outOfOrder := c.outOfOrderMigrations(sourceMigrations, appliedMigrations)
+	if len(outOfOrder) == 0 {
+		return nil
+	}
+	err := &types.OutOfOrderError{Migrations: outOfOrder}
+	if policy == config.OutOfOrderReject {
+		return err
+	}
+	common.LogWarn(c.ctx, "%v", err.Error())
+	return nil
+}
 
-	len := len(flattenedAppliedMigrations)
-	common.LogInfo(c.ctx, "Number of flattened DB migrations: %d", len)
+// computeMigrationsToApply computes which source migrations should be applied to DB based on migrations already present in DB
+func (c *coordinator) computeMigrationsToApply(sourceMigrations []types.Migration, appliedMigrations []types.DBMigration, tenants []types.Tenant) []types.Migration {
+	common.LogInfo(c.ctx, "Number of DB migrations: %d", len(appliedMigrations))
 
-	out := c.difference(sourceMigrations, flattenedAppliedMigrations)
+	out := c.difference(sourceMigrations, appliedMigrations, tenants)
 	return out
 }
 
+// computeMigrationsToRollback returns DB migrations of a given version in reverse order with down migrations taken from source migrations
+func (c *coordinator) computeMigrationsToRollback(version *types.Version, sourceMigrations []types.Migration) ([]types.DBMigration, error) {
+	// key is Migration.File
+	downs := map[string]string{}
+	for _, m := range sourceMigrations {
+		downs[m.File] = m.Down
+	}
+
+	dbMigrations := make([]types.DBMigration, len(version.DBMigrations))
+	copy(dbMigrations, version.DBMigrations)
+	sort.SliceStable(dbMigrations, func(i, j int) bool {
+		return dbMigrations[i].ID > dbMigrations[j].ID
+	})
+
+	migrationsToRollback := []types.DBMigration{}
+	for _, m := range dbMigrations {
+		down := downs[m.File]
+		if down == "" {
+			if m.MigrationType == types.MigrationTypeSingleScript || m.MigrationType == types.MigrationTypeTenantScript {
+				continue
+			}
+			return nil, fmt.Errorf("down migration not found for: %v", m.File)
+		}
+		m.Down = down
+		migrationsToRollback = append(migrationsToRollback, m)
+	}
+	return migrationsToRollback, nil
+}
+
 // filterTenantMigrations returns only migrations which are of type MigrationTypeTenantSchema
 func (c *coordinator) filterTenantMigrations(sourceMigrations []types.Migration) []types.Migration {
 	filteredTenantMigrations := []types.Migration{}
@@ -339,3 +1265,12 @@ func (c *coordinator) recordVersionMetrics(summary *types.Summary) {
 	// total is for all tenants in the system
 	c.metrics.AddGaugeValue("migrations_applied", []string{"tenant_migrations_total"}, float64(summary.TenantMigrationsTotal))
 }
+
+// parseLabelSelector parses label selector passed to migrator, empty selector selects all tenants
+func parseLabelSelector(selector string) (types.LabelSelector, error) {
+	labelSelector, err := types.ParseLabelSelector(selector)
+	if err != nil {
+		return nil, &types.InvalidArgumentError{Argument: "selector", Err: err}
+	}
+	return labelSelector, nil
+}
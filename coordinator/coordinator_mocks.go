@@ -3,6 +3,8 @@ package coordinator
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/graph-gophers/graphql-go"
@@ -18,7 +20,7 @@ import (
 type mockedDiskLoader struct {
 }
 
-func (m *mockedDiskLoader) GetSourceMigrations() []types.Migration {
+func (m *mockedDiskLoader) GetSourceMigrations() ([]types.Migration, error) {
 	// 5 migrations in total
 	// 4 migrations with type MigrationTypeSingleMigration
 	// 3 migrations with sourceDir source and type MigrationTypeSingleMigration
@@ -30,7 +32,7 @@ func (m *mockedDiskLoader) GetSourceMigrations() []types.Migration {
 	m3 := types.Migration{Name: "201602220001.sql", SourceDir: "config", File: "config/201602220001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select def"}
 	m4 := types.Migration{Name: "201602220002.sql", SourceDir: "source", File: "source/201602220002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select def"}
 	m5 := types.Migration{Name: "201602220003.sql", SourceDir: "tenant", File: "tenant/201602220003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "select def"}
-	return []types.Migration{m1, m2, m3, m4, m5}
+	return []types.Migration{m1, m2, m3, m4, m5}, nil
 }
 
 func (m *mockedDiskLoader) HealthCheck() error {
@@ -53,6 +55,34 @@ func newMockedDiskLoaderHealthCheckError(_ context.Context, _ *config.Config) lo
 	return &mockedDiskLoaderHealthCheckError{}
 }
 
+type mockedDiskLoaderError struct {
+	mockedDiskLoader
+}
+
+func (m *mockedDiskLoaderError) GetSourceMigrations() ([]types.Migration, error) {
+	return nil, errors.New("trouble maker")
+}
+
+func newMockedDiskLoaderError(_ context.Context, _ *config.Config) loader.Loader {
+	return &mockedDiskLoaderError{}
+}
+
+type mockedOutOfOrderDiskLoader struct {
+	mockedDiskLoader
+}
+
+func (m *mockedOutOfOrderDiskLoader) GetSourceMigrations() ([]types.Migration, error) {
+	// 201602220000.sql is already applied, 201602210000.sql was merged later but sorts before it
+	m1 := types.Migration{Name: "201602210000.sql", SourceDir: "tenant", File: "tenant/201602210000.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "select abc"}
+	m2 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
+	m3 := types.Migration{Name: "201602230000.sql", SourceDir: "source", File: "source/201602230000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select def"}
+	return []types.Migration{m1, m2, m3}, nil
+}
+
+func newMockedOutOfOrderDiskLoader(_ context.Context, _ *config.Config) loader.Loader {
+	return &mockedOutOfOrderDiskLoader{}
+}
+
 type mockedNotifier struct {
 	returnError bool
 }
@@ -75,9 +105,9 @@ func newErrorMockedNotifier(_ context.Context, _ *config.Config) notifications.N
 type mockedBrokenCheckSumDiskLoader struct {
 }
 
-func (m *mockedBrokenCheckSumDiskLoader) GetSourceMigrations() []types.Migration {
-	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc", CheckSum: "xxx"}
-	return []types.Migration{m1}
+func (m *mockedBrokenCheckSumDiskLoader) GetSourceMigrations() ([]types.Migration, error) {
+	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abcd", CheckSum: "xxx"}
+	return []types.Migration{m1}, nil
 }
 
 func (m *mockedBrokenCheckSumDiskLoader) HealthCheck() error {
@@ -91,10 +121,10 @@ func newBrokenCheckSumMockedDiskLoader(_ context.Context, _ *config.Config) load
 type mockedDifferentScriptCheckSumMockedDiskLoader struct {
 }
 
-func (m *mockedDifferentScriptCheckSumMockedDiskLoader) GetSourceMigrations() []types.Migration {
+func (m *mockedDifferentScriptCheckSumMockedDiskLoader) GetSourceMigrations() ([]types.Migration, error) {
 	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
 	m2 := types.Migration{Name: "recreate-indexes.sql", SourceDir: "tenants-scripts", File: "tenants-scripts/recreate-indexes.sql", MigrationType: types.MigrationTypeTenantScript, Contents: "select abc", CheckSum: "sha256-1"}
-	return []types.Migration{m1, m2}
+	return []types.Migration{m1, m2}, nil
 }
 
 func (m *mockedDifferentScriptCheckSumMockedDiskLoader) HealthCheck() error {
@@ -111,43 +141,155 @@ type mockedConnector struct {
 func (m *mockedConnector) Dispose() {
 }
 
-func (m *mockedConnector) CreateTenant(string, string, types.Action, []types.Migration, bool) (*types.Summary, *types.Version) {
-	return &types.Summary{}, &types.Version{}
+func (m *mockedConnector) CreateTenant(string, string, types.Action, []types.Migration, bool) (*types.Summary, *types.Version, error) {
+	return &types.Summary{}, &types.Version{}, nil
 }
 
-func (m *mockedConnector) CreateVersion(string, types.Action, []types.Migration, bool) (*types.Summary, *types.Version) {
-	return &types.Summary{}, &types.Version{}
+// CreateVersion recomputes the plan like DB connectors do under migrator lock when planCheck is passed
+func (m *mockedConnector) CreateVersion(_ string, _ types.Action, migrations []types.Migration, selector types.LabelSelector, _ bool, planCheck *types.PlanCheck) (*types.Summary, *types.Version, error) {
+	if planCheck != nil {
+		tenants, _ := m.GetTenants()
+		labels, _ := m.GetTenantLabels()
+		tenants = selector.SelectTenants(tenants, labels)
+		schemas, _ := m.PlanMigrations(migrations, tenants)
+		if plan := types.NewPlan(planCheck.SourceMigrations, migrations, schemas, tenants); plan.Hash != planCheck.Hash {
+			return nil, nil, &types.PlanChangedError{Expected: planCheck.Hash, Actual: plan.Hash}
+		}
+	}
+	return &types.Summary{}, &types.Version{}, nil
+}
+
+func (m *mockedConnector) Baseline(versionName string, migrations []types.Migration, tenants []types.Tenant, dryRun bool) (*types.Summary, *types.Version, error) {
+	summary := &types.Summary{Tenants: int32(len(tenants))}
+	for _, m := range migrations {
+		if m.MigrationType == types.MigrationTypeSingleMigration {
+			summary.SingleMigrations++
+		} else {
+			summary.TenantMigrations++
+			summary.TenantMigrationsTotal += int32(len(tenants))
+		}
+	}
+	summary.MigrationsGrandTotal = summary.SingleMigrations + summary.TenantMigrationsTotal
+	return summary, &types.Version{Name: versionName}, nil
+}
+
+// PlanMigrations plans tenant migrations for all passed tenants and single migrations for their source directories
+func (m *mockedConnector) PlanMigrations(migrations []types.Migration, tenants []types.Tenant) (map[string][]string, error) {
+	schemas := map[string][]string{}
+	for _, migration := range migrations {
+		if migration.MigrationType == types.MigrationTypeTenantMigration || migration.MigrationType == types.MigrationTypeTenantScript {
+			for _, t := range tenants {
+				schemas[migration.File] = append(schemas[migration.File], t.Name)
+			}
+			continue
+		}
+		schemas[migration.File] = []string{migration.SourceDir}
+	}
+	return schemas, nil
+}
+
+func (m *mockedConnector) RollbackVersion(version *types.Version, migrations []types.DBMigration, dryRun bool) (*types.Summary, error) {
+	return &types.Summary{VersionID: version.ID, MigrationsGrandTotal: int32(len(migrations))}, nil
+}
+
+func (m *mockedConnector) RepairChecksums(migrations []types.Migration, reason string) ([]types.ChecksumRepair, error) {
+	repairs := []types.ChecksumRepair{}
+	for _, migration := range migrations {
+		repairs = append(repairs, types.ChecksumRepair{File: migration.File, NewCheckSum: migration.CheckSum, NewContents: migration.Contents, Reason: reason, Schemas: 1})
+	}
+	return repairs, nil
 }
 
-func (m *mockedConnector) GetTenants() []types.Tenant {
+func (m *mockedConnector) GetTenants() ([]types.Tenant, error) {
 	a := types.Tenant{Name: "a"}
 	b := types.Tenant{Name: "b"}
 	c := types.Tenant{Name: "c"}
-	return []types.Tenant{a, b, c}
+	return []types.Tenant{a, b, c}, nil
+}
+
+func (m *mockedConnector) ArchiveTenant(tenant string, versionName string) (*types.Summary, *types.Version, error) {
+	return &types.Summary{Tenants: 1}, &types.Version{Name: versionName}, nil
+}
+
+func (m *mockedConnector) DropTenant(tenant string, versionName string, dryRun bool) (*types.Summary, *types.Version, error) {
+	return &types.Summary{Tenants: 1}, &types.Version{Name: versionName}, nil
+}
+
+func (m *mockedConnector) RenameTenant(from string, to string, versionName string) (*types.Summary, *types.Version, error) {
+	return &types.Summary{Tenants: 1}, &types.Version{Name: versionName}, nil
+}
+
+// GetSchemaFingerprints returns the same objects for all schemas except "b" which has a hotfix index and a changed column
+func (m *mockedConnector) GetSchemaFingerprints(schemas []string) ([]types.SchemaFingerprint, error) {
+	fingerprints := []types.SchemaFingerprint{}
+	for _, schema := range schemas {
+		objects := []types.SchemaObject{
+			{Type: "table", Name: "orders", Definition: "BASE TABLE"},
+			{Type: "column", Name: "orders.id", Definition: "integer not null"},
+			{Type: "column", Name: "orders.notes", Definition: "character varying(100)"},
+			{Type: "constraint", Name: "orders.orders_pkey", Definition: "PRIMARY KEY (id)"},
+		}
+		if schema == "b" {
+			objects[2].Definition = "text"
+			objects = append(objects[:3], types.SchemaObject{Type: "index", Name: "orders.idx_orders_notes", Definition: "CREATE INDEX idx_orders_notes ON orders USING btree (notes)"})
+		}
+		fingerprints = append(fingerprints, types.NewSchemaFingerprint(schema, objects))
+	}
+	return fingerprints, nil
+}
+
+func (m *mockedConnector) GetTenantLabels() (map[string][]types.TenantLabel, error) {
+	return map[string][]types.TenantLabel{
+		"a": {{Key: "canary", Value: "true"}, {Key: "region", Value: "eu"}},
+		"b": {{Key: "region", Value: "us"}},
+	}, nil
 }
 
-func (m *mockedConnector) GetVersions() []types.Version {
+func (m *mockedConnector) SetTenantLabels(tenant string, labels []types.TenantLabel) error {
+	return nil
+}
+
+func (m *mockedConnector) GetVersions() ([]types.Version, error) {
 	a := types.Version{ID: 12, Name: "a", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -2)}}
 	b := types.Version{ID: 121, Name: "bb", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -1)}}
 	c := types.Version{ID: 122, Name: "ccc", Created: graphql.Time{Time: time.Now()}}
-	return []types.Version{a, b, c}
+	return []types.Version{a, b, c}, nil
 }
 
-func (m *mockedConnector) GetVersionsByFile(file string) []types.Version {
+func (m *mockedConnector) GetVersionsByFile(file string) ([]types.Version, error) {
 	a := types.Version{ID: 12, Name: "a", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -2)}}
-	return []types.Version{a}
+	return []types.Version{a}, nil
 }
 
 func (m *mockedConnector) GetVersionByID(ID int32) (*types.Version, error) {
 	a := types.Version{ID: ID, Name: "a", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -2)}}
+	// versions 101 and 102 have schema snapshots, 102 adds a column in tenant schema and a new single schema
+	config := types.NewSchemaFingerprint("config", []types.SchemaObject{{Type: "table", Name: "settings", Definition: "BASE TABLE"}})
+	orders := []types.SchemaObject{{Type: "table", Name: "orders", Definition: "BASE TABLE"}, {Type: "column", Name: "orders.id", Definition: "integer not null"}}
+	switch ID {
+	case 101:
+		tenant := types.NewSchemaFingerprint("a", orders)
+		a.SchemaSnapshot = []types.SchemaSnapshot{
+			{Schema: "config", MigrationType: types.MigrationTypeSingleMigration, Fingerprint: config.Fingerprint, Objects: config.Objects},
+			{Schema: "a", MigrationType: types.MigrationTypeTenantMigration, Fingerprint: tenant.Fingerprint, Objects: tenant.Objects},
+		}
+	case 102:
+		ref := types.NewSchemaFingerprint("ref", []types.SchemaObject{{Type: "table", Name: "countries", Definition: "BASE TABLE"}})
+		tenant := types.NewSchemaFingerprint("b", append(orders, types.SchemaObject{Type: "column", Name: "orders.total", Definition: "numeric"}))
+		a.SchemaSnapshot = []types.SchemaSnapshot{
+			{Schema: "config", MigrationType: types.MigrationTypeSingleMigration, Fingerprint: config.Fingerprint, Objects: config.Objects},
+			{Schema: "ref", MigrationType: types.MigrationTypeSingleMigration, Fingerprint: ref.Fingerprint, Objects: ref.Objects},
+			{Schema: "b", MigrationType: types.MigrationTypeTenantMigration, Fingerprint: tenant.Fingerprint, Objects: tenant.Objects},
+		}
+	}
 	return &a, nil
 }
 
-func (m *mockedConnector) GetAppliedMigrations() []types.DBMigration {
+func (m *mockedConnector) GetAppliedMigrations() ([]types.DBMigration, error) {
 	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
 	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
 	ms := []types.DBMigration{{Migration: m1, Schema: "source", Created: graphql.Time{Time: d1}}}
-	return ms
+	return ms, nil
 }
 
 func (m *mockedConnector) GetDBMigrationByID(ID int32) (*types.DBMigration, error) {
@@ -161,6 +303,49 @@ func (m *mockedConnector) HealthCheck() error {
 	return nil
 }
 
+// jobs are shared by all mocked connectors just like they are shared by migrator instances using the same DB
+var (
+	mockedJobsMutex sync.Mutex
+	mockedJobs      = map[int32]types.Job{}
+)
+
+func (m *mockedConnector) CreateJob(operation string, name string) (*types.Job, error) {
+	mockedJobsMutex.Lock()
+	defer mockedJobsMutex.Unlock()
+	job := types.Job{ID: int32(len(mockedJobs) + 1), Operation: operation, Name: name, Status: types.JobStatusQueued}
+	mockedJobs[job.ID] = job
+	return &job, nil
+}
+
+func (m *mockedConnector) UpdateJob(job *types.Job) error {
+	mockedJobsMutex.Lock()
+	defer mockedJobsMutex.Unlock()
+	mockedJobs[job.ID] = *job
+	return nil
+}
+
+func (m *mockedConnector) GetJobByID(ID int32) (*types.Job, error) {
+	mockedJobsMutex.Lock()
+	defer mockedJobsMutex.Unlock()
+	job, ok := mockedJobs[ID]
+	if !ok {
+		return nil, &types.NotFoundError{Resource: "job", ID: fmt.Sprint(ID)}
+	}
+	return &job, nil
+}
+
+func (m *mockedConnector) FailStaleJob(ID int32, staleBefore time.Time, message string) error {
+	mockedJobsMutex.Lock()
+	defer mockedJobsMutex.Unlock()
+	job, ok := mockedJobs[ID]
+	if ok && job.Status == types.JobStatusRunning && job.Heartbeat != nil && job.Heartbeat.Time.Before(staleBefore) {
+		job.Status = types.JobStatusFailed
+		job.Error = &message
+		mockedJobs[ID] = job
+	}
+	return nil
+}
+
 func newMockedConnector(context.Context, *config.Config) db.Connector {
 	return &mockedConnector{}
 }
@@ -181,19 +366,32 @@ type mockedDifferentScriptCheckSumMockedConnector struct {
 	mockedConnector
 }
 
-func (m *mockedDifferentScriptCheckSumMockedConnector) GetAppliedMigrations() []types.DBMigration {
+func (m *mockedDifferentScriptCheckSumMockedConnector) GetAppliedMigrations() ([]types.DBMigration, error) {
 	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
 	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
 	m2 := types.Migration{Name: "recreate-indexes.sql", SourceDir: "tenants-scripts", File: "tenants-scripts/recreate-indexes.sql", MigrationType: types.MigrationTypeTenantScript, Contents: "select abc", CheckSum: "sha256-2"}
 	d2 := time.Date(2016, 02, 22, 16, 41, 1, 456, time.UTC)
 	ms := []types.DBMigration{{Migration: m1, Schema: "source", Created: graphql.Time{Time: d1}}, {Migration: m2, Schema: "customer1", Created: graphql.Time{Time: d2}}}
-	return ms
+	return ms, nil
 }
 
 func newDifferentScriptCheckSumMockedConnector(context.Context, *config.Config) db.Connector {
 	return &mockedDifferentScriptCheckSumMockedConnector{mockedConnector{}}
 }
 
+// mockedArchivedTenantConnector returns tenant "b" as archived
+type mockedArchivedTenantConnector struct {
+	mockedConnector
+}
+
+func (m *mockedArchivedTenantConnector) GetTenants() ([]types.Tenant, error) {
+	return []types.Tenant{{Name: "a"}, {Name: "b", Archived: true}, {Name: "c"}}, nil
+}
+
+func newMockedArchivedTenantConnector(context.Context, *config.Config) db.Connector {
+	return &mockedArchivedTenantConnector{mockedConnector{}}
+}
+
 func newNoopMetrics() metrics.Metrics {
 	return &noopMetrics{}
 }
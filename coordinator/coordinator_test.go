@@ -2,12 +2,15 @@ package coordinator
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/graph-gophers/graphql-go"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/db"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
@@ -101,7 +104,8 @@ func TestComputeMigrationsToApply(t *testing.T) {
 		loader:    newMockedDiskLoader(context.TODO(), nil),
 		notifier:  newMockedNotifier(context.TODO(), nil),
 	}
-	migrations := coordinator.computeMigrationsToApply(diskMigrations, dbMigrations)
+	tenants := []types.Tenant{{Name: "abc"}, {Name: "def"}}
+	migrations := coordinator.computeMigrationsToApply(diskMigrations, dbMigrations, tenants)
 
 	// that should be 5 now...
 	assert.Len(t, migrations, 5)
@@ -145,7 +149,8 @@ func TestComputeMigrationsToApplyDifferentTimestamps(t *testing.T) {
 		loader:    newMockedDiskLoader(context.TODO(), nil),
 		notifier:  newMockedNotifier(context.TODO(), nil),
 	}
-	migrations := coordinator.computeMigrationsToApply(diskMigrations, dbMigrations)
+	tenants := []types.Tenant{{Name: "abc"}, {Name: "def"}}
+	migrations := coordinator.computeMigrationsToApply(diskMigrations, dbMigrations, tenants)
 
 	assert.Len(t, migrations, 3)
 
@@ -154,6 +159,52 @@ func TestComputeMigrationsToApplyDifferentTimestamps(t *testing.T) {
 	assert.Equal(t, dev1p2.File, migrations[2].File)
 }
 
+func TestOutOfOrderMigrations(t *testing.T) {
+	// use case:
+	// same as above, dev1 migrations which sort before already applied dev2 migrations are out of order
+	mdef1 := types.Migration{Name: "20181111", SourceDir: "tenants", File: "tenants/20181111", MigrationType: types.MigrationTypeTenantMigration}
+	mdef2 := types.Migration{Name: "20181112", SourceDir: "public", File: "public/20181112", MigrationType: types.MigrationTypeSingleMigration}
+
+	dev1 := types.Migration{Name: "20181119", SourceDir: "tenants", File: "tenants/20181119", MigrationType: types.MigrationTypeTenantMigration}
+	dev1p := types.Migration{Name: "20181119", SourceDir: "public", File: "public/20181119", MigrationType: types.MigrationTypeSingleMigration}
+	dev1s := types.Migration{Name: "20181119", SourceDir: "public-scripts", File: "public-scripts/20181119", MigrationType: types.MigrationTypeSingleScript}
+
+	dev2 := types.Migration{Name: "20181120", SourceDir: "tenants", File: "tenants/20181120", MigrationType: types.MigrationTypeTenantMigration}
+	dev3 := types.Migration{Name: "20181121", SourceDir: "tenants", File: "tenants/20181121", MigrationType: types.MigrationTypeTenantMigration}
+
+	diskMigrations := []types.Migration{mdef1, mdef2, dev1, dev1p, dev1s, dev2, dev3}
+	dbMigrations := []types.DBMigration{{Migration: mdef1, Schema: "abc", Created: graphql.Time{Time: time.Now()}}, {Migration: mdef2, Schema: "public", Created: graphql.Time{Time: time.Now()}}, {Migration: dev2, Schema: "abc", Created: graphql.Time{Time: time.Now()}}}
+
+	coordinator := &coordinator{ctx: context.TODO()}
+	migrations := coordinator.outOfOrderMigrations(diskMigrations, dbMigrations)
+
+	assert.Equal(t, []types.Migration{dev1, dev1p}, migrations)
+}
+
+func TestComputeMigrationsToApplyFailedTenants(t *testing.T) {
+	// use case:
+	// tenants are committed in separate transactions and tenant ghi failed
+	// next version should apply the tenant migration again (connector applies it only to ghi)
+	mdef1 := types.Migration{Name: "20181111", SourceDir: "public", File: "public/20181111", MigrationType: types.MigrationTypeSingleMigration}
+	mdef2 := types.Migration{Name: "20181111", SourceDir: "tenants", File: "tenants/20181111", MigrationType: types.MigrationTypeTenantMigration}
+	mdef3 := types.Migration{Name: "20181112", SourceDir: "tenants", File: "tenants/20181112", MigrationType: types.MigrationTypeTenantMigration}
+
+	diskMigrations := []types.Migration{mdef1, mdef2, mdef3}
+	dbMigrations := []types.DBMigration{{Migration: mdef1, Schema: "public", Created: graphql.Time{Time: time.Now()}}, {Migration: mdef2, Schema: "abc", Created: graphql.Time{Time: time.Now()}}, {Migration: mdef2, Schema: "def", Created: graphql.Time{Time: time.Now()}}, {Migration: mdef2, Schema: "ghi", Created: graphql.Time{Time: time.Now()}}, {Migration: mdef3, Schema: "abc", Created: graphql.Time{Time: time.Now()}}, {Migration: mdef3, Schema: "def", Created: graphql.Time{Time: time.Now()}}}
+
+	coordinator := &coordinator{
+		ctx:       context.TODO(),
+		connector: newMockedConnector(context.TODO(), nil),
+		loader:    newMockedDiskLoader(context.TODO(), nil),
+		notifier:  newMockedNotifier(context.TODO(), nil),
+	}
+	tenants := []types.Tenant{{Name: "abc"}, {Name: "def"}, {Name: "ghi"}}
+	migrations := coordinator.computeMigrationsToApply(diskMigrations, dbMigrations, tenants)
+
+	assert.Len(t, migrations, 1)
+	assert.Equal(t, mdef3.File, migrations[0].File)
+}
+
 func TestFilterTenantMigrations(t *testing.T) {
 	mdef1 := types.Migration{Name: "20181111", SourceDir: "tenants", File: "tenants/20181111", MigrationType: types.MigrationTypeTenantMigration}
 	mdef2 := types.Migration{Name: "20181111", SourceDir: "public", File: "public/20181111", MigrationType: types.MigrationTypeSingleMigration}
@@ -218,7 +269,8 @@ func TestIntersect(t *testing.T) {
 func TestVerifySourceMigrationsCheckSumsOK(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
-	verified, offendingMigrations := coordinator.VerifySourceMigrationsCheckSums()
+	verified, offendingMigrations, err := coordinator.VerifySourceMigrationsCheckSums()
+	assert.Nil(t, err)
 	assert.True(t, verified)
 	assert.Empty(t, offendingMigrations)
 }
@@ -226,33 +278,154 @@ func TestVerifySourceMigrationsCheckSumsOK(t *testing.T) {
 func TestVerifySourceMigrationsCheckSumsKO(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
-	verified, offendingMigrations := coordinator.VerifySourceMigrationsCheckSums()
+	verified, offendingMigrations, err := coordinator.VerifySourceMigrationsCheckSums()
+	assert.Nil(t, err)
 	assert.False(t, verified)
-	assert.Equal(t, coordinator.GetSourceMigrations(nil)[0], offendingMigrations[0])
+	sourceMigrations, _ := coordinator.GetSourceMigrations(nil)
+	assert.Equal(t, sourceMigrations[0], offendingMigrations[0])
 }
 
 func TestVerifySourceMigrationsAndScriptsCheckSumsOK(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newNoopMetrics(), newDifferentScriptCheckSumMockedConnector, newDifferentScriptCheckSumMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
-	verified, offendingMigrations := coordinator.VerifySourceMigrationsCheckSums()
+	verified, offendingMigrations, err := coordinator.VerifySourceMigrationsCheckSums()
+	assert.Nil(t, err)
 	assert.True(t, verified)
 	assert.Empty(t, offendingMigrations)
 }
 
+func TestVerifyChecksums(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	mismatches, err := coordinator.VerifyChecksums()
+	assert.Nil(t, err)
+	assert.Len(t, mismatches, 1)
+	assert.Equal(t, "source/201602220000.sql", mismatches[0].File)
+	assert.Equal(t, "xxx", mismatches[0].SourceCheckSum)
+	assert.Equal(t, "", mismatches[0].AppliedCheckSum)
+	assert.Equal(t, int32(12), mismatches[0].Versions[0].ID)
+	expectedDiff := "--- source/201602220000.sql\tapplied\n+++ source/201602220000.sql\tsource\n@@ -1 +1 @@\n-select abc\n+select abcd\n"
+	assert.Equal(t, expectedDiff, mismatches[0].Diff)
+}
+
+func TestVerifyChecksumsOK(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newDifferentScriptCheckSumMockedConnector, newDifferentScriptCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	mismatches, err := coordinator.VerifyChecksums()
+	assert.Nil(t, err)
+	assert.Empty(t, mismatches)
+}
+
+func TestRepairChecksums(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	repairs, err := coordinator.RepairChecksums(nil, "whitespace fix")
+	assert.Nil(t, err)
+	assert.Len(t, repairs, 1)
+	assert.Equal(t, "source/201602220000.sql", repairs[0].File)
+	assert.Equal(t, "xxx", repairs[0].NewCheckSum)
+	assert.Equal(t, "whitespace fix", repairs[0].Reason)
+}
+
+func TestRepairChecksumsFiles(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	repairs, err := coordinator.RepairChecksums([]string{"source/201602220001.sql", "config/201602220001.sql"}, "whitespace fix")
+	assert.Nil(t, err)
+	assert.Len(t, repairs, 2)
+	assert.Equal(t, "source/201602220001.sql", repairs[0].File)
+	assert.Equal(t, "config/201602220001.sql", repairs[1].File)
+}
+
+func TestRepairChecksumsErrors(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	_, err := coordinator.RepairChecksums([]string{"source/201602220001.sql"}, " ")
+	var invalidArgument *types.InvalidArgumentError
+	assert.True(t, errors.As(err, &invalidArgument))
+	assert.Equal(t, "invalid reason: reason for checksum repair must not be empty", err.Error())
+	_, err = coordinator.RepairChecksums([]string{"xyz/201602220001.sql"}, "whitespace fix")
+	var notFound *types.NotFoundError
+	assert.True(t, errors.As(err, &notFound))
+}
+
 func TestGetTenants(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
-	tenants := coordinator.GetTenants()
-	a := types.Tenant{Name: "a"}
-	b := types.Tenant{Name: "b"}
-	c := types.Tenant{Name: "c"}
+	tenants, err := coordinator.GetTenants("")
+	assert.Nil(t, err)
+	a := types.Tenant{Name: "a", Labels: []types.TenantLabel{{Key: "canary", Value: "true"}, {Key: "region", Value: "eu"}}}
+	b := types.Tenant{Name: "b", Labels: []types.TenantLabel{{Key: "region", Value: "us"}}}
+	c := types.Tenant{Name: "c", Labels: []types.TenantLabel{}}
 	assert.Equal(t, []types.Tenant{a, b, c}, tenants)
 }
 
+func TestGetTenantsSelector(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	tenants, err := coordinator.GetTenants("canary=true")
+	assert.Nil(t, err)
+	assert.Len(t, tenants, 1)
+	assert.Equal(t, "a", tenants[0].Name)
+
+	tenants, err = coordinator.GetTenants("region,region!=eu")
+	assert.Nil(t, err)
+	assert.Len(t, tenants, 1)
+	assert.Equal(t, "b", tenants[0].Name)
+
+	tenants, err = coordinator.GetTenants("!region")
+	assert.Nil(t, err)
+	assert.Len(t, tenants, 1)
+	assert.Equal(t, "c", tenants[0].Name)
+
+	_, err = coordinator.GetTenants("region=eu;drop")
+	var invalidArgument *types.InvalidArgumentError
+	assert.True(t, errors.As(err, &invalidArgument))
+	assert.Equal(t, "selector", invalidArgument.Argument)
+}
+
+func TestSetTenantLabels(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	labels := []types.TenantLabel{{Key: "plan", Value: "premium"}}
+	tenant, err := coordinator.SetTenantLabels("c", labels)
+	assert.Nil(t, err)
+	assert.Equal(t, &types.Tenant{Name: "c", Labels: labels}, tenant)
+
+	_, err = coordinator.SetTenantLabels("unknown", labels)
+	var notFound *types.NotFoundError
+	assert.True(t, errors.As(err, &notFound))
+	assert.Equal(t, "tenant not found: unknown", err.Error())
+
+	_, err = coordinator.SetTenantLabels("c", []types.TenantLabel{{Key: "plan", Value: "a"}, {Key: "plan", Value: "b"}})
+	var invalidArgument *types.InvalidArgumentError
+	assert.True(t, errors.As(err, &invalidArgument))
+	assert.Equal(t, "invalid labels: duplicated label key: plan", err.Error())
+}
+
+func TestCreateVersionSelector(t *testing.T) {
+	coordinator := New(context.TODO(), &config.Config{}, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	results, err := coordinator.CreateVersion("commit-sha", types.ActionApply, false, "canary=true", "")
+	assert.Nil(t, err)
+	assert.NotNil(t, results.Summary)
+
+	_, err = coordinator.CreateVersion("commit-sha", types.ActionApply, false, "canary=", "")
+	assert.Nil(t, err)
+
+	_, err = coordinator.CreateVersion("commit-sha", types.ActionApply, false, "=true", "")
+	var invalidArgument *types.InvalidArgumentError
+	assert.True(t, errors.As(err, &invalidArgument))
+}
+
 func TestGetVersions(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
-	versions := coordinator.GetVersions()
+	versions, err := coordinator.GetVersions()
+	assert.Nil(t, err)
 
 	assert.Equal(t, int32(12), versions[0].ID)
 	assert.Equal(t, int32(121), versions[1].ID)
@@ -270,7 +443,8 @@ func TestGetVersionByID(t *testing.T) {
 func TestGetVersionsByFile(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
-	versions := coordinator.GetVersionsByFile("tenants/abc.sql")
+	versions, err := coordinator.GetVersionsByFile("tenants/abc.sql")
+	assert.Nil(t, err)
 
 	assert.Equal(t, int32(12), versions[0].ID)
 }
@@ -299,6 +473,8 @@ func TestGetSourceMigrationByFileNotFound(t *testing.T) {
 	_, err := coordinator.GetSourceMigrationByFile(file)
 	assert.NotNil(t, err)
 	assert.Equal(t, "source migration not found: xyz/201602220001.sql", err.Error())
+	var notFound *types.NotFoundError
+	assert.True(t, errors.As(err, &notFound))
 }
 
 func TestGetSourceMigrationsFilterMigrationType(t *testing.T) {
@@ -308,7 +484,8 @@ func TestGetSourceMigrationsFilterMigrationType(t *testing.T) {
 	filters := SourceMigrationFilters{
 		MigrationType: &migrationType,
 	}
-	migrations := coordinator.GetSourceMigrations(&filters)
+	migrations, err := coordinator.GetSourceMigrations(&filters)
+	assert.Nil(t, err)
 	assert.True(t, len(migrations) == 4)
 }
 
@@ -321,7 +498,8 @@ func TestGetSourceMigrationsFilterMigrationTypeSourceDir(t *testing.T) {
 		MigrationType: &migrationType,
 		SourceDir:     &sourceDir,
 	}
-	migrations := coordinator.GetSourceMigrations(&filters)
+	migrations, err := coordinator.GetSourceMigrations(&filters)
+	assert.Nil(t, err)
 	assert.True(t, len(migrations) == 3)
 }
 
@@ -334,7 +512,8 @@ func TestGetSourceMigrationsFilterMigrationTypeName(t *testing.T) {
 		MigrationType: &migrationType,
 		Name:          &name,
 	}
-	migrations := coordinator.GetSourceMigrations(&filters)
+	migrations, err := coordinator.GetSourceMigrations(&filters)
+	assert.Nil(t, err)
 	assert.True(t, len(migrations) == 2)
 }
 
@@ -345,14 +524,16 @@ func TestGetSourceMigrationsFilterFile(t *testing.T) {
 	filters := SourceMigrationFilters{
 		File: &file,
 	}
-	migrations := coordinator.GetSourceMigrations(&filters)
+	migrations, err := coordinator.GetSourceMigrations(&filters)
+	assert.Nil(t, err)
 	assert.True(t, len(migrations) == 1)
 }
 
 func TestCreateVersion(t *testing.T) {
-	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	coordinator := New(context.TODO(), &config.Config{}, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
 	defer coordinator.Dispose()
-	results := coordinator.CreateVersion("commit-sha", types.ActionApply, false)
+	results, err := coordinator.CreateVersion("commit-sha", types.ActionApply, false, "", "")
+	assert.Nil(t, err)
 	assert.NotNil(t, results)
 	assert.NotNil(t, results.Summary)
 	assert.NotNil(t, results.Version)
@@ -361,12 +542,236 @@ func TestCreateVersion(t *testing.T) {
 func TestCreateTenant(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
 	defer coordinator.Dispose()
-	results := coordinator.CreateTenant("commit-sha", types.ActionSync, true, "NewTenant")
+	results, err := coordinator.CreateTenant("commit-sha", types.ActionSync, true, "NewTenant", nil)
+	assert.Nil(t, err)
 	assert.NotNil(t, results)
 	assert.NotNil(t, results.Summary)
 	assert.NotNil(t, results.Version)
 }
 
+func TestPlan(t *testing.T) {
+	coordinator := New(context.TODO(), &config.Config{}, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	plan, err := coordinator.Plan("")
+	assert.Nil(t, err)
+
+	// source/201602220000.sql is already applied
+	assert.Len(t, plan.SingleSchemas, 2)
+	assert.Equal(t, "source", plan.SingleSchemas[0].Schema)
+	assert.Equal(t, []types.PlannedMigration{
+		{File: "source/201602220001.sql", MigrationType: types.MigrationTypeSingleMigration},
+		{File: "source/201602220002.sql", MigrationType: types.MigrationTypeSingleMigration},
+	}, plan.SingleSchemas[0].Migrations)
+	assert.Equal(t, "config", plan.SingleSchemas[1].Schema)
+	assert.Len(t, plan.SingleSchemas[1].Migrations, 1)
+
+	assert.Len(t, plan.Tenants, 3)
+	for i, tenant := range []string{"a", "b", "c"} {
+		assert.Equal(t, tenant, plan.Tenants[i].Schema)
+		assert.Equal(t, []types.PlannedMigration{{File: "tenant/201602220003.sql", MigrationType: types.MigrationTypeTenantMigration}}, plan.Tenants[i].Migrations)
+	}
+	assert.Equal(t, int32(6), plan.Pending())
+}
+
+func TestPlanSelector(t *testing.T) {
+	coordinator := New(context.TODO(), &config.Config{}, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	plan, err := coordinator.Plan("canary=true")
+	assert.Nil(t, err)
+	assert.Len(t, plan.Tenants, 1)
+	assert.Equal(t, "a", plan.Tenants[0].Schema)
+
+	_, err = coordinator.Plan("=true")
+	var invalidArgument *types.InvalidArgumentError
+	assert.True(t, errors.As(err, &invalidArgument))
+}
+
+func TestPlanHash(t *testing.T) {
+	coordinator := New(context.TODO(), &config.Config{}, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	plan, err := coordinator.Plan("")
+	assert.Nil(t, err)
+	assert.Len(t, plan.Hash, 64)
+
+	again, err := coordinator.Plan("")
+	assert.Nil(t, err)
+	assert.Equal(t, plan.Hash, again.Hash)
+
+	// different tenants produce different hash
+	canary, err := coordinator.Plan("canary=true")
+	assert.Nil(t, err)
+	assert.NotEqual(t, plan.Hash, canary.Hash)
+
+	results, err := coordinator.CreateVersion("commit-sha", types.ActionApply, false, "canary=true", canary.Hash)
+	assert.Nil(t, err)
+	assert.NotNil(t, results.Version)
+}
+
+func TestCreateVersionPlanChanged(t *testing.T) {
+	coordinator := New(context.TODO(), &config.Config{}, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	plan, err := coordinator.Plan("canary=true")
+	assert.Nil(t, err)
+
+	// plan was made for canary tenants only
+	results, err := coordinator.CreateVersion("commit-sha", types.ActionApply, false, "", plan.Hash)
+	assert.Nil(t, results)
+	var planChanged *types.PlanChangedError
+	assert.True(t, errors.As(err, &planChanged))
+	assert.Equal(t, plan.Hash, planChanged.Expected)
+	assert.NotEqual(t, plan.Hash, planChanged.Actual)
+}
+
+func TestCreateVersionJob(t *testing.T) {
+	// job outlives the request which started it
+	ctx, cancel := context.WithCancel(context.TODO())
+	coordinator := New(ctx, &config.Config{}, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	job, err := coordinator.CreateVersionJob("commit-sha", types.ActionApply, false, "", "")
+	coordinator.Dispose()
+	cancel()
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobOperationCreateVersion, job.Operation)
+	assert.Equal(t, "commit-sha", job.Name)
+	assert.Equal(t, types.JobStatusQueued, job.Status)
+
+	// job can be read by a different coordinator
+	poller := New(context.TODO(), &config.Config{}, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer poller.Dispose()
+	assert.Eventually(t, func() bool {
+		job, err = poller.GetJobByID(job.ID)
+		return err == nil && job.Status == types.JobStatusSucceeded
+	}, time.Second, 10*time.Millisecond)
+	assert.NotNil(t, job.Summary)
+	assert.Nil(t, job.Error)
+	assert.Equal(t, jobOwner, *job.Owner)
+	assert.NotNil(t, job.Heartbeat)
+}
+
+func TestCreateVersionJobInvalidSelector(t *testing.T) {
+	coordinator := New(context.TODO(), &config.Config{}, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	job, err := coordinator.CreateVersionJob("commit-sha", types.ActionApply, false, "=true", "")
+	assert.Nil(t, job)
+	var invalidArgument *types.InvalidArgumentError
+	assert.True(t, errors.As(err, &invalidArgument))
+}
+
+func TestCreateTenantJobFailed(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	job, err := coordinator.CreateTenantJob("commit-sha", types.ActionApply, false, "NewTenant", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobOperationCreateTenant, job.Operation)
+
+	assert.Eventually(t, func() bool {
+		job, err = coordinator.GetJobByID(job.ID)
+		return err == nil && job.Status == types.JobStatusFailed
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, job.Summary)
+	assert.Contains(t, *job.Error, "checksum")
+
+	_, err = coordinator.CreateTenantJob("commit-sha", types.ActionApply, false, "NewTenant", []types.TenantLabel{{Key: "", Value: "true"}})
+	var invalidArgument *types.InvalidArgumentError
+	assert.True(t, errors.As(err, &invalidArgument))
+}
+
+func TestGetJobByIDStale(t *testing.T) {
+	coordinator := New(context.TODO(), &config.Config{}, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	connector := &mockedConnector{}
+	owner := "migrator-0:1"
+	alive, err := connector.CreateJob(types.JobOperationCreateVersion, "alive")
+	assert.Nil(t, err)
+	alive.Status = types.JobStatusRunning
+	alive.Owner = &owner
+	alive.Heartbeat = &graphql.Time{Time: time.Now().UTC()}
+	assert.Nil(t, connector.UpdateJob(alive))
+
+	// owner was killed and stopped storing heartbeats
+	abandoned, err := connector.CreateJob(types.JobOperationCreateVersion, "abandoned")
+	assert.Nil(t, err)
+	abandoned.Status = types.JobStatusRunning
+	abandoned.Owner = &owner
+	abandoned.Heartbeat = &graphql.Time{Time: time.Now().UTC().Add(-2 * jobStaleTimeout)}
+	assert.Nil(t, connector.UpdateJob(abandoned))
+
+	job, err := coordinator.GetJobByID(alive.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStatusRunning, job.Status)
+	assert.Nil(t, job.Error)
+
+	job, err = coordinator.GetJobByID(abandoned.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStatusFailed, job.Status)
+	assert.Contains(t, *job.Error, "owner migrator-0:1 stopped storing heartbeats")
+}
+
+func TestGetJobByIDNotFound(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	_, err := coordinator.GetJobByID(-1)
+	var notFound *types.NotFoundError
+	assert.True(t, errors.As(err, &notFound))
+}
+
+func TestCreateVersionCheckSumMismatch(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.CreateVersion("commit-sha", types.ActionApply, false, "", "")
+	assert.Nil(t, results)
+	var mismatch *types.ChecksumMismatchError
+	assert.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, []string{"source/201602220000.sql"}, mismatch.Files())
+}
+
+func TestCreateVersionOutOfOrder(t *testing.T) {
+	config := &config.Config{OutOfOrder: config.OutOfOrderReject}
+	coordinator := New(context.TODO(), config, newNoopMetrics(), newMockedConnector, newMockedOutOfOrderDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.CreateVersion("commit-sha", types.ActionApply, false, "", "")
+	assert.Nil(t, results)
+	var outOfOrder *types.OutOfOrderError
+	assert.True(t, errors.As(err, &outOfOrder))
+	assert.Equal(t, []string{"tenant/201602210000.sql"}, outOfOrder.Files())
+
+	// warn and allow apply out-of-order migrations
+	for _, policy := range []string{"warn", "allow"} {
+		config.OutOfOrder = policy
+		results, err = coordinator.CreateVersion("commit-sha", types.ActionApply, false, "", "")
+		assert.Nil(t, err)
+		assert.NotNil(t, results)
+	}
+}
+
+func TestGetSourceMigrationsOutOfOrder(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedOutOfOrderDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	migrations, err := coordinator.GetSourceMigrations(nil)
+	assert.Nil(t, err)
+	assert.Len(t, migrations, 3)
+	assert.True(t, migrations[0].OutOfOrder)
+	// applied
+	assert.False(t, migrations[1].OutOfOrder)
+	// pending but in order
+	assert.False(t, migrations[2].OutOfOrder)
+}
+
+func TestCreateVersionLoaderError(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoaderError, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.CreateVersion("commit-sha", types.ActionApply, false, "", "")
+	assert.Nil(t, results)
+	assert.Equal(t, "trouble maker", err.Error())
+}
+
 func TestHealthCheckDBAndLoaderOK(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
 	defer coordinator.Dispose()
@@ -399,3 +804,285 @@ func TestHealthCheckLoaderKO(t *testing.T) {
 	assert.Equal(t, "Loader", healthResponse.Checks[1].Name)
 	assert.Equal(t, types.HealthStatusDown, healthResponse.Checks[1].Status)
 }
+
+func TestHealthCheckTargets(t *testing.T) {
+	cfg := &config.Config{
+		Driver: "postgres",
+		Targets: map[string]*config.Target{
+			"orders":    {Driver: "postgres", DataSource: "orders"},
+			"documents": {Driver: "mongodb", DataSource: "documents"},
+		},
+	}
+	newConnector := func(ctx context.Context, config *config.Config) db.Connector {
+		if config.DataSource == "documents" {
+			return newMockedConnectorHealthCheckError(ctx, config)
+		}
+		return newMockedConnector(ctx, config)
+	}
+	coordinator := New(context.TODO(), cfg, newNoopMetrics(), newConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	healthResponse := coordinator.HealthCheck()
+	assert.Equal(t, types.HealthStatusDown, healthResponse.Status)
+	assert.Len(t, healthResponse.Checks, 6)
+	assert.Equal(t, "DB", healthResponse.Checks[0].Name)
+	assert.Equal(t, types.HealthStatusUp, healthResponse.Checks[0].Status)
+	assert.Equal(t, "Loader", healthResponse.Checks[1].Name)
+	// targets are sorted by name
+	assert.Equal(t, "DB documents", healthResponse.Checks[2].Name)
+	assert.Equal(t, types.HealthStatusDown, healthResponse.Checks[2].Status)
+	assert.Equal(t, "Loader documents", healthResponse.Checks[3].Name)
+	assert.Equal(t, types.HealthStatusUp, healthResponse.Checks[3].Status)
+	assert.Equal(t, "DB orders", healthResponse.Checks[4].Name)
+	assert.Equal(t, types.HealthStatusUp, healthResponse.Checks[4].Status)
+	assert.Equal(t, "Loader orders", healthResponse.Checks[5].Name)
+}
+
+func TestHealthCheckTargetsWithoutDefaultTarget(t *testing.T) {
+	config := &config.Config{
+		Targets: map[string]*config.Target{
+			"orders": {Driver: "postgres", DataSource: "orders"},
+		},
+	}
+	coordinator := New(context.TODO(), config, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	healthResponse := coordinator.HealthCheck()
+	assert.Equal(t, types.HealthStatusUp, healthResponse.Status)
+	assert.Len(t, healthResponse.Checks, 2)
+	assert.Equal(t, "DB orders", healthResponse.Checks[0].Name)
+	assert.Equal(t, "Loader orders", healthResponse.Checks[1].Name)
+}
+
+func TestComputeMigrationsToRollback(t *testing.T) {
+	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table abc", Down: "drop table abc"}
+	m2 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.def", Down: "drop table {schema}.def"}
+	s1 := types.Migration{Name: "recreate-indexes.sql", SourceDir: "tenants-scripts", File: "tenants-scripts/recreate-indexes.sql", MigrationType: types.MigrationTypeTenantScript, Contents: "select abc"}
+
+	// down migrations are not stored in DB, they are read from source migrations
+	applied1 := m1
+	applied1.Down = ""
+	applied2 := m2
+	applied2.Down = ""
+	dbm1 := types.DBMigration{Migration: applied1, ID: 1, Schema: "source"}
+	dbm2 := types.DBMigration{Migration: applied2, ID: 2, Schema: "abc"}
+	dbm3 := types.DBMigration{Migration: applied2, ID: 3, Schema: "def"}
+	dbs1 := types.DBMigration{Migration: s1, ID: 4, Schema: "abc"}
+	version := &types.Version{ID: 123, DBMigrations: []types.DBMigration{dbm1, dbm2, dbm3, dbs1}}
+
+	coordinator := &coordinator{ctx: context.TODO()}
+	migrations, err := coordinator.computeMigrationsToRollback(version, []types.Migration{m1, m2, s1})
+	assert.Nil(t, err)
+
+	// scripts without down migrations are skipped, migrations are returned in reverse order
+	assert.Len(t, migrations, 3)
+	assert.Equal(t, int32(3), migrations[0].ID)
+	assert.Equal(t, "def", migrations[0].Schema)
+	assert.Equal(t, m2.Down, migrations[0].Down)
+	assert.Equal(t, int32(2), migrations[1].ID)
+	assert.Equal(t, int32(1), migrations[2].ID)
+	assert.Equal(t, m1.Down, migrations[2].Down)
+}
+
+func TestComputeMigrationsToRollbackDownNotFound(t *testing.T) {
+	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table abc"}
+	version := &types.Version{ID: 123, DBMigrations: []types.DBMigration{{Migration: m1, ID: 1, Schema: "source"}}}
+
+	coordinator := &coordinator{ctx: context.TODO()}
+	migrations, err := coordinator.computeMigrationsToRollback(version, []types.Migration{m1})
+	assert.Nil(t, migrations)
+	assert.Equal(t, "down migration not found for: source/201602220000.sql", err.Error())
+}
+
+func TestRollbackVersion(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.RollbackVersion(122, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(122), results.Summary.VersionID)
+	assert.Equal(t, int32(122), results.Version.ID)
+}
+
+func TestArchiveTenant(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedArchivedTenantConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	results, err := coordinator.ArchiveTenant("a")
+	assert.Nil(t, err)
+	assert.Equal(t, "Archive tenant a", results.Version.Name)
+	assert.Equal(t, int32(1), results.Summary.Tenants)
+
+	_, err = coordinator.ArchiveTenant("b")
+	var invalidArgument *types.InvalidArgumentError
+	assert.True(t, errors.As(err, &invalidArgument))
+	assert.Equal(t, "invalid name: tenant already archived: b", err.Error())
+
+	_, err = coordinator.ArchiveTenant("unknown")
+	var notFound *types.NotFoundError
+	assert.True(t, errors.As(err, &notFound))
+}
+
+func TestBaseline(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedArchivedTenantConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	// source/201602220000.sql is already applied, source/201602220002.sql and tenant/201602220003.sql stay pending
+	results, err := coordinator.Baseline("201602220001.sql", nil, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "Baseline up to 201602220001.sql", results.Version.Name)
+	assert.Equal(t, int32(2), results.Summary.SingleMigrations)
+	assert.Equal(t, int32(0), results.Summary.TenantMigrations)
+	// archived tenant b is skipped
+	assert.Equal(t, int32(2), results.Summary.Tenants)
+
+	results, err = coordinator.Baseline("201602220003.sql", []string{"a"}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), results.Summary.SingleMigrations)
+	assert.Equal(t, int32(1), results.Summary.TenantMigrationsTotal)
+	assert.Equal(t, int32(1), results.Summary.Tenants)
+
+	_, err = coordinator.Baseline("201602220001.sql", []string{"b"}, false)
+	var invalidArgument *types.InvalidArgumentError
+	assert.True(t, errors.As(err, &invalidArgument))
+	assert.Equal(t, "invalid tenants: tenant b is archived", err.Error())
+
+	_, err = coordinator.Baseline("201602220001.sql", []string{"unknown"}, false)
+	var notFound *types.NotFoundError
+	assert.True(t, errors.As(err, &notFound))
+
+	_, err = coordinator.Baseline("201602220009.sql", nil, false)
+	assert.True(t, errors.As(err, &notFound))
+	assert.Equal(t, "source migration not found: 201602220009.sql", err.Error())
+}
+
+func TestBaselineRefusedWhenLaterMigrationsApplied(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedOutOfOrderDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	// source/201602220000.sql is already applied
+	_, err := coordinator.Baseline("201602210000.sql", nil, false)
+	var invalidArgument *types.InvalidArgumentError
+	assert.True(t, errors.As(err, &invalidArgument))
+	assert.Equal(t, "invalid upTo: migrations which sort after 201602210000.sql were already applied: source/201602220000.sql", err.Error())
+}
+
+func TestDropTenant(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedArchivedTenantConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	// archived tenants can be dropped too
+	results, err := coordinator.DropTenant("b", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "Drop tenant b", results.Version.Name)
+
+	_, err = coordinator.DropTenant("unknown", false)
+	assert.Equal(t, "tenant not found: unknown", err.Error())
+}
+
+func TestRenameTenant(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedArchivedTenantConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	results, err := coordinator.RenameTenant("a", "d")
+	assert.Nil(t, err)
+	assert.Equal(t, "Rename tenant a to d", results.Version.Name)
+
+	_, err = coordinator.RenameTenant("a", "c")
+	var invalidArgument *types.InvalidArgumentError
+	assert.True(t, errors.As(err, &invalidArgument))
+	assert.Equal(t, "to", invalidArgument.Argument)
+
+	_, err = coordinator.RenameTenant("unknown", "d")
+	assert.Equal(t, "tenant not found: unknown", err.Error())
+}
+
+func TestFilterActiveTenants(t *testing.T) {
+	coordinator := &coordinator{}
+	tenants := []types.Tenant{{Name: "a"}, {Name: "b", Archived: true}, {Name: "c"}}
+	assert.Equal(t, []types.Tenant{{Name: "a"}, {Name: "c"}}, coordinator.filterActiveTenants(tenants))
+}
+
+func TestSchemaDrift(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	drift, err := coordinator.SchemaDrift()
+	assert.Nil(t, err)
+	assert.Len(t, drift, 2)
+
+	assert.True(t, drift[0].Majority)
+	assert.Equal(t, []string{"a", "c"}, drift[0].Tenants)
+	assert.Equal(t, int32(4), drift[0].Objects)
+	assert.Empty(t, drift[0].Differences)
+
+	assert.False(t, drift[1].Majority)
+	assert.Equal(t, []string{"b"}, drift[1].Tenants)
+	assert.NotEqual(t, drift[0].Fingerprint, drift[1].Fingerprint)
+
+	varchar, text, index := "character varying(100)", "text", "CREATE INDEX idx_orders_notes ON orders USING btree (notes)"
+	pkey := "PRIMARY KEY (id)"
+	assert.Equal(t, []types.SchemaObjectDiff{
+		{Type: "column", Name: "orders.notes", Expected: &varchar, Actual: &text},
+		{Type: "constraint", Name: "orders.orders_pkey", Expected: &pkey},
+		{Type: "index", Name: "orders.idx_orders_notes", Actual: &index},
+	}, drift[1].Differences)
+}
+
+func TestSchemaDriftSkipsArchivedTenants(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedArchivedTenantConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	drift, err := coordinator.SchemaDrift()
+	assert.Nil(t, err)
+	assert.Len(t, drift, 1)
+	assert.Equal(t, []string{"a", "c"}, drift[0].Tenants)
+}
+
+func TestComputeSchemaDriftNoTenants(t *testing.T) {
+	coordinator := &coordinator{}
+	assert.Empty(t, coordinator.computeSchemaDrift([]types.SchemaFingerprint{}))
+}
+
+func TestVersionSchemaDiff(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	diffs, err := coordinator.VersionSchemaDiff(101, 102)
+	assert.Nil(t, err)
+	// config schema did not change
+	assert.Len(t, diffs, 2)
+
+	// tenant snapshots are compared even though different tenants were captured
+	assert.Equal(t, types.MigrationTypeTenantMigration, diffs[0].MigrationType)
+	assert.Equal(t, "a", *diffs[0].FromSchema)
+	assert.Equal(t, "b", *diffs[0].ToSchema)
+	numeric := "numeric"
+	assert.Equal(t, []types.SchemaObjectDiff{{Type: "column", Name: "orders.total", Actual: &numeric}}, diffs[0].Differences)
+
+	// new single schema
+	assert.Equal(t, types.MigrationTypeSingleMigration, diffs[1].MigrationType)
+	assert.Nil(t, diffs[1].FromSchema)
+	assert.Equal(t, "ref", *diffs[1].ToSchema)
+	assert.Len(t, diffs[1].Differences, 1)
+
+	// reversed diff follows order of snapshots of the from version
+	diffs, err = coordinator.VersionSchemaDiff(102, 101)
+	assert.Nil(t, err)
+	assert.Len(t, diffs, 2)
+	assert.Equal(t, "ref", *diffs[0].FromSchema)
+	assert.Nil(t, diffs[0].ToSchema)
+	assert.Equal(t, []types.SchemaObjectDiff{{Type: "column", Name: "orders.total", Expected: &numeric}}, diffs[1].Differences)
+
+	// same version
+	diffs, err = coordinator.VersionSchemaDiff(101, 101)
+	assert.Nil(t, err)
+	assert.Empty(t, diffs)
+}
+
+func TestVersionSchemaDiffNoSnapshot(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	_, err := coordinator.VersionSchemaDiff(101, 5)
+	var notFound *types.NotFoundError
+	assert.True(t, errors.As(err, &notFound))
+	assert.Equal(t, "schema snapshot not found: 5", err.Error())
+}
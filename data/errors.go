@@ -0,0 +1,87 @@
+package data
+
+import (
+	"errors"
+
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// error codes returned in GraphQL errors as extensions.code
+const (
+	errorCodeNotFound         = "NOT_FOUND"
+	errorCodeChecksumMismatch = "CHECKSUM_MISMATCH"
+	errorCodeOutOfOrder       = "OUT_OF_ORDER"
+	errorCodeSQLFailure       = "SQL_FAILURE"
+	errorCodeTemplateError    = "TEMPLATE_ERROR"
+	errorCodeLockTimeout      = "LOCK_TIMEOUT"
+	errorCodeInvalidArgument  = "INVALID_ARGUMENT"
+	errorCodePlanChanged      = "PLAN_CHANGED"
+	errorCodeInternal         = "INTERNAL_ERROR"
+)
+
+// resolverError is returned by resolvers, graphql-go renders extensions returned by Extensions() in the response
+type resolverError struct {
+	err        error
+	extensions map[string]interface{}
+}
+
+func (e *resolverError) Error() string {
+	return e.err.Error()
+}
+
+func (e *resolverError) Unwrap() error {
+	return e.err
+}
+
+func (e *resolverError) Extensions() map[string]interface{} {
+	return e.extensions
+}
+
+// toResolverError maps errors returned by coordinator to GraphQL errors with extensions.code set
+func toResolverError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var notFound *types.NotFoundError
+	var checksumMismatch *types.ChecksumMismatchError
+	var outOfOrder *types.OutOfOrderError
+	var sqlError *types.SQLError
+	var templateError *types.TemplateError
+	var lockTimeout *types.LockTimeoutError
+	var invalidArgument *types.InvalidArgumentError
+	var planChanged *types.PlanChangedError
+
+	extensions := map[string]interface{}{}
+	switch {
+	case errors.As(err, &notFound):
+		extensions["code"] = errorCodeNotFound
+	case errors.As(err, &checksumMismatch):
+		extensions["code"] = errorCodeChecksumMismatch
+		extensions["files"] = checksumMismatch.Files()
+	case errors.As(err, &outOfOrder):
+		extensions["code"] = errorCodeOutOfOrder
+		extensions["files"] = outOfOrder.Files()
+	case errors.As(err, &sqlError):
+		extensions["code"] = errorCodeSQLFailure
+		extensions["file"] = sqlError.File
+		extensions["schema"] = sqlError.Schema
+	case errors.As(err, &templateError):
+		extensions["code"] = errorCodeTemplateError
+		extensions["file"] = templateError.File
+		extensions["schema"] = templateError.Schema
+	case errors.As(err, &lockTimeout):
+		extensions["code"] = errorCodeLockTimeout
+	case errors.As(err, &invalidArgument):
+		extensions["code"] = errorCodeInvalidArgument
+		extensions["argument"] = invalidArgument.Argument
+	case errors.As(err, &planChanged):
+		extensions["code"] = errorCodePlanChanged
+		extensions["expected"] = planChanged.Expected
+		extensions["actual"] = planChanged.Actual
+	default:
+		extensions["code"] = errorCodeInternal
+	}
+
+	return &resolverError{err: err, extensions: extensions}
+}
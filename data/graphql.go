@@ -1,6 +1,9 @@
 package data
 
 import (
+	"errors"
+
+	"github.com/lukaszbudnik/migrator/config"
 	"github.com/lukaszbudnik/migrator/coordinator"
 	"github.com/lukaszbudnik/migrator/types"
 )
@@ -41,6 +44,12 @@ type SourceMigration implements Migration {
   file: String!
   contents: String!
   checkSum: String!
+  // set by the "-- migrator: transaction=false" directive, migration is executed outside of the version transaction
+  noTransaction: Boolean!
+  // pending migration which sorts before already applied migrations, see outOfOrder config option
+  outOfOrder: Boolean!
+  // script from one of onChangeScripts directories, applied only when its checksum changed
+  onChange: Boolean!
 }
 type DBMigration implements Migration {
   id: Int!
@@ -55,12 +64,24 @@ type DBMigration implements Migration {
 }
 type Tenant {
   name: String!
+  labels: [TenantLabel!]!
+  archived: Boolean!
+}
+type TenantLabel {
+  key: String!
+  value: String!
+}
+input TenantLabelInput {
+  key: String!
+  value: String!
 }
 type Version {
   id: Int!
   name: String!
   created: Time!
   dbMigrations: [DBMigration!]!
+  // empty unless schemaSnapshots config option was enabled when the version was created
+  schemaSnapshot: [SchemaSnapshot!]!
 }
 input SourceMigrationFilters {
   name: String
@@ -72,12 +93,21 @@ input VersionInput {
   versionName: String!
   action: Action = Apply
   dryRun: Boolean = false
+  // label selector, when provided tenant migrations are applied only to matching tenants, for example: canary=true
+  selector: String
+  // when true the version is created in the background and job is returned straight away, use job(id: Int!) to poll its status
+  async: Boolean = false
+  // hash returned by plan(), when provided version is refused if source migrations or tenants changed since the plan was made
+  planHash: String
 }
 input TenantInput {
   tenantName: String!
   versionName: String!
   action: Action = Apply
   dryRun: Boolean = false
+  labels: [TenantLabelInput!]
+  // when true the tenant is created in the background and job is returned straight away, use job(id: Int!) to poll its status
+  async: Boolean = false
 }
 type Summary {
   // date time operation started
@@ -102,109 +132,550 @@ type Summary {
   tenantScriptsTotal: Int!
   // sum of singleScripts and tenantScriptsTotal
   scriptsGrandTotal: Int!
+  // number of on-change scripts (for all schemas) not applied because their checksums did not change
+  scriptsSkipped: Int!
+  // tenants committed successfully, empty unless perTenantTransactions is enabled
+  succeededTenants: [String!]!
+  // tenants rolled back together with the errors, empty unless perTenantTransactions is enabled
+  // the next createVersion applies pending migrations only to the failed tenants
+  failedTenants: [TenantFailure!]!
+  // how long migrations of every tenant took, empty unless perTenantTransactions is enabled or tenantConcurrency is greater than 1
+  tenantDurations: [TenantDuration!]!
+  // files executed outside of the version transaction, changes made by them cannot be rolled back
+  // in dry-run mode these files are not executed
+  nonTransactional: [String!]!
+}
+type TenantFailure {
+  tenant: String!
+  error: String!
+}
+type TenantDuration {
+  tenant: String!
+  // in seconds
+  duration: Float!
+}
+type ChecksumMismatch {
+  file: String!
+  // checksum of the source migration
+  sourceCheckSum: String!
+  // checksum recorded when the migration was applied
+  appliedCheckSum: String!
+  // versions in which the migration was applied
+  versions: [Version!]!
+  // unified diff between applied and source contents
+  diff: String!
+}
+type PlannedMigration {
+  file: String!
+  migrationType: MigrationType!
+  checkSum: String!
+  // script from one of onChangeScripts directories whose checksum changed
+  onChange: Boolean!
+}
+type SchemaPlan {
+  schema: String!
+  // migrations in the order in which they would be applied
+  migrations: [PlannedMigration!]!
+}
+type Plan {
+  // pass it to createVersion as planHash to refuse the version when source migrations or tenants changed
+  hash: String!
+  // number of planned migrations, scripts are applied by every version and are not counted
+  pending: Int!
+  singleSchemas: [SchemaPlan!]!
+  tenants: [SchemaPlan!]!
+}
+type SchemaDrift {
+  // fingerprint of tables, columns, indexes, and constraints shared by all tenants in the group
+  fingerprint: String!
+  tenants: [String!]!
+  // true for the group with the most tenants, differences of other groups are computed against it
+  majority: Boolean!
+  // number of schema objects
+  objects: Int!
+  differences: [SchemaObjectDiff!]!
+}
+type SchemaObjectDiff {
+  // table, column, index, or constraint (collection or index on MongoDB)
+  type: String!
+  // object name qualified with table name, schema name is never included
+  name: String!
+  // definition in the majority group (or in the from version), null when the object is missing there
+  expected: String
+  // definition in the group (or in the to version), null when the object is missing there
+  actual: String
+}
+type SchemaObject {
+  type: String!
+  name: String!
+  definition: String!
+}
+type SchemaSnapshot {
+  schema: String!
+  // SingleMigration for single schemas, TenantMigration for the representative tenant
+  migrationType: MigrationType!
+  fingerprint: String!
+  objects: [SchemaObject!]!
+}
+type SchemaSnapshotDiff {
+  migrationType: MigrationType!
+  // null when the schema was not captured in the from version
+  fromSchema: String
+  // null when the schema was not captured in the to version
+  toSchema: String
+  differences: [SchemaObjectDiff!]!
+}
+type ChecksumRepair {
+  file: String!
+  oldCheckSum: String!
+  newCheckSum: String!
+  oldContents: String!
+  newContents: String!
+  reason: String!
+  // number of schemas in which the migration was repaired
+  schemas: Int!
+}
+enum JobStatus {
+  Queued
+  Running
+  Succeeded
+  Failed
+}
+type Job {
+  id: Int!
+  // createVersion or createTenant
+  operation: String!
+  // version name
+  name: String!
+  status: JobStatus!
+  // number of migrations applied so far out of total, a migration applied to N schemas counts N times
+  applied: Int!
+  total: Int!
+  // set when job succeeded
+  summary: Summary
+  // set when job failed, a running job which owner stopped storing heartbeats is marked as failed when it is polled
+  error: String
+  // migrator instance which runs the job
+  owner: String
+  // time when owner of the running job last reported it is alive
+  heartbeat: Time
+  created: Time!
+  updated: Time!
 }
 type CreateResults {
+  // empty when operation is run asynchronously, summary of the job is available in job(id: Int!) once it succeeds
   summary: Summary!
   version: Version
+  // set only when operation is run asynchronously
+  job: Job
 }
+// every query and mutation accepts optional target argument which is the name of a target defined in targets section of config
+// when target is not passed the default target (top-level driver and dataSource) is used
 type Query {
   // returns array of SourceMigration objects
   // all parameters are optional and can be used to filter source migrations
   // note that if the input query includes "contents" field this operation can produce large amounts of data 
   // if you want to return "contents" field it may be better to get individual source migrations using sourceMigration(file: String!)
-  sourceMigrations(filters: SourceMigrationFilters): [SourceMigration!]!
+  sourceMigrations(filters: SourceMigrationFilters, target: String): [SourceMigration!]!
   // returns a single SourceMigration
   // this operation can be used to fetch a complete SourceMigration including "contents" field
   // file is the unique identifier for a source migration file which you can get from sourceMigrations()
-  sourceMigration(file: String!): SourceMigration
+  sourceMigration(file: String!, target: String): SourceMigration
   // returns array of Version objects
   // file is optional and can be used to return versions in which given source migration file was applied
   // note that if input query includes DBMigration array and "contents" field this operation can produce large amounts of data
   // if you want to return "contents" field it may be better to get individual versions using either 
   // version(id: Int!) or even get individual DB migration using dbMigration(id: Int!)
-  versions(file: String): [Version!]!
+  versions(file: String, target: String): [Version!]!
   // returns a single Version
   // id is the unique identifier of a version which you can get from versions()
   // note that if input query includes "contents" field this operation can produce large amounts of data
   // if you want to return "contents" field it may be better to get individual DB migration using dbMigration(id: Int!)
-  version(id: Int!): Version
+  version(id: Int!, target: String): Version
   // returns a single DBMigration
   // this operation can be used to fetch a complete DBMigration including "contents" field
   // id is the unique identifier of a DB migration which you can get from versions(file: String) or version(id: Int!)
-  dbMigration(id: Int!): DBMigration
+  dbMigration(id: Int!, target: String): DBMigration
   // returns array of Tenant objects
-  tenants(): [Tenant!]!
+  // selector is a comma-separated list of label requirements: key=value, key!=value, key (label exists), !key (label does not exist)
+  tenants(selector: String, target: String): [Tenant!]!
+  // returns source migrations which were modified after they had been applied, empty array means all checksums match
+  // scripts are skipped as they are applied every time and are often updated
+  verifyChecksums(target: String): [ChecksumMismatch!]!
+  // returns migrations & scripts which createVersion would apply to every single schema and every tenant, together with plan hash
+  // selector is optional and has the same format as in tenants(selector: String)
+  plan(selector: String, target: String): Plan!
+  // groups active tenants by fingerprints of their schemas read from DB catalog and shows objects which differ from the majority
+  schemaDrift(target: String): [SchemaDrift!]!
+  // returns structural changes between schema snapshots captured by two versions, only changed schemas are returned
+  versionSchemaDiff(from: Int!, to: Int!, target: String): [SchemaSnapshotDiff!]!
+  // returns a single asynchronous Job, jobs are stored in DB and can be polled from any migrator instance
+  // id is the unique identifier of a job which you can get from createVersion or createTenant called with async: true
+  job(id: Int!, target: String): Job
 }
 type Mutation {
   // creates new DB version by applying all eligible DB migrations & scripts
-  createVersion(input: VersionInput!): CreateResults!
+  createVersion(input: VersionInput!, target: String): CreateResults!
   // creates new tenant by applying only tenant-specific DB migrations & scripts, also creates new DB version
-  createTenant(input: TenantInput!): CreateResults!
+  createTenant(input: TenantInput!, target: String): CreateResults!
+  // creates new DB version in which source migrations up to and including upTo are marked as applied without executing them
+  // upTo is a source migration name, newer source migrations stay pending, scripts are skipped
+  // tenants is optional, by default tenant migrations are marked as applied for all active tenants
+  // baseline is refused when migrations which sort after upTo were already applied
+  baseline(upTo: String!, tenants: [String!], dryRun: Boolean = false, target: String): CreateResults!
+  // rolls back DB version by executing down migrations in reverse order and removes the version from DB
+  // every DB migration recorded in the version must have a down migration (for example 201602160003.down.sql)
+  // scripts without down migrations are skipped, returned summary contains the numbers of rolled back migrations & scripts
+  rollbackVersion(id: Int!, dryRun: Boolean = false, target: String): CreateResults!
+  // replaces contents and checksums of applied DB migrations in all schemas with the ones of source migrations
+  // files are source migration files to repair, if files are not provided all migrations reported by verifyChecksums are repaired
+  // old and new values together with the reason are recorded in the checksum repairs audit table
+  repairChecksums(files: [String!], reason: String!, target: String): [ChecksumRepair!]!
+  // replaces all labels of an existing tenant
+  setTenantLabels(tenant: String!, labels: [TenantLabelInput!]!, target: String): Tenant!
+  // archives tenant, archived tenants are skipped by createVersion, tenant schema and its DB migrations are kept
+  archiveTenant(name: String!, target: String): CreateResults!
+  // drops tenant schema and removes tenant together with its DB migrations and labels
+  // in dry-run mode tenant schema is not dropped and all other changes are rolled back
+  dropTenant(name: String!, dryRun: Boolean = false, target: String): CreateResults!
+  // renames tenant schema and updates tenant name in tenants, DB migrations and labels
+  renameTenant(from: String!, to: String!, target: String): CreateResults!
 }
 `
 
 // RootResolver is resolver for all the migrator data
 type RootResolver struct {
+	// Coordinator is used for the default target, it is nil when config defines only named targets
 	Coordinator coordinator.Coordinator
+	// Targets are coordinators of named targets
+	Targets map[string]coordinator.Coordinator
+}
+
+// coordinator returns coordinator of the target passed in GraphQL arguments, default target is used when target is not passed
+func (r *RootResolver) coordinator(target *string) (coordinator.Coordinator, error) {
+	if target == nil || *target == "" || *target == config.DefaultTarget {
+		if r.Coordinator == nil {
+			return nil, &types.InvalidArgumentError{Argument: "target", Err: errors.New("target is required, default target is not configured")}
+		}
+		return r.Coordinator, nil
+	}
+	c, ok := r.Targets[*target]
+	if !ok {
+		return nil, &types.NotFoundError{Resource: "target", ID: *target}
+	}
+	return c, nil
 }
 
-// Tenants resolves all tenants
-func (r *RootResolver) Tenants() ([]types.Tenant, error) {
-	tenants := r.Coordinator.GetTenants()
-	return tenants, nil
+// Tenants resolves all tenants, optionally only tenants matching label selector
+func (r *RootResolver) Tenants(args struct {
+	Selector *string
+	Target   *string
+}) ([]types.Tenant, error) {
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	var selector string
+	if args.Selector != nil {
+		selector = *args.Selector
+	}
+	tenants, err := c.GetTenants(selector)
+	return tenants, toResolverError(err)
 }
 
 // Versions resoves all versions, optionally can return versions with specific source migration (file is the identifier for source migrations)
 func (r *RootResolver) Versions(args struct {
-	File *string
+	File   *string
+	Target *string
 }) ([]types.Version, error) {
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
 	if args.File != nil {
-		return r.Coordinator.GetVersionsByFile(*args.File), nil
+		versions, err := c.GetVersionsByFile(*args.File)
+		return versions, toResolverError(err)
 	}
-	return r.Coordinator.GetVersions(), nil
+	versions, err := c.GetVersions()
+	return versions, toResolverError(err)
 }
 
 // Version resolves version by ID
 func (r *RootResolver) Version(args struct {
-	ID int32
+	ID     int32
+	Target *string
 }) (*types.Version, error) {
-	return r.Coordinator.GetVersionByID(args.ID)
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	version, err := c.GetVersionByID(args.ID)
+	return version, toResolverError(err)
 }
 
 // SourceMigrations resolves source migrations using optional filters
 func (r *RootResolver) SourceMigrations(args struct {
 	Filters *coordinator.SourceMigrationFilters
+	Target  *string
 }) ([]types.Migration, error) {
-	sourceMigrations := r.Coordinator.GetSourceMigrations(args.Filters)
-	return sourceMigrations, nil
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	sourceMigrations, err := c.GetSourceMigrations(args.Filters)
+	return sourceMigrations, toResolverError(err)
 }
 
 // SourceMigration resolves source migration by its file name
 func (r *RootResolver) SourceMigration(args struct {
-	File string
+	File   string
+	Target *string
 }) (*types.Migration, error) {
-	return r.Coordinator.GetSourceMigrationByFile(args.File)
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	sourceMigration, err := c.GetSourceMigrationByFile(args.File)
+	return sourceMigration, toResolverError(err)
 }
 
 // DBMigration resolves DB migration by ID
 func (r *RootResolver) DBMigration(args struct {
-	ID int32
+	ID     int32
+	Target *string
 }) (*types.DBMigration, error) {
-	return r.Coordinator.GetDBMigrationByID(args.ID)
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	dbMigration, err := c.GetDBMigrationByID(args.ID)
+	return dbMigration, toResolverError(err)
+}
+
+// Job resolves asynchronous job by its ID
+func (r *RootResolver) Job(args struct {
+	ID     int32
+	Target *string
+}) (*types.Job, error) {
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	job, err := c.GetJobByID(args.ID)
+	return job, toResolverError(err)
+}
+
+// VerifyChecksums resolves source migrations modified after they had been applied
+func (r *RootResolver) VerifyChecksums(args struct {
+	Target *string
+}) ([]types.ChecksumMismatch, error) {
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	mismatches, err := c.VerifyChecksums()
+	return mismatches, toResolverError(err)
+}
+
+// Plan resolves migrations which createVersion would apply
+func (r *RootResolver) Plan(args struct {
+	Selector *string
+	Target   *string
+}) (*types.Plan, error) {
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	var selector string
+	if args.Selector != nil {
+		selector = *args.Selector
+	}
+	plan, err := c.Plan(selector)
+	return plan, toResolverError(err)
+}
+
+// SchemaDrift resolves tenants grouped by fingerprints of their schemas
+func (r *RootResolver) SchemaDrift(args struct {
+	Target *string
+}) ([]types.SchemaDrift, error) {
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	drift, err := c.SchemaDrift()
+	return drift, toResolverError(err)
+}
+
+// VersionSchemaDiff resolves structural changes between schema snapshots of two versions
+func (r *RootResolver) VersionSchemaDiff(args struct {
+	From   int32
+	To     int32
+	Target *string
+}) ([]types.SchemaSnapshotDiff, error) {
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	diffs, err := c.VersionSchemaDiff(args.From, args.To)
+	return diffs, toResolverError(err)
 }
 
 // CreateVersion creates new DB version
 func (r *RootResolver) CreateVersion(args struct {
-	Input types.VersionInput
+	Input  types.VersionInput
+	Target *string
 }) (*types.CreateResults, error) {
-	results := r.Coordinator.CreateVersion(args.Input.VersionName, args.Input.Action, args.Input.DryRun)
-	return results, nil
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	var selector string
+	if args.Input.Selector != nil {
+		selector = *args.Input.Selector
+	}
+	var planHash string
+	if args.Input.PlanHash != nil {
+		planHash = *args.Input.PlanHash
+	}
+	if args.Input.Async {
+		job, err := c.CreateVersionJob(args.Input.VersionName, args.Input.Action, args.Input.DryRun, selector, planHash)
+		return asyncResults(job), toResolverError(err)
+	}
+	results, err := c.CreateVersion(args.Input.VersionName, args.Input.Action, args.Input.DryRun, selector, planHash)
+	return results, toResolverError(err)
 }
 
 // CreateTenant creates new tenant
 func (r *RootResolver) CreateTenant(args struct {
-	Input types.TenantInput
+	Input  types.TenantInput
+	Target *string
+}) (*types.CreateResults, error) {
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	var labels []types.TenantLabel
+	if args.Input.Labels != nil {
+		labels = *args.Input.Labels
+	}
+	if args.Input.Async {
+		job, err := c.CreateTenantJob(args.Input.VersionName, args.Input.Action, args.Input.DryRun, args.Input.TenantName, labels)
+		return asyncResults(job), toResolverError(err)
+	}
+	results, err := c.CreateTenant(args.Input.VersionName, args.Input.Action, args.Input.DryRun, args.Input.TenantName, labels)
+	return results, toResolverError(err)
+}
+
+// asyncResults returns results of an operation run asynchronously, summary is empty as nothing was applied yet
+func asyncResults(job *types.Job) *types.CreateResults {
+	if job == nil {
+		return nil
+	}
+	return &types.CreateResults{Summary: &types.Summary{StartedAt: job.Created}, Job: job}
+}
+
+// RollbackVersion rolls back DB version
+func (r *RootResolver) RollbackVersion(args struct {
+	ID     int32
+	DryRun bool
+	Target *string
+}) (*types.CreateResults, error) {
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	results, err := c.RollbackVersion(args.ID, args.DryRun)
+	return results, toResolverError(err)
+}
+
+// Baseline marks source migrations up to a given name as applied without executing them
+func (r *RootResolver) Baseline(args struct {
+	UpTo    string
+	Tenants *[]string
+	DryRun  bool
+	Target  *string
+}) (*types.CreateResults, error) {
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	var tenants []string
+	if args.Tenants != nil {
+		tenants = *args.Tenants
+	}
+	results, err := c.Baseline(args.UpTo, tenants, args.DryRun)
+	return results, toResolverError(err)
+}
+
+// RepairChecksums replaces contents and checksums of applied DB migrations with the ones of source migrations
+func (r *RootResolver) RepairChecksums(args struct {
+	Files  *[]string
+	Reason string
+	Target *string
+}) ([]types.ChecksumRepair, error) {
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	var files []string
+	if args.Files != nil {
+		files = *args.Files
+	}
+	repairs, err := c.RepairChecksums(files, args.Reason)
+	return repairs, toResolverError(err)
+}
+
+// SetTenantLabels replaces all labels of an existing tenant
+func (r *RootResolver) SetTenantLabels(args struct {
+	Tenant string
+	Labels []types.TenantLabel
+	Target *string
+}) (*types.Tenant, error) {
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	tenant, err := c.SetTenantLabels(args.Tenant, args.Labels)
+	return tenant, toResolverError(err)
+}
+
+// ArchiveTenant archives tenant
+func (r *RootResolver) ArchiveTenant(args struct {
+	Name   string
+	Target *string
+}) (*types.CreateResults, error) {
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	results, err := c.ArchiveTenant(args.Name)
+	return results, toResolverError(err)
+}
+
+// DropTenant drops tenant schema and removes tenant
+func (r *RootResolver) DropTenant(args struct {
+	Name   string
+	DryRun bool
+	Target *string
+}) (*types.CreateResults, error) {
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	results, err := c.DropTenant(args.Name, args.DryRun)
+	return results, toResolverError(err)
+}
+
+// RenameTenant renames tenant schema and tenant
+func (r *RootResolver) RenameTenant(args struct {
+	From   string
+	To     string
+	Target *string
 }) (*types.CreateResults, error) {
-	results := r.Coordinator.CreateTenant(args.Input.VersionName, args.Input.Action, args.Input.DryRun, args.Input.TenantName)
-	return results, nil
+	c, err := r.coordinator(args.Target)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	results, err := c.RenameTenant(args.From, args.To)
+	return results, toResolverError(err)
 }
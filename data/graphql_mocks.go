@@ -1,6 +1,8 @@
 package data
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -19,18 +21,48 @@ func (m *mockedCoordinator) safeString(value *string) string {
 	return *value
 }
 
-func (m *mockedCoordinator) CreateTenant(string, types.Action, bool, string) *types.CreateResults {
+func (m *mockedCoordinator) CreateTenant(string, types.Action, bool, string, []types.TenantLabel) (*types.CreateResults, error) {
 	version, _ := m.GetVersionByID(0)
-	return &types.CreateResults{Summary: &types.Summary{}, Version: version}
+	return &types.CreateResults{Summary: &types.Summary{}, Version: version}, nil
 }
 
-func (m *mockedCoordinator) CreateVersion(string, types.Action, bool) *types.CreateResults {
+func (m *mockedCoordinator) Plan(string) (*types.Plan, error) {
+	single := types.SchemaPlan{Schema: "config", Migrations: []types.PlannedMigration{{File: "config/201602220001.sql", MigrationType: types.MigrationTypeSingleMigration, CheckSum: "sha256-1"}, {File: "config-scripts/views.sql", MigrationType: types.MigrationTypeSingleScript, CheckSum: "sha256-2"}}}
+	tenant := types.SchemaPlan{Schema: "abc", Migrations: []types.PlannedMigration{{File: "tenant/201602220003.sql", MigrationType: types.MigrationTypeTenantMigration, CheckSum: "sha256-3"}}}
+	return &types.Plan{Hash: "0a1b2c", SingleSchemas: []types.SchemaPlan{single}, Tenants: []types.SchemaPlan{tenant}}, nil
+}
+
+func (m *mockedCoordinator) CreateVersion(string, types.Action, bool, string, string) (*types.CreateResults, error) {
 	// re-use mocked version from GetVersionByID...
 	version, _ := m.GetVersionByID(0)
-	return &types.CreateResults{Summary: &types.Summary{}, Version: version}
+	summary := &types.Summary{SucceededTenants: []string{"abc"}, FailedTenants: []types.TenantFailure{{Tenant: "def", Error: "trouble maker"}}, TenantDurations: []types.TenantDuration{{Tenant: "abc", Duration: 0.5}, {Tenant: "def", Duration: 0.25}}, NonTransactional: []string{"tenants/202001010000.sql"}}
+	return &types.CreateResults{Summary: summary, Version: version}, nil
+}
+
+func (m *mockedCoordinator) CreateTenantJob(versionName string, action types.Action, dryRun bool, tenant string, labels []types.TenantLabel) (*types.Job, error) {
+	d := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	return &types.Job{ID: 1, Operation: types.JobOperationCreateTenant, Name: versionName, Status: types.JobStatusQueued, Created: graphql.Time{Time: d}, Updated: graphql.Time{Time: d}}, nil
+}
+
+func (m *mockedCoordinator) CreateVersionJob(versionName string, action types.Action, dryRun bool, selector string, planHash string) (*types.Job, error) {
+	d := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	return &types.Job{ID: 1, Operation: types.JobOperationCreateVersion, Name: versionName, Status: types.JobStatusQueued, Created: graphql.Time{Time: d}, Updated: graphql.Time{Time: d}}, nil
+}
+
+func (m *mockedCoordinator) GetJobByID(ID int32) (*types.Job, error) {
+	if ID != 1 {
+		return nil, &types.NotFoundError{Resource: "job", ID: fmt.Sprint(ID)}
+	}
+	d := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	return &types.Job{ID: ID, Operation: types.JobOperationCreateVersion, Name: "commit-sha", Status: types.JobStatusSucceeded, Applied: 3, Total: 3, Summary: &types.Summary{MigrationsGrandTotal: 3}, Created: graphql.Time{Time: d}, Updated: graphql.Time{Time: d}}, nil
+}
+
+func (m *mockedCoordinator) RollbackVersion(ID int32, dryRun bool) (*types.CreateResults, error) {
+	version, _ := m.GetVersionByID(ID)
+	return &types.CreateResults{Summary: &types.Summary{VersionID: ID}, Version: version}, nil
 }
 
-func (m *mockedCoordinator) GetSourceMigrations(filters *coordinator.SourceMigrationFilters) []types.Migration {
+func (m *mockedCoordinator) GetSourceMigrations(filters *coordinator.SourceMigrationFilters) ([]types.Migration, error) {
 
 	if filters == nil {
 		m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
@@ -38,11 +70,11 @@ func (m *mockedCoordinator) GetSourceMigrations(filters *coordinator.SourceMigra
 		m3 := types.Migration{Name: "201602220001.sql", SourceDir: "config", File: "config/201602220001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select def"}
 		m4 := types.Migration{Name: "201602220002.sql", SourceDir: "source", File: "source/201602220002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select def"}
 		m5 := types.Migration{Name: "201602220003.sql", SourceDir: "tenant", File: "tenant/201602220003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "select def"}
-		return []types.Migration{m1, m2, m3, m4, m5}
+		return []types.Migration{m1, m2, m3, m4, m5}, nil
 	}
 
 	m1 := types.Migration{Name: m.safeString(filters.Name), SourceDir: m.safeString(filters.SourceDir), File: m.safeString(filters.File), MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
-	return []types.Migration{m1}
+	return []types.Migration{m1}, nil
 }
 
 func (m *mockedCoordinator) GetSourceMigrationByFile(file string) (*types.Migration, error) {
@@ -56,23 +88,53 @@ func (m *mockedCoordinator) GetSourceMigrationByFile(file string) (*types.Migrat
 func (m *mockedCoordinator) Dispose() {
 }
 
-func (m *mockedCoordinator) GetTenants() []types.Tenant {
-	a := types.Tenant{Name: "a"}
-	b := types.Tenant{Name: "b"}
-	c := types.Tenant{Name: "c"}
-	return []types.Tenant{a, b, c}
+func (m *mockedCoordinator) GetTenants(selector string) ([]types.Tenant, error) {
+	a := types.Tenant{Name: "a", Labels: []types.TenantLabel{{Key: "canary", Value: "true"}}}
+	b := types.Tenant{Name: "b", Labels: []types.TenantLabel{}}
+	c := types.Tenant{Name: "c", Labels: []types.TenantLabel{}}
+	labelSelector, err := types.ParseLabelSelector(selector)
+	if err != nil {
+		return nil, &types.InvalidArgumentError{Argument: "selector", Err: err}
+	}
+	tenants := []types.Tenant{}
+	for _, t := range []types.Tenant{a, b, c} {
+		if labelSelector.Matches(t.Labels) {
+			tenants = append(tenants, t)
+		}
+	}
+	return tenants, nil
+}
+
+func (m *mockedCoordinator) SetTenantLabels(tenant string, labels []types.TenantLabel) (*types.Tenant, error) {
+	return &types.Tenant{Name: tenant, Labels: labels}, nil
+}
+
+func (m *mockedCoordinator) ArchiveTenant(name string) (*types.CreateResults, error) {
+	return &types.CreateResults{Summary: &types.Summary{Tenants: 1}, Version: &types.Version{ID: 123, Name: "Archive tenant " + name}}, nil
+}
+
+func (m *mockedCoordinator) Baseline(upTo string, tenants []string, dryRun bool) (*types.CreateResults, error) {
+	return &types.CreateResults{Summary: &types.Summary{SingleMigrations: 2, Tenants: int32(len(tenants))}, Version: &types.Version{ID: 125, Name: "Baseline up to " + upTo}}, nil
+}
+
+func (m *mockedCoordinator) DropTenant(name string, dryRun bool) (*types.CreateResults, error) {
+	return &types.CreateResults{Summary: &types.Summary{Tenants: 1}, Version: &types.Version{ID: 124, Name: "Drop tenant " + name}}, nil
 }
 
-func (m *mockedCoordinator) GetVersions() []types.Version {
+func (m *mockedCoordinator) RenameTenant(from, to string) (*types.CreateResults, error) {
+	return &types.CreateResults{Summary: &types.Summary{Tenants: 1}, Version: &types.Version{ID: 125, Name: "Rename tenant " + from + " to " + to}}, nil
+}
+
+func (m *mockedCoordinator) GetVersions() ([]types.Version, error) {
 	a := types.Version{ID: 12, Name: "a", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -2)}}
 	b := types.Version{ID: 121, Name: "bb", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -1)}}
 	c := types.Version{ID: 122, Name: "ccc", Created: graphql.Time{Time: time.Now()}}
-	return []types.Version{a, b, c}
+	return []types.Version{a, b, c}, nil
 }
 
-func (m *mockedCoordinator) GetVersionsByFile(file string) []types.Version {
+func (m *mockedCoordinator) GetVersionsByFile(file string) ([]types.Version, error) {
 	a := types.Version{ID: 12, Name: "a", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -2)}}
-	return []types.Version{a}
+	return []types.Version{a}, nil
 }
 
 func (m *mockedCoordinator) GetVersionByID(ID int32) (*types.Version, error) {
@@ -96,8 +158,8 @@ func (m *mockedCoordinator) GetVersionByID(ID int32) (*types.Version, error) {
 }
 
 // not used in GraphQL
-func (m *mockedCoordinator) GetAppliedMigrations() []types.DBMigration {
-	return []types.DBMigration{}
+func (m *mockedCoordinator) GetAppliedMigrations() ([]types.DBMigration, error) {
+	return []types.DBMigration{}, nil
 }
 
 func (m *mockedCoordinator) GetDBMigrationByID(ID int32) (*types.DBMigration, error) {
@@ -107,10 +169,88 @@ func (m *mockedCoordinator) GetDBMigrationByID(ID int32) (*types.DBMigration, er
 	return &db, nil
 }
 
-func (m *mockedCoordinator) VerifySourceMigrationsCheckSums() (bool, []types.Migration) {
-	return true, nil
+func (m *mockedCoordinator) VerifySourceMigrationsCheckSums() (bool, []types.Migration, error) {
+	return true, nil, nil
+}
+
+func (m *mockedCoordinator) VerifyChecksums() ([]types.ChecksumMismatch, error) {
+	version, _ := m.GetVersionByID(12)
+	diff := "--- source/201602220000.sql\tapplied\n+++ source/201602220000.sql\tsource\n@@ -1 +1 @@\n-select abc\n+select abcd\n"
+	return []types.ChecksumMismatch{{File: "source/201602220000.sql", SourceCheckSum: "sha256-2", AppliedCheckSum: "sha256-1", Versions: []types.Version{*version}, Diff: diff}}, nil
+}
+
+func (m *mockedCoordinator) VersionSchemaDiff(from int32, to int32) ([]types.SchemaSnapshotDiff, error) {
+	fromSchema, toSchema, actual := "abc", "def", "numeric"
+	return []types.SchemaSnapshotDiff{
+		{MigrationType: types.MigrationTypeTenantMigration, FromSchema: &fromSchema, ToSchema: &toSchema, Differences: []types.SchemaObjectDiff{
+			{Type: "column", Name: "orders.total", Actual: &actual},
+		}},
+	}, nil
+}
+
+func (m *mockedCoordinator) SchemaDrift() ([]types.SchemaDrift, error) {
+	expected, actual, index := "integer not null", "bigint not null", "CREATE INDEX idx_orders_created ON orders USING btree (created)"
+	return []types.SchemaDrift{
+		{Fingerprint: "f1", Tenants: []string{"abc", "def"}, Majority: true, Objects: 12, Differences: []types.SchemaObjectDiff{}},
+		{Fingerprint: "f2", Tenants: []string{"xyz"}, Objects: 13, Differences: []types.SchemaObjectDiff{
+			{Type: "column", Name: "orders.id", Expected: &expected, Actual: &actual},
+			{Type: "index", Name: "orders.idx_orders_created", Actual: &index},
+		}},
+	}, nil
+}
+
+func (m *mockedCoordinator) RepairChecksums(files []string, reason string) ([]types.ChecksumRepair, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, &types.InvalidArgumentError{Argument: "reason", Err: errors.New("reason for checksum repair must not be empty")}
+	}
+	if files == nil {
+		files = []string{"source/201602220000.sql"}
+	}
+	repairs := []types.ChecksumRepair{}
+	for _, file := range files {
+		repairs = append(repairs, types.ChecksumRepair{File: file, OldCheckSum: "sha256-1", NewCheckSum: "sha256-2", OldContents: "select abc", NewContents: "select abcd", Reason: reason, Schemas: 3})
+	}
+	return repairs, nil
 }
 
 func (m *mockedCoordinator) HealthCheck() types.HealthResponse {
 	return types.HealthResponse{Status: types.HealthStatusUp, Checks: []types.HealthChecks{}}
 }
+
+// mockedErrorCoordinator returns err from all mutations
+type mockedErrorCoordinator struct {
+	mockedCoordinator
+	err error
+}
+
+func (m *mockedErrorCoordinator) CreateVersion(string, types.Action, bool, string, string) (*types.CreateResults, error) {
+	return nil, m.err
+}
+
+func (m *mockedErrorCoordinator) CreateTenant(string, types.Action, bool, string, []types.TenantLabel) (*types.CreateResults, error) {
+	return nil, m.err
+}
+
+func (m *mockedErrorCoordinator) SetTenantLabels(string, []types.TenantLabel) (*types.Tenant, error) {
+	return nil, m.err
+}
+
+func (m *mockedErrorCoordinator) ArchiveTenant(string) (*types.CreateResults, error) {
+	return nil, m.err
+}
+
+func (m *mockedErrorCoordinator) Baseline(string, []string, bool) (*types.CreateResults, error) {
+	return nil, m.err
+}
+
+func (m *mockedErrorCoordinator) DropTenant(string, bool) (*types.CreateResults, error) {
+	return nil, m.err
+}
+
+func (m *mockedErrorCoordinator) RenameTenant(string, string) (*types.CreateResults, error) {
+	return nil, m.err
+}
+
+func (m *mockedErrorCoordinator) RollbackVersion(int32, bool) (*types.CreateResults, error) {
+	return nil, m.err
+}
@@ -3,11 +3,15 @@ package data
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/graph-gophers/graphql-go"
+	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/types"
 )
 
 func TestTenants(t *testing.T) {
@@ -32,6 +36,179 @@ func TestTenants(t *testing.T) {
 	assert.Equal(t, 3, results)
 }
 
+func TestTenantsSelector(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "Tenants"
+	query := `query Tenants($selector: String) {
+      tenants(selector: $selector) {
+        name
+        labels {
+          key
+          value
+        }
+      }
+    }`
+	variables := map[string]interface{}{
+		"selector": "canary=true",
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Nil(t, resp.Errors)
+	assert.JSONEq(t, `{"tenants":[{"name":"a","labels":[{"key":"canary","value":"true"}]}]}`, string(resp.Data))
+
+	variables["selector"] = "!canary"
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.Nil(t, resp.Errors)
+	assert.JSONEq(t, `{"tenants":[{"name":"b","labels":[]},{"name":"c","labels":[]}]}`, string(resp.Data))
+
+	variables["selector"] = "canary=true;drop"
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "INVALID_ARGUMENT", resp.Errors[0].Extensions["code"])
+}
+
+func TestTargets(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	// only named targets are configured
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Targets: map[string]coordinator.Coordinator{"documents": &mockedCoordinator{}}}, opts...)
+
+	opName := "Tenants"
+	query := `query Tenants($target: String) {
+      tenants(target: $target) {
+        name
+      }
+    }`
+
+	resp := schema.Exec(ctx, query, opName, map[string]interface{}{"target": "documents"})
+	assert.Nil(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(jsonMap["tenants"].([]interface{})))
+
+	resp = schema.Exec(ctx, query, opName, map[string]interface{}{"target": "orders"})
+	assert.Equal(t, "target not found: orders", resp.Errors[0].Message)
+	assert.Equal(t, "NOT_FOUND", resp.Errors[0].Extensions["code"])
+
+	resp = schema.Exec(ctx, query, opName, map[string]interface{}{})
+	assert.Equal(t, "invalid target: target is required, default target is not configured", resp.Errors[0].Message)
+	assert.Equal(t, "INVALID_ARGUMENT", resp.Errors[0].Extensions["code"])
+
+	opName = "CreateVersion"
+	mutation := `mutation CreateVersion($input: VersionInput!, $target: String) {
+      createVersion(input: $input, target: $target) {
+        summary {
+          startedAt
+        }
+      }
+    }`
+	variables := map[string]interface{}{
+		"input":  map[string]interface{}{"versionName": "commit-sha", "action": "Apply"},
+		"target": "documents",
+	}
+	resp = schema.Exec(ctx, mutation, opName, variables)
+	assert.Nil(t, resp.Errors)
+}
+
+func TestSetTenantLabels(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "SetTenantLabels"
+	query := `mutation SetTenantLabels($tenant: String!, $labels: [TenantLabelInput!]!) {
+      setTenantLabels(tenant: $tenant, labels: $labels) {
+        name
+        labels {
+          key
+          value
+        }
+      }
+    }`
+	variables := map[string]interface{}{
+		"tenant": "b",
+		"labels": []interface{}{
+			map[string]interface{}{"key": "region", "value": "eu"},
+			map[string]interface{}{"key": "plan", "value": "premium"},
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Nil(t, resp.Errors)
+	assert.JSONEq(t, `{"setTenantLabels":{"name":"b","labels":[{"key":"region","value":"eu"},{"key":"plan","value":"premium"}]}}`, string(resp.Data))
+}
+
+func TestTenantLifecycle(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	query := `mutation TenantLifecycle {
+      archiveTenant(name: "a") {
+        summary {
+          tenants
+        }
+        version {
+          name
+        }
+      }
+      dropTenant(name: "b", dryRun: true) {
+        version {
+          name
+        }
+      }
+      renameTenant(from: "c", to: "d") {
+        version {
+          name
+        }
+      }
+    }`
+
+	resp := schema.Exec(ctx, query, "TenantLifecycle", map[string]interface{}{})
+	assert.Nil(t, resp.Errors)
+	assert.JSONEq(t, `{"archiveTenant":{"summary":{"tenants":1},"version":{"name":"Archive tenant a"}},"dropTenant":{"version":{"name":"Drop tenant b"}},"renameTenant":{"version":{"name":"Rename tenant c to d"}}}`, string(resp.Data))
+}
+
+func TestBaseline(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	query := `mutation Baseline($upTo: String!, $tenants: [String!]) {
+      baseline(upTo: $upTo, tenants: $tenants) {
+        summary {
+          singleMigrations
+          tenants
+        }
+        version {
+          name
+        }
+      }
+    }`
+	variables := map[string]interface{}{
+		"upTo":    "201602220001.sql",
+		"tenants": []interface{}{"abc", "def"},
+	}
+
+	resp := schema.Exec(ctx, query, "Baseline", variables)
+	assert.Nil(t, resp.Errors)
+	assert.JSONEq(t, `{"baseline":{"summary":{"singleMigrations":2,"tenants":2},"version":{"name":"Baseline up to 201602220001.sql"}}}`, string(resp.Data))
+
+	// tenants are optional
+	resp = schema.Exec(ctx, query, "Baseline", map[string]interface{}{"upTo": "201602220001.sql"})
+	assert.Nil(t, resp.Errors)
+	assert.JSONEq(t, `{"baseline":{"summary":{"singleMigrations":2,"tenants":0},"version":{"name":"Baseline up to 201602220001.sql"}}}`, string(resp.Data))
+}
+
 func TestVersions(t *testing.T) {
 	ctx := context.Background()
 
@@ -301,7 +478,9 @@ func TestSourceMigration(t *testing.T) {
 	      name,
 	      migrationType,
 	      sourceDir,
-	    	file
+	    	file,
+	      noTransaction,
+	      outOfOrder
 	    }
   }`
 	variables := map[string]interface{}{
@@ -317,7 +496,9 @@ func TestSourceMigration(t *testing.T) {
 	assert.NotNil(t, "201602220001.sql", results["name"])
 	assert.NotNil(t, "SingleMigration", results["migrationType"])
 	assert.NotNil(t, "config", results["sourceDir"])
-	// we return only 4 fields in above query others should be nil
+	assert.Equal(t, false, results["noTransaction"])
+	assert.Equal(t, false, results["outOfOrder"])
+	// we return only 6 fields in above query others should be nil
 	assert.Nil(t, results["contents"])
 	assert.Nil(t, results["checkSum"])
 }
@@ -403,6 +584,215 @@ func TestComplexQueries(t *testing.T) {
 	assert.Equal(t, 3, tenants)
 }
 
+func TestVerifyChecksums(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "VerifyChecksums"
+	query := `query VerifyChecksums {
+      verifyChecksums {
+        file
+        sourceCheckSum
+        appliedCheckSum
+        versions {
+          id
+        }
+        diff
+      }
+    }`
+	variables := map[string]interface{}{}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Nil(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	mismatches := jsonMap["verifyChecksums"].([]interface{})
+	assert.Len(t, mismatches, 1)
+	mismatch := mismatches[0].(map[string]interface{})
+	assert.Equal(t, "source/201602220000.sql", mismatch["file"])
+	assert.Equal(t, "sha256-2", mismatch["sourceCheckSum"])
+	assert.Equal(t, "sha256-1", mismatch["appliedCheckSum"])
+	assert.Equal(t, float64(12), mismatch["versions"].([]interface{})[0].(map[string]interface{})["id"])
+	assert.Contains(t, mismatch["diff"], "-select abc\n+select abcd\n")
+}
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "Plan"
+	query := `query Plan($selector: String) {
+      plan(selector: $selector) {
+        hash
+        pending
+        singleSchemas {
+          schema
+          migrations {
+            file
+            migrationType
+            checkSum
+            onChange
+          }
+        }
+        tenants {
+          schema
+          migrations {
+            file
+          }
+        }
+      }
+    }`
+	variables := map[string]interface{}{
+		"selector": "region=eu",
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Nil(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	plan := jsonMap["plan"].(map[string]interface{})
+	assert.Equal(t, "0a1b2c", plan["hash"])
+	// scripts are not pending
+	assert.Equal(t, float64(2), plan["pending"])
+	singleSchemas := plan["singleSchemas"].([]interface{})
+	assert.Len(t, singleSchemas, 1)
+	migrations := singleSchemas[0].(map[string]interface{})["migrations"].([]interface{})
+	assert.Len(t, migrations, 2)
+	script := migrations[1].(map[string]interface{})
+	assert.Equal(t, "config-scripts/views.sql", script["file"])
+	assert.Equal(t, "SingleScript", script["migrationType"])
+	assert.Equal(t, "sha256-2", script["checkSum"])
+	assert.Equal(t, false, script["onChange"])
+	tenants := plan["tenants"].([]interface{})
+	assert.Equal(t, "abc", tenants[0].(map[string]interface{})["schema"])
+}
+
+func TestSchemaDrift(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "SchemaDrift"
+	query := `query SchemaDrift {
+      schemaDrift {
+        fingerprint
+        tenants
+        majority
+        objects
+        differences {
+          type
+          name
+          expected
+          actual
+        }
+      }
+    }`
+
+	resp := schema.Exec(ctx, query, opName, map[string]interface{}{})
+	assert.Nil(t, resp.Errors)
+	assert.JSONEq(t, `{"schemaDrift":[
+	  {"fingerprint":"f1","tenants":["abc","def"],"majority":true,"objects":12,"differences":[]},
+	  {"fingerprint":"f2","tenants":["xyz"],"majority":false,"objects":13,"differences":[
+	    {"type":"column","name":"orders.id","expected":"integer not null","actual":"bigint not null"},
+	    {"type":"index","name":"orders.idx_orders_created","expected":null,"actual":"CREATE INDEX idx_orders_created ON orders USING btree (created)"}
+	  ]}
+	]}`, string(resp.Data))
+}
+
+func TestVersionSchemaDiff(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "VersionSchemaDiff"
+	query := `query VersionSchemaDiff($from: Int!, $to: Int!) {
+      versionSchemaDiff(from: $from, to: $to) {
+        migrationType
+        fromSchema
+        toSchema
+        differences {
+          type
+          name
+          expected
+          actual
+        }
+      }
+    }`
+	variables := map[string]interface{}{
+		"from": 1,
+		"to":   2,
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Nil(t, resp.Errors)
+	assert.JSONEq(t, `{"versionSchemaDiff":[
+	  {"migrationType":"TenantMigration","fromSchema":"abc","toSchema":"def","differences":[
+	    {"type":"column","name":"orders.total","expected":null,"actual":"numeric"}
+	  ]}
+	]}`, string(resp.Data))
+}
+
+func TestRepairChecksums(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "RepairChecksums"
+	query := `mutation RepairChecksums($files: [String!], $reason: String!) {
+      repairChecksums(files: $files, reason: $reason) {
+        file
+        oldCheckSum
+        newCheckSum
+        reason
+        schemas
+      }
+    }`
+	variables := map[string]interface{}{
+		"files":  []interface{}{"tenants/201602220001.sql", "tenants/201602220002.sql"},
+		"reason": "comment fix",
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Nil(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	repairs := jsonMap["repairChecksums"].([]interface{})
+	assert.Len(t, repairs, 2)
+	repair := repairs[1].(map[string]interface{})
+	assert.Equal(t, "tenants/201602220002.sql", repair["file"])
+	assert.Equal(t, "sha256-1", repair["oldCheckSum"])
+	assert.Equal(t, "sha256-2", repair["newCheckSum"])
+	assert.Equal(t, "comment fix", repair["reason"])
+	assert.Equal(t, float64(3), repair["schemas"])
+
+	// without files all modified migrations are repaired
+	delete(variables, "files")
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.Nil(t, resp.Errors)
+	err = json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	repairs = jsonMap["repairChecksums"].([]interface{})
+	assert.Len(t, repairs, 1)
+	assert.Equal(t, "source/201602220000.sql", repairs[0].(map[string]interface{})["file"])
+
+	variables["reason"] = " "
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "invalid reason: reason for checksum repair must not be empty", resp.Errors[0].Message)
+	assert.Equal(t, "INVALID_ARGUMENT", resp.Errors[0].Extensions["code"])
+	assert.Equal(t, "reason", resp.Errors[0].Extensions["argument"])
+}
+
 func TestCreateVersionWithDefaults(t *testing.T) {
 	ctx := context.Background()
 
@@ -453,6 +843,168 @@ func TestCreateVersionWithDefaults(t *testing.T) {
 	assert.Nil(t, summary["duration"])
 }
 
+func TestCreateVersionTenantFailures(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "CreateVersion"
+	query := `mutation CreateVersion($input: VersionInput!) {
+  createVersion(input: $input) {
+    summary {
+      succeededTenants
+      failedTenants {
+        tenant
+        error
+      }
+      tenantDurations {
+        tenant
+        duration
+      }
+      nonTransactional
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	summary := jsonMap["createVersion"].(map[string]interface{})["summary"].(map[string]interface{})
+
+	assert.Equal(t, []interface{}{"abc"}, summary["succeededTenants"])
+	failedTenants := summary["failedTenants"].([]interface{})
+	assert.Len(t, failedTenants, 1)
+	assert.Equal(t, map[string]interface{}{"tenant": "def", "error": "trouble maker"}, failedTenants[0])
+	tenantDurations := summary["tenantDurations"].([]interface{})
+	assert.Equal(t, map[string]interface{}{"tenant": "abc", "duration": 0.5}, tenantDurations[0])
+	assert.Equal(t, map[string]interface{}{"tenant": "def", "duration": 0.25}, tenantDurations[1])
+	assert.Equal(t, []interface{}{"tenants/202001010000.sql"}, summary["nonTransactional"])
+}
+
+func TestCreateVersionAsync(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "CreateVersion"
+	query := `mutation CreateVersion($input: VersionInput!) {
+  createVersion(input: $input) {
+    summary {
+      tenantMigrationsTotal
+    }
+    version {
+      id
+    }
+    job {
+      id
+      operation
+      name
+      status
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+			"async":       true,
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	results := jsonMap["createVersion"].(map[string]interface{})
+
+	// nothing was applied yet
+	assert.Equal(t, map[string]interface{}{"tenantMigrationsTotal": float64(0)}, results["summary"])
+	assert.Nil(t, results["version"])
+	assert.Equal(t, map[string]interface{}{"id": float64(1), "operation": "createVersion", "name": "commit-sha", "status": "Queued"}, results["job"])
+}
+
+func TestCreateTenantAsync(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "CreateTenant"
+	query := `mutation CreateTenant($input: TenantInput!) {
+  createTenant(input: $input) {
+    job {
+      id
+      operation
+      status
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+			"tenantName":  "abc",
+			"async":       true,
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	job := jsonMap["createTenant"].(map[string]interface{})["job"]
+	assert.Equal(t, map[string]interface{}{"id": float64(1), "operation": "createTenant", "status": "Queued"}, job)
+}
+
+func TestJob(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "Job"
+	query := `query Job($id: Int!) {
+  job(id: $id) {
+    id
+    status
+    applied
+    total
+    summary {
+      migrationsGrandTotal
+    }
+    error
+    created
+  }
+}`
+
+	resp := schema.Exec(ctx, query, opName, map[string]interface{}{"id": 1})
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	job := jsonMap["job"].(map[string]interface{})
+	assert.Equal(t, "Succeeded", job["status"])
+	assert.Equal(t, float64(3), job["applied"])
+	assert.Equal(t, float64(3), job["total"])
+	assert.Equal(t, map[string]interface{}{"migrationsGrandTotal": float64(3)}, job["summary"])
+	assert.Nil(t, job["error"])
+	assert.Equal(t, "2016-02-22T16:41:01.000000123Z", job["created"])
+
+	resp = schema.Exec(ctx, query, opName, map[string]interface{}{"id": 2})
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "job not found: 2", resp.Errors[0].Message)
+	assert.Equal(t, "NOT_FOUND", resp.Errors[0].Extensions["code"])
+}
+
 func TestCreateVersionNonDefaultParams(t *testing.T) {
 	ctx := context.Background()
 
@@ -484,6 +1036,8 @@ func TestCreateVersionNonDefaultParams(t *testing.T) {
 			"action":      "Sync",
 			"dryRun":      true,
 			"versionName": "commit-sha",
+			"planHash":    "0a1b2c",
+			"selector":    "canary=true",
 		},
 	}
 
@@ -543,6 +1097,7 @@ func TestCreateTenantWithDefaults(t *testing.T) {
 		"input": map[string]interface{}{
 			"versionName": "commit-sha",
 			"tenantName":  "new-tenant",
+			"labels":      []interface{}{map[string]interface{}{"key": "canary", "value": "true"}},
 		},
 	}
 
@@ -634,3 +1189,80 @@ func TestCreateTenantNonDefaultParams(t *testing.T) {
 	// we return only 4 fields in above query others should be nil including duration
 	assert.Nil(t, summary["duration"])
 }
+
+func TestRollbackVersion(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "RollbackVersion"
+	query := `mutation RollbackVersion($id: Int!) {
+  rollbackVersion(id: $id, dryRun: true) {
+    version {
+      id
+    }
+    summary {
+      migrationsGrandTotal
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"id": 123,
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Nil(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	results := jsonMap["rollbackVersion"].(map[string]interface{})
+	version := results["version"].(map[string]interface{})
+	assert.Equal(t, float64(123), version["id"])
+}
+
+func TestCreateVersionErrorCodes(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+
+	opName := "CreateVersion"
+	query := `mutation CreateVersion($input: VersionInput!) {
+  createVersion(input: $input) {
+    summary {
+      migrationsGrandTotal
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+		},
+	}
+
+	sqlError := &types.SQLError{File: "tenants/201602160002.sql", Schema: "abc", Err: errors.New("syntax error")}
+	checksumMismatch := &types.ChecksumMismatchError{Migrations: []types.Migration{{File: "source/201602160001.sql"}}}
+
+	tests := []struct {
+		err        error
+		extensions map[string]interface{}
+	}{
+		{&types.NotFoundError{Resource: "version", ID: "123"}, map[string]interface{}{"code": "NOT_FOUND"}},
+		{checksumMismatch, map[string]interface{}{"code": "CHECKSUM_MISMATCH", "files": []string{"source/201602160001.sql"}}},
+		{&types.OutOfOrderError{Migrations: []types.Migration{{File: "tenants/201602160001.sql"}}}, map[string]interface{}{"code": "OUT_OF_ORDER", "files": []string{"tenants/201602160001.sql"}}},
+		{sqlError, map[string]interface{}{"code": "SQL_FAILURE", "file": "tenants/201602160002.sql", "schema": "abc"}},
+		{&types.TemplateError{File: "tenants/201602160002.sql", Schema: "abc", Err: errors.New("map has no entry for key")}, map[string]interface{}{"code": "TEMPLATE_ERROR", "file": "tenants/201602160002.sql", "schema": "abc"}},
+		{&types.LockTimeoutError{Timeout: time.Minute}, map[string]interface{}{"code": "LOCK_TIMEOUT"}},
+		{&types.InvalidArgumentError{Argument: "selector", Err: errors.New("invalid label selector requirement: =true")}, map[string]interface{}{"code": "INVALID_ARGUMENT", "argument": "selector"}},
+		{&types.PlanChangedError{Expected: "0a1b2c", Actual: "3d4e5f"}, map[string]interface{}{"code": "PLAN_CHANGED", "expected": "0a1b2c", "actual": "3d4e5f"}},
+		{errors.New("trouble maker"), map[string]interface{}{"code": "INTERNAL_ERROR"}},
+	}
+
+	for _, test := range tests {
+		schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedErrorCoordinator{err: test.err}}, opts...)
+		resp := schema.Exec(ctx, query, opName, variables)
+		assert.Len(t, resp.Errors, 1)
+		assert.Equal(t, test.err.Error(), resp.Errors[0].Message)
+		assert.Equal(t, test.extensions, resp.Errors[0].Extensions)
+	}
+}
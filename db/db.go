@@ -3,10 +3,11 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sort"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/graph-gophers/graphql-go"
@@ -18,14 +19,28 @@ import (
 
 // Connector interface abstracts all DB operations performed by migrator
 type Connector interface {
-	GetTenants() []types.Tenant
-	GetVersions() []types.Version
-	GetVersionsByFile(file string) []types.Version
+	GetTenants() ([]types.Tenant, error)
+	GetTenantLabels() (map[string][]types.TenantLabel, error)
+	SetTenantLabels(string, []types.TenantLabel) error
+	GetVersions() ([]types.Version, error)
+	GetVersionsByFile(file string) ([]types.Version, error)
 	GetVersionByID(ID int32) (*types.Version, error)
 	GetDBMigrationByID(ID int32) (*types.DBMigration, error)
-	GetAppliedMigrations() []types.DBMigration
-	CreateVersion(string, types.Action, []types.Migration, bool) (*types.Summary, *types.Version)
-	CreateTenant(string, string, types.Action, []types.Migration, bool) (*types.Summary, *types.Version)
+	GetAppliedMigrations() ([]types.DBMigration, error)
+	CreateVersion(string, types.Action, []types.Migration, types.LabelSelector, bool, *types.PlanCheck) (*types.Summary, *types.Version, error)
+	Baseline(string, []types.Migration, []types.Tenant, bool) (*types.Summary, *types.Version, error)
+	CreateTenant(string, string, types.Action, []types.Migration, bool) (*types.Summary, *types.Version, error)
+	PlanMigrations([]types.Migration, []types.Tenant) (map[string][]string, error)
+	RollbackVersion(*types.Version, []types.DBMigration, bool) (*types.Summary, error)
+	RepairChecksums([]types.Migration, string) ([]types.ChecksumRepair, error)
+	ArchiveTenant(string, string) (*types.Summary, *types.Version, error)
+	DropTenant(string, string, bool) (*types.Summary, *types.Version, error)
+	RenameTenant(string, string, string) (*types.Summary, *types.Version, error)
+	GetSchemaFingerprints([]string) ([]types.SchemaFingerprint, error)
+	CreateJob(string, string) (*types.Job, error)
+	UpdateJob(*types.Job) error
+	GetJobByID(ID int32) (*types.Job, error)
+	FailStaleJob(int32, time.Time, string) error
 	HealthCheck() error
 	Dispose()
 }
@@ -53,11 +68,18 @@ func New(ctx context.Context, config *config.Config) Connector {
 }
 
 const (
-	migratorSchema           = "migrator"
-	migratorTenantsTable     = "migrator_tenants"
-	migratorMigrationsTable  = "migrator_migrations"
-	migratorVersionsTable    = "migrator_versions"
-	defaultSchemaPlaceHolder = "{schema}"
+	migratorSchema               = "migrator"
+	migratorTenantsTable         = "migrator_tenants"
+	migratorMigrationsTable      = "migrator_migrations"
+	migratorVersionsTable        = "migrator_versions"
+	migratorChecksumRepairsTable = "migrator_checksum_repairs"
+	migratorTenantLabelsTable    = "migrator_tenant_labels"
+	migratorArchivedTenantsTable = "migrator_archived_tenants"
+	migratorSchemaSnapshotsTable = "migrator_schema_snapshots"
+	migratorJobsTable            = "migrator_jobs"
+	defaultSchemaPlaceHolder     = "{schema}"
+	migratorLockName             = "migrator"
+	lockRetryInterval            = 500 * time.Millisecond
 )
 
 // init initialises migrator by making sure proper schema/table are created
@@ -66,46 +88,90 @@ func (bc *baseConnector) init() error {
 		return nil
 	}
 	if bc.db == nil {
-		db, err := sql.Open(bc.config.Driver, bc.config.DataSource)
+		p, err := getPool(bc.ctx, bc.config)
 		if err != nil {
-			return fmt.Errorf("failed to open connection to DB: %v", err.Error())
+			return err
 		}
-		bc.db = db
-
-		if err := bc.db.Ping(); err != nil {
-			return fmt.Errorf("failed to connect to database: %v", err)
+		bc.db = p.db
+		// migrator tables are created once per shared pool and target config, targets sharing a pool can use different tenant tables
+		if err := p.setup(bc.setupKey(), bc.createMigratorTables); err != nil {
+			return err
 		}
+	} else if err := bc.createMigratorTables(); err != nil {
+		return err
 	}
 
-	tx, err := bc.db.Begin()
+	bc.initialised = true
+
+	return nil
+}
+
+// setupKey identifies target config settings which migrator tables depend on
+func (bc *baseConnector) setupKey() string {
+	return fmt.Sprintf("%v|%v", bc.config.TenantSelect, bc.config.TenantSelectSQL)
+}
+
+// createMigratorTables makes sure migrator schema and tables exist
+func (bc *baseConnector) createMigratorTables() error {
+	tx, err := bc.db.BeginTx(bc.ctx, nil)
 	if err != nil {
 		return fmt.Errorf("could not start DB transaction: %v", err)
 	}
 
 	// make sure migrator schema exists
 	createSchema := bc.dialect.GetCreateSchemaSQL(migratorSchema)
-	if _, err := bc.db.Exec(createSchema); err != nil {
+	if _, err := bc.db.ExecContext(bc.ctx, createSchema); err != nil {
 		return fmt.Errorf("could not create migrator schema: %v", err)
 	}
 
 	// make sure migrations table exists
 	createMigrationsTable := bc.dialect.GetCreateMigrationsTableSQL()
-	if _, err := bc.db.Exec(createMigrationsTable); err != nil {
+	if _, err := bc.db.ExecContext(bc.ctx, createMigrationsTable); err != nil {
 		return fmt.Errorf("could not create migrations table: %v", err)
 	}
 
 	// make sure versions table exists
 	createVersionsTableSQLs := bc.dialect.GetCreateVersionsTableSQL()
 	for _, createVersionsTableSQL := range createVersionsTableSQLs {
-		if _, err := bc.db.Exec(createVersionsTableSQL); err != nil {
+		if _, err := bc.db.ExecContext(bc.ctx, createVersionsTableSQL); err != nil {
 			return fmt.Errorf("could not create versions table: %v", err)
 		}
 	}
 
+	// make sure checksum repairs table exists
+	createChecksumRepairsTable := bc.dialect.GetCreateChecksumRepairsTableSQL()
+	if _, err := bc.db.ExecContext(bc.ctx, createChecksumRepairsTable); err != nil {
+		return fmt.Errorf("could not create checksum repairs table: %v", err)
+	}
+
+	// make sure tenant labels table exists, labels are stored separately so that they work with custom tenant tables too
+	createTenantLabelsTable := bc.dialect.GetCreateTenantLabelsTableSQL()
+	if _, err := bc.db.ExecContext(bc.ctx, createTenantLabelsTable); err != nil {
+		return fmt.Errorf("could not create tenant labels table: %v", err)
+	}
+
+	// make sure archived tenants table exists
+	createArchivedTenantsTable := bc.dialect.GetCreateArchivedTenantsTableSQL()
+	if _, err := bc.db.ExecContext(bc.ctx, createArchivedTenantsTable); err != nil {
+		return fmt.Errorf("could not create archived tenants table: %v", err)
+	}
+
+	// make sure schema snapshots table exists
+	createSchemaSnapshotsTable := bc.dialect.GetCreateSchemaSnapshotsTableSQL()
+	if _, err := bc.db.ExecContext(bc.ctx, createSchemaSnapshotsTable); err != nil {
+		return fmt.Errorf("could not create schema snapshots table: %v", err)
+	}
+
+	// make sure jobs table exists
+	createJobsTable := bc.dialect.GetCreateJobsTableSQL()
+	if _, err := bc.db.ExecContext(bc.ctx, createJobsTable); err != nil {
+		return fmt.Errorf("could not create jobs table: %v", err)
+	}
+
 	// if using default migrator tenants table make sure it exists
 	if bc.config.TenantSelectSQL == "" {
 		createTenantsTable := bc.dialect.GetCreateTenantsTableSQL()
-		if _, err := bc.db.Exec(createTenantsTable); err != nil {
+		if _, err := bc.db.ExecContext(bc.ctx, createTenantsTable); err != nil {
 			return fmt.Errorf("could not create default tenants table: %v", err)
 		}
 	}
@@ -114,20 +180,12 @@ func (bc *baseConnector) init() error {
 		return fmt.Errorf("could not commit transaction: %v", err)
 	}
 
-	bc.initialised = true
-
 	return nil
 }
 
-func (bc *baseConnector) initOrPanic() {
-	if err := bc.init(); err != nil {
-		panic(fmt.Sprintf("Error initialising migrator: %v", err))
-	}
-}
-
-// Dispose closes all resources allocated by connector
+// Dispose releases resources allocated by connector, the shared connection pool is kept open for other connectors
 func (bc *baseConnector) Dispose() {
-	if bc.db != nil {
+	if bc.db != nil && !isPooled(bc.db) {
 		bc.db.Close()
 	}
 }
@@ -148,133 +206,260 @@ func (bc *baseConnector) getTenantSelectSQL() string {
 	return tenantSelectSQL
 }
 
-// GetTenants returns a list of all DB tenants
-func (bc *baseConnector) GetTenants() []types.Tenant {
-	bc.initOrPanic()
+// GetTenants returns a list of all DB tenants, archived tenants are marked as archived
+func (bc *baseConnector) GetTenants() ([]types.Tenant, error) {
+	if err := bc.init(); err != nil {
+		return nil, err
+	}
 
 	tenantSelectSQL := bc.getTenantSelectSQL()
 
 	tenants := []types.Tenant{}
 
-	rows, err := bc.db.Query(tenantSelectSQL)
+	rows, err := bc.db.QueryContext(bc.ctx, tenantSelectSQL)
 	if err != nil {
-		panic(fmt.Sprintf("Could not query tenants: %v", err))
+		return nil, fmt.Errorf("could not query tenants: %v", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var name string
 		if err = rows.Scan(&name); err != nil {
-			panic(fmt.Sprintf("Could not read tenants: %v", err))
+			return nil, fmt.Errorf("could not read tenants: %v", err)
 		}
 		tenants = append(tenants, types.Tenant{Name: name})
 	}
 
-	return tenants
+	archived, err := bc.getArchivedTenants()
+	if err != nil {
+		return nil, err
+	}
+	for i := range tenants {
+		tenants[i].Archived = archived[tenants[i].Name]
+	}
+
+	return tenants, nil
+}
+
+// getArchivedTenants returns a set of archived tenants
+func (bc *baseConnector) getArchivedTenants() (map[string]bool, error) {
+	rows, err := bc.db.QueryContext(bc.ctx, bc.dialect.GetArchivedTenantsSelectSQL())
+	if err != nil {
+		return nil, fmt.Errorf("could not query archived tenants: %v", err)
+	}
+	defer rows.Close()
+
+	archived := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("could not read archived tenants: %v", err)
+		}
+		archived[name] = true
+	}
+	return archived, nil
+}
+
+// GetTenantLabels returns labels of all tenants, key is tenant name
+func (bc *baseConnector) GetTenantLabels() (map[string][]types.TenantLabel, error) {
+	if err := bc.init(); err != nil {
+		return nil, err
+	}
+
+	rows, err := bc.db.QueryContext(bc.ctx, bc.dialect.GetTenantLabelsSelectSQL())
+	if err != nil {
+		return nil, fmt.Errorf("could not query tenant labels: %v", err)
+	}
+	defer rows.Close()
+
+	labels := map[string][]types.TenantLabel{}
+	for rows.Next() {
+		var tenant, key, value string
+		if err = rows.Scan(&tenant, &key, &value); err != nil {
+			return nil, fmt.Errorf("could not read tenant labels: %v", err)
+		}
+		labels[tenant] = append(labels[tenant], types.TenantLabel{Key: key, Value: value})
+	}
+
+	return labels, nil
+}
+
+// SetTenantLabels replaces all labels of a tenant with passed labels
+func (bc *baseConnector) SetTenantLabels(tenant string, labels []types.TenantLabel) (err error) {
+	if err := bc.init(); err != nil {
+		return err
+	}
+
+	tx, err := bc.db.BeginTx(bc.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(bc.ctx, bc.dialect.GetTenantLabelsDeleteSQL(), tenant); err != nil {
+		return fmt.Errorf("could not delete tenant labels: %v", err)
+	}
+	for _, l := range labels {
+		if _, err = tx.ExecContext(bc.ctx, bc.dialect.GetTenantLabelInsertSQL(), tenant, l.Key, l.Value); err != nil {
+			return fmt.Errorf("could not insert tenant label: %v", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return nil
 }
 
-func (bc *baseConnector) GetVersions() []types.Version {
-	bc.initOrPanic()
+func (bc *baseConnector) GetVersions() ([]types.Version, error) {
+	if err := bc.init(); err != nil {
+		return nil, err
+	}
 
 	versionsSelectSQL := bc.dialect.GetVersionsSelectSQL()
 
-	rows, err := bc.db.Query(versionsSelectSQL)
+	rows, err := bc.db.QueryContext(bc.ctx, versionsSelectSQL)
 	if err != nil {
-		panic(fmt.Sprintf("Could not query versions: %v", err))
+		return nil, fmt.Errorf("could not query versions: %v", err)
 	}
 	defer rows.Close()
 
-	return bc.readVersions(rows)
+	versions, err := bc.readVersions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bc.attachSchemaSnapshots(bc.db, versions, bc.dialect.GetSchemaSnapshotsSelectSQL()); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
 }
 
-func (bc *baseConnector) GetVersionsByFile(file string) []types.Version {
-	bc.initOrPanic()
+func (bc *baseConnector) GetVersionsByFile(file string) ([]types.Version, error) {
+	if err := bc.init(); err != nil {
+		return nil, err
+	}
 
 	versionsSelectSQL := bc.dialect.GetVersionsByFileSQL()
 
-	rows, err := bc.db.Query(versionsSelectSQL, file)
+	rows, err := bc.db.QueryContext(bc.ctx, versionsSelectSQL, file)
 	if err != nil {
-		panic(fmt.Sprintf("Could not query versions: %v", err))
+		return nil, fmt.Errorf("could not query versions: %v", err)
 	}
 	defer rows.Close()
 
-	return bc.readVersions(rows)
+	versions, err := bc.readVersions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bc.attachSchemaSnapshots(bc.db, versions, bc.dialect.GetSchemaSnapshotsSelectSQL()); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
 }
 
 func (bc *baseConnector) GetVersionByID(ID int32) (*types.Version, error) {
-	bc.initOrPanic()
+	if err := bc.init(); err != nil {
+		return nil, err
+	}
 
 	versionsSelectSQL := bc.dialect.GetVersionByIDSQL()
 
-	rows, err := bc.db.Query(versionsSelectSQL, ID)
+	rows, err := bc.db.QueryContext(bc.ctx, versionsSelectSQL, ID)
 	if err != nil {
-		panic(fmt.Sprintf("Could not query versions: %v", err))
+		return nil, fmt.Errorf("could not query versions: %v", err)
 	}
 	defer rows.Close()
 
 	// readVersions is generic and returns a slice of Version objects
 	// we are querying by ID and are interested in only the first one
-	versions := bc.readVersions(rows)
+	versions, err := bc.readVersions(rows)
+	if err != nil {
+		return nil, err
+	}
 
 	if len(versions) == 0 {
-		return nil, fmt.Errorf("version not found ID: %v", ID)
+		return nil, &types.NotFoundError{Resource: "version", ID: fmt.Sprint(ID)}
+	}
+
+	if err := bc.attachSchemaSnapshots(bc.db, versions, bc.dialect.GetVersionSchemaSnapshotsSelectSQL(), ID); err != nil {
+		return nil, err
 	}
 
 	return &versions[0], nil
 }
 
-func (bc *baseConnector) getVersionByIDInTx(tx *sql.Tx, ID int32) *types.Version {
+func (bc *baseConnector) getVersionByIDInTx(tx *sql.Tx, ID int32) (*types.Version, error) {
 	versionsSelectSQL := bc.dialect.GetVersionByIDSQL()
 
-	rows, err := tx.Query(versionsSelectSQL, ID)
+	rows, err := tx.QueryContext(bc.ctx, versionsSelectSQL, ID)
 	if err != nil {
-		panic(fmt.Sprintf("Could not query versions: %v", err))
+		return nil, fmt.Errorf("could not query versions: %v", err)
 	}
 	defer rows.Close()
 
 	// readVersions is generic and returns a slice of Version objects
 	// we are querying by ID and are interested in only the first one
-	versions := bc.readVersions(rows)
+	versions, err := bc.readVersions(rows)
+	if err != nil {
+		return nil, err
+	}
 
 	// when running in transaction version must be found
 	if len(versions) == 0 {
-		panic(fmt.Sprintf("Version not found ID: %v", ID))
+		return nil, &types.NotFoundError{Resource: "version", ID: fmt.Sprint(ID)}
+	}
+
+	if err := bc.attachSchemaSnapshots(tx, versions, bc.dialect.GetVersionSchemaSnapshotsSelectSQL(), ID); err != nil {
+		return nil, err
 	}
 
-	return &versions[0]
+	return &versions[0], nil
 }
 
-func (bc *baseConnector) readVersions(rows *sql.Rows) []types.Version {
+func (bc *baseConnector) readVersions(rows *sql.Rows) ([]types.Version, error) {
 	versions := []types.Version{}
 	versionsMap := map[int64]*types.Version{}
 
 	for rows.Next() {
+		// versions which only audit an operation (for example archiveTenant) have no DB migrations
+		// and all migration columns returned by the left join are null
 		var (
 			vid           int64
 			vname         string
 			vcreated      time.Time
-			mid           int64
-			name          string
-			sourceDir     string
-			filename      string
-			migrationType types.MigrationType
-			schema        string
-			created       time.Time
-			contents      string
-			checksum      string
+			mid           sql.NullInt64
+			name          sql.NullString
+			sourceDir     sql.NullString
+			filename      sql.NullString
+			migrationType sql.NullInt64
+			schema        sql.NullString
+			created       sql.NullTime
+			contents      sql.NullString
+			checksum      sql.NullString
 		)
 
 		if err := rows.Scan(&vid, &vname, &vcreated, &mid, &name, &sourceDir, &filename, &migrationType, &schema, &created, &contents, &checksum); err != nil {
-			panic(fmt.Sprintf("Could not read versions: %v", err))
+			return nil, fmt.Errorf("could not read versions: %v", err)
 		}
 		if versionsMap[vid] == nil {
-			version := types.Version{ID: int32(vid), Name: vname, Created: graphql.Time{Time: vcreated}}
+			version := types.Version{ID: int32(vid), Name: vname, Created: graphql.Time{Time: vcreated}, DBMigrations: []types.DBMigration{}, SchemaSnapshot: []types.SchemaSnapshot{}}
 			versionsMap[vid] = &version
 		}
 
+		if !mid.Valid {
+			continue
+		}
 		version := versionsMap[vid]
-		migration := types.Migration{Name: name, SourceDir: sourceDir, File: filename, MigrationType: migrationType, Contents: contents, CheckSum: checksum}
-		version.DBMigrations = append(version.DBMigrations, types.DBMigration{Migration: migration, ID: int32(mid), Schema: schema, Created: graphql.Time{Time: created}})
+		migration := types.Migration{Name: name.String, SourceDir: sourceDir.String, File: filename.String, MigrationType: types.MigrationType(migrationType.Int64), Contents: contents.String, CheckSum: checksum.String}
+		version.DBMigrations = append(version.DBMigrations, types.DBMigration{Migration: migration, ID: int32(mid.Int64), Schema: schema.String, Created: graphql.Time{Time: created.Time}})
 	}
 
 	// map to versions
@@ -285,22 +470,24 @@ func (bc *baseConnector) readVersions(rows *sql.Rows) []types.Version {
 	sort.Slice(versions, func(i, j int) bool {
 		return versions[i].ID > versions[j].ID
 	})
-	return versions
+	return versions, nil
 }
 
 func (bc *baseConnector) GetDBMigrationByID(ID int32) (*types.DBMigration, error) {
-	bc.initOrPanic()
+	if err := bc.init(); err != nil {
+		return nil, err
+	}
 
 	query := bc.dialect.GetMigrationByIDSQL()
 
-	rows, err := bc.db.Query(query, ID)
+	rows, err := bc.db.QueryContext(bc.ctx, query, ID)
 	if err != nil {
-		panic(fmt.Sprintf("Could not query DB migrations: %v", err.Error()))
+		return nil, fmt.Errorf("could not query DB migrations: %v", err.Error())
 	}
 	defer rows.Close()
 
 	if !rows.Next() {
-		return nil, fmt.Errorf("DB migration not found ID: %v", ID)
+		return nil, &types.NotFoundError{Resource: "DB migration", ID: fmt.Sprint(ID)}
 	}
 
 	var (
@@ -315,7 +502,7 @@ func (bc *baseConnector) GetDBMigrationByID(ID int32) (*types.DBMigration, error
 		checksum      string
 	)
 	if err = rows.Scan(&id, &name, &sourceDir, &filename, &migrationType, &schema, &created, &contents, &checksum); err != nil {
-		panic(fmt.Sprintf("Could not read DB migration: %v", err.Error()))
+		return nil, fmt.Errorf("could not read DB migration: %v", err.Error())
 	}
 	m := types.Migration{Name: name, SourceDir: sourceDir, File: filename, MigrationType: migrationType, Contents: contents, CheckSum: checksum}
 	db := types.DBMigration{Migration: m, ID: int32(id), Schema: schema, Created: graphql.Time{Time: created}}
@@ -324,16 +511,18 @@ func (bc *baseConnector) GetDBMigrationByID(ID int32) (*types.DBMigration, error
 }
 
 // GetAppliedMigrations returns a list of all applied DB migrations
-func (bc *baseConnector) GetAppliedMigrations() []types.DBMigration {
-	bc.initOrPanic()
+func (bc *baseConnector) GetAppliedMigrations() ([]types.DBMigration, error) {
+	if err := bc.init(); err != nil {
+		return nil, err
+	}
 
 	query := bc.dialect.GetMigrationSelectSQL()
 
 	dbMigrations := []types.DBMigration{}
 
-	rows, err := bc.db.Query(query)
+	rows, err := bc.db.QueryContext(bc.ctx, query)
 	if err != nil {
-		panic(fmt.Sprintf("Could not query DB migrations: %v", err.Error()))
+		return nil, fmt.Errorf("could not query DB migrations: %v", err.Error())
 	}
 	defer rows.Close()
 
@@ -349,224 +538,1145 @@ func (bc *baseConnector) GetAppliedMigrations() []types.DBMigration {
 			checksum      string
 		)
 		if err = rows.Scan(&name, &sourceDir, &filename, &migrationType, &schema, &created, &contents, &checksum); err != nil {
-			panic(fmt.Sprintf("Could not read DB migration: %v", err.Error()))
+			return nil, fmt.Errorf("could not read DB migration: %v", err.Error())
 		}
 		mdef := types.Migration{Name: name, SourceDir: sourceDir, File: filename, MigrationType: migrationType, Contents: contents, CheckSum: checksum}
 		dbMigrations = append(dbMigrations, types.DBMigration{Migration: mdef, Schema: schema, Created: graphql.Time{Time: created}})
 	}
-	return dbMigrations
+	return dbMigrations, nil
 }
 
 // CreateVersion creates new DB version and applies passed migrations
-func (bc *baseConnector) CreateVersion(versionName string, action types.Action, migrations []types.Migration, dryRun bool) (*types.Summary, *types.Version) {
-	if len(migrations) == 0 {
+// when selector is not empty tenant migrations are applied only to tenants which labels match the selector
+// when planCheck is not nil the plan is recomputed under migrator lock and PlanChangedError is returned if its hash differs
+func (bc *baseConnector) CreateVersion(versionName string, action types.Action, migrations []types.Migration, selector types.LabelSelector, dryRun bool, planCheck *types.PlanCheck) (results *types.Summary, version *types.Version, err error) {
+	if len(migrations) == 0 && planCheck == nil {
 		return &types.Summary{
 			StartedAt: graphql.Time{Time: time.Now()},
 			Duration:  0,
-		}, nil
+		}, nil, nil
+	}
+
+	selectTenants := func() ([]types.Tenant, error) {
+		return bc.selectTenants(selector)
+	}
+	tenants, err := selectTenants()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	tenants := bc.GetTenants()
+	return bc.createVersion(versionName, action, migrations, tenants, dryRun, newPlanVerifier(planCheck, migrations, selectTenants, bc.targetSchemas))
+}
 
-	tx, err := bc.db.Begin()
+// selectTenants returns active tenants which labels match the selector, all active tenants are returned for empty selector
+func (bc *baseConnector) selectTenants(selector types.LabelSelector) ([]types.Tenant, error) {
+	tenants, err := bc.GetTenants()
 	if err != nil {
-		panic(fmt.Sprintf("Could not start transaction: %v", err.Error()))
+		return nil, err
 	}
+	tenants = activeTenants(tenants)
 
-	defer func() {
-		r := recover()
-		if r == nil {
-			if dryRun {
-				common.LogInfo(bc.ctx, "Running in dry-run mode, calling rollback")
-				tx.Rollback()
-			} else {
-				common.LogInfo(bc.ctx, "Running %v, committing transaction", action)
-				if err := tx.Commit(); err != nil {
-					panic(fmt.Sprintf("Could not commit transaction: %v", err.Error()))
-				}
-			}
-		} else {
-			common.LogInfo(bc.ctx, "Recovered in CreateVersion. Transaction rollback.")
-			tx.Rollback()
-			panic(r)
+	if len(selector) > 0 {
+		labels, err := bc.GetTenantLabels()
+		if err != nil {
+			return nil, err
 		}
-	}()
-
-	results := bc.applyMigrationsInTx(tx, versionName, action, tenants, migrations)
-	version := bc.getVersionByIDInTx(tx, results.VersionID)
+		tenants = selector.SelectTenants(tenants, labels)
+	}
+	return tenants, nil
+}
 
-	return results, version
+// Baseline creates new DB version in which passed migrations are recorded as applied without executing them (sync action)
+// tenant migrations are recorded only for passed tenants, single migrations are recorded for their schemas
+func (bc *baseConnector) Baseline(versionName string, migrations []types.Migration, tenants []types.Tenant, dryRun bool) (*types.Summary, *types.Version, error) {
+	if len(migrations) == 0 {
+		return &types.Summary{
+			StartedAt: graphql.Time{Time: time.Now()},
+			Duration:  0,
+		}, nil, nil
+	}
+	if err := bc.init(); err != nil {
+		return nil, nil, err
+	}
+	return bc.createVersion(versionName, types.ActionSync, migrations, tenants, dryRun, nil)
 }
 
-// CreateTenant creates new tenant and applies passed tenant migrations
-func (bc *baseConnector) CreateTenant(tenant string, versionName string, action types.Action, migrations []types.Migration, dryRun bool) (*types.Summary, *types.Version) {
-	bc.initOrPanic()
+// PlanMigrations returns schemas to which passed migrations would be applied, key is Migration.File
+// on-change scripts which did not change are planned with no schemas
+func (bc *baseConnector) PlanMigrations(migrations []types.Migration, tenants []types.Tenant) (map[string][]string, error) {
+	if err := bc.init(); err != nil {
+		return nil, err
+	}
+	appliedMigrations, err := bc.GetAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return computeSchemasToApply(migrations, appliedMigrations, tenants, bc.targetSchemas)
+}
 
-	tenantInsertSQL := bc.getTenantInsertSQL()
+// createVersion applies migrations under migrator lock, verifyPlan (if not nil) is called with migrations applied by the time the lock was acquired
+func (bc *baseConnector) createVersion(versionName string, action types.Action, migrations []types.Migration, tenants []types.Tenant, dryRun bool, verifyPlan func([]types.DBMigration) error) (results *types.Summary, version *types.Version, err error) {
+	rendered, err := bc.renderMigrations(versionName, action, migrations, tenants)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	tx, err := bc.db.Begin()
+	conn, tx, err := bc.beginTx()
 	if err != nil {
-		panic(fmt.Sprintf("Could not start transaction: %v", err.Error()))
+		return nil, nil, err
 	}
+	defer bc.releaseLock(conn)
 
 	defer func() {
-		r := recover()
-		if r == nil {
-			if dryRun {
-				common.LogInfo(bc.ctx, "Running in dry-run mode, calling rollback")
-				tx.Rollback()
-			} else {
-				common.LogInfo(bc.ctx, "Running %v action, committing transaction", action)
-				if err := tx.Commit(); err != nil {
-					panic(fmt.Sprintf("Could not commit transaction: %v", err.Error()))
-				}
-			}
-		} else {
-			common.LogInfo(bc.ctx, "Recovered in CreateTenant. Transaction rollback.")
-			tx.Rollback()
-			panic(r)
+		if err = bc.endTx(tx, "CreateVersion", action, dryRun, err); err != nil {
+			results, version = nil, nil
 		}
 	}()
 
-	createSchema := bc.dialect.GetCreateSchemaSQL(tenant)
-	if _, err = tx.Exec(createSchema); err != nil {
-		panic(fmt.Sprintf("Create schema failed: %v", err))
+	if err := bc.acquireLock(tx); err != nil {
+		return nil, nil, err
 	}
-
-	insert, err := bc.db.Prepare(tenantInsertSQL)
+	// migrations to apply were computed before the lock was acquired
+	// if another migrator instance held the lock it could have already applied them
+	appliedMigrations, err := bc.GetAppliedMigrations()
 	if err != nil {
-		panic(fmt.Sprintf("Could not create prepared statement: %v", err))
+		return nil, nil, err
 	}
-
-	_, err = tx.Stmt(insert).Exec(tenant)
+	if verifyPlan != nil {
+		if err := verifyPlan(appliedMigrations); err != nil {
+			return nil, nil, err
+		}
+	}
+	schemasToApply, err := computeSchemasToApply(migrations, appliedMigrations, tenants, bc.targetSchemas)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to add tenant entry: %v", err))
+		return nil, nil, err
+	}
+	migrations, skipped := skipUnchangedScripts(migrations, schemasToApply, tenants, bc.targetSchemas)
+	if len(migrations) == 0 {
+		common.LogInfo(bc.ctx, "No migrations to apply, version not created")
+		return &types.Summary{
+			StartedAt:      graphql.Time{Time: time.Now()},
+			ScriptsSkipped: skipped,
+		}, nil, nil
 	}
 
-	tenantStruct := types.Tenant{Name: tenant}
-	results := bc.applyMigrationsInTx(tx, versionName, action, []types.Tenant{tenantStruct}, migrations)
-
-	version := bc.getVersionByIDInTx(tx, results.VersionID)
-
-	return results, version
-}
+	progressFromContext(bc.ctx).start(schemasToApply)
 
-// getTenantInsertSQL returns tenant insert SQL statement from configuration file
-// or, if absent, returns default Dialect-specific migrator tenant insert SQL
-func (bc *baseConnector) getTenantInsertSQL() string {
-	var tenantInsertSQL string
-	// if set explicitly in config use it
-	// otherwise use default value provided by Dialect implementation
-	tenantInsert := bc.config.GetTenantInsert()
-	if tenantInsert != "" {
-		// Log warning if using deprecated field
-		if bc.config.IsUsingDeprecatedTenantInsertSQL() {
-			common.LogWarn(bc.ctx, "tenantInsertSQL is deprecated since v2025.1.0 and will be removed in v2027.0.0. Use tenantInsert instead.")
+	if (bc.config.IsPerTenantTransactions() || bc.hasNonTransactionalMigrations(action, migrations)) && !dryRun {
+		// migrations are committed in their own transactions, tx only holds migrator lock
+		if bc.config.IsPerTenantTransactions() {
+			results, err = bc.applyMigrationsPerTenant(versionName, action, tenants, migrations, schemasToApply, rendered)
+		} else {
+			results, err = bc.applyMigrationsInPhases(versionName, action, tenants, migrations, schemasToApply, rendered, nil)
 		}
-		tenantInsertSQL = tenantInsert
-	} else {
-		tenantInsertSQL = bc.dialect.GetTenantInsertSQL()
+		if err != nil {
+			return nil, nil, err
+		}
+		results.ScriptsSkipped = skipped
+		if bc.config.SchemaSnapshots {
+			if err := bc.insertSchemaSnapshotsInTx(tx, results.VersionID, tenants, results); err != nil {
+				return nil, nil, err
+			}
+		}
+		version, err = bc.getVersionByIDInTx(tx, results.VersionID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return results, version, nil
 	}
-	return tenantInsertSQL
-}
 
-// getSchemaPlaceHolder returns a schema placeholder which is
-// either the default one or overridden by user in config
-func (bc *baseConnector) getSchemaPlaceHolder() string {
-	var schemaPlaceHolder string
-	if bc.config.SchemaPlaceHolder != "" {
-		schemaPlaceHolder = bc.config.SchemaPlaceHolder
-	} else {
-		schemaPlaceHolder = defaultSchemaPlaceHolder
+	results, err = bc.applyMigrationsInTx(tx, versionName, action, tenants, migrations, schemasToApply, rendered, dryRun)
+	if err != nil {
+		return nil, nil, err
+	}
+	results.ScriptsSkipped = skipped
+	if bc.config.SchemaSnapshots && !dryRun {
+		if err := bc.insertSchemaSnapshotsInTx(tx, results.VersionID, tenants, results); err != nil {
+			return nil, nil, err
+		}
+	}
+	version, err = bc.getVersionByIDInTx(tx, results.VersionID)
+	if err != nil {
+		return nil, nil, err
 	}
-	return schemaPlaceHolder
-}
 
-func (bc *baseConnector) applyMigrationsInTx(tx *sql.Tx, versionName string, action types.Action, tenants []types.Tenant, migrations []types.Migration) *types.Summary {
+	return results, version, nil
+}
 
-	results := &types.Summary{
-		StartedAt: graphql.Time{Time: time.Now()},
-		Tenants:   int32(len(tenants)),
+// CreateTenant creates new tenant and applies passed tenant migrations
+func (bc *baseConnector) CreateTenant(tenant string, versionName string, action types.Action, migrations []types.Migration, dryRun bool) (results *types.Summary, version *types.Version, err error) {
+	if err := bc.init(); err != nil {
+		return nil, nil, err
 	}
 
-	defer func() {
-		results.Duration = time.Since(results.StartedAt.Time).Seconds()
-		results.MigrationsGrandTotal = results.TenantMigrationsTotal + results.SingleMigrations
-		results.ScriptsGrandTotal = results.TenantScriptsTotal + results.SingleScripts
-	}()
-
-	schemaPlaceHolder := bc.getSchemaPlaceHolder()
+	if !isValidIdentifier(tenant) {
+		return nil, nil, fmt.Errorf("tenant name contains invalid characters: %v", tenant)
+	}
 
-	var versionID int64
-	versionInsertSQL := bc.dialect.GetVersionInsertSQL()
-	versionInsert, err := bc.db.Prepare(versionInsertSQL)
+	tenants := []types.Tenant{{Name: tenant}}
+	rendered, err := bc.renderMigrations(versionName, action, migrations, tenants)
 	if err != nil {
-		panic(fmt.Sprintf("Could not create prepared statement for version: %v", err))
-	}
-	stmt := tx.Stmt(versionInsert)
-	if bc.dialect.LastInsertIDSupported() {
-		result, _ := stmt.Exec(versionName)
-		versionID, _ = result.LastInsertId()
-	} else {
-		stmt.QueryRow(versionName).Scan(&versionID)
+		return nil, nil, err
 	}
 
-	insertMigrationSQL := bc.dialect.GetMigrationInsertSQL()
-	insert, err := bc.db.Prepare(insertMigrationSQL)
+	tenantInsertSQL := bc.getTenantInsertSQL()
+
+	conn, tx, err := bc.beginTx()
 	if err != nil {
-		panic(fmt.Sprintf("Could not create prepared statement for migration: %v", err))
+		return nil, nil, err
 	}
+	defer bc.releaseLock(conn)
 
-	for _, m := range migrations {
-		var schemas []string
-		if m.MigrationType == types.MigrationTypeTenantMigration || m.MigrationType == types.MigrationTypeTenantScript {
-			for _, t := range tenants {
-				schemas = append(schemas, t.Name)
-			}
-		} else {
-			schemas = []string{filepath.Base(m.SourceDir)}
+	defer func() {
+		if err = bc.endTx(tx, "CreateTenant", action, dryRun, err); err != nil {
+			results, version = nil, nil
 		}
+	}()
 
-		for _, s := range schemas {
-			common.LogDebug(bc.ctx, "Applying migration type: %d, schema: %s, file: %s ", m.MigrationType, s, m.File)
-
-			if action == types.ActionApply {
-				contents := strings.Replace(m.Contents, schemaPlaceHolder, s, -1)
-				if _, err = tx.Exec(contents); err != nil {
-					panic(fmt.Sprintf("SQL migration %v failed with error: %v", m.File, err.Error()))
-				}
-			}
+	if err := bc.acquireLock(tx); err != nil {
+		return nil, nil, err
+	}
 
-			if _, err = tx.Stmt(insert).Exec(m.Name, m.SourceDir, m.File, m.MigrationType, s, m.Contents, m.CheckSum, versionID); err != nil {
-				panic(fmt.Sprintf("Failed to add migration entry: %v", err.Error()))
-			}
+	createTenant := func(tx *sql.Tx) error {
+		createSchema := bc.dialect.GetCreateSchemaSQL(tenant)
+		if _, err := tx.ExecContext(bc.ctx, createSchema); err != nil {
+			return fmt.Errorf("create schema failed: %v", err)
 		}
 
-		if m.MigrationType == types.MigrationTypeSingleMigration {
-			results.SingleMigrations++
-		}
-		if m.MigrationType == types.MigrationTypeSingleScript {
-			results.SingleScripts++
-		}
-		if m.MigrationType == types.MigrationTypeTenantMigration {
-			results.TenantMigrations++
-			results.TenantMigrationsTotal += int32(len(schemas))
+		insert, err := bc.db.PrepareContext(bc.ctx, tenantInsertSQL)
+		if err != nil {
+			return fmt.Errorf("could not create prepared statement: %v", err)
 		}
-		if m.MigrationType == types.MigrationTypeTenantScript {
-			results.TenantScripts++
-			results.TenantScriptsTotal += int32(len(schemas))
+
+		if _, err := tx.Stmt(insert).ExecContext(bc.ctx, tenant); err != nil {
+			return fmt.Errorf("failed to add tenant entry: %v", err)
 		}
+		return nil
+	}
 
+	schemasToApply, err := computeSchemasToApply(migrations, []types.DBMigration{}, tenants, bc.targetSchemas)
+	if err != nil {
+		return nil, nil, err
+	}
+	progressFromContext(bc.ctx).start(schemasToApply)
+	if bc.hasNonTransactionalMigrations(action, migrations) && !dryRun {
+		// tenant schema is created and migrations are applied in their own transactions, tx only holds migrator lock
+		results, err = bc.applyMigrationsInPhases(versionName, action, tenants, migrations, schemasToApply, rendered, createTenant)
+	} else {
+		if err := createTenant(tx); err != nil {
+			return nil, nil, err
+		}
+		results, err = bc.applyMigrationsInTx(tx, versionName, action, tenants, migrations, schemasToApply, rendered, dryRun)
+	}
+	if err != nil {
+		return nil, nil, err
 	}
 
-	results.VersionID = int32(versionID)
+	version, err = bc.getVersionByIDInTx(tx, results.VersionID)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return results
+	return results, version, nil
 }
 
-func (bc *baseConnector) HealthCheck() error {
+// RollbackVersion executes down migrations (passed in the order in which they should be executed)
+// and removes the version together with all its DB migrations
+func (bc *baseConnector) RollbackVersion(version *types.Version, migrations []types.DBMigration, dryRun bool) (results *types.Summary, err error) {
 	if err := bc.init(); err != nil {
-		return err
+		return nil, err
 	}
-	return bc.db.Ping()
+
+	// down migrations are rendered before any of them is executed
+	rendered, err := newContentsRenderer(bc.config, bc.getSchemaPlaceHolder(), version.Name).renderDownMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, tx, err := bc.beginTx()
+	if err != nil {
+		return nil, err
+	}
+	defer bc.releaseLock(conn)
+
+	defer func() {
+		if err = bc.endTx(tx, "RollbackVersion", types.ActionApply, dryRun, err); err != nil {
+			results = nil
+		}
+	}()
+
+	if err := bc.acquireLock(tx); err != nil {
+		return nil, err
+	}
+
+	// checked under migrator lock so that no newer version can be created between the check and the rollback
+	var latestID sql.NullInt32
+	if err := tx.QueryRowContext(bc.ctx, bc.dialect.GetLatestVersionIDSQL()).Scan(&latestID); err != nil {
+		return nil, fmt.Errorf("failed to read latest version: %v", err.Error())
+	}
+	if err := checkLatestVersion(version, latestID.Int32); err != nil {
+		return nil, err
+	}
+
+	results = &types.Summary{
+		StartedAt: graphql.Time{Time: time.Now()},
+		VersionID: version.ID,
+	}
+
+	for i, m := range migrations {
+		common.LogDebug(bc.ctx, "Rolling back migration type: %d, schema: %s, file: %s ", m.MigrationType, m.Schema, m.File)
+		if err := bc.execMigration(tx, m.Migration, m.Schema, rendered[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.ExecContext(bc.ctx, bc.dialect.GetMigrationsDeleteByVersionIDSQL(), version.ID); err != nil {
+		return nil, fmt.Errorf("failed to delete migration entries: %v", err.Error())
+	}
+	if _, err := tx.ExecContext(bc.ctx, bc.dialect.GetVersionSchemaSnapshotsDeleteSQL(), version.ID); err != nil {
+		return nil, fmt.Errorf("failed to delete schema snapshots: %v", err.Error())
+	}
+	if _, err := tx.ExecContext(bc.ctx, bc.dialect.GetVersionDeleteSQL(), version.ID); err != nil {
+		return nil, fmt.Errorf("failed to delete version entry: %v", err.Error())
+	}
+
+	computeRollbackSummary(results, migrations)
+	results.Duration = time.Since(results.StartedAt.Time).Seconds()
+
+	return results, nil
+}
+
+// checkLatestVersion returns error if version is not the latest version
+// down migrations of older versions would run against a schema already changed by newer versions
+func checkLatestVersion(version *types.Version, latestID int32) error {
+	if latestID > version.ID {
+		return &types.InvalidArgumentError{Argument: "ID", Err: fmt.Errorf("version %v is not the latest version, roll back version %v first", version.ID, latestID)}
+	}
+	return nil
+}
+
+// RepairChecksums replaces contents and checksums of applied DB migrations in all schemas with the ones of passed source migrations
+// every repair is recorded in the checksum repairs table together with the reason
+func (bc *baseConnector) RepairChecksums(migrations []types.Migration, reason string) (repairs []types.ChecksumRepair, err error) {
+	if err := bc.init(); err != nil {
+		return nil, err
+	}
+
+	conn, tx, err := bc.beginTx()
+	if err != nil {
+		return nil, err
+	}
+	defer bc.releaseLock(conn)
+
+	defer func() {
+		if err = bc.endTx(tx, "RepairChecksums", types.ActionApply, false, err); err != nil {
+			repairs = nil
+		}
+	}()
+
+	if err := bc.acquireLock(tx); err != nil {
+		return nil, err
+	}
+
+	appliedMigrations, err := bc.GetAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	repairs, err = computeChecksumRepairs(migrations, appliedMigrations, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	repaired := map[string]bool{}
+	for _, r := range repairs {
+		if !repaired[r.File] {
+			if _, err := tx.ExecContext(bc.ctx, bc.dialect.GetMigrationChecksumUpdateSQL(), r.NewContents, r.NewCheckSum, r.File); err != nil {
+				return nil, fmt.Errorf("failed to update DB migration checksum: %v", err.Error())
+			}
+			repaired[r.File] = true
+		}
+		if _, err := tx.ExecContext(bc.ctx, bc.dialect.GetChecksumRepairInsertSQL(), r.File, r.OldCheckSum, r.NewCheckSum, r.OldContents, r.NewContents, r.Reason); err != nil {
+			return nil, fmt.Errorf("failed to add checksum repair entry: %v", err.Error())
+		}
+	}
+
+	return repairs, nil
+}
+
+// beginTx starts transaction on a dedicated connection
+// session-level locks (MySQL named locks) must be released on the same connection on which they were acquired
+func (bc *baseConnector) beginTx() (*sql.Conn, *sql.Tx, error) {
+	conn, err := bc.db.Conn(bc.ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not obtain connection: %v", err.Error())
+	}
+	tx, err := conn.BeginTx(bc.ctx, nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("could not start transaction: %v", err.Error())
+	}
+	if err := bc.setDBLockTimeoutInTx(tx); err != nil {
+		tx.Rollback()
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, tx, nil
+}
+
+// setDBLockTimeoutInTx sets dbLockTimeout for the transaction so that a migration waiting for a DB lock fails fast
+// instead of queueing other sessions behind it, supported only by PostgreSQL
+func (bc *baseConnector) setDBLockTimeoutInTx(tx *sql.Tx) error {
+	timeout := bc.config.GetDBLockTimeout()
+	if timeout == 0 {
+		return nil
+	}
+	if lockTimeoutSQL := bc.dialect.GetDBLockTimeoutSQL(timeout); lockTimeoutSQL != "" {
+		if _, err := tx.ExecContext(bc.ctx, lockTimeoutSQL); err != nil {
+			return fmt.Errorf("could not set DB lock timeout: %v", err.Error())
+		}
+	}
+	return nil
+}
+
+// setDBLockTimeoutInSession sets dbLockTimeout for the session of a connection used by non-transactional migrations,
+// the returned function restores the default before the connection is returned to the pool, supported only by PostgreSQL
+func (bc *baseConnector) setDBLockTimeoutInSession(conn *sql.Conn) (func(), error) {
+	timeout := bc.config.GetDBLockTimeout()
+	if timeout == 0 || bc.dialect.GetSessionDBLockTimeoutSQL(timeout) == "" {
+		return func() {}, nil
+	}
+	if _, err := conn.ExecContext(bc.ctx, bc.dialect.GetSessionDBLockTimeoutSQL(timeout)); err != nil {
+		return nil, fmt.Errorf("could not set DB lock timeout: %v", err.Error())
+	}
+	return func() {
+		// the default is restored even when the request was cancelled
+		if _, err := conn.ExecContext(context.WithoutCancel(bc.ctx), bc.dialect.GetSessionDBLockTimeoutSQL(0)); err != nil {
+			common.LogError(bc.ctx, "Could not restore DB lock timeout: %v", err.Error())
+		}
+	}, nil
+}
+
+// execer is implemented by *sql.DB, *sql.Conn, and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// execMigration executes rendered contents of a migration, execution is cancelled when migration timeout
+// (timeout directive or migrationTimeout config option) is exceeded
+// inside transaction or on a dedicated connection the timeout is also set as DB statement timeout (supported only by PostgreSQL)
+func (bc *baseConnector) execMigration(e execer, m types.Migration, schema string, contents string) error {
+	timeout := m.Timeout
+	if timeout == 0 {
+		timeout = bc.config.GetMigrationTimeout()
+	}
+	if timeout == 0 {
+		if _, err := e.ExecContext(bc.ctx, contents); err != nil {
+			return &types.SQLError{File: m.File, Schema: schema, Err: err}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(bc.ctx, timeout)
+	defer cancel()
+	statementTimeoutSQL, defaultStatementTimeoutSQL := "", ""
+	switch e := e.(type) {
+	case *sql.Tx:
+		statementTimeoutSQL, defaultStatementTimeoutSQL = bc.dialect.GetStatementTimeoutSQL(timeout), bc.dialect.GetStatementTimeoutSQL(0)
+	case *sql.Conn:
+		if sessionTimeoutSQL := bc.dialect.GetSessionStatementTimeoutSQL(timeout); sessionTimeoutSQL != "" {
+			if _, err := e.ExecContext(bc.ctx, sessionTimeoutSQL); err != nil {
+				return &types.SQLError{File: m.File, Schema: schema, Err: err}
+			}
+			// session statement timeout is restored also when the migration failed, the connection is returned to the pool
+			defer func() {
+				if _, err := e.ExecContext(context.WithoutCancel(bc.ctx), bc.dialect.GetSessionStatementTimeoutSQL(0)); err != nil {
+					common.LogError(bc.ctx, "Could not restore statement timeout: %v", err.Error())
+				}
+			}()
+		}
+	}
+	if statementTimeoutSQL != "" {
+		if _, err := e.ExecContext(bc.ctx, statementTimeoutSQL); err != nil {
+			return &types.SQLError{File: m.File, Schema: schema, Err: err}
+		}
+	}
+	if _, err := e.ExecContext(ctx, contents); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("migration timed out after %v: %w", timeout, err)
+		}
+		return &types.SQLError{File: m.File, Schema: schema, Err: err}
+	}
+	if statementTimeoutSQL != "" {
+		if _, err := e.ExecContext(bc.ctx, defaultStatementTimeoutSQL); err != nil {
+			return &types.SQLError{File: m.File, Schema: schema, Err: err}
+		}
+	}
+	return nil
+}
+
+// endTx ends transaction started by operation, transaction is rolled back when operation failed (err is not nil) or in dry-run mode
+// returns err or commit error
+func (bc *baseConnector) endTx(tx *sql.Tx, operation string, action types.Action, dryRun bool, err error) error {
+	if err != nil {
+		common.LogError(bc.ctx, "%v failed, transaction rollback: %v", operation, err.Error())
+		tx.Rollback()
+		return err
+	}
+	if dryRun {
+		common.LogInfo(bc.ctx, "Running in dry-run mode, calling rollback")
+		tx.Rollback()
+		return nil
+	}
+	common.LogInfo(bc.ctx, "Running %v %v, committing transaction", operation, action)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %v", err.Error())
+	}
+	return nil
+}
+
+// acquireLock acquires migrator lock which guarantees that only one migrator instance modifies DB at a time
+// if the lock is not acquired within configured lock timeout acquireLock returns LockTimeoutError
+func (bc *baseConnector) acquireLock(tx *sql.Tx) error {
+	timeout := bc.config.GetLockTimeout()
+	deadline := time.Now().Add(timeout)
+	query := bc.dialect.GetAcquireLockSQL(timeout)
+	for {
+		var acquired sql.NullInt64
+		if err := tx.QueryRowContext(bc.ctx, query).Scan(&acquired); err != nil {
+			return fmt.Errorf("could not acquire migration lock: %v", err.Error())
+		}
+		if acquired.Valid && acquired.Int64 == 1 {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return &types.LockTimeoutError{Timeout: timeout}
+		}
+		common.LogInfo(bc.ctx, "Another migration is in progress, waiting for migration lock")
+		select {
+		case <-bc.ctx.Done():
+			return fmt.Errorf("could not acquire migration lock: %v", bc.ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// releaseLock releases migrator lock (if lock is not released on commit/rollback) and returns connection to the pool
+func (bc *baseConnector) releaseLock(conn *sql.Conn) {
+	if releaseLockSQL := bc.dialect.GetReleaseLockSQL(); releaseLockSQL != "" {
+		// lock must be released even when the request was cancelled, otherwise pooled connection would keep holding it
+		if _, err := conn.ExecContext(context.WithoutCancel(bc.ctx), releaseLockSQL); err != nil {
+			common.LogError(bc.ctx, "Could not release migration lock: %v", err.Error())
+		}
+	}
+	conn.Close()
+}
+
+// getTenantInsertSQL returns tenant insert SQL statement from configuration file
+// or, if absent, returns default Dialect-specific migrator tenant insert SQL
+func (bc *baseConnector) getTenantInsertSQL() string {
+	var tenantInsertSQL string
+	// if set explicitly in config use it
+	// otherwise use default value provided by Dialect implementation
+	tenantInsert := bc.config.GetTenantInsert()
+	if tenantInsert != "" {
+		// Log warning if using deprecated field
+		if bc.config.IsUsingDeprecatedTenantInsertSQL() {
+			common.LogWarn(bc.ctx, "tenantInsertSQL is deprecated since v2025.1.0 and will be removed in v2027.0.0. Use tenantInsert instead.")
+		}
+		tenantInsertSQL = tenantInsert
+	} else {
+		tenantInsertSQL = bc.dialect.GetTenantInsertSQL()
+	}
+	return tenantInsertSQL
+}
+
+// getSchemaPlaceHolder returns a schema placeholder which is
+// either the default one or overridden by user in config
+func (bc *baseConnector) getSchemaPlaceHolder() string {
+	var schemaPlaceHolder string
+	if bc.config.SchemaPlaceHolder != "" {
+		schemaPlaceHolder = bc.config.SchemaPlaceHolder
+	} else {
+		schemaPlaceHolder = defaultSchemaPlaceHolder
+	}
+	return schemaPlaceHolder
+}
+
+// renderMigrations renders contents of migrations for all their target schemas, migrations are rendered only when they are applied
+func (bc *baseConnector) renderMigrations(versionName string, action types.Action, migrations []types.Migration, tenants []types.Tenant) (renderedContents, error) {
+	if action != types.ActionApply {
+		return renderedContents{}, nil
+	}
+	return newContentsRenderer(bc.config, bc.getSchemaPlaceHolder(), versionName).renderMigrations(migrations, tenants, bc.targetSchemas)
+}
+
+func (bc *baseConnector) applyMigrationsInTx(tx *sql.Tx, versionName string, action types.Action, tenants []types.Tenant, migrations []types.Migration, schemasToApply map[string][]string, rendered renderedContents, dryRun bool) (*types.Summary, error) {
+
+	results := &types.Summary{
+		StartedAt: graphql.Time{Time: time.Now()},
+		Tenants:   int32(len(tenants)),
+	}
+
+	defer func() {
+		results.Duration = time.Since(results.StartedAt.Time).Seconds()
+		results.MigrationsGrandTotal = results.TenantMigrationsTotal + results.SingleMigrations
+		results.ScriptsGrandTotal = results.TenantScriptsTotal + results.SingleScripts
+	}()
+
+	versionID, err := bc.insertVersionInTx(tx, versionName)
+	if err != nil {
+		return nil, err
+	}
+	results.VersionID = versionID
+	if err := bc.applySchemaMigrationsInTx(tx, results.VersionID, action, migrations, schemasToApply, rendered, dryRun, results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// applyMigrationsInPhases applies migrations which contain non-transactional migrations, see applySchemaMigrationsInPhases
+// prepare (if not nil) and version insert are run in the first transaction
+func (bc *baseConnector) applyMigrationsInPhases(versionName string, action types.Action, tenants []types.Tenant, migrations []types.Migration, schemasToApply map[string][]string, rendered renderedContents, prepare func(tx *sql.Tx) error) (*types.Summary, error) {
+
+	results := &types.Summary{
+		StartedAt: graphql.Time{Time: time.Now()},
+		Tenants:   int32(len(tenants)),
+	}
+
+	defer func() {
+		results.Duration = time.Since(results.StartedAt.Time).Seconds()
+		results.MigrationsGrandTotal = results.TenantMigrationsTotal + results.SingleMigrations
+		results.ScriptsGrandTotal = results.TenantScriptsTotal + results.SingleScripts
+	}()
+
+	begin := func(tx *sql.Tx) error {
+		if prepare != nil {
+			if err := prepare(tx); err != nil {
+				return err
+			}
+		}
+		versionID, err := bc.insertVersionInTx(tx, versionName)
+		if err != nil {
+			return err
+		}
+		results.VersionID = versionID
+		return nil
+	}
+	if err := bc.applySchemaMigrationsInPhases(begin, action, migrations, schemasToApply, rendered, results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// applyMigrationsPerTenant applies single schema migrations and scripts in one transaction
+// and then tenant migrations and scripts in a separate transaction for every tenant, tenants are migrated by a pool of tenantConcurrency workers
+// a failed tenant does not roll back other tenants, it is reported in the summary and is retried by the next version
+func (bc *baseConnector) applyMigrationsPerTenant(versionName string, action types.Action, tenants []types.Tenant, migrations []types.Migration, schemasToApply map[string][]string, rendered renderedContents) (*types.Summary, error) {
+
+	results := &types.Summary{
+		StartedAt:        graphql.Time{Time: time.Now()},
+		Tenants:          int32(len(tenants)),
+		SucceededTenants: []string{},
+		FailedTenants:    []types.TenantFailure{},
+		TenantDurations:  []types.TenantDuration{},
+	}
+
+	defer func() {
+		results.Duration = time.Since(results.StartedAt.Time).Seconds()
+		results.MigrationsGrandTotal = results.TenantMigrationsTotal + results.SingleMigrations
+		results.ScriptsGrandTotal = results.TenantScriptsTotal + results.SingleScripts
+	}()
+
+	singleMigrations := []types.Migration{}
+	tenantMigrations := []types.Migration{}
+	for _, m := range migrations {
+		if m.MigrationType == types.MigrationTypeTenantMigration || m.MigrationType == types.MigrationTypeTenantScript {
+			tenantMigrations = append(tenantMigrations, m)
+		} else {
+			singleMigrations = append(singleMigrations, m)
+		}
+	}
+
+	begin := func(tx *sql.Tx) error {
+		versionID, err := bc.insertVersionInTx(tx, versionName)
+		if err != nil {
+			return err
+		}
+		results.VersionID = versionID
+		return nil
+	}
+	if err := bc.applySchemaMigrationsInPhases(begin, action, singleMigrations, schemasToApply, rendered, results); err != nil {
+		return nil, err
+	}
+
+	for _, m := range tenantMigrations {
+		if m.MigrationType == types.MigrationTypeTenantMigration {
+			results.TenantMigrations++
+		} else {
+			results.TenantScripts++
+		}
+	}
+
+	// outcomes are indexed by tenant position so that results are reported in tenants order
+	type tenantOutcome struct {
+		applied  bool
+		results  *types.Summary
+		err      error
+		duration float64
+	}
+	outcomes := make([]tenantOutcome, len(tenants))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < bc.config.GetTenantConcurrency(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				tenant := tenants[i].Name
+				tenantSchemasToApply := map[string][]string{}
+				for _, m := range tenantMigrations {
+					for _, s := range schemasToApply[m.File] {
+						if s == tenant {
+							tenantSchemasToApply[m.File] = []string{s}
+						}
+					}
+				}
+				if len(tenantSchemasToApply) == 0 {
+					continue
+				}
+
+				startedAt := time.Now()
+				tenantResults := &types.Summary{VersionID: results.VersionID}
+				err := bc.applySchemaMigrationsInPhases(nil, action, tenantMigrations, tenantSchemasToApply, rendered, tenantResults)
+				outcomes[i] = tenantOutcome{applied: true, results: tenantResults, err: err, duration: time.Since(startedAt).Seconds()}
+			}
+		}()
+	}
+	for i := range tenants {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, o := range outcomes {
+		if !o.applied {
+			continue
+		}
+		tenant := tenants[i].Name
+		results.TenantDurations = append(results.TenantDurations, types.TenantDuration{Tenant: tenant, Duration: o.duration})
+		if o.err != nil {
+			common.LogError(bc.ctx, "Tenant %v failed, transaction rolled back: %v", tenant, o.err.Error())
+			results.FailedTenants = append(results.FailedTenants, types.TenantFailure{Tenant: tenant, Error: o.err.Error()})
+			continue
+		}
+		results.SucceededTenants = append(results.SucceededTenants, tenant)
+		results.TenantMigrationsTotal += o.results.TenantMigrationsTotal
+		results.TenantScriptsTotal += o.results.TenantScriptsTotal
+		for _, file := range o.results.NonTransactional {
+			results.NonTransactional = appendUnique(results.NonTransactional, file)
+		}
+	}
+
+	return results, nil
+}
+
+// runInTx runs fn in a new transaction, the transaction is committed when fn succeeds and rolled back when fn returns an error
+func (bc *baseConnector) runInTx(fn func(tx *sql.Tx) error) error {
+	tx, err := bc.db.BeginTx(bc.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %v", err.Error())
+	}
+	if err := bc.setDBLockTimeoutInTx(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %v", err.Error())
+	}
+	return nil
+}
+
+// insertVersionInTx inserts new version and returns its ID
+func (bc *baseConnector) insertVersionInTx(tx *sql.Tx, versionName string) (int32, error) {
+	var versionID int64
+	versionInsertSQL := bc.dialect.GetVersionInsertSQL()
+	versionInsert, err := bc.db.PrepareContext(bc.ctx, versionInsertSQL)
+	if err != nil {
+		return 0, fmt.Errorf("could not create prepared statement for version: %v", err)
+	}
+	stmt := tx.Stmt(versionInsert)
+	if bc.dialect.LastInsertIDSupported() {
+		result, err := stmt.ExecContext(bc.ctx, versionName)
+		if err != nil {
+			return 0, fmt.Errorf("failed to add version entry: %v", err)
+		}
+		versionID, _ = result.LastInsertId()
+	} else if err := stmt.QueryRowContext(bc.ctx, versionName).Scan(&versionID); err != nil {
+		return 0, fmt.Errorf("failed to add version entry: %v", err)
+	}
+	return int32(versionID), nil
+}
+
+// applySchemaMigrationInTx applies a rendered migration to a single schema and records it in a given version
+// non-transactional migrations reach the transaction only in dry-run mode in which they are not executed, see applySchemaMigrationsInPhases
+func (bc *baseConnector) applySchemaMigrationInTx(tx *sql.Tx, insert *sql.Stmt, versionID int32, action types.Action, m types.Migration, schema string, contents string, dryRun bool, results *types.Summary) error {
+	if bc.isNonTransactional(action, m) {
+		if !dryRun {
+			return fmt.Errorf("non-transactional migration %v cannot be applied in a transaction", m.File)
+		}
+		results.NonTransactional = appendUnique(results.NonTransactional, m.File)
+		common.LogInfo(bc.ctx, "Running in dry-run mode, non-transactional migration %v not executed", m.File)
+	} else if action == types.ActionApply {
+		if err := bc.execMigration(tx, m, schema, contents); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Stmt(insert).ExecContext(bc.ctx, m.Name, m.SourceDir, m.File, m.MigrationType, schema, m.Contents, m.CheckSum, int64(versionID)); err != nil {
+		return fmt.Errorf("failed to add migration entry: %v", err.Error())
+	}
+	return nil
+}
+
+// applySchemaMigrationsInTx applies rendered migrations to the passed schemas (key is Migration.File), records them in a given version and updates results
+// migrations marked with NoTransaction are recorded but not executed, they are passed here only in dry-run mode
+// raw contents are recorded so that checksums of source and applied migrations can be compared
+func (bc *baseConnector) applySchemaMigrationsInTx(tx *sql.Tx, versionID int32, action types.Action, migrations []types.Migration, schemasToApply map[string][]string, rendered renderedContents, dryRun bool, results *types.Summary) error {
+	insertMigrationSQL := bc.dialect.GetMigrationInsertSQL()
+	insert, err := bc.db.PrepareContext(bc.ctx, insertMigrationSQL)
+	if err != nil {
+		return fmt.Errorf("could not create prepared statement for migration: %v", err)
+	}
+
+	for _, m := range migrations {
+		schemas := schemasToApply[m.File]
+
+		for _, s := range schemas {
+			common.LogDebug(bc.ctx, "Applying migration type: %d, schema: %s, file: %s ", m.MigrationType, s, m.File)
+
+			started := publishMigrationStarted(bc.ctx, versionID, m, s)
+			err := bc.applySchemaMigrationInTx(tx, insert, versionID, action, m, s, rendered[m.File][s], dryRun, results)
+			publishMigrationFinished(bc.ctx, versionID, m, s, started, err)
+			if err != nil {
+				return err
+			}
+			progressFromContext(bc.ctx).step()
+		}
+
+		countAppliedMigration(results, m, len(schemas))
+	}
+	return nil
+}
+
+// applySchemaMigrationsInPhases applies rendered migrations which contain non-transactional migrations, the order of migrations is kept:
+// migrations preceding a non-transactional migration are committed before it is executed, so that it sees their effects
+// (for example a table created earlier in the same version) and does not wait for locks held by an open transaction,
+// then the non-transactional migration is executed outside of any transaction and recorded as soon as it succeeds in a schema,
+// a failure rolls back only migrations applied after the last non-transactional migration, all migrations applied before stay recorded
+// begin (if not nil) is run in the first transaction, it must set results.VersionID if it is not set
+func (bc *baseConnector) applySchemaMigrationsInPhases(begin func(tx *sql.Tx) error, action types.Action, migrations []types.Migration, schemasToApply map[string][]string, rendered renderedContents, results *types.Summary) error {
+	phase := []types.Migration{}
+	commitPhase := func() error {
+		if len(phase) == 0 && begin == nil {
+			return nil
+		}
+		err := bc.runInTx(func(tx *sql.Tx) error {
+			if begin != nil {
+				if err := begin(tx); err != nil {
+					return err
+				}
+			}
+			return bc.applySchemaMigrationsInTx(tx, results.VersionID, action, phase, schemasToApply, rendered, false, results)
+		})
+		begin = nil
+		phase = []types.Migration{}
+		return err
+	}
+
+	for _, m := range migrations {
+		if !bc.isNonTransactional(action, m) {
+			phase = append(phase, m)
+			continue
+		}
+		if err := commitPhase(); err != nil {
+			return err
+		}
+		if err := bc.applyNonTransactionalMigration(results.VersionID, m, schemasToApply[m.File], rendered, results); err != nil {
+			return err
+		}
+	}
+	return commitPhase()
+}
+
+// applyNonTransactionalMigration executes a rendered migration outside of any transaction and records it in a given version
+// in every schema as soon as it succeeds, so that a later failure does not leave an applied migration without its record
+func (bc *baseConnector) applyNonTransactionalMigration(versionID int32, m types.Migration, schemas []string, rendered renderedContents, results *types.Summary) error {
+	// migration is executed and recorded on a dedicated connection so that DB lock and statement timeouts can be set for its session
+	conn, err := bc.db.Conn(bc.ctx)
+	if err != nil {
+		return fmt.Errorf("could not obtain connection: %v", err.Error())
+	}
+	defer conn.Close()
+
+	insertMigrationSQL := bc.dialect.GetMigrationInsertSQL()
+	insert, err := conn.PrepareContext(bc.ctx, insertMigrationSQL)
+	if err != nil {
+		return fmt.Errorf("could not create prepared statement for migration: %v", err)
+	}
+	defer insert.Close()
+
+	restoreDBLockTimeout, err := bc.setDBLockTimeoutInSession(conn)
+	if err != nil {
+		return err
+	}
+	defer restoreDBLockTimeout()
+
+	results.NonTransactional = appendUnique(results.NonTransactional, m.File)
+	for _, s := range schemas {
+		common.LogDebug(bc.ctx, "Applying non-transactional migration type: %d, schema: %s, file: %s ", m.MigrationType, s, m.File)
+
+		started := publishMigrationStarted(bc.ctx, versionID, m, s)
+		err := bc.execMigration(conn, m, s, rendered[m.File][s])
+		if err == nil {
+			if _, insertErr := insert.ExecContext(bc.ctx, m.Name, m.SourceDir, m.File, m.MigrationType, s, m.Contents, m.CheckSum, int64(versionID)); insertErr != nil {
+				err = fmt.Errorf("failed to add migration entry: %v", insertErr.Error())
+			}
+		}
+		publishMigrationFinished(bc.ctx, versionID, m, s, started, err)
+		if err != nil {
+			return err
+		}
+		progressFromContext(bc.ctx).step()
+	}
+
+	countAppliedMigration(results, m, len(schemas))
+	return nil
+}
+
+// isNonTransactional returns true if migration is executed outside of a transaction
+func (bc *baseConnector) isNonTransactional(action types.Action, m types.Migration) bool {
+	return action == types.ActionApply && m.NoTransaction && bc.dialect.NoTransactionSupported()
+}
+
+// hasNonTransactionalMigrations returns true if any of migrations is executed outside of a transaction
+func (bc *baseConnector) hasNonTransactionalMigrations(action types.Action, migrations []types.Migration) bool {
+	for _, m := range migrations {
+		if bc.isNonTransactional(action, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// countAppliedMigration updates results with a migration applied to the passed number of schemas
+func countAppliedMigration(results *types.Summary, m types.Migration, schemas int) {
+	switch m.MigrationType {
+	case types.MigrationTypeSingleMigration:
+		results.SingleMigrations++
+	case types.MigrationTypeSingleScript:
+		results.SingleScripts++
+	case types.MigrationTypeTenantMigration:
+		results.TenantMigrations++
+		results.TenantMigrationsTotal += int32(schemas)
+	case types.MigrationTypeTenantScript:
+		results.TenantScripts++
+		results.TenantScriptsTotal += int32(schemas)
+	}
+}
+
+// targetSchemas returns all schemas to which given migration is applied
+func (bc *baseConnector) targetSchemas(m types.Migration, tenants []types.Tenant) []string {
+	if m.MigrationType == types.MigrationTypeTenantMigration || m.MigrationType == types.MigrationTypeTenantScript {
+		schemas := []string{}
+		for _, t := range tenants {
+			schemas = append(schemas, t.Name)
+		}
+		return schemas
+	}
+	return []string{filepath.Base(m.SourceDir)}
+}
+
+func (bc *baseConnector) HealthCheck() error {
+	if err := bc.init(); err != nil {
+		return err
+	}
+	return bc.db.Ping()
+}
+
+// computeSchemasToApply returns schemas to which migrations should be applied, key is Migration.File
+// a migration already applied to all its schemas means that another migrator instance has just applied it
+func computeSchemasToApply(migrations []types.Migration, appliedMigrations []types.DBMigration, tenants []types.Tenant, targetSchemas func(types.Migration, []types.Tenant) []string) (map[string][]string, error) {
+	schemasToApply := pendingSchemas(migrations, appliedMigrations, tenants, targetSchemas)
+	for _, m := range migrations {
+		if m.OnChange || m.MigrationType == types.MigrationTypeSingleScript || m.MigrationType == types.MigrationTypeTenantScript {
+			continue
+		}
+		if len(targetSchemas(m, tenants)) > 0 && len(schemasToApply[m.File]) == 0 {
+			return nil, fmt.Errorf("another migration is in progress or has just finished, migration %v has already been applied", m.File)
+		}
+	}
+	return schemasToApply, nil
+}
+
+// pendingSchemas returns schemas in which migrations are not applied yet, key is Migration.File
+// schemas in which a migration is already applied (for example tenants which succeeded in a previous version) are skipped
+// scripts are applied every time, on-change scripts only to schemas in which the last applied checksum differs
+func pendingSchemas(migrations []types.Migration, appliedMigrations []types.DBMigration, tenants []types.Tenant, targetSchemas func(types.Migration, []types.Tenant) []string) map[string][]string {
+	type appliedKey struct{ file, schema string }
+	applied := map[appliedKey]bool{}
+	// scripts are recorded every time they are applied, the most recent entry holds the last applied checksum
+	lastApplied := map[appliedKey]types.DBMigration{}
+	for _, m := range appliedMigrations {
+		key := appliedKey{m.File, m.Schema}
+		applied[key] = true
+		if last, ok := lastApplied[key]; !ok || !m.Created.Time.Before(last.Created.Time) {
+			lastApplied[key] = m
+		}
+	}
+
+	schemasToApply := map[string][]string{}
+	for _, m := range migrations {
+		schemas := targetSchemas(m, tenants)
+		if m.OnChange {
+			changed := []string{}
+			for _, s := range schemas {
+				if last, ok := lastApplied[appliedKey{m.File, s}]; !ok || last.CheckSum != m.CheckSum {
+					changed = append(changed, s)
+				}
+			}
+			schemasToApply[m.File] = changed
+			continue
+		}
+		if m.MigrationType == types.MigrationTypeSingleScript || m.MigrationType == types.MigrationTypeTenantScript {
+			schemasToApply[m.File] = schemas
+			continue
+		}
+		pending := []string{}
+		for _, s := range schemas {
+			if !applied[appliedKey{m.File, s}] {
+				pending = append(pending, s)
+			}
+		}
+		schemasToApply[m.File] = pending
+	}
+	return schemasToApply
+}
+
+// newPlanVerifier returns a function which recomputes the plan from passed applied migrations and tenants selected when it is called
+// and returns PlanChangedError if its hash differs from the expected one, nil is returned when planCheck is nil
+func newPlanVerifier(planCheck *types.PlanCheck, migrations []types.Migration, selectTenants func() ([]types.Tenant, error), targetSchemas func(types.Migration, []types.Tenant) []string) func([]types.DBMigration) error {
+	if planCheck == nil {
+		return nil
+	}
+	return func(appliedMigrations []types.DBMigration) error {
+		// tenants are read again, a tenant created or removed since the plan was made changes the plan hash
+		tenants, err := selectTenants()
+		if err != nil {
+			return err
+		}
+		// migrations applied since the plan was made are planned with no schemas and change the plan hash
+		schemasToApply := pendingSchemas(migrations, appliedMigrations, tenants, targetSchemas)
+		if plan := types.NewPlan(planCheck.SourceMigrations, migrations, schemasToApply, tenants); plan.Hash != planCheck.Hash {
+			return &types.PlanChangedError{Expected: planCheck.Hash, Actual: plan.Hash}
+		}
+		return nil
+	}
+}
+
+// skipUnchangedScripts removes on-change scripts which are not applied to any schema
+// returns remaining migrations and the number of schemas in which on-change scripts were skipped
+func skipUnchangedScripts(migrations []types.Migration, schemasToApply map[string][]string, tenants []types.Tenant, targetSchemas func(types.Migration, []types.Tenant) []string) ([]types.Migration, int32) {
+	var skipped int32
+	remaining := []types.Migration{}
+	for _, m := range migrations {
+		if m.OnChange {
+			skipped += int32(len(targetSchemas(m, tenants)) - len(schemasToApply[m.File]))
+			if len(schemasToApply[m.File]) == 0 {
+				continue
+			}
+		}
+		remaining = append(remaining, m)
+	}
+	return remaining, skipped
+}
+
+// computeChecksumRepairs returns checksum repairs of passed source migrations, one repair for every distinct applied checksum
+// a migration could be applied to different schemas with different contents, for example a tenant migration modified before a new tenant was created
+// migrations which were not applied are reported as not found, migrations which checksum already matches are skipped
+func computeChecksumRepairs(migrations []types.Migration, appliedMigrations []types.DBMigration, reason string) ([]types.ChecksumRepair, error) {
+	repairs := []types.ChecksumRepair{}
+	for _, m := range migrations {
+		applied := false
+		// key is old checksum, value is index in repairs
+		indexes := map[string]int{}
+		for _, a := range appliedMigrations {
+			if a.File != m.File {
+				continue
+			}
+			applied = true
+			if a.CheckSum == m.CheckSum {
+				continue
+			}
+			if i, ok := indexes[a.CheckSum]; ok {
+				repairs[i].Schemas++
+				continue
+			}
+			indexes[a.CheckSum] = len(repairs)
+			repairs = append(repairs, types.ChecksumRepair{File: m.File, OldCheckSum: a.CheckSum, NewCheckSum: m.CheckSum, OldContents: a.Contents, NewContents: m.Contents, Reason: reason, Schemas: 1})
+		}
+		if !applied {
+			return nil, &types.NotFoundError{Resource: "DB migration", ID: m.File}
+		}
+	}
+	return repairs, nil
+}
+
+// computeRollbackSummary updates summary with the numbers of rolled back migrations and scripts
+func computeRollbackSummary(results *types.Summary, migrations []types.DBMigration) {
+	tenants := map[string]bool{}
+	tenantFiles := map[string]bool{}
+	for _, m := range migrations {
+		switch m.MigrationType {
+		case types.MigrationTypeSingleMigration:
+			results.SingleMigrations++
+		case types.MigrationTypeSingleScript:
+			results.SingleScripts++
+		case types.MigrationTypeTenantMigration:
+			if !tenantFiles[m.File] {
+				results.TenantMigrations++
+			}
+			results.TenantMigrationsTotal++
+		case types.MigrationTypeTenantScript:
+			if !tenantFiles[m.File] {
+				results.TenantScripts++
+			}
+			results.TenantScriptsTotal++
+		}
+		if m.MigrationType == types.MigrationTypeTenantMigration || m.MigrationType == types.MigrationTypeTenantScript {
+			tenants[m.Schema] = true
+			tenantFiles[m.File] = true
+		}
+	}
+	results.Tenants = int32(len(tenants))
+	results.MigrationsGrandTotal = results.TenantMigrationsTotal + results.SingleMigrations
+	results.ScriptsGrandTotal = results.TenantScriptsTotal + results.SingleScripts
+}
+
+// appendUnique appends value to values unless it is already there
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
 }
@@ -3,8 +3,10 @@ package db
 import (
 	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
 )
 
 var isValidIdentifier = regexp.MustCompile(`^[A-Za-z0-9_-]+$`).MatchString
@@ -24,7 +26,50 @@ type dialect interface {
 	GetVersionsSelectSQL() string
 	GetVersionsByFileSQL() string
 	GetVersionByIDSQL() string
+	GetVersionDeleteSQL() string
+	GetLatestVersionIDSQL() string
+	GetMigrationsDeleteByVersionIDSQL() string
+	GetCreateChecksumRepairsTableSQL() string
+	GetChecksumRepairInsertSQL() string
+	GetMigrationChecksumUpdateSQL() string
+	GetCreateTenantLabelsTableSQL() string
+	GetTenantLabelsSelectSQL() string
+	GetTenantLabelsDeleteSQL() string
+	GetTenantLabelInsertSQL() string
+	GetTenantLabelsRenameSQL() string
+	GetCreateArchivedTenantsTableSQL() string
+	GetArchivedTenantsSelectSQL() string
+	GetArchivedTenantInsertSQL() string
+	GetArchivedTenantDeleteSQL() string
+	GetArchivedTenantRenameSQL() string
+	GetCreateSchemaSnapshotsTableSQL() string
+	GetSchemaSnapshotsSelectSQL() string
+	GetVersionSchemaSnapshotsSelectSQL() string
+	GetSchemaSnapshotInsertSQL() string
+	GetVersionSchemaSnapshotsDeleteSQL() string
+	GetCreateJobsTableSQL() string
+	GetJobInsertSQL() string
+	GetJobUpdateSQL() string
+	GetJobByIDSQL() string
+	GetJobFailStaleSQL() string
+	GetTenantDeleteSQL() string
+	GetTenantRenameSQL() string
+	GetMigrationsDeleteBySchemaSQL() string
+	GetMigrationsSchemaRenameSQL() string
+	GetSchemaTablesSQL() string
+	GetSchemaObjectsSQL() string
+	NormalizeSchemaObjects(string, []types.SchemaObject)
+	GetDropSchemaSQL(string, []string) []string
+	GetRenameSchemaSQL(string, string, []string) []string
+	GetAcquireLockSQL(time.Duration) string
+	GetReleaseLockSQL() string
+	GetDBLockTimeoutSQL(time.Duration) string
+	GetStatementTimeoutSQL(time.Duration) string
+	GetSessionDBLockTimeoutSQL(time.Duration) string
+	GetSessionStatementTimeoutSQL(time.Duration) string
 	LastInsertIDSupported() bool
+	NoTransactionSupported() bool
+	SchemasMappedToTablePrefixes() bool
 }
 
 // baseDialect struct is used to provide default dialect interface implementation
@@ -33,8 +78,9 @@ type baseDialect struct {
 
 const (
 	selectVersionsSQL        = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id order by vid desc, mid asc"
-	selectMigrationsSQL      = "select name, source_dir as sd, filename, type, db_schema, created, contents, checksum from %v.%v order by name, source_dir"
+	selectMigrationsSQL      = "select name, source_dir as sd, filename, type, db_schema, created, contents, checksum from %v.%v order by name, source_dir, id"
 	selectTenantsSQL         = "select name from %v.%v"
+	selectLatestVersionIDSQL = "select max(id) from %v.%v"
 	createMigrationsTableSQL = `
 create table if not exists %v.%v (
   id serial primary key,
@@ -54,6 +100,64 @@ create table if not exists %v.%v (
   name varchar(200) not null,
   created timestamp default now()
 )
+`
+	createSchemaSnapshotsTableSQL = `
+create table if not exists %v.%v (
+  id serial primary key,
+  version_id int not null,
+  db_schema varchar(200) not null,
+  type int not null,
+  fingerprint varchar(64) not null,
+  objects text not null,
+  created timestamp default now()
+)
+`
+	createChecksumRepairsTableSQL = `
+create table if not exists %v.%v (
+  id serial primary key,
+  filename varchar(200) not null,
+  old_checksum varchar(64),
+  new_checksum varchar(64),
+  old_contents text,
+  new_contents text,
+  reason text not null,
+  created timestamp default now()
+)
+`
+	createTenantLabelsTableSQL = `
+create table if not exists %v.%v (
+  id serial primary key,
+  tenant varchar(200) not null,
+  label_key varchar(200) not null,
+  label_value varchar(200) not null,
+  created timestamp default now()
+)
+`
+	selectSchemaSnapshotsSQL      = "select version_id, db_schema, type, fingerprint, objects from %v.%v order by version_id, type, db_schema"
+	selectTenantLabelsSQL         = "select tenant, label_key, label_value from %v.%v order by tenant, label_key"
+	createArchivedTenantsTableSQL = `
+create table if not exists %v.%v (
+  id serial primary key,
+  name varchar(200) not null,
+  created timestamp default now()
+)
+`
+	selectArchivedTenantsSQL = "select name from %v.%v"
+	createJobsTableSQL       = `
+create table if not exists %v.%v (
+  id serial primary key,
+  operation varchar(200) not null,
+  name varchar(200) not null,
+  status varchar(20) not null,
+  applied int not null default 0,
+  total int not null default 0,
+  summary text,
+  error text,
+  owner varchar(200),
+  heartbeat timestamp null,
+  created timestamp default now(),
+  updated timestamp default now()
+)
 `
 	createSchemaSQL = "create schema if not exists %v"
 )
@@ -70,6 +174,54 @@ func (bd *baseDialect) GetCreateMigrationsTableSQL() string {
 	return fmt.Sprintf(createMigrationsTableSQL, migratorSchema, migratorMigrationsTable)
 }
 
+// GetCreateChecksumRepairsTableSQL returns migrator's create checksum repairs (audit) table SQL statement.
+// This SQL is used by both MySQL and PostgreSQL.
+func (bd *baseDialect) GetCreateChecksumRepairsTableSQL() string {
+	return fmt.Sprintf(createChecksumRepairsTableSQL, migratorSchema, migratorChecksumRepairsTable)
+}
+
+// GetCreateTenantLabelsTableSQL returns migrator's create tenant labels table SQL statement.
+// This SQL is used by both MySQL and PostgreSQL.
+func (bd *baseDialect) GetCreateTenantLabelsTableSQL() string {
+	return fmt.Sprintf(createTenantLabelsTableSQL, migratorSchema, migratorTenantLabelsTable)
+}
+
+// GetTenantLabelsSelectSQL returns migrator's tenant labels select SQL statement.
+// This SQL is used by all MySQL, PostgreSQL, and MS SQL.
+func (bd *baseDialect) GetTenantLabelsSelectSQL() string {
+	return fmt.Sprintf(selectTenantLabelsSQL, migratorSchema, migratorTenantLabelsTable)
+}
+
+// GetCreateArchivedTenantsTableSQL returns migrator's create archived tenants table SQL statement.
+// This SQL is used by both MySQL and PostgreSQL.
+func (bd *baseDialect) GetCreateArchivedTenantsTableSQL() string {
+	return fmt.Sprintf(createArchivedTenantsTableSQL, migratorSchema, migratorArchivedTenantsTable)
+}
+
+// GetArchivedTenantsSelectSQL returns migrator's archived tenants select SQL statement.
+// This SQL is used by all MySQL, PostgreSQL, and MS SQL.
+func (bd *baseDialect) GetArchivedTenantsSelectSQL() string {
+	return fmt.Sprintf(selectArchivedTenantsSQL, migratorSchema, migratorArchivedTenantsTable)
+}
+
+// GetCreateSchemaSnapshotsTableSQL returns migrator's default create schema snapshots table SQL statement.
+// This SQL is used by both MySQL and PostgreSQL.
+func (bd *baseDialect) GetCreateSchemaSnapshotsTableSQL() string {
+	return fmt.Sprintf(createSchemaSnapshotsTableSQL, migratorSchema, migratorSchemaSnapshotsTable)
+}
+
+// GetSchemaSnapshotsSelectSQL returns migrator's default schema snapshots select SQL statement.
+// This SQL is used by MySQL, PostgreSQL, and MS SQL.
+func (bd *baseDialect) GetSchemaSnapshotsSelectSQL() string {
+	return fmt.Sprintf(selectSchemaSnapshotsSQL, migratorSchema, migratorSchemaSnapshotsTable)
+}
+
+// GetCreateJobsTableSQL returns migrator's create jobs table SQL statement.
+// This SQL is used by both MySQL and PostgreSQL.
+func (bd *baseDialect) GetCreateJobsTableSQL() string {
+	return fmt.Sprintf(createJobsTableSQL, migratorSchema, migratorJobsTable)
+}
+
 // GetTenantSelectSQL returns migrator's default tenant select SQL statement.
 // This SQL is used by all MySQL, PostgreSQL, and MS SQL.
 func (bd *baseDialect) GetTenantSelectSQL() string {
@@ -97,6 +249,66 @@ func (bd *baseDialect) GetVersionsSelectSQL() string {
 	return fmt.Sprintf(selectVersionsSQL, migratorSchema, migratorVersionsTable, migratorSchema, migratorMigrationsTable)
 }
 
+// GetLatestVersionIDSQL returns select SQL statement that returns ID of the latest version
+// This SQL is used by all MySQL, PostgreSQL, and MS SQL.
+func (bd *baseDialect) GetLatestVersionIDSQL() string {
+	return fmt.Sprintf(selectLatestVersionIDSQL, migratorSchema, migratorVersionsTable)
+}
+
+// GetReleaseLockSQL returns SQL statement which releases migrator lock.
+// Locks used by PostgreSQL, MS SQL, and SQLite are owned by the transaction and released on commit/rollback.
+func (bd *baseDialect) GetReleaseLockSQL() string {
+	return ""
+}
+
+// GetDBLockTimeoutSQL returns SQL statement which sets DB lock timeout for the current transaction.
+// This is supported only by PostgreSQL, other databases rely on cancellation of migration context.
+func (bd *baseDialect) GetDBLockTimeoutSQL(timeout time.Duration) string {
+	return ""
+}
+
+// GetStatementTimeoutSQL returns SQL statement which sets statement timeout for the current transaction.
+// This is supported only by PostgreSQL, other databases rely on cancellation of migration context.
+func (bd *baseDialect) GetStatementTimeoutSQL(timeout time.Duration) string {
+	return ""
+}
+
+// GetSessionDBLockTimeoutSQL returns SQL statement which sets DB lock timeout for the current session, it is used by non-transactional migrations.
+// This is supported only by PostgreSQL, other databases rely on cancellation of migration context.
+func (bd *baseDialect) GetSessionDBLockTimeoutSQL(timeout time.Duration) string {
+	return ""
+}
+
+// GetSessionStatementTimeoutSQL returns SQL statement which sets statement timeout for the current session, it is used by non-transactional migrations.
+// This is supported only by PostgreSQL, other databases rely on cancellation of migration context.
+func (bd *baseDialect) GetSessionStatementTimeoutSQL(timeout time.Duration) string {
+	return ""
+}
+
+// NoTransactionSupported instructs migrator if migrations can be executed outside of the version transaction.
+// This is supported by all MySQL, PostgreSQL, MS SQL, and SQLite.
+// Migrations preceding a non-transactional migration are committed before it is executed, the version transaction only holds migrator lock.
+func (bd *baseDialect) NoTransactionSupported() bool {
+	return true
+}
+
+// SchemasMappedToTablePrefixes instructs migrator if schemas are mapped to table name prefixes instead of DB schemas.
+// This is used only by SQLite, MySQL, PostgreSQL, and MS SQL support schemas.
+func (bd *baseDialect) SchemasMappedToTablePrefixes() bool {
+	return false
+}
+
+// NormalizeSchemaObjects removes schema qualifiers from names and definitions of schema objects
+// so that objects of different tenants can be compared, for example nextval('abc.orders_id_seq') becomes nextval('orders_id_seq').
+// This is used by MySQL, PostgreSQL, and MS SQL.
+func (bd *baseDialect) NormalizeSchemaObjects(schema string, objects []types.SchemaObject) {
+	qualifier := regexp.MustCompile(`(^|[^A-Za-z0-9_])["\x60\[]?` + regexp.QuoteMeta(schema) + `["\x60\]]?\.`)
+	for i := range objects {
+		objects[i].Name = qualifier.ReplaceAllString(objects[i].Name, "$1")
+		objects[i].Definition = qualifier.ReplaceAllString(objects[i].Definition, "$1")
+	}
+}
+
 // newDialect constructs dialect instance based on the passed Config
 func newDialect(config *config.Config) dialect {
 
@@ -107,14 +319,24 @@ func newDialect(config *config.Config) dialect {
 		dialect = &mySQLDialect{}
 	case "sqlserver":
 		dialect = &msSQLDialect{}
+	case "sqlite":
+		dialect = &sqliteDialect{}
 	case "postgres":
 		dialect = &postgreSQLDialect{}
-		// migrator switched to jackc/pgx PostgreSQL driver
-		// for backward compatibility the external Driver name is still "postgres" but internally it's now "pgx"
-		config.Driver = "pgx"
+		config.Driver = sqlDriverName(config.Driver)
 	default:
 		panic(fmt.Sprintf("Failed to create Connector unknown driver: %v", config.Driver))
 	}
 
 	return dialect
 }
+
+// sqlDriverName returns the name under which database/sql driver for the passed Driver is registered
+// migrator switched to jackc/pgx PostgreSQL driver
+// for backward compatibility the external Driver name is still "postgres" but internally it's now "pgx"
+func sqlDriverName(driver string) string {
+	if driver == "postgres" {
+		return "pgx"
+	}
+	return driver
+}
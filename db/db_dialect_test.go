@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -88,3 +89,21 @@ func TestBaseDialectGetVersionsSelectSQL(t *testing.T) {
 
 	assert.Equal(t, expected, versionsSelectSQL)
 }
+
+func TestBaseDialectNormalizeSchemaObjects(t *testing.T) {
+	dialect := &postgreSQLDialect{}
+
+	objects := []types.SchemaObject{
+		{Type: "column", Name: "orders.id", Definition: "integer not null default nextval('abc.orders_id_seq'::regclass)"},
+		{Type: "index", Name: "orders.orders_pkey", Definition: "CREATE UNIQUE INDEX orders_pkey ON abc.orders USING btree (id)"},
+		{Type: "constraint", Name: "orders.fk_customer", Definition: `FOREIGN KEY (customer_id) REFERENCES "abc"."customers"(id)`},
+		{Type: "column", Name: "orders.xabc_id", Definition: "xabc.type"},
+	}
+	dialect.NormalizeSchemaObjects("abc", objects)
+
+	assert.Equal(t, "integer not null default nextval('orders_id_seq'::regclass)", objects[0].Definition)
+	assert.Equal(t, "CREATE UNIQUE INDEX orders_pkey ON orders USING btree (id)", objects[1].Definition)
+	assert.Equal(t, `FOREIGN KEY (customer_id) REFERENCES "customers"(id)`, objects[2].Definition)
+	// other schemas which end with tenant name are not touched
+	assert.Equal(t, "xabc.type", objects[3].Definition)
+}
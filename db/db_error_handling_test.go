@@ -105,6 +105,151 @@ func TestInitCannotCreateMigratorVersionsTable(t *testing.T) {
 	}
 }
 
+func TestInitCannotCreateMigratorChecksumRepairsTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, false}
+
+	mock.ExpectBegin()
+	// don't have to provide full SQL here - patterns at work
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	// create versions table is a script
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnError(errors.New("trouble maker"))
+
+	initErr := connector.init()
+
+	assert.NotNil(t, initErr)
+	assert.Contains(t, initErr.Error(), "could not create checksum repairs table: trouble maker")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestInitCannotCreateMigratorTenantLabelsTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, false}
+
+	mock.ExpectBegin()
+	// don't have to provide full SQL here - patterns at work
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	// create versions table is a script
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_checksum_repairs").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_tenant_labels").WillReturnError(errors.New("trouble maker"))
+
+	initErr := connector.init()
+
+	assert.NotNil(t, initErr)
+	assert.Contains(t, initErr.Error(), "could not create tenant labels table: trouble maker")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestInitCannotCreateMigratorArchivedTenantsTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, false}
+
+	mock.ExpectBegin()
+	// don't have to provide full SQL here - patterns at work
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	// create versions table is a script
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_checksum_repairs").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_tenant_labels").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_archived_tenants").WillReturnError(errors.New("trouble maker"))
+
+	initErr := connector.init()
+
+	assert.NotNil(t, initErr)
+	assert.Contains(t, initErr.Error(), "could not create archived tenants table: trouble maker")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestInitCannotCreateMigratorSchemaSnapshotsTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, false}
+
+	mock.ExpectBegin()
+	// don't have to provide full SQL here - patterns at work
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	// create versions table is a script
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_checksum_repairs").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_tenant_labels").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_archived_tenants").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_schema_snapshots").WillReturnError(errors.New("trouble maker"))
+
+	initErr := connector.init()
+
+	assert.NotNil(t, initErr)
+	assert.Contains(t, initErr.Error(), "could not create schema snapshots table: trouble maker")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestInitCannotCreateMigratorJobsTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, false}
+
+	mock.ExpectBegin()
+	// don't have to provide full SQL here - patterns at work
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	// create versions table is a script
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_checksum_repairs").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_tenant_labels").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_archived_tenants").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_schema_snapshots").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_jobs").WillReturnError(errors.New("trouble maker"))
+
+	initErr := connector.init()
+
+	assert.NotNil(t, initErr)
+	assert.Contains(t, initErr.Error(), "could not create jobs table: trouble maker")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestInitCannotCreateMigratorTenantsTable(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.Nil(t, err)
@@ -120,6 +265,11 @@ func TestInitCannotCreateMigratorTenantsTable(t *testing.T) {
 	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
 	// create versions table is a script
 	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_checksum_repairs").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_tenant_labels").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_archived_tenants").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_schema_snapshots").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_jobs").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("create table").WillReturnError(errors.New("trouble maker"))
 
 	initErr := connector.init()
@@ -146,6 +296,11 @@ func TestInitCannotCommitTransaction(t *testing.T) {
 	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_checksum_repairs").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_tenant_labels").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_archived_tenants").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_schema_snapshots").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists migrator.migrator_jobs").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectCommit().WillReturnError(errors.New("trouble maker"))
 
@@ -171,9 +326,9 @@ func TestGetTenantsError(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectQuery("select").WillReturnError(errors.New("trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not query tenants: trouble maker", func() {
-		connector.GetTenants()
-	})
+	_, err = connector.GetTenants()
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not query tenants: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -192,9 +347,9 @@ func TestGetAppliedMigrationsError(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectQuery("select").WillReturnError(errors.New("trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not query DB migrations: trouble maker", func() {
-		connector.GetAppliedMigrations()
-	})
+	_, err = connector.GetAppliedMigrations()
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not query DB migrations: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -212,15 +367,16 @@ func TestCreateVersionTransactionBeginError(t *testing.T) {
 
 	rows := sqlmock.NewRows([]string{"name"}).AddRow("tenantname")
 	mock.ExpectQuery("select").WillReturnRows(rows)
+	expectNoArchivedTenants(mock)
 	mock.ExpectBegin().WillReturnError(errors.New("trouble maker tx.Begin()"))
 
 	t1 := time.Now().UnixNano()
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, "Could not start transaction: trouble maker tx.Begin()", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not start transaction: trouble maker tx.Begin()", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -238,7 +394,10 @@ func TestCreateVersionInsertVersionPreparedStatementError(t *testing.T) {
 
 	tenants := sqlmock.NewRows([]string{"name"}).AddRow("tenantname")
 	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
 	mock.ExpectPrepare("insert into").WillReturnError(errors.New("trouble maker"))
 	mock.ExpectRollback()
 
@@ -246,9 +405,9 @@ func TestCreateVersionInsertVersionPreparedStatementError(t *testing.T) {
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, "Could not create prepared statement for version: trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not create prepared statement for version: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -266,10 +425,13 @@ func TestCreateVersionInsertMigrationPreparedStatementError(t *testing.T) {
 
 	tenants := sqlmock.NewRows([]string{"name"}).AddRow("tenantname")
 	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations").WillReturnError(errors.New("trouble maker"))
 	mock.ExpectRollback()
@@ -278,9 +440,9 @@ func TestCreateVersionInsertMigrationPreparedStatementError(t *testing.T) {
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, "Could not create prepared statement for migration: trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not create prepared statement for migration: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -298,10 +460,13 @@ func TestCreateVersionMigrationSQLError(t *testing.T) {
 
 	tenants := sqlmock.NewRows([]string{"name"}).AddRow("tenantname")
 	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnError(errors.New("trouble maker"))
@@ -311,9 +476,9 @@ func TestCreateVersionMigrationSQLError(t *testing.T) {
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, fmt.Sprintf("SQL migration %v failed with error: trouble maker", tenant1.File), func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf("SQL migration %v failed for schema tenantname with error: trouble maker", tenant1.File), err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -336,19 +501,22 @@ func TestCreateVersionInsertMigrationError(t *testing.T) {
 	tenant := "tenantname"
 	tenants := sqlmock.NewRows([]string{"name"}).AddRow(tenant)
 	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnError(errors.New("trouble maker"))
 	mock.ExpectRollback()
 
-	assert.PanicsWithValue(t, "Failed to add migration entry: trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "failed to add migration entry: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -371,10 +539,13 @@ func TestCreateVersionGetVersionError(t *testing.T) {
 	tenant := "tenantname"
 	tenants := sqlmock.NewRows([]string{"name"}).AddRow(tenant)
 	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
@@ -382,9 +553,9 @@ func TestCreateVersionGetVersionError(t *testing.T) {
 	// get version
 	mock.ExpectQuery("select").WillReturnError(errors.New("get version trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not query versions: get version trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not query versions: get version trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -407,10 +578,13 @@ func TestCreateVersionVersionNotFound(t *testing.T) {
 	tenant := "tenantname"
 	tenants := sqlmock.NewRows([]string{"name"}).AddRow(tenant)
 	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
@@ -419,9 +593,9 @@ func TestCreateVersionVersionNotFound(t *testing.T) {
 	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"})
 	mock.ExpectQuery("select").WillReturnRows(rows)
 
-	assert.PanicsWithValue(t, "Version not found ID: 0", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "version not found: 0", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -444,10 +618,13 @@ func TestCreateVersionMigrationsCommitError(t *testing.T) {
 	tenant := "tenantname"
 	tenants := sqlmock.NewRows([]string{"name"}).AddRow(tenant)
 	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
@@ -455,11 +632,106 @@ func TestCreateVersionMigrationsCommitError(t *testing.T) {
 	// get version
 	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
 	mock.ExpectQuery("select").WillReturnRows(rows)
+	expectNoSchemaSnapshots(mock)
 	mock.ExpectCommit().WillReturnError(errors.New("tx trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not commit transaction: tx trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not commit transaction: tx trouble maker", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionLockTimeout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.LockTimeout = "0s"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tenants := sqlmock.NewRows([]string{"name"}).AddRow("tenantname")
+	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
+	mock.ExpectBegin()
+	// lock held by another migrator instance
+	mock.ExpectQuery("select pg_try_advisory_xact_lock").WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_xact_lock"}).AddRow(0))
+	mock.ExpectRollback()
+
+	t1 := time.Now().UnixNano()
+	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
+	migrationsToApply := []types.Migration{tenant1}
+
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "Another migration is in progress, could not acquire migration lock within 0s", err.Error())
+	var lockTimeout *types.LockTimeoutError
+	assert.True(t, errors.As(err, &lockTimeout))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionAcquireLockError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tenants := sqlmock.NewRows([]string{"name"}).AddRow("tenantname")
+	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery("select pg_try_advisory_xact_lock").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
+
+	t1 := time.Now().UnixNano()
+	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
+	migrationsToApply := []types.Migration{tenant1}
+
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not acquire migration lock: trouble maker", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionAlreadyAppliedByAnotherInstance(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	t1 := time.Now().UnixNano()
+	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
+	migrationsToApply := []types.Migration{tenant1}
+
+	tenants := sqlmock.NewRows([]string{"name"}).AddRow("tenantname")
+	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
+	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	// migration applied by another migrator instance while waiting for the lock
+	applied := sqlmock.NewRows([]string{"name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow(tenant1.Name, tenant1.SourceDir, tenant1.File, tenant1.MigrationType, "tenantname", time.Now(), tenant1.Contents, tenant1.CheckSum)
+	mock.ExpectQuery("select name, source_dir").WillReturnRows(applied)
+	mock.ExpectRollback()
+
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf("another migration is in progress or has just finished, migration %v has already been applied", tenant1.File), err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -481,9 +753,9 @@ func TestCreateTenantTransactionBeginError(t *testing.T) {
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, "Could not start transaction: trouble maker tx.Begin()", func() {
-		connector.CreateTenant("newtenant", "commit-sha", types.ActionApply, migrationsToApply, false)
-	})
+	_, _, err = connector.CreateTenant("newtenant", "commit-sha", types.ActionApply, migrationsToApply, false)
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not start transaction: trouble maker tx.Begin()", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -500,6 +772,7 @@ func TestCreateTenantCreateSchemaError(t *testing.T) {
 	connector := baseConnector{newTestContext(), config, dialect, db, true}
 
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
 	mock.ExpectExec("create schema").WillReturnError(errors.New("trouble maker"))
 	mock.ExpectRollback()
 
@@ -507,9 +780,9 @@ func TestCreateTenantCreateSchemaError(t *testing.T) {
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, "Create schema failed: trouble maker", func() {
-		connector.CreateTenant("newtenant", "commit-sha", types.ActionApply, migrationsToApply, false)
-	})
+	_, _, err = connector.CreateTenant("newtenant", "commit-sha", types.ActionApply, migrationsToApply, false)
+	assert.NotNil(t, err)
+	assert.Equal(t, "create schema failed: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -526,6 +799,7 @@ func TestCreateTenantInsertTenantPreparedStatementError(t *testing.T) {
 	connector := baseConnector{newTestContext(), config, dialect, db, true}
 
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
 	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectPrepare("insert into").WillReturnError(errors.New("trouble maker"))
 	mock.ExpectRollback()
@@ -534,9 +808,9 @@ func TestCreateTenantInsertTenantPreparedStatementError(t *testing.T) {
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, "Could not create prepared statement: trouble maker", func() {
-		connector.CreateTenant("newtenant", "commit-sha", types.ActionApply, migrationsToApply, false)
-	})
+	_, _, err = connector.CreateTenant("newtenant", "commit-sha", types.ActionApply, migrationsToApply, false)
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not create prepared statement: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -555,6 +829,7 @@ func TestCreateTenantInsertTenantError(t *testing.T) {
 	tenant := "tenant"
 
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
 	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectPrepare("insert into")
 	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant).WillReturnError(errors.New("trouble maker"))
@@ -564,9 +839,9 @@ func TestCreateTenantInsertTenantError(t *testing.T) {
 	m1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{m1}
 
-	assert.PanicsWithValue(t, "Failed to add tenant entry: trouble maker", func() {
-		connector.CreateTenant(tenant, "commit-sha", types.ActionApply, migrationsToApply, false)
-	})
+	_, _, err = connector.CreateTenant(tenant, "commit-sha", types.ActionApply, migrationsToApply, false)
+	assert.NotNil(t, err)
+	assert.Equal(t, "failed to add tenant entry: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -588,13 +863,14 @@ func TestCreateTenantCommitError(t *testing.T) {
 
 	tenant := "tenantname"
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
 	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
 	// tenant
 	mock.ExpectPrepare("insert into")
 	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant).WillReturnResult(sqlmock.NewResult(0, 0))
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
@@ -602,11 +878,12 @@ func TestCreateTenantCommitError(t *testing.T) {
 	// get version
 	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
 	mock.ExpectQuery("select").WillReturnRows(rows)
+	expectNoSchemaSnapshots(mock)
 	mock.ExpectCommit().WillReturnError(errors.New("tx trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not commit transaction: tx trouble maker", func() {
-		connector.CreateTenant(tenant, "commit-sha", types.ActionApply, migrationsToApply, false)
-	})
+	_, _, err = connector.CreateTenant(tenant, "commit-sha", types.ActionApply, migrationsToApply, false)
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not commit transaction: tx trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -625,9 +902,9 @@ func TestGetVersionsError(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectQuery("select").WillReturnError(errors.New("trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not query versions: trouble maker", func() {
-		connector.GetVersions()
-	})
+	_, err = connector.GetVersions()
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not query versions: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -646,9 +923,9 @@ func TestGetVersionsByFileError(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectQuery("select").WillReturnError(errors.New("trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not query versions: trouble maker", func() {
-		connector.GetVersionsByFile("file")
-	})
+	_, err = connector.GetVersionsByFile("file")
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not query versions: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -667,9 +944,9 @@ func TestGetVersionsByIDError(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectQuery("select").WillReturnError(errors.New("trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not query versions: trouble maker", func() {
-		connector.GetVersionByID(0)
-	})
+	_, err = connector.GetVersionByID(0)
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not query versions: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -688,9 +965,9 @@ func TestGetDBMigrationByIDError(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectQuery("select").WillReturnError(errors.New("trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not query DB migrations: trouble maker", func() {
-		connector.GetDBMigrationByID(0)
-	})
+	_, err = connector.GetDBMigrationByID(0)
+	assert.NotNil(t, err)
+	assert.Equal(t, "could not query DB migrations: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
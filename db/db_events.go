@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// MigrationEventFunc is notified when a migration starts and finishes in a schema
+// it is called synchronously by the connector applying migrations and must not block
+type MigrationEventFunc func(types.MigrationEvent)
+
+type migrationEventsKey struct{}
+
+// WithMigrationEvents returns a copy of ctx which carries fn, connectors created with the returned context
+// publish migration events of CreateVersion and CreateTenant to fn
+func WithMigrationEvents(ctx context.Context, fn MigrationEventFunc) context.Context {
+	return context.WithValue(ctx, migrationEventsKey{}, fn)
+}
+
+// publishMigrationStarted publishes started event and returns the time migration started
+func publishMigrationStarted(ctx context.Context, versionID int32, m types.Migration, schema string) time.Time {
+	started := time.Now()
+	if fn, ok := ctx.Value(migrationEventsKey{}).(MigrationEventFunc); ok {
+		fn(types.MigrationEvent{Type: types.MigrationEventStarted, VersionID: versionID, File: m.File, Schema: schema, Time: graphql.Time{Time: started}})
+	}
+	return started
+}
+
+// publishMigrationFinished publishes finished event, err is the error returned by the migration
+func publishMigrationFinished(ctx context.Context, versionID int32, m types.Migration, schema string, started time.Time, err error) {
+	fn, ok := ctx.Value(migrationEventsKey{}).(MigrationEventFunc)
+	if !ok {
+		return
+	}
+	finished := time.Now()
+	event := types.MigrationEvent{Type: types.MigrationEventFinished, VersionID: versionID, File: m.File, Schema: schema, Duration: finished.Sub(started).Seconds(), Time: graphql.Time{Time: finished}}
+	if err != nil {
+		message := err.Error()
+		event.Error = &message
+	}
+	fn(event)
+}
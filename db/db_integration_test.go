@@ -26,7 +26,8 @@ func TestGetTenants(t *testing.T) {
 			connector := New(newTestContext(), config)
 			defer connector.Dispose()
 
-			tenants := connector.GetTenants()
+			tenants, err := connector.GetTenants()
+			assert.Nil(t, err)
 
 			assert.True(t, len(tenants) >= 3)
 			assert.Contains(t, tenants, types.Tenant{Name: "abc"})
@@ -48,10 +49,12 @@ func TestCreateVersion(t *testing.T) {
 			connector := New(newTestContext(), config)
 			defer connector.Dispose()
 
-			tenants := connector.GetTenants()
+			tenants, err := connector.GetTenants()
+			assert.Nil(t, err)
 			noOfTenants := len(tenants)
 
-			dbMigrationsBefore := connector.GetAppliedMigrations()
+			dbMigrationsBefore, err := connector.GetAppliedMigrations()
+			assert.Nil(t, err)
 			lenBefore := len(dbMigrationsBefore)
 
 			p1 := time.Now().UnixNano()
@@ -83,7 +86,8 @@ func TestCreateVersion(t *testing.T) {
 
 			migrationsToApply := []types.Migration{public1, public2, public3, tenant1, tenant2, tenant3, public4, public5, tenant4}
 
-			results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
+			results, version, err := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+			assert.Nil(t, err)
 
 			assert.NotNil(t, version)
 			assert.True(t, version.ID > 0)
@@ -100,7 +104,8 @@ func TestCreateVersion(t *testing.T) {
 			assert.Equal(t, int32(noOfTenants*1+2), results.ScriptsGrandTotal)
 			assert.Greater(t, results.Duration, float64(0))
 
-			dbMigrationsAfter := connector.GetAppliedMigrations()
+			dbMigrationsAfter, err := connector.GetAppliedMigrations()
+			assert.Nil(t, err)
 			lenAfter := len(dbMigrationsAfter)
 
 			// 3 tenant migrations * no of tenants + 3 public
@@ -125,7 +130,8 @@ func TestCreateVersionEmptyMigrationArray(t *testing.T) {
 
 			migrationsToApply := []types.Migration{}
 
-			results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
+			results, version, err := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+			assert.Nil(t, err)
 			// empty migrations slice - no version created
 			assert.Nil(t, version)
 			assert.Equal(t, int32(0), results.MigrationsGrandTotal)
@@ -178,7 +184,8 @@ func TestCreateTenant(t *testing.T) {
 
 			uniqueTenant := fmt.Sprintf("new_test_tenant_%v", time.Now().UnixNano())
 
-			results, version := connector.CreateTenant(uniqueTenant, "commit-sha", types.ActionApply, migrationsToApply, false)
+			results, version, err := connector.CreateTenant(uniqueTenant, "commit-sha", types.ActionApply, migrationsToApply, false)
+			assert.Nil(t, err)
 
 			assert.NotNil(t, version)
 			assert.True(t, version.ID > 0)
@@ -207,7 +214,8 @@ func TestGetVersions(t *testing.T) {
 			connector := New(newTestContext(), config)
 			defer connector.Dispose()
 
-			versions := connector.GetVersions()
+			versions, err := connector.GetVersions()
+			assert.Nil(t, err)
 
 			assert.True(t, len(versions) >= 2)
 			// versions are sorted from newest (highest ID) to oldest (lowest ID)
@@ -228,10 +236,12 @@ func TestGetVersionsByFile(t *testing.T) {
 			connector := New(newTestContext(), config)
 			defer connector.Dispose()
 
-			versions := connector.GetVersions()
+			versions, err := connector.GetVersions()
+			assert.Nil(t, err)
 			existingVersion := versions[0]
 
-			versions = connector.GetVersionsByFile(versions[0].DBMigrations[0].File)
+			versions, err = connector.GetVersionsByFile(versions[0].DBMigrations[0].File)
+			assert.Nil(t, err)
 			version := versions[0]
 			assert.Equal(t, existingVersion.ID, version.ID)
 			assert.Equal(t, existingVersion.DBMigrations[0].File, version.DBMigrations[0].File)
@@ -252,7 +262,8 @@ func TestGetVersionByID(t *testing.T) {
 			connector := New(newTestContext(), config)
 			defer connector.Dispose()
 
-			versions := connector.GetVersions()
+			versions, err := connector.GetVersions()
+			assert.Nil(t, err)
 			existingVersion := versions[0]
 
 			version, err := connector.GetVersionByID(existingVersion.ID)
@@ -277,7 +288,7 @@ func TestGetVersionByIDNotFound(t *testing.T) {
 
 			version, err := connector.GetVersionByID(-1)
 			assert.Nil(t, version)
-			assert.Equal(t, "version not found ID: -1", err.Error())
+			assert.Equal(t, "version not found: -1", err.Error())
 		})
 	}
 }
@@ -294,7 +305,8 @@ func TestGetDBMigrationByID(t *testing.T) {
 			connector := New(newTestContext(), config)
 			defer connector.Dispose()
 
-			versions := connector.GetVersions()
+			versions, err := connector.GetVersions()
+			assert.Nil(t, err)
 			existingVersion := versions[0]
 			existingDBMigration := existingVersion.DBMigrations[0]
 
@@ -319,7 +331,7 @@ func TestGetDBMigrationByIDNotFound(t *testing.T) {
 
 			dbMigration, err := connector.GetDBMigrationByID(-1)
 			assert.Nil(t, dbMigration)
-			assert.Equal(t, "DB migration not found ID: -1", err.Error())
+			assert.Equal(t, "DB migration not found: -1", err.Error())
 		})
 	}
 }
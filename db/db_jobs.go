@@ -0,0 +1,127 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// CreateJob records a new queued job
+func (bc *baseConnector) CreateJob(operation string, name string) (*types.Job, error) {
+	if err := bc.init(); err != nil {
+		return nil, err
+	}
+
+	var jobID int64
+	insert := bc.dialect.GetJobInsertSQL()
+	if bc.dialect.LastInsertIDSupported() {
+		result, err := bc.db.ExecContext(bc.ctx, insert, operation, name, string(types.JobStatusQueued))
+		if err != nil {
+			return nil, fmt.Errorf("failed to add job entry: %v", err)
+		}
+		jobID, _ = result.LastInsertId()
+	} else if err := bc.db.QueryRowContext(bc.ctx, insert, operation, name, string(types.JobStatusQueued)).Scan(&jobID); err != nil {
+		return nil, fmt.Errorf("failed to add job entry: %v", err)
+	}
+
+	return bc.GetJobByID(int32(jobID))
+}
+
+// UpdateJob stores status, progress, and results of a job
+func (bc *baseConnector) UpdateJob(job *types.Job) error {
+	if err := bc.init(); err != nil {
+		return err
+	}
+
+	var summary *string
+	if job.Summary != nil {
+		bytes, err := json.Marshal(job.Summary)
+		if err != nil {
+			return fmt.Errorf("could not serialise job summary: %v", err)
+		}
+		s := string(bytes)
+		summary = &s
+	}
+
+	var heartbeat *time.Time
+	if job.Heartbeat != nil {
+		heartbeat = &job.Heartbeat.Time
+	}
+
+	if _, err := bc.db.ExecContext(bc.ctx, bc.dialect.GetJobUpdateSQL(), string(job.Status), job.Applied, job.Total, summary, job.Error, job.Owner, heartbeat, job.ID); err != nil {
+		return fmt.Errorf("failed to update job: %v", err)
+	}
+	return nil
+}
+
+// FailStaleJob marks a running job as failed if its heartbeat is older than staleBefore
+// job which owner stored a heartbeat in the meantime is left intact
+func (bc *baseConnector) FailStaleJob(ID int32, staleBefore time.Time, message string) error {
+	if err := bc.init(); err != nil {
+		return err
+	}
+
+	if _, err := bc.db.ExecContext(bc.ctx, bc.dialect.GetJobFailStaleSQL(), string(types.JobStatusFailed), message, ID, string(types.JobStatusRunning), staleBefore); err != nil {
+		return fmt.Errorf("failed to update job: %v", err)
+	}
+	return nil
+}
+
+// GetJobByID returns a job, NotFoundError is returned when job does not exist
+func (bc *baseConnector) GetJobByID(ID int32) (*types.Job, error) {
+	if err := bc.init(); err != nil {
+		return nil, err
+	}
+
+	rows, err := bc.db.QueryContext(bc.ctx, bc.dialect.GetJobByIDSQL(), ID)
+	if err != nil {
+		return nil, fmt.Errorf("could not query jobs: %v", err.Error())
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, &types.NotFoundError{Resource: "job", ID: fmt.Sprint(ID)}
+	}
+
+	var (
+		id        int64
+		operation string
+		name      string
+		status    string
+		applied   int32
+		total     int32
+		summary   sql.NullString
+		jobError  sql.NullString
+		owner     sql.NullString
+		heartbeat sql.NullTime
+		created   time.Time
+		updated   time.Time
+	)
+	if err := rows.Scan(&id, &operation, &name, &status, &applied, &total, &summary, &jobError, &owner, &heartbeat, &created, &updated); err != nil {
+		return nil, fmt.Errorf("could not read job: %v", err.Error())
+	}
+
+	job := &types.Job{ID: int32(id), Operation: operation, Name: name, Status: types.JobStatus(status), Applied: applied, Total: total, Created: graphql.Time{Time: created}, Updated: graphql.Time{Time: updated}}
+	if summary.Valid {
+		job.Summary = &types.Summary{}
+		if err := json.Unmarshal([]byte(summary.String), job.Summary); err != nil {
+			return nil, fmt.Errorf("could not read job summary: %v", err)
+		}
+	}
+	if jobError.Valid {
+		job.Error = &jobError.String
+	}
+	if owner.Valid {
+		job.Owner = &owner.String
+	}
+	if heartbeat.Valid {
+		job.Heartbeat = &graphql.Time{Time: heartbeat.Time}
+	}
+
+	return job, nil
+}
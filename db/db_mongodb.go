@@ -2,8 +2,11 @@ package db
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/graph-gophers/graphql-go"
@@ -16,6 +19,25 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// lease protects from a lock held forever by a crashed migrator instance
+// expired lease documents are removed by TTL index and are also taken over when acquiring the lock
+const migratorLocksCollection = "migrator_locks"
+
+// errLeaseLost is returned by extendLease when the lease document expired and was taken over by another instance
+var errLeaseLost = errors.New("migration lock lease is no longer owned by this instance")
+
+// mongoDBLease is migrator lock held by this instance, it is extended by a heartbeat until it is released
+// while the lease is held connector context is replaced by lease context which is cancelled when the lease is lost
+type mongoDBLease struct {
+	owner  string
+	ttl    time.Duration
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	parent context.Context
+	stop   chan struct{}
+	done   chan struct{}
+}
+
 type mongoDBConnector struct {
 	ctx         context.Context
 	config      *config.Config
@@ -32,19 +54,66 @@ func newMongoDBConnector(ctx context.Context, config *config.Config) Connector {
 	}
 }
 
+var (
+	mongoDBClientsMutex sync.Mutex
+	mongoDBClients      = map[string]*mongo.Client{}
+)
+
+// getMongoDBClient returns MongoDB client shared by all connectors created for the same data source,
+// mongo.Client maintains its own connection pool and is safe for concurrent use
+func getMongoDBClient(ctx context.Context, config *config.Config) (*mongo.Client, error) {
+	if client, ok := lookupMongoDBClient(config.DataSource); ok {
+		return client, nil
+	}
+
+	guard := connectGuard(config.DataSource)
+	guard.Lock()
+	defer guard.Unlock()
+
+	// client could have been connected while waiting for the guard
+	if client, ok := lookupMongoDBClient(config.DataSource); ok {
+		return client, nil
+	}
+
+	clientOptions := options.Client().ApplyURI(config.DataSource)
+	if config.MaxOpenConns > 0 {
+		clientOptions.SetMaxPoolSize(uint64(config.MaxOpenConns))
+	}
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %v", err)
+	}
+
+	ping := func(ctx context.Context) error {
+		return client.Ping(ctx, nil)
+	}
+	if err := pingWithRetries(ctx, config, ping); err != nil {
+		client.Disconnect(context.WithoutCancel(ctx))
+		return nil, fmt.Errorf("failed to ping MongoDB: %v", err)
+	}
+
+	mongoDBClientsMutex.Lock()
+	mongoDBClients[config.DataSource] = client
+	mongoDBClientsMutex.Unlock()
+	return client, nil
+}
+
+// lookupMongoDBClient returns shared MongoDB client for the passed data source if it is already connected
+func lookupMongoDBClient(dataSource string) (*mongo.Client, bool) {
+	mongoDBClientsMutex.Lock()
+	defer mongoDBClientsMutex.Unlock()
+	client, ok := mongoDBClients[dataSource]
+	return client, ok
+}
+
 func (mc *mongoDBConnector) init() error {
 	if mc.initialised {
 		return nil
 	}
 
-	clientOptions := options.Client().ApplyURI(mc.config.DataSource)
-	client, err := mongo.Connect(mc.ctx, clientOptions)
+	client, err := getMongoDBClient(mc.ctx, mc.config)
 	if err != nil {
-		return fmt.Errorf("failed to connect to MongoDB: %v", err)
-	}
-
-	if err := client.Ping(mc.ctx, nil); err != nil {
-		return fmt.Errorf("failed to ping MongoDB: %v", err)
+		return err
 	}
 
 	mc.client = client
@@ -88,13 +157,41 @@ func (mc *mongoDBConnector) createCollections() error {
 		return fmt.Errorf("failed to create migrations index: %v", err)
 	}
 
+	// Create tenant labels collection
+	labelsCol := mc.db.Collection(migratorTenantLabelsTable)
+	_, err = labelsCol.Indexes().CreateOne(mc.ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant", Value: 1}, {Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create tenant labels index: %v", err)
+	}
+
+	// Create schema snapshots collection
+	snapshotsCol := mc.db.Collection(migratorSchemaSnapshotsTable)
+	_, err = snapshotsCol.Indexes().CreateOne(mc.ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "version_id", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create schema snapshots index: %v", err)
+	}
+
+	// Create locks collection
+	locksCol := mc.db.Collection(migratorLocksCollection)
+	_, err = locksCol.Indexes().CreateOne(mc.ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create locks index: %v", err)
+	}
+
 	return nil
 }
 
-func (mc *mongoDBConnector) GetTenants() []types.Tenant {
+func (mc *mongoDBConnector) GetTenants() ([]types.Tenant, error) {
 	if err := mc.init(); err != nil {
-		common.LogError(mc.ctx, "Failed to initialize MongoDB: %v", err)
-		return []types.Tenant{}
+		return nil, err
 	}
 
 	// Support custom tenant collection via config
@@ -106,8 +203,7 @@ func (mc *mongoDBConnector) GetTenants() []types.Tenant {
 
 	cursor, err := col.Find(mc.ctx, bson.M{})
 	if err != nil {
-		common.LogError(mc.ctx, "Failed to get tenants: %v", err)
-		return []types.Tenant{}
+		return nil, fmt.Errorf("failed to get tenants: %v", err)
 	}
 	defer cursor.Close(mc.ctx)
 
@@ -122,13 +218,89 @@ func (mc *mongoDBConnector) GetTenants() []types.Tenant {
 		}
 	}
 
-	return tenants
+	archived, err := mc.getArchivedTenants()
+	if err != nil {
+		return nil, err
+	}
+	for i := range tenants {
+		tenants[i].Archived = archived[tenants[i].Name]
+	}
+
+	return tenants, nil
 }
 
-func (mc *mongoDBConnector) GetVersions() []types.Version {
+// getArchivedTenants returns a set of archived tenants
+func (mc *mongoDBConnector) getArchivedTenants() (map[string]bool, error) {
+	cursor, err := mc.db.Collection(migratorArchivedTenantsTable).Find(mc.ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get archived tenants: %v", err)
+	}
+	defer cursor.Close(mc.ctx)
+
+	archived := map[string]bool{}
+	for cursor.Next(mc.ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			continue
+		}
+		if name, ok := doc["name"].(string); ok {
+			archived[name] = true
+		}
+	}
+	return archived, nil
+}
+
+// GetTenantLabels returns labels of all tenants, key is tenant name
+func (mc *mongoDBConnector) GetTenantLabels() (map[string][]types.TenantLabel, error) {
 	if err := mc.init(); err != nil {
-		common.LogError(mc.ctx, "Failed to initialize MongoDB: %v", err)
-		return []types.Version{}
+		return nil, err
+	}
+
+	labelsCol := mc.db.Collection(migratorTenantLabelsTable)
+	cursor, err := labelsCol.Find(mc.ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "tenant", Value: 1}, {Key: "key", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant labels: %v", err)
+	}
+	defer cursor.Close(mc.ctx)
+
+	labels := map[string][]types.TenantLabel{}
+	for cursor.Next(mc.ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			continue
+		}
+		tenant, _ := doc["tenant"].(string)
+		key, _ := doc["key"].(string)
+		value, _ := doc["value"].(string)
+		labels[tenant] = append(labels[tenant], types.TenantLabel{Key: key, Value: value})
+	}
+
+	return labels, nil
+}
+
+// SetTenantLabels replaces all labels of a tenant with passed labels
+func (mc *mongoDBConnector) SetTenantLabels(tenant string, labels []types.TenantLabel) error {
+	if err := mc.init(); err != nil {
+		return err
+	}
+
+	labelsCol := mc.db.Collection(migratorTenantLabelsTable)
+	if _, err := labelsCol.DeleteMany(mc.ctx, bson.M{"tenant": tenant}); err != nil {
+		return fmt.Errorf("failed to delete tenant labels: %v", err)
+	}
+	for _, l := range labels {
+		doc := bson.M{"tenant": tenant, "key": l.Key, "value": l.Value, "created": time.Now()}
+		if _, err := labelsCol.InsertOne(mc.ctx, doc); err != nil {
+			return fmt.Errorf("failed to insert tenant label: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (mc *mongoDBConnector) GetVersions() ([]types.Version, error) {
+	if err := mc.init(); err != nil {
+		return nil, err
 	}
 
 	versionsCol := mc.db.Collection(migratorVersionsTable)
@@ -136,8 +308,7 @@ func (mc *mongoDBConnector) GetVersions() []types.Version {
 
 	cursor, err := versionsCol.Find(mc.ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}))
 	if err != nil {
-		common.LogError(mc.ctx, "Failed to get versions: %v", err)
-		return []types.Version{}
+		return nil, fmt.Errorf("failed to get versions: %v", err)
 	}
 	defer cursor.Close(mc.ctx)
 
@@ -168,22 +339,25 @@ func (mc *mongoDBConnector) GetVersions() []types.Version {
 			migCursor.Close(mc.ctx)
 		}
 
+		if version.SchemaSnapshot, err = mc.getSchemaSnapshots(versionID); err != nil {
+			return nil, err
+		}
+
 		versions = append(versions, version)
 	}
 
-	return versions
+	return versions, nil
 }
 
-func (mc *mongoDBConnector) GetVersionsByFile(file string) []types.Version {
+func (mc *mongoDBConnector) GetVersionsByFile(file string) ([]types.Version, error) {
 	if err := mc.init(); err != nil {
-		common.LogError(mc.ctx, "Failed to initialize MongoDB: %v", err)
-		return []types.Version{}
+		return nil, err
 	}
 
 	migrationsCol := mc.db.Collection(migratorMigrationsTable)
 	cursor, err := migrationsCol.Find(mc.ctx, bson.M{"filename": file})
 	if err != nil {
-		return []types.Version{}
+		return nil, fmt.Errorf("failed to get versions: %v", err)
 	}
 	defer cursor.Close(mc.ctx)
 
@@ -203,7 +377,7 @@ func (mc *mongoDBConnector) GetVersionsByFile(file string) []types.Version {
 		}
 	}
 
-	return versions
+	return versions, nil
 }
 
 func (mc *mongoDBConnector) GetVersionByID(ID int32) (*types.Version, error) {
@@ -214,6 +388,9 @@ func (mc *mongoDBConnector) GetVersionByID(ID int32) (*types.Version, error) {
 	versionsCol := mc.db.Collection(migratorVersionsTable)
 	var doc bson.M
 	err := versionsCol.FindOne(mc.ctx, bson.M{"_id": ID}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, &types.NotFoundError{Resource: "version", ID: fmt.Sprint(ID)}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -237,6 +414,10 @@ func (mc *mongoDBConnector) GetVersionByID(ID int32) (*types.Version, error) {
 		}
 	}
 
+	if version.SchemaSnapshot, err = mc.getSchemaSnapshots(ID); err != nil {
+		return nil, err
+	}
+
 	return version, nil
 }
 
@@ -248,6 +429,9 @@ func (mc *mongoDBConnector) GetDBMigrationByID(ID int32) (*types.DBMigration, er
 	col := mc.db.Collection(migratorMigrationsTable)
 	var doc bson.M
 	err := col.FindOne(mc.ctx, bson.M{"_id": ID}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, &types.NotFoundError{Resource: "DB migration", ID: fmt.Sprint(ID)}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -256,17 +440,15 @@ func (mc *mongoDBConnector) GetDBMigrationByID(ID int32) (*types.DBMigration, er
 	return &migration, nil
 }
 
-func (mc *mongoDBConnector) GetAppliedMigrations() []types.DBMigration {
+func (mc *mongoDBConnector) GetAppliedMigrations() ([]types.DBMigration, error) {
 	if err := mc.init(); err != nil {
-		common.LogError(mc.ctx, "Failed to initialize MongoDB: %v", err)
-		return []types.DBMigration{}
+		return nil, err
 	}
 
 	col := mc.db.Collection(migratorMigrationsTable)
-	cursor, err := col.Find(mc.ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "source_dir", Value: 1}}))
+	cursor, err := col.Find(mc.ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "source_dir", Value: 1}, {Key: "_id", Value: 1}}))
 	if err != nil {
-		common.LogError(mc.ctx, "Failed to get applied migrations: %v", err)
-		return []types.DBMigration{}
+		return nil, fmt.Errorf("failed to get applied migrations: %v", err)
 	}
 	defer cursor.Close(mc.ctx)
 
@@ -279,29 +461,113 @@ func (mc *mongoDBConnector) GetAppliedMigrations() []types.DBMigration {
 		migrations = append(migrations, mc.docToDBMigration(doc))
 	}
 
-	return migrations
+	return migrations, nil
 }
 
-func (mc *mongoDBConnector) CreateVersion(versionName string, action types.Action, migrations []types.Migration, dryRun bool) (*types.Summary, *types.Version) {
+func (mc *mongoDBConnector) CreateVersion(versionName string, action types.Action, migrations []types.Migration, selector types.LabelSelector, dryRun bool, planCheck *types.PlanCheck) (*types.Summary, *types.Version, error) {
 	if err := mc.init(); err != nil {
-		common.LogError(mc.ctx, "Failed to initialize MongoDB: %v", err)
-		return nil, nil
+		return nil, nil, err
 	}
 
 	startTime := time.Now()
-	tenants := mc.GetTenants()
+	selectTenants := func() ([]types.Tenant, error) {
+		return mc.selectTenants(selector)
+	}
+	tenants, err := selectTenants()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return mc.createVersion(startTime, versionName, action, migrations, tenants, dryRun, newPlanVerifier(planCheck, migrations, selectTenants, mc.targetSchemas))
+}
+
+// selectTenants returns active tenants which labels match the selector, all active tenants are returned for empty selector
+func (mc *mongoDBConnector) selectTenants(selector types.LabelSelector) ([]types.Tenant, error) {
+	tenants, err := mc.GetTenants()
+	if err != nil {
+		return nil, err
+	}
+	tenants = activeTenants(tenants)
 
-	summary := &types.Summary{
+	if len(selector) > 0 {
+		labels, err := mc.GetTenantLabels()
+		if err != nil {
+			return nil, err
+		}
+		tenants = selector.SelectTenants(tenants, labels)
+	}
+	return tenants, nil
+}
+
+// Baseline creates new version in which passed migrations are recorded as applied without executing them (sync action)
+func (mc *mongoDBConnector) Baseline(versionName string, migrations []types.Migration, tenants []types.Tenant, dryRun bool) (*types.Summary, *types.Version, error) {
+	if err := mc.init(); err != nil {
+		return nil, nil, err
+	}
+	return mc.createVersion(time.Now(), versionName, types.ActionSync, migrations, tenants, dryRun, nil)
+}
+
+// createVersion applies migrations under migrator lock, verifyPlan (if not nil) is called with migrations applied by the time the lock was acquired
+func (mc *mongoDBConnector) createVersion(startTime time.Time, versionName string, action types.Action, migrations []types.Migration, tenants []types.Tenant, dryRun bool, verifyPlan func([]types.DBMigration) error) (summary *types.Summary, version *types.Version, err error) {
+	summary = &types.Summary{
 		StartedAt: graphql.Time{Time: startTime},
 		Tenants:   int32(len(tenants)),
 	}
 
+	rendered, err := mc.renderMigrations(versionName, action, migrations, tenants)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	if dryRun {
+		// migrator lock is not acquired in dry run, the plan is verified against currently applied migrations
+		if verifyPlan != nil {
+			appliedMigrations, err := mc.GetAppliedMigrations()
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := verifyPlan(appliedMigrations); err != nil {
+				return nil, nil, err
+			}
+		}
 		mc.computeSummary(summary, migrations, tenants)
 		summary.Duration = time.Since(startTime).Seconds()
-		return summary, nil
+		return summary, nil, nil
 	}
 
+	lease, err := mc.acquireLock()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if lockErr := mc.releaseLock(lease); lockErr != nil {
+			summary, version, err = nil, nil, lockErr
+		}
+	}()
+
+	// migrations to apply were computed before the lock was acquired
+	// if another migrator instance held the lock it could have already applied them
+	appliedMigrations, err := mc.GetAppliedMigrations()
+	if err != nil {
+		return nil, nil, err
+	}
+	if verifyPlan != nil {
+		if err := verifyPlan(appliedMigrations); err != nil {
+			return nil, nil, err
+		}
+	}
+	schemasToApply, err := computeSchemasToApply(migrations, appliedMigrations, tenants, mc.targetSchemas)
+	if err != nil {
+		return nil, nil, err
+	}
+	migrations, summary.ScriptsSkipped = skipUnchangedScripts(migrations, schemasToApply, tenants, mc.targetSchemas)
+	if len(migrations) == 0 {
+		common.LogInfo(mc.ctx, "No migrations to apply, version not created")
+		summary.Duration = time.Since(startTime).Seconds()
+		return summary, nil, nil
+	}
+	progressFromContext(mc.ctx).start(schemasToApply)
+
 	// Create version
 	versionsCol := mc.db.Collection(migratorVersionsTable)
 	versionID := mc.getNextSequence("version_id")
@@ -310,13 +576,12 @@ func (mc *mongoDBConnector) CreateVersion(versionName string, action types.Actio
 		"name":    versionName,
 		"created": time.Now(),
 	}
-	_, err := versionsCol.InsertOne(mc.ctx, versionDoc)
+	_, err = versionsCol.InsertOne(mc.ctx, versionDoc)
 	if err != nil {
-		common.LogError(mc.ctx, "Failed to create version: %v", err)
-		return nil, nil
+		return nil, nil, fmt.Errorf("failed to create version: %v", err)
 	}
 
-	version := &types.Version{
+	version = &types.Version{
 		ID:      versionID,
 		Name:    versionName,
 		Created: graphql.Time{Time: time.Now()},
@@ -324,56 +589,87 @@ func (mc *mongoDBConnector) CreateVersion(versionName string, action types.Actio
 
 	// Apply migrations
 	for _, migration := range migrations {
-		if migration.MigrationType == types.MigrationTypeSingleMigration || migration.MigrationType == types.MigrationTypeSingleScript {
-			// Use source directory as database name (consistent with SQL implementations)
-			dbName := migration.SourceDir
-			if action == types.ActionApply {
-				mc.executeMigration(migration, dbName)
-			}
-			mc.recordMigration(versionID, migration, dbName, version)
-			if migration.MigrationType == types.MigrationTypeSingleMigration {
-				summary.SingleMigrations++
-			} else {
-				summary.SingleScripts++
-			}
-		} else {
-			for _, tenant := range tenants {
-				if action == types.ActionApply {
-					mc.executeMigration(migration, tenant.Name)
-				}
-				mc.recordMigration(versionID, migration, tenant.Name, version)
-			}
-			if migration.MigrationType == types.MigrationTypeTenantMigration {
-				summary.TenantMigrations++
-			} else {
-				summary.TenantScripts++
+		// tenants in which the migration was already applied are skipped
+		schemas := schemasToApply[migration.File]
+		for _, dbName := range schemas {
+			if err := mc.applyMigration(versionID, action, migration, rendered[migration.File][dbName], dbName, version); err != nil {
+				return nil, nil, err
 			}
 		}
+		switch migration.MigrationType {
+		case types.MigrationTypeSingleMigration:
+			summary.SingleMigrations++
+		case types.MigrationTypeSingleScript:
+			summary.SingleScripts++
+		case types.MigrationTypeTenantMigration:
+			summary.TenantMigrations++
+			summary.TenantMigrationsTotal += int32(len(schemas))
+		case types.MigrationTypeTenantScript:
+			summary.TenantScripts++
+			summary.TenantScriptsTotal += int32(len(schemas))
+		}
+	}
+
+	if mc.config.SchemaSnapshots {
+		if err := mc.insertSchemaSnapshots(versionID, tenants); err != nil {
+			return nil, nil, err
+		}
+		if version.SchemaSnapshot, err = mc.getSchemaSnapshots(versionID); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	summary.TenantMigrationsTotal = summary.TenantMigrations * summary.Tenants
-	summary.TenantScriptsTotal = summary.TenantScripts * summary.Tenants
 	summary.MigrationsGrandTotal = summary.SingleMigrations + summary.TenantMigrationsTotal
 	summary.ScriptsGrandTotal = summary.SingleScripts + summary.TenantScriptsTotal
 	summary.Duration = time.Since(startTime).Seconds()
 	summary.VersionID = versionID
 
-	return summary, version
+	return summary, version, nil
 }
 
-func (mc *mongoDBConnector) CreateTenant(tenantName string, versionName string, action types.Action, migrations []types.Migration, dryRun bool) (*types.Summary, *types.Version) {
+// PlanMigrations returns databases to which passed migrations would be applied, key is Migration.File
+// on-change scripts which did not change are planned with no databases
+func (mc *mongoDBConnector) PlanMigrations(migrations []types.Migration, tenants []types.Tenant) (map[string][]string, error) {
 	if err := mc.init(); err != nil {
-		common.LogError(mc.ctx, "Failed to initialize MongoDB: %v", err)
-		return nil, nil
+		return nil, err
+	}
+	appliedMigrations, err := mc.GetAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return computeSchemasToApply(migrations, appliedMigrations, tenants, mc.targetSchemas)
+}
+
+// targetSchemas returns all databases to which given migration is applied
+func (mc *mongoDBConnector) targetSchemas(m types.Migration, tenants []types.Tenant) []string {
+	if m.MigrationType == types.MigrationTypeTenantMigration || m.MigrationType == types.MigrationTypeTenantScript {
+		schemas := []string{}
+		for _, t := range tenants {
+			schemas = append(schemas, t.Name)
+		}
+		return schemas
+	}
+	// Use source directory as database name (consistent with SQL implementations)
+	return []string{m.SourceDir}
+}
+
+func (mc *mongoDBConnector) CreateTenant(tenantName string, versionName string, action types.Action, migrations []types.Migration, dryRun bool) (summary *types.Summary, version *types.Version, err error) {
+	if err := mc.init(); err != nil {
+		return nil, nil, err
 	}
 
 	startTime := time.Now()
 
-	summary := &types.Summary{
+	summary = &types.Summary{
 		StartedAt: graphql.Time{Time: startTime},
 		Tenants:   1,
 	}
 
+	rendered, err := mc.renderMigrations(versionName, action, migrations, []types.Tenant{{Name: tenantName}})
+	if err != nil {
+		return nil, nil, err
+	}
+
 	if dryRun {
 		for _, migration := range migrations {
 			if migration.MigrationType == types.MigrationTypeTenantMigration {
@@ -387,18 +683,27 @@ func (mc *mongoDBConnector) CreateTenant(tenantName string, versionName string,
 		summary.MigrationsGrandTotal = summary.TenantMigrationsTotal
 		summary.ScriptsGrandTotal = summary.TenantScriptsTotal
 		summary.Duration = time.Since(startTime).Seconds()
-		return summary, nil
+		return summary, nil, nil
 	}
 
+	lease, err := mc.acquireLock()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if lockErr := mc.releaseLock(lease); lockErr != nil {
+			summary, version, err = nil, nil, lockErr
+		}
+	}()
+
 	// Create tenant
 	collectionName := mc.getTenantCollectionName()
 	fieldName := mc.getTenantFieldName()
 	tenantsCol := mc.db.Collection(collectionName)
 	tenantDoc := bson.M{fieldName: tenantName, "created": time.Now()}
-	_, err := tenantsCol.InsertOne(mc.ctx, tenantDoc)
+	_, err = tenantsCol.InsertOne(mc.ctx, tenantDoc)
 	if err != nil {
-		common.LogError(mc.ctx, "Failed to create tenant: %v", err)
-		return nil, nil
+		return nil, nil, fmt.Errorf("failed to create tenant: %v", err)
 	}
 
 	// Create version
@@ -411,23 +716,29 @@ func (mc *mongoDBConnector) CreateTenant(tenantName string, versionName string,
 	}
 	_, err = versionsCol.InsertOne(mc.ctx, versionDoc)
 	if err != nil {
-		common.LogError(mc.ctx, "Failed to create version: %v", err)
-		return nil, nil
+		return nil, nil, fmt.Errorf("failed to create version: %v", err)
 	}
 
-	version := &types.Version{
+	version = &types.Version{
 		ID:      versionID,
 		Name:    versionName,
 		Created: graphql.Time{Time: time.Now()},
 	}
 
+	schemasToApply := map[string][]string{}
+	for _, migration := range migrations {
+		if migration.MigrationType == types.MigrationTypeTenantMigration || migration.MigrationType == types.MigrationTypeTenantScript {
+			schemasToApply[migration.File] = []string{tenantName}
+		}
+	}
+	progressFromContext(mc.ctx).start(schemasToApply)
+
 	// Apply tenant migrations
 	for _, migration := range migrations {
 		if migration.MigrationType == types.MigrationTypeTenantMigration || migration.MigrationType == types.MigrationTypeTenantScript {
-			if action == types.ActionApply {
-				mc.executeMigration(migration, tenantName)
+			if err := mc.applyMigration(versionID, action, migration, rendered[migration.File][tenantName], tenantName, version); err != nil {
+				return nil, nil, err
 			}
-			mc.recordMigration(versionID, migration, tenantName, version)
 			if migration.MigrationType == types.MigrationTypeTenantMigration {
 				summary.TenantMigrations++
 			} else {
@@ -443,7 +754,97 @@ func (mc *mongoDBConnector) CreateTenant(tenantName string, versionName string,
 	summary.Duration = time.Since(startTime).Seconds()
 	summary.VersionID = versionID
 
-	return summary, version
+	return summary, version, nil
+}
+
+// applyMigration executes a rendered migration in a given database (only for apply action) and records it in a given version
+// migration events and progress are published for every database
+func (mc *mongoDBConnector) applyMigration(versionID int32, action types.Action, migration types.Migration, contents string, dbName string, version *types.Version) error {
+	started := publishMigrationStarted(mc.ctx, versionID, migration, dbName)
+	var err error
+	if action == types.ActionApply {
+		err = mc.executeMigration(migration, contents, dbName)
+	}
+	if err == nil {
+		err = mc.recordMigration(versionID, migration, dbName, version)
+	}
+	publishMigrationFinished(mc.ctx, versionID, migration, dbName, started, err)
+	if err != nil {
+		return err
+	}
+	progressFromContext(mc.ctx).step()
+	return nil
+}
+
+func (mc *mongoDBConnector) RollbackVersion(version *types.Version, migrations []types.DBMigration, dryRun bool) (summary *types.Summary, err error) {
+	if err := mc.init(); err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+
+	summary = &types.Summary{
+		StartedAt: graphql.Time{Time: startTime},
+		VersionID: version.ID,
+	}
+
+	// down migrations are rendered before any of them is executed
+	rendered, err := newContentsRenderer(mc.config, mc.getSchemaPlaceHolder(), version.Name).renderDownMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun {
+		lease, err := mc.acquireLock()
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if lockErr := mc.releaseLock(lease); lockErr != nil {
+				summary, err = nil, lockErr
+			}
+		}()
+	}
+
+	// checked under migrator lock so that no newer version can be created between the check and the rollback
+	latest := struct {
+		ID int32 `bson:"_id"`
+	}{}
+	opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}}).SetProjection(bson.M{"_id": 1})
+	if err := mc.db.Collection(migratorVersionsTable).FindOne(mc.ctx, bson.M{}, opts).Decode(&latest); err != nil && err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to read latest version: %v", err)
+	}
+	if err := checkLatestVersion(version, latest.ID); err != nil {
+		return nil, err
+	}
+
+	if !dryRun {
+		for i, migration := range migrations {
+			if err := mc.executeMigration(migration.Migration, rendered[i], migration.Schema); err != nil {
+				return nil, err
+			}
+		}
+
+		migrationsCol := mc.db.Collection(migratorMigrationsTable)
+		if _, err := migrationsCol.DeleteMany(mc.ctx, bson.M{"version_id": version.ID}); err != nil {
+			return nil, fmt.Errorf("failed to delete migrations: %v", err)
+		}
+
+		snapshotsCol := mc.db.Collection(migratorSchemaSnapshotsTable)
+		if _, err := snapshotsCol.DeleteMany(mc.ctx, bson.M{"version_id": version.ID}); err != nil {
+			return nil, fmt.Errorf("failed to delete schema snapshots: %v", err)
+		}
+
+		versionsCol := mc.db.Collection(migratorVersionsTable)
+		if _, err := versionsCol.DeleteOne(mc.ctx, bson.M{"_id": version.ID}); err != nil {
+			return nil, fmt.Errorf("failed to delete version: %v", err)
+		}
+	}
+
+	computeRollbackSummary(summary, migrations)
+	summary.Duration = time.Since(startTime).Seconds()
+
+	return summary, nil
 }
 
 func (mc *mongoDBConnector) HealthCheck() error {
@@ -454,9 +855,7 @@ func (mc *mongoDBConnector) HealthCheck() error {
 }
 
 func (mc *mongoDBConnector) Dispose() {
-	if mc.client != nil {
-		mc.client.Disconnect(mc.ctx)
-	}
+	// client is shared by all MongoDB connectors and is kept connected
 }
 
 // Helper methods
@@ -501,15 +900,287 @@ func (mc *mongoDBConnector) convertToTime(v interface{}) time.Time {
 	}
 }
 
-func (mc *mongoDBConnector) executeMigration(migration types.Migration, dbName string) {
+// ArchiveTenant marks tenant as archived, archived tenants are skipped by CreateVersion
+// tenant database and its DB migrations are kept, the operation is recorded as a new version
+func (mc *mongoDBConnector) ArchiveTenant(tenant string, versionName string) (*types.Summary, *types.Version, error) {
+	if err := mc.init(); err != nil {
+		return nil, nil, err
+	}
+
+	return mc.applyTenantOperation(versionName, false, func() error {
+		doc := bson.M{"name": tenant, "created": time.Now()}
+		if _, err := mc.db.Collection(migratorArchivedTenantsTable).InsertOne(mc.ctx, doc); err != nil {
+			return fmt.Errorf("failed to archive tenant: %v", err)
+		}
+		return nil
+	})
+}
+
+// DropTenant drops tenant database and removes tenant together with its DB migrations, labels, and archived entry
+// the operation is recorded as a new version, dry-run mode does not modify DB
+func (mc *mongoDBConnector) DropTenant(tenant string, versionName string, dryRun bool) (*types.Summary, *types.Version, error) {
+	if err := mc.init(); err != nil {
+		return nil, nil, err
+	}
+
+	return mc.applyTenantOperation(versionName, dryRun, func() error {
+		if err := mc.client.Database(tenant).Drop(mc.ctx); err != nil {
+			return fmt.Errorf("failed to drop tenant database: %v", err)
+		}
+		if _, err := mc.db.Collection(migratorMigrationsTable).DeleteMany(mc.ctx, bson.M{"db_schema": tenant}); err != nil {
+			return fmt.Errorf("failed to delete migration entries: %v", err)
+		}
+		if _, err := mc.db.Collection(migratorTenantLabelsTable).DeleteMany(mc.ctx, bson.M{"tenant": tenant}); err != nil {
+			return fmt.Errorf("failed to delete tenant labels: %v", err)
+		}
+		if _, err := mc.db.Collection(migratorArchivedTenantsTable).DeleteMany(mc.ctx, bson.M{"name": tenant}); err != nil {
+			return fmt.Errorf("failed to delete archived tenant entry: %v", err)
+		}
+		if _, err := mc.db.Collection(mc.getTenantCollectionName()).DeleteMany(mc.ctx, bson.M{mc.getTenantFieldName(): tenant}); err != nil {
+			return fmt.Errorf("failed to delete tenant: %v", err)
+		}
+		return nil
+	})
+}
+
+// RenameTenant moves all collections of tenant database to a new database and updates tenant name in tenants, DB migrations, labels, and archived tenants
+// the operation is recorded as a new version
+func (mc *mongoDBConnector) RenameTenant(from string, to string, versionName string) (*types.Summary, *types.Version, error) {
+	if err := mc.init(); err != nil {
+		return nil, nil, err
+	}
+
+	return mc.applyTenantOperation(versionName, false, func() error {
+		// MongoDB cannot rename a database, collections are moved one by one
+		collections, err := mc.client.Database(from).ListCollectionNames(mc.ctx, bson.M{})
+		if err != nil {
+			return fmt.Errorf("failed to list tenant collections: %v", err)
+		}
+		existing, err := mc.client.Database(to).ListCollectionNames(mc.ctx, bson.M{})
+		if err != nil {
+			return fmt.Errorf("failed to list collections of database %v: %v", to, err)
+		}
+		// collisions are checked upfront so that the tenant is not left split across both databases
+		if collisions := intersectStrings(collections, existing); len(collisions) > 0 {
+			return &types.InvalidArgumentError{Argument: "to", Err: fmt.Errorf("collections already exist in database %v: %v", to, strings.Join(collisions, ", "))}
+		}
+
+		admin := mc.client.Database("admin")
+		rename := func(collection, from, to string) error {
+			command := bson.D{{Key: "renameCollection", Value: from + "." + collection}, {Key: "to", Value: to + "." + collection}}
+			// collections are moved back even when the request was cancelled
+			return admin.RunCommand(context.WithoutCancel(mc.ctx), command).Err()
+		}
+		if err := moveTenantCollections(from, to, collections, rename); err != nil {
+			return err
+		}
+
+		fieldName := mc.getTenantFieldName()
+		entries := []struct {
+			collection string
+			field      string
+			what       string
+		}{
+			{migratorMigrationsTable, "db_schema", "migration entries"},
+			{migratorTenantLabelsTable, "tenant", "tenant labels"},
+			{migratorArchivedTenantsTable, "name", "archived tenant entry"},
+			{mc.getTenantCollectionName(), fieldName, "tenant"},
+		}
+		renameEntries := func(i int, from, to string) error {
+			_, err := mc.db.Collection(entries[i].collection).UpdateMany(context.WithoutCancel(mc.ctx), bson.M{entries[i].field: from}, bson.M{"$set": bson.M{entries[i].field: to}})
+			return err
+		}
+		for i := range entries {
+			if err := renameEntries(i, from, to); err != nil {
+				// entries already renamed and moved collections are reverted so that the tenant keeps its old name
+				for j := i - 1; j >= 0; j-- {
+					if err := renameEntries(j, to, from); err != nil {
+						common.LogError(mc.ctx, "Could not revert rename of %v: %v", entries[j].what, err.Error())
+					}
+				}
+				err = fmt.Errorf("failed to update %v: %v", entries[i].what, err)
+				if notRestored := moveTenantCollectionsBack(from, to, collections, rename); len(notRestored) > 0 {
+					return fmt.Errorf("%v, collections left in database %v: %v", err, to, strings.Join(notRestored, ", "))
+				}
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// moveTenantCollections moves collections from one database to another, if a rename fails collections already moved are moved back
+// collections which could not be moved back are listed in the returned error
+func moveTenantCollections(from, to string, collections []string, rename func(collection, from, to string) error) error {
+	for i, c := range collections {
+		if err := rename(c, from, to); err != nil {
+			err = fmt.Errorf("failed to rename tenant collection %v: %v", c, err)
+			if notRestored := moveTenantCollectionsBack(from, to, collections[:i], rename); len(notRestored) > 0 {
+				return fmt.Errorf("%v, collections left in database %v: %v", err, to, strings.Join(notRestored, ", "))
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// moveTenantCollectionsBack moves collections back to the old database and returns collections which could not be moved back
+func moveTenantCollectionsBack(from, to string, collections []string, rename func(collection, from, to string) error) []string {
+	notRestored := []string{}
+	for _, c := range collections {
+		if err := rename(c, to, from); err != nil {
+			notRestored = append(notRestored, c)
+		}
+	}
+	return notRestored
+}
+
+// intersectStrings returns elements of a which are also in b
+func intersectStrings(a, b []string) []string {
+	inB := map[string]bool{}
+	for _, s := range b {
+		inB[s] = true
+	}
+	both := []string{}
+	for _, s := range a {
+		if inB[s] {
+			both = append(both, s)
+		}
+	}
+	return both
+}
+
+// applyTenantOperation executes tenant lifecycle operation holding migrator lock and records it as a new version without DB migrations
+func (mc *mongoDBConnector) applyTenantOperation(versionName string, dryRun bool, apply func() error) (summary *types.Summary, version *types.Version, err error) {
+	startTime := time.Now()
+	summary = &types.Summary{
+		StartedAt: graphql.Time{Time: startTime},
+		Tenants:   1,
+	}
+
+	if dryRun {
+		summary.Duration = time.Since(startTime).Seconds()
+		return summary, nil, nil
+	}
+
+	lease, err := mc.acquireLock()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if lockErr := mc.releaseLock(lease); lockErr != nil {
+			summary, version, err = nil, nil, lockErr
+		}
+	}()
+
+	if err := apply(); err != nil {
+		return nil, nil, err
+	}
+
+	versionID := mc.getNextSequence("version_id")
+	created := time.Now()
+	versionDoc := bson.M{
+		"_id":     versionID,
+		"name":    versionName,
+		"created": created,
+	}
+	if _, err := mc.db.Collection(migratorVersionsTable).InsertOne(mc.ctx, versionDoc); err != nil {
+		return nil, nil, fmt.Errorf("failed to create version: %v", err)
+	}
+
+	summary.VersionID = versionID
+	summary.Duration = time.Since(startTime).Seconds()
+
+	return summary, &types.Version{ID: versionID, Name: versionName, Created: graphql.Time{Time: created}, DBMigrations: []types.DBMigration{}}, nil
+}
+
+// RepairChecksums replaces contents and checksums of applied DB migrations in all databases with the ones of passed source migrations
+// every repair is recorded in the checksum repairs collection together with the reason
+func (mc *mongoDBConnector) RepairChecksums(migrations []types.Migration, reason string) (repairs []types.ChecksumRepair, err error) {
+	if err := mc.init(); err != nil {
+		return nil, err
+	}
+
+	lease, err := mc.acquireLock()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if lockErr := mc.releaseLock(lease); lockErr != nil {
+			repairs, err = nil, lockErr
+		}
+	}()
+
+	appliedMigrations, err := mc.GetAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	repairs, err = computeChecksumRepairs(migrations, appliedMigrations, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	migrationsCol := mc.db.Collection(migratorMigrationsTable)
+	repairsCol := mc.db.Collection(migratorChecksumRepairsTable)
+	repaired := map[string]bool{}
+	for _, r := range repairs {
+		if !repaired[r.File] {
+			update := bson.M{"$set": bson.M{"contents": r.NewContents, "checksum": r.NewCheckSum}}
+			if _, err := migrationsCol.UpdateMany(mc.ctx, bson.M{"filename": r.File}, update); err != nil {
+				return nil, fmt.Errorf("failed to update DB migration checksum: %v", err)
+			}
+			repaired[r.File] = true
+		}
+		doc := bson.M{
+			"filename":     r.File,
+			"old_checksum": r.OldCheckSum,
+			"new_checksum": r.NewCheckSum,
+			"old_contents": r.OldContents,
+			"new_contents": r.NewContents,
+			"reason":       r.Reason,
+			"created":      time.Now(),
+		}
+		if _, err := repairsCol.InsertOne(mc.ctx, doc); err != nil {
+			return nil, fmt.Errorf("failed to add checksum repair entry: %v", err)
+		}
+	}
+
+	return repairs, nil
+}
+
+// getSchemaPlaceHolder returns a schema placeholder which is
+// either the default one or overridden by user in config
+func (mc *mongoDBConnector) getSchemaPlaceHolder() string {
+	if mc.config.SchemaPlaceHolder != "" {
+		return mc.config.SchemaPlaceHolder
+	}
+	return defaultSchemaPlaceHolder
+}
+
+// renderMigrations renders contents of migrations for all their target databases, migrations are rendered only when they are applied
+func (mc *mongoDBConnector) renderMigrations(versionName string, action types.Action, migrations []types.Migration, tenants []types.Tenant) (renderedContents, error) {
+	if action != types.ActionApply {
+		return renderedContents{}, nil
+	}
+	return newContentsRenderer(mc.config, mc.getSchemaPlaceHolder(), versionName).renderMigrations(migrations, tenants, mc.targetSchemas)
+}
+
+// executeMigration executes rendered commands of the migration file one by one, MongoDB does not use transactions so commands executed before a failed one are not rolled back
+// execution is cancelled when migration timeout (timeout directive or migrationTimeout config option) is exceeded
+func (mc *mongoDBConnector) executeMigration(migration types.Migration, contents string, dbName string) error {
+	file := migration.File
 	targetDB := mc.client.Database(dbName)
 
-	// Replace schema placeholder
-	schemaPlaceHolder := mc.config.SchemaPlaceHolder
-	if schemaPlaceHolder == "" {
-		schemaPlaceHolder = defaultSchemaPlaceHolder
+	ctx := mc.ctx
+	timeout := migration.Timeout
+	if timeout == 0 {
+		timeout = mc.config.GetMigrationTimeout()
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(mc.ctx, timeout)
+		defer cancel()
 	}
-	contents := strings.ReplaceAll(migration.Contents, schemaPlaceHolder, dbName)
 
 	// Parse and execute JavaScript-like MongoDB commands
 	// This handles common patterns like db.collection.insertOne(), db.collection.createIndex(), etc.
@@ -520,14 +1191,18 @@ func (mc *mongoDBConnector) executeMigration(migration types.Migration, dbName s
 			continue
 		}
 
-		if err := mc.executeMongoDBCommand(targetDB, line); err != nil {
-			common.LogError(mc.ctx, "Failed to execute command in migration %s (database %s): %v", migration.File, dbName, err)
+		if err := mc.executeMongoDBCommand(ctx, targetDB, line); err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("migration timed out after %v: %w", timeout, err)
+			}
+			return &types.SQLError{File: file, Schema: dbName, Err: err}
 		}
 	}
+	return nil
 }
 
 // executeMongoDBCommand parses and executes a MongoDB command
-func (mc *mongoDBConnector) executeMongoDBCommand(targetDB *mongo.Database, command string) error {
+func (mc *mongoDBConnector) executeMongoDBCommand(ctx context.Context, targetDB *mongo.Database, command string) error {
 	command = strings.TrimSpace(command)
 
 	// Match pattern: db.collectionName.operation(...) or db.getSiblingDB('dbname').collectionName.operation(...)
@@ -586,13 +1261,13 @@ func (mc *mongoDBConnector) executeMongoDBCommand(targetDB *mongo.Database, comm
 	// Handle different operations
 	switch operation {
 	case "insertOne":
-		return mc.handleInsertOne(col, rest[opEnd:])
+		return mc.handleInsertOne(ctx, col, rest[opEnd:])
 	case "createIndex":
-		return mc.handleCreateIndex(col, rest[opEnd:])
+		return mc.handleCreateIndex(ctx, col, rest[opEnd:])
 	case "updateMany":
-		return mc.handleUpdateMany(col, rest[opEnd:])
+		return mc.handleUpdateMany(ctx, col, rest[opEnd:])
 	case "updateOne":
-		return mc.handleUpdateOne(col, rest[opEnd:])
+		return mc.handleUpdateOne(ctx, col, rest[opEnd:])
 	default:
 		common.LogWarn(mc.ctx, "Unsupported operation: %s", operation)
 		return nil
@@ -600,7 +1275,7 @@ func (mc *mongoDBConnector) executeMongoDBCommand(targetDB *mongo.Database, comm
 }
 
 // handleInsertOne executes insertOne operation
-func (mc *mongoDBConnector) handleInsertOne(col *mongo.Collection, args string) error {
+func (mc *mongoDBConnector) handleInsertOne(ctx context.Context, col *mongo.Collection, args string) error {
 	// Extract JSON document from insertOne({...})
 	start := strings.Index(args, "{")
 	end := strings.LastIndex(args, "}")
@@ -619,12 +1294,12 @@ func (mc *mongoDBConnector) handleInsertOne(col *mongo.Collection, args string)
 		return fmt.Errorf("failed to parse document: %v", err)
 	}
 
-	_, err := col.InsertOne(mc.ctx, doc)
+	_, err := col.InsertOne(ctx, doc)
 	return err
 }
 
 // handleCreateIndex executes createIndex operation
-func (mc *mongoDBConnector) handleCreateIndex(col *mongo.Collection, args string) error {
+func (mc *mongoDBConnector) handleCreateIndex(ctx context.Context, col *mongo.Collection, args string) error {
 	// Extract index spec and options from createIndex({...}, {...})
 	start := strings.Index(args, "{")
 	if start == -1 {
@@ -680,7 +1355,7 @@ func (mc *mongoDBConnector) handleCreateIndex(col *mongo.Collection, args string
 		}
 	}
 
-	_, err := col.Indexes().CreateOne(mc.ctx, mongo.IndexModel{
+	_, err := col.Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys:    keys,
 		Options: opts,
 	})
@@ -688,17 +1363,17 @@ func (mc *mongoDBConnector) handleCreateIndex(col *mongo.Collection, args string
 }
 
 // handleUpdateMany executes updateMany operation
-func (mc *mongoDBConnector) handleUpdateMany(col *mongo.Collection, args string) error {
-	return mc.handleUpdate(col, args, true)
+func (mc *mongoDBConnector) handleUpdateMany(ctx context.Context, col *mongo.Collection, args string) error {
+	return mc.handleUpdate(ctx, col, args, true)
 }
 
 // handleUpdateOne executes updateOne operation
-func (mc *mongoDBConnector) handleUpdateOne(col *mongo.Collection, args string) error {
-	return mc.handleUpdate(col, args, false)
+func (mc *mongoDBConnector) handleUpdateOne(ctx context.Context, col *mongo.Collection, args string) error {
+	return mc.handleUpdate(ctx, col, args, false)
 }
 
 // handleUpdate executes update operations (updateOne or updateMany)
-func (mc *mongoDBConnector) handleUpdate(col *mongo.Collection, args string, many bool) error {
+func (mc *mongoDBConnector) handleUpdate(ctx context.Context, col *mongo.Collection, args string, many bool) error {
 	// Extract filter and update documents from updateMany({filter}, {update}, {options})
 	start := strings.Index(args, "{")
 	if start == -1 {
@@ -778,10 +1453,10 @@ func (mc *mongoDBConnector) handleUpdate(col *mongo.Collection, args string, man
 
 	// Execute update
 	if many {
-		_, err := col.UpdateMany(mc.ctx, filter, update)
+		_, err := col.UpdateMany(ctx, filter, update)
 		return err
 	}
-	_, err := col.UpdateOne(mc.ctx, filter, update)
+	_, err := col.UpdateOne(ctx, filter, update)
 	return err
 }
 
@@ -847,7 +1522,7 @@ func (mc *mongoDBConnector) jsToJSON(js string) string {
 	return builder.String()
 }
 
-func (mc *mongoDBConnector) recordMigration(versionID int32, migration types.Migration, schema string, version *types.Version) {
+func (mc *mongoDBConnector) recordMigration(versionID int32, migration types.Migration, schema string, version *types.Version) error {
 	col := mc.db.Collection(migratorMigrationsTable)
 	migrationID := mc.getNextSequence("migration_id")
 
@@ -866,8 +1541,7 @@ func (mc *mongoDBConnector) recordMigration(versionID int32, migration types.Mig
 
 	_, err := col.InsertOne(mc.ctx, doc)
 	if err != nil {
-		common.LogError(mc.ctx, "Failed to record migration: %v", err)
-		return
+		return fmt.Errorf("failed to record migration: %v", err)
 	}
 
 	dbMigration := types.DBMigration{
@@ -877,6 +1551,113 @@ func (mc *mongoDBConnector) recordMigration(versionID int32, migration types.Mig
 		Created:   graphql.Time{Time: time.Now()},
 	}
 	version.DBMigrations = append(version.DBMigrations, dbMigration)
+	return nil
+}
+
+// acquireLock acquires migrator lock by inserting lease document, an expired lease is taken over
+// the lease is extended by a heartbeat until it is released so that a migration running longer than lease TTL keeps the lock
+// if the lock is not acquired within configured lock timeout acquireLock returns LockTimeoutError
+func (mc *mongoDBConnector) acquireLock() (*mongoDBLease, error) {
+	col := mc.db.Collection(migratorLocksCollection)
+	owner := primitive.NewObjectID().Hex()
+	ttl := mc.config.GetLockLeaseTTL()
+	timeout := mc.config.GetLockTimeout()
+	deadline := time.Now().Add(timeout)
+	for {
+		now := time.Now()
+		filter := bson.M{"_id": migratorLockName, "expires_at": bson.M{"$lt": now}}
+		update := bson.M{"$set": bson.M{"owner": owner, "acquired": now, "expires_at": now.Add(ttl)}}
+		// when lease is held by another instance filter does not match and upsert fails with duplicate key error
+		_, err := col.UpdateOne(mc.ctx, filter, update, options.Update().SetUpsert(true))
+		if err == nil {
+			return mc.holdLease(owner, ttl, func() error { return mc.extendLease(owner, ttl) }), nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("could not acquire migration lock: %v", err.Error())
+		}
+		if !time.Now().Before(deadline) {
+			return nil, &types.LockTimeoutError{Timeout: timeout}
+		}
+		common.LogInfo(mc.ctx, "Another migration is in progress, waiting for migration lock")
+		select {
+		case <-mc.ctx.Done():
+			return nil, fmt.Errorf("could not acquire migration lock: %v", mc.ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// holdLease replaces connector context with lease context and starts the heartbeat which extends the lease every third of its TTL
+func (mc *mongoDBConnector) holdLease(owner string, ttl time.Duration, extend func() error) *mongoDBLease {
+	ctx, cancel := context.WithCancelCause(mc.ctx)
+	lease := &mongoDBLease{owner: owner, ttl: ttl, ctx: ctx, cancel: cancel, parent: mc.ctx, stop: make(chan struct{}), done: make(chan struct{})}
+	mc.ctx = ctx
+	go mc.heartbeat(lease, ttl/3, extend)
+	return lease
+}
+
+// heartbeat calls extend every interval until lease is released
+// when the lease is lost lease context is cancelled so that the migration stops writing without the lock
+func (mc *mongoDBConnector) heartbeat(lease *mongoDBLease, interval time.Duration, extend func() error) {
+	defer close(lease.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lease.stop:
+			return
+		case <-ticker.C:
+			err := extend()
+			if errors.Is(err, errLeaseLost) {
+				common.LogError(lease.parent, "Migration lock lost, cancelling migration")
+				lease.cancel(&types.LockTimeoutError{Timeout: lease.ttl})
+				return
+			}
+			if err != nil {
+				common.LogError(lease.parent, "Could not extend migration lock: %v", err.Error())
+			}
+		}
+	}
+}
+
+// extendLease moves expiry of the lease document, but only if it is still owned by the passed owner
+func (mc *mongoDBConnector) extendLease(owner string, ttl time.Duration) error {
+	col := mc.db.Collection(migratorLocksCollection)
+	// lease is extended even when the request was cancelled, it is held until the migration is rolled back and the lock released
+	result, err := col.UpdateOne(context.WithoutCancel(mc.ctx), bson.M{"_id": migratorLockName, "owner": owner}, bson.M{"$set": bson.M{"expires_at": time.Now().Add(ttl)}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errLeaseLost
+	}
+	return nil
+}
+
+// releaseLock stops the heartbeat and removes lease document, but only if it is still owned by the lease owner
+// if the lease was lost while it was held releaseLock returns LockTimeoutError
+func (mc *mongoDBConnector) releaseLock(lease *mongoDBLease) error {
+	lost := mc.stopLease(lease)
+	col := mc.db.Collection(migratorLocksCollection)
+	// lease must be removed even when the request was cancelled, otherwise other instances would wait until it expires
+	if _, err := col.DeleteOne(context.WithoutCancel(mc.ctx), bson.M{"_id": migratorLockName, "owner": lease.owner}); err != nil {
+		common.LogError(mc.ctx, "Could not release migration lock: %v", err.Error())
+	}
+	return lost
+}
+
+// stopLease stops the heartbeat and restores connector context, if the lease was lost stopLease returns LockTimeoutError
+func (mc *mongoDBConnector) stopLease(lease *mongoDBLease) error {
+	close(lease.stop)
+	<-lease.done
+	mc.ctx = lease.parent
+	var lockTimeout *types.LockTimeoutError
+	lost := errors.As(context.Cause(lease.ctx), &lockTimeout)
+	lease.cancel(nil)
+	if lost {
+		return lockTimeout
+	}
+	return nil
 }
 
 func (mc *mongoDBConnector) getNextSequence(name string) int32 {
@@ -928,3 +1709,237 @@ func (mc *mongoDBConnector) computeSummary(summary *types.Summary, migrations []
 	summary.MigrationsGrandTotal = summary.SingleMigrations + summary.TenantMigrationsTotal
 	summary.ScriptsGrandTotal = summary.SingleScripts + summary.TenantScriptsTotal
 }
+
+// GetSchemaFingerprints reads collections and indexes of passed tenant databases
+// and returns their normalized fingerprints, databases with identical objects have identical fingerprints
+func (mc *mongoDBConnector) GetSchemaFingerprints(schemas []string) ([]types.SchemaFingerprint, error) {
+	if err := mc.init(); err != nil {
+		return nil, err
+	}
+
+	fingerprints := []types.SchemaFingerprint{}
+	for _, schema := range schemas {
+		objects, err := mc.getSchemaObjects(schema)
+		if err != nil {
+			return nil, err
+		}
+		fingerprints = append(fingerprints, types.NewSchemaFingerprint(schema, objects))
+	}
+
+	return fingerprints, nil
+}
+
+// getSchemaObjects returns collections and indexes of a given database
+func (mc *mongoDBConnector) getSchemaObjects(schema string) ([]types.SchemaObject, error) {
+	db := mc.client.Database(schema)
+	collections, err := db.ListCollectionSpecifications(mc.ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %v", err)
+	}
+	objects := []types.SchemaObject{}
+	for _, c := range collections {
+		objects = append(objects, types.SchemaObject{Type: "collection", Name: c.Name, Definition: c.Type})
+		if c.Type != "collection" {
+			continue
+		}
+		indexes, err := db.Collection(c.Name).Indexes().ListSpecifications(mc.ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list indexes: %v", err)
+		}
+		for _, i := range indexes {
+			definition := i.KeysDocument.String()
+			if i.Unique != nil && *i.Unique {
+				definition = "unique " + definition
+			}
+			objects = append(objects, types.SchemaObject{Type: "index", Name: c.Name + "." + i.Name, Definition: definition})
+		}
+	}
+	return objects, nil
+}
+
+// insertSchemaSnapshots captures collections and indexes of all single databases and of the first tenant and records them in a given version
+func (mc *mongoDBConnector) insertSchemaSnapshots(versionID int32, tenants []types.Tenant) error {
+	schemas := map[string]types.MigrationType{}
+	names := []string{}
+	for _, schema := range mc.config.SingleMigrations {
+		schemas[schema] = types.MigrationTypeSingleMigration
+		names = append(names, schema)
+	}
+	if len(tenants) > 0 {
+		if _, ok := schemas[tenants[0].Name]; !ok {
+			schemas[tenants[0].Name] = types.MigrationTypeTenantMigration
+			names = append(names, tenants[0].Name)
+		}
+	}
+
+	snapshotsCol := mc.db.Collection(migratorSchemaSnapshotsTable)
+	for _, schema := range names {
+		objects, err := mc.getSchemaObjects(schema)
+		if err != nil {
+			return err
+		}
+		fingerprint := types.NewSchemaFingerprint(schema, objects)
+		doc := bson.M{
+			"version_id":  versionID,
+			"db_schema":   schema,
+			"type":        int32(schemas[schema]),
+			"fingerprint": fingerprint.Fingerprint,
+			"objects":     fingerprint.Objects,
+			"created":     time.Now(),
+		}
+		if _, err := snapshotsCol.InsertOne(mc.ctx, doc); err != nil {
+			return fmt.Errorf("failed to add schema snapshot: %v", err)
+		}
+	}
+	return nil
+}
+
+// getSchemaSnapshots returns schema snapshots of a given version
+func (mc *mongoDBConnector) getSchemaSnapshots(versionID int32) ([]types.SchemaSnapshot, error) {
+	cursor, err := mc.db.Collection(migratorSchemaSnapshotsTable).Find(mc.ctx, bson.M{"version_id": versionID}, options.Find().SetSort(bson.D{{Key: "type", Value: 1}, {Key: "db_schema", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema snapshots: %v", err)
+	}
+	defer cursor.Close(mc.ctx)
+
+	snapshots := []types.SchemaSnapshot{}
+	for cursor.Next(mc.ctx) {
+		var doc struct {
+			Schema      string               `bson:"db_schema"`
+			Type        int32                `bson:"type"`
+			Fingerprint string               `bson:"fingerprint"`
+			Objects     []types.SchemaObject `bson:"objects"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to read schema snapshot: %v", err)
+		}
+		snapshots = append(snapshots, types.SchemaSnapshot{Schema: doc.Schema, MigrationType: types.MigrationType(doc.Type), Fingerprint: doc.Fingerprint, Objects: doc.Objects})
+	}
+	return snapshots, nil
+}
+
+// CreateJob records a new queued job
+func (mc *mongoDBConnector) CreateJob(operation string, name string) (*types.Job, error) {
+	if err := mc.init(); err != nil {
+		return nil, err
+	}
+
+	created := time.Now()
+	job := &types.Job{
+		ID:        mc.getNextSequence("job_id"),
+		Operation: operation,
+		Name:      name,
+		Status:    types.JobStatusQueued,
+		Created:   graphql.Time{Time: created},
+		Updated:   graphql.Time{Time: created},
+	}
+	doc := bson.M{
+		"_id":       job.ID,
+		"operation": job.Operation,
+		"name":      job.Name,
+		"status":    string(job.Status),
+		"applied":   job.Applied,
+		"total":     job.Total,
+		"created":   created,
+		"updated":   created,
+	}
+	if _, err := mc.db.Collection(migratorJobsTable).InsertOne(mc.ctx, doc); err != nil {
+		return nil, fmt.Errorf("failed to add job entry: %v", err)
+	}
+
+	return job, nil
+}
+
+// UpdateJob stores status, progress, and results of a job, summary is stored as JSON just like in SQL databases
+func (mc *mongoDBConnector) UpdateJob(job *types.Job) error {
+	if err := mc.init(); err != nil {
+		return err
+	}
+
+	set := bson.M{
+		"status":  string(job.Status),
+		"applied": job.Applied,
+		"total":   job.Total,
+		"updated": time.Now(),
+	}
+	if job.Summary != nil {
+		bytes, err := json.Marshal(job.Summary)
+		if err != nil {
+			return fmt.Errorf("could not serialise job summary: %v", err)
+		}
+		set["summary"] = string(bytes)
+	}
+	if job.Error != nil {
+		set["error"] = *job.Error
+	}
+	if job.Owner != nil {
+		set["owner"] = *job.Owner
+	}
+	if job.Heartbeat != nil {
+		set["heartbeat"] = job.Heartbeat.Time
+	}
+
+	if _, err := mc.db.Collection(migratorJobsTable).UpdateOne(mc.ctx, bson.M{"_id": job.ID}, bson.M{"$set": set}); err != nil {
+		return fmt.Errorf("failed to update job: %v", err)
+	}
+	return nil
+}
+
+// GetJobByID returns a job, NotFoundError is returned when job does not exist
+func (mc *mongoDBConnector) GetJobByID(ID int32) (*types.Job, error) {
+	if err := mc.init(); err != nil {
+		return nil, err
+	}
+
+	var doc bson.M
+	err := mc.db.Collection(migratorJobsTable).FindOne(mc.ctx, bson.M{"_id": ID}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, &types.NotFoundError{Resource: "job", ID: fmt.Sprint(ID)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job := &types.Job{
+		ID:        doc["_id"].(int32),
+		Operation: doc["operation"].(string),
+		Name:      doc["name"].(string),
+		Status:    types.JobStatus(doc["status"].(string)),
+		Applied:   doc["applied"].(int32),
+		Total:     doc["total"].(int32),
+		Created:   graphql.Time{Time: mc.convertToTime(doc["created"])},
+		Updated:   graphql.Time{Time: mc.convertToTime(doc["updated"])},
+	}
+	if summary, ok := doc["summary"].(string); ok {
+		job.Summary = &types.Summary{}
+		if err := json.Unmarshal([]byte(summary), job.Summary); err != nil {
+			return nil, fmt.Errorf("could not read job summary: %v", err)
+		}
+	}
+	if jobError, ok := doc["error"].(string); ok {
+		job.Error = &jobError
+	}
+	if owner, ok := doc["owner"].(string); ok {
+		job.Owner = &owner
+	}
+	if heartbeat, ok := doc["heartbeat"]; ok {
+		job.Heartbeat = &graphql.Time{Time: mc.convertToTime(heartbeat)}
+	}
+
+	return job, nil
+}
+
+// FailStaleJob marks a running job as failed if its heartbeat is older than staleBefore
+// job which owner stored a heartbeat in the meantime is left intact
+func (mc *mongoDBConnector) FailStaleJob(ID int32, staleBefore time.Time, message string) error {
+	if err := mc.init(); err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": ID, "status": string(types.JobStatusRunning), "heartbeat": bson.M{"$lt": staleBefore}}
+	set := bson.M{"status": string(types.JobStatusFailed), "error": message, "updated": time.Now()}
+	if _, err := mc.db.Collection(migratorJobsTable).UpdateOne(mc.ctx, filter, bson.M{"$set": set}); err != nil {
+		return fmt.Errorf("failed to update job: %v", err)
+	}
+	return nil
+}
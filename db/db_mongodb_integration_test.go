@@ -1,6 +1,7 @@
 package db
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -8,6 +9,7 @@ import (
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/lukaszbudnik/migrator/types"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 func TestMongoDBGetTenants(t *testing.T) {
@@ -19,11 +21,15 @@ func TestMongoDBGetTenants(t *testing.T) {
 	defer connector.Dispose()
 
 	// Create test tenants
-	connector.CreateTenant("abc", "test-tenant-abc", types.ActionSync, []types.Migration{}, false)
-	connector.CreateTenant("def", "test-tenant-def", types.ActionSync, []types.Migration{}, false)
-	connector.CreateTenant("xyz", "test-tenant-xyz", types.ActionSync, []types.Migration{}, false)
+	_, _, err = connector.CreateTenant("abc", "test-tenant-abc", types.ActionSync, []types.Migration{}, false)
+	assert.Nil(t, err)
+	_, _, err = connector.CreateTenant("def", "test-tenant-def", types.ActionSync, []types.Migration{}, false)
+	assert.Nil(t, err)
+	_, _, err = connector.CreateTenant("xyz", "test-tenant-xyz", types.ActionSync, []types.Migration{}, false)
+	assert.Nil(t, err)
 
-	tenants := connector.GetTenants()
+	tenants, err := connector.GetTenants()
+	assert.Nil(t, err)
 
 	assert.True(t, len(tenants) >= 3)
 	assert.Contains(t, tenants, types.Tenant{Name: "abc"})
@@ -40,13 +46,17 @@ func TestMongoDBCreateVersion(t *testing.T) {
 	defer connector.Dispose()
 
 	// Create test tenants
-	connector.CreateTenant("tenant1", "test-tenant-1", types.ActionSync, []types.Migration{}, false)
-	connector.CreateTenant("tenant2", "test-tenant-2", types.ActionSync, []types.Migration{}, false)
+	_, _, err = connector.CreateTenant("tenant1", "test-tenant-1", types.ActionSync, []types.Migration{}, false)
+	assert.Nil(t, err)
+	_, _, err = connector.CreateTenant("tenant2", "test-tenant-2", types.ActionSync, []types.Migration{}, false)
+	assert.Nil(t, err)
 
-	tenants := connector.GetTenants()
+	tenants, err := connector.GetTenants()
+	assert.Nil(t, err)
 	noOfTenants := len(tenants)
 
-	dbMigrationsBefore := connector.GetAppliedMigrations()
+	dbMigrationsBefore, err := connector.GetAppliedMigrations()
+	assert.Nil(t, err)
 	lenBefore := len(dbMigrationsBefore)
 
 	p1 := time.Now().UnixNano()
@@ -68,7 +78,8 @@ func TestMongoDBCreateVersion(t *testing.T) {
 
 	migrationsToApply := []types.Migration{ref1, ref2, config1, tenant1, tenant2}
 
-	results, version := connector.CreateVersion("commit-sha-mongo", types.ActionApply, migrationsToApply, false)
+	results, version, err := connector.CreateVersion("commit-sha-mongo", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.Nil(t, err)
 
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
@@ -80,7 +91,8 @@ func TestMongoDBCreateVersion(t *testing.T) {
 	assert.Equal(t, int32(noOfTenants*2), results.TenantMigrationsTotal)
 	assert.Equal(t, int32(noOfTenants*2+3), results.MigrationsGrandTotal)
 
-	dbMigrationsAfter := connector.GetAppliedMigrations()
+	dbMigrationsAfter, err := connector.GetAppliedMigrations()
+	assert.Nil(t, err)
 	lenAfter := len(dbMigrationsAfter)
 
 	assert.Equal(t, lenBefore+int(results.MigrationsGrandTotal), lenAfter)
@@ -98,9 +110,11 @@ func TestMongoDBScripts(t *testing.T) {
 	testTenant := fmt.Sprintf("scripttenant%d", time.Now().UnixNano())
 	m1 := time.Now().UnixNano()
 	tenantMigration := types.Migration{Name: fmt.Sprintf("%v.js", m1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.js", m1), MigrationType: types.MigrationTypeTenantMigration, Contents: "db.settings.insertOne({k: 999, v: '999'})"}
-	connector.CreateTenant(testTenant, "test-tenant-scripts", types.ActionApply, []types.Migration{tenantMigration}, false)
+	_, _, err = connector.CreateTenant(testTenant, "test-tenant-scripts", types.ActionApply, []types.Migration{tenantMigration}, false)
+	assert.Nil(t, err)
 
-	tenants := connector.GetTenants()
+	tenants, err := connector.GetTenants()
+	assert.Nil(t, err)
 	noOfTenants := len(tenants)
 
 	s1 := time.Now().UnixNano()
@@ -114,7 +128,8 @@ func TestMongoDBScripts(t *testing.T) {
 
 	scriptsToApply := []types.Migration{singleScript, tenantScript}
 
-	results, version := connector.CreateVersion("test-scripts", types.ActionApply, scriptsToApply, false)
+	results, version, err := connector.CreateVersion("test-scripts", types.ActionApply, scriptsToApply, nil, false, nil)
+	assert.Nil(t, err)
 
 	assert.NotNil(t, version)
 	assert.Equal(t, int32(1), results.SingleScripts)
@@ -131,7 +146,8 @@ func TestMongoDBCreateTenant(t *testing.T) {
 	connector := New(newTestContext(), config)
 	defer connector.Dispose()
 
-	tenantsBefore := connector.GetTenants()
+	tenantsBefore, err := connector.GetTenants()
+	assert.Nil(t, err)
 	lenBefore := len(tenantsBefore)
 
 	p1 := time.Now().UnixNano()
@@ -143,7 +159,8 @@ func TestMongoDBCreateTenant(t *testing.T) {
 	migrationsToApply := []types.Migration{tenant1, tenant2}
 
 	newTenantName := fmt.Sprintf("newtenant%d", time.Now().UnixNano())
-	results, version := connector.CreateTenant(newTenantName, "create-tenant-version", types.ActionApply, migrationsToApply, false)
+	results, version, err := connector.CreateTenant(newTenantName, "create-tenant-version", types.ActionApply, migrationsToApply, false)
+	assert.Nil(t, err)
 
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
@@ -152,7 +169,8 @@ func TestMongoDBCreateTenant(t *testing.T) {
 	assert.Equal(t, int32(2), results.TenantMigrationsTotal)
 	assert.Equal(t, int32(2), results.MigrationsGrandTotal)
 
-	tenantsAfter := connector.GetTenants()
+	tenantsAfter, err := connector.GetTenants()
+	assert.Nil(t, err)
 	lenAfter := len(tenantsAfter)
 
 	assert.Equal(t, lenBefore+1, lenAfter)
@@ -186,13 +204,15 @@ func TestMongoDBCustomTenantCollection(t *testing.T) {
 
 	// Create tenant in custom collection
 	tenantName := fmt.Sprintf("custom_tenant_%d", time.Now().UnixNano())
-	results, version := connector.CreateTenant(tenantName, "test-custom-collection", types.ActionSync, []types.Migration{}, false)
+	results, version, err := connector.CreateTenant(tenantName, "test-custom-collection", types.ActionSync, []types.Migration{}, false)
+	assert.Nil(t, err)
 
 	assert.NotNil(t, version)
 	assert.Equal(t, int32(1), results.Tenants)
 
 	// Verify tenant was created in custom collection
-	tenants := connector.GetTenants()
+	tenants, err := connector.GetTenants()
+	assert.Nil(t, err)
 	assert.Contains(t, tenants, types.Tenant{Name: tenantName})
 }
 
@@ -211,13 +231,15 @@ func TestMongoDBCustomTenantCollectionAndField(t *testing.T) {
 
 	// Create tenant in custom collection with custom field
 	tenantName := fmt.Sprintf("org_%d", time.Now().UnixNano())
-	results, version := connector.CreateTenant(tenantName, "test-custom-field", types.ActionSync, []types.Migration{}, false)
+	results, version, err := connector.CreateTenant(tenantName, "test-custom-field", types.ActionSync, []types.Migration{}, false)
+	assert.Nil(t, err)
 
 	assert.NotNil(t, version)
 	assert.Equal(t, int32(1), results.Tenants)
 
 	// Verify tenant was created with custom field
-	tenants := connector.GetTenants()
+	tenants, err := connector.GetTenants()
+	assert.Nil(t, err)
 	assert.Contains(t, tenants, types.Tenant{Name: tenantName})
 }
 
@@ -236,12 +258,57 @@ func TestMongoDBBackwardCompatibilityTenantSelectSQL(t *testing.T) {
 
 	// Create tenant using old config field names
 	tenantName := fmt.Sprintf("legacy_tenant_%d", time.Now().UnixNano())
-	results, version := connector.CreateTenant(tenantName, "test-legacy-config", types.ActionSync, []types.Migration{}, false)
+	results, version, err := connector.CreateTenant(tenantName, "test-legacy-config", types.ActionSync, []types.Migration{}, false)
+	assert.Nil(t, err)
 
 	assert.NotNil(t, version)
 	assert.Equal(t, int32(1), results.Tenants)
 
 	// Verify tenant was created
-	tenants := connector.GetTenants()
+	tenants, err := connector.GetTenants()
+	assert.Nil(t, err)
 	assert.Contains(t, tenants, types.Tenant{Name: tenantName})
 }
+
+func TestMongoDBLockLeaseExtended(t *testing.T) {
+	configFile := "../test/migrator-mongodb.yaml"
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+	config.LockLeaseTTL = "300ms"
+	config.LockTimeout = "100ms"
+
+	connector := New(newTestContext(), config).(*mongoDBConnector)
+	defer connector.Dispose()
+	assert.Nil(t, connector.init())
+
+	lease, err := connector.acquireLock()
+	assert.Nil(t, err)
+
+	readExpiresAt := func() time.Time {
+		var doc struct {
+			Owner     string    `bson:"owner"`
+			ExpiresAt time.Time `bson:"expires_at"`
+		}
+		err := connector.db.Collection(migratorLocksCollection).FindOne(connector.ctx, bson.M{"_id": migratorLockName}).Decode(&doc)
+		assert.Nil(t, err)
+		assert.Equal(t, lease.owner, doc.Owner)
+		return doc.ExpiresAt
+	}
+	first := readExpiresAt()
+
+	// lock is held longer than lease TTL, the lease is extended and other instances cannot take it over
+	time.Sleep(600 * time.Millisecond)
+	assert.True(t, readExpiresAt().After(first))
+
+	other := New(newTestContext(), config).(*mongoDBConnector)
+	defer other.Dispose()
+	assert.Nil(t, other.init())
+	_, err = other.acquireLock()
+	var lockTimeout *types.LockTimeoutError
+	assert.True(t, errors.As(err, &lockTimeout))
+
+	connector.releaseLock(lease)
+	otherLease, err := other.acquireLock()
+	assert.Nil(t, err)
+	other.releaseLock(otherLease)
+}
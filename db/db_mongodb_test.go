@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -396,3 +397,99 @@ func TestConfigGetTenantInsertBackwardCompatibility(t *testing.T) {
 	cfg = &config.Config{}
 	assert.Equal(t, "", cfg.GetTenantInsert())
 }
+
+func TestMongoDBLeaseHeartbeat(t *testing.T) {
+	mc := &mongoDBConnector{ctx: context.Background(), config: &config.Config{}}
+
+	extended := make(chan struct{}, 10)
+	lease := mc.holdLease("abc", 3*time.Millisecond, func() error {
+		select {
+		case extended <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	// lease is extended repeatedly while it is held
+	for i := 0; i < 3; i++ {
+		select {
+		case <-extended:
+		case <-time.After(5 * time.Second):
+			t.Fatal("lease was not extended")
+		}
+	}
+
+	// heartbeat stops when lease is released
+	assert.Nil(t, mc.stopLease(lease))
+	select {
+	case <-lease.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("heartbeat was not stopped")
+	}
+	assert.Equal(t, context.Background(), mc.ctx)
+}
+
+func TestMongoDBLeaseLost(t *testing.T) {
+	mc := &mongoDBConnector{ctx: context.Background(), config: &config.Config{}}
+
+	// lease is extended once, then it expires and is taken over by another instance
+	extensions := 0
+	lease := mc.holdLease("abc", 3*time.Millisecond, func() error {
+		extensions++
+		if extensions > 1 {
+			return errLeaseLost
+		}
+		return nil
+	})
+
+	// migration writing with connector context is cancelled
+	writes := 0
+	for mc.ctx.Err() == nil {
+		writes++
+		if writes > 5000 {
+			t.Fatal("migration was not cancelled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	err := mc.stopLease(lease)
+	var lockTimeout *types.LockTimeoutError
+	assert.True(t, errors.As(err, &lockTimeout))
+	assert.Nil(t, mc.ctx.Err())
+}
+
+func TestMoveTenantCollectionsRollback(t *testing.T) {
+	databases := map[string]string{"orders": "abc", "invoices": "abc", "payments": "abc"}
+	rename := func(collection, from, to string) error {
+		if collection == "payments" {
+			return errors.New("trouble maker")
+		}
+		databases[collection] = to
+		return nil
+	}
+
+	err := moveTenantCollections("abc", "def", []string{"orders", "invoices", "payments"}, rename)
+	assert.Equal(t, "failed to rename tenant collection payments: trouble maker", err.Error())
+	// collections moved before the failure are moved back
+	assert.Equal(t, map[string]string{"orders": "abc", "invoices": "abc", "payments": "abc"}, databases)
+}
+
+func TestMoveTenantCollectionsRollbackFailure(t *testing.T) {
+	databases := map[string]string{"orders": "abc", "invoices": "abc", "payments": "abc"}
+	rename := func(collection, from, to string) error {
+		if collection == "payments" || (collection == "invoices" && to == "abc") {
+			return errors.New("trouble maker")
+		}
+		databases[collection] = to
+		return nil
+	}
+
+	err := moveTenantCollections("abc", "def", []string{"orders", "invoices", "payments"}, rename)
+	assert.Equal(t, "failed to rename tenant collection payments: trouble maker, collections left in database def: invoices", err.Error())
+	assert.Equal(t, map[string]string{"orders": "abc", "invoices": "def", "payments": "abc"}, databases)
+}
+
+func TestIntersectStrings(t *testing.T) {
+	assert.Equal(t, []string{"orders"}, intersectStrings([]string{"invoices", "orders"}, []string{"orders", "payments"}))
+	assert.Empty(t, intersectStrings([]string{"invoices"}, []string{"orders"}))
+}
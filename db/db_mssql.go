@@ -2,6 +2,8 @@ package db
 
 import (
 	"fmt"
+	"time"
+
 	// blank import for MSSQL driver
 	_ "github.com/microsoft/go-mssqldb"
 )
@@ -11,13 +13,38 @@ type msSQLDialect struct {
 }
 
 const (
-	insertMigrationMSSQLDialectSQL      = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)"
-	insertTenantMSSQLDialectSQL         = "insert into %v.%v (name) values (@p1)"
-	insertVersionMSSQLSQLDialectSQL     = "insert into %v.%v (name) output inserted.id values (@p1)"
-	selectVersionsByFileMSSQLDialectSQL = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = @p1) order by vid desc, mid asc"
-	selectVersionByIDMSSQLDialectSQL    = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = @p1 order by mid asc"
-	selectMigrationByIDMSSQLDialectSQL  = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from %v.%v where id = @p1"
-	createTenantsTableMSSQLDialectSQL   = `
+	insertMigrationMSSQLDialectSQL             = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)"
+	insertTenantMSSQLDialectSQL                = "insert into %v.%v (name) values (@p1)"
+	insertVersionMSSQLSQLDialectSQL            = "insert into %v.%v (name) output inserted.id values (@p1)"
+	selectVersionsByFileMSSQLDialectSQL        = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = @p1) order by vid desc, mid asc"
+	selectVersionByIDMSSQLDialectSQL           = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = @p1 order by mid asc"
+	selectMigrationByIDMSSQLDialectSQL         = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from %v.%v where id = @p1"
+	deleteVersionMSSQLDialectSQL               = "delete from %v.%v where id = @p1"
+	deleteMigrationsByVersionIDMSSQLDialectSQL = "delete from %v.%v where version_id = @p1"
+	insertChecksumRepairMSSQLDialectSQL        = "insert into %v.%v (filename, old_checksum, new_checksum, old_contents, new_contents, reason) values (@p1, @p2, @p3, @p4, @p5, @p6)"
+	updateMigrationChecksumMSSQLDialectSQL     = "update %v.%v set contents = @p1, checksum = @p2 where filename = @p3"
+	deleteTenantLabelsMSSQLDialectSQL          = "delete from %v.%v where tenant = @p1"
+	insertTenantLabelMSSQLDialectSQL           = "insert into %v.%v (tenant, label_key, label_value) values (@p1, @p2, @p3)"
+	renameTenantLabelsMSSQLDialectSQL          = "update %v.%v set tenant = @p1 where tenant = @p2"
+	insertArchivedTenantMSSQLDialectSQL        = "insert into %v.%v (name) values (@p1)"
+	deleteArchivedTenantMSSQLDialectSQL        = "delete from %v.%v where name = @p1"
+	renameArchivedTenantMSSQLDialectSQL        = "update %v.%v set name = @p1 where name = @p2"
+	deleteTenantMSSQLDialectSQL                = "delete from %v.%v where name = @p1"
+	renameTenantMSSQLDialectSQL                = "update %v.%v set name = @p1 where name = @p2"
+	deleteMigrationsBySchemaMSSQLDialectSQL    = "delete from %v.%v where db_schema = @p1"
+	renameMigrationsSchemaMSSQLDialectSQL      = "update %v.%v set db_schema = @p1 where db_schema = @p2"
+	selectVersionSnapshotsMSSQLDialectSQL      = "select version_id, db_schema, type, fingerprint, objects from %v.%v where version_id = @p1 order by type, db_schema"
+	insertSchemaSnapshotMSSQLDialectSQL        = "insert into %v.%v (version_id, db_schema, type, fingerprint, objects) values (@p1, @p2, @p3, @p4, @p5)"
+	deleteVersionSnapshotsMSSQLDialectSQL      = "delete from %v.%v where version_id = @p1"
+	insertJobMSSQLDialectSQL                   = "insert into %v.%v (operation, name, status) output inserted.id values (@p1, @p2, @p3)"
+	updateJobMSSQLDialectSQL                   = "update %v.%v set status = @p1, applied = @p2, total = @p3, summary = @p4, error = @p5, owner = @p6, heartbeat = @p7, updated = current_timestamp where id = @p8"
+	selectJobByIDMSSQLDialectSQL               = "select id, operation, name, status, applied, total, summary, error, owner, heartbeat, created, updated from %v.%v where id = @p1"
+	failStaleJobMSSQLDialectSQL                = "update %v.%v set status = @p1, error = @p2, updated = current_timestamp where id = @p3 and status = @p4 and heartbeat < @p5"
+	selectSchemaTablesMSSQLDialectSQL          = "select table_name from information_schema.tables where table_schema = @p1 and table_type = 'BASE TABLE'"
+	dropTableMSSQLDialectSQL                   = "drop table [%v].[%v]"
+	dropSchemaMSSQLDialectSQL                  = "drop schema [%v]"
+	transferTableMSSQLDialectSQL               = "alter schema [%v] transfer [%v].[%v]"
+	createTenantsTableMSSQLDialectSQL          = `
 IF NOT EXISTS (select * from information_schema.tables where table_schema = '%v' and table_name = '%v')
 BEGIN
   create table [%v].%v (
@@ -42,6 +69,76 @@ BEGIN
 		checksum varchar(64)
   );
 END
+`
+	createChecksumRepairsTableMSSQLDialectSQL = `
+IF NOT EXISTS (select * from information_schema.tables where table_schema = '%v' and table_name = '%v')
+BEGIN
+  create table [%v].%v (
+    id int identity (1,1) primary key,
+    filename varchar(200) not null,
+    old_checksum varchar(64),
+    new_checksum varchar(64),
+    old_contents text,
+    new_contents text,
+    reason text not null,
+    created datetime default CURRENT_TIMESTAMP
+  );
+END
+`
+	createTenantLabelsTableMSSQLDialectSQL = `
+IF NOT EXISTS (select * from information_schema.tables where table_schema = '%v' and table_name = '%v')
+BEGIN
+  create table [%v].%v (
+    id int identity (1,1) primary key,
+    tenant varchar(200) not null,
+    label_key varchar(200) not null,
+    label_value varchar(200) not null,
+    created datetime default CURRENT_TIMESTAMP
+  );
+END
+`
+	createArchivedTenantsTableMSSQLDialectSQL = `
+IF NOT EXISTS (select * from information_schema.tables where table_schema = '%v' and table_name = '%v')
+BEGIN
+  create table [%v].%v (
+    id int identity (1,1) primary key,
+    name varchar(200) not null,
+    created datetime default CURRENT_TIMESTAMP
+  );
+END
+`
+	createSchemaSnapshotsTableMSSQLDialectSQL = `
+IF NOT EXISTS (select * from information_schema.tables where table_schema = '%v' and table_name = '%v')
+BEGIN
+  create table [%v].%v (
+    id int identity (1,1) primary key,
+    version_id int not null,
+    db_schema varchar(200) not null,
+    type int not null,
+    fingerprint varchar(64) not null,
+    objects text not null,
+    created datetime default CURRENT_TIMESTAMP
+  );
+END
+`
+	createJobsTableMSSQLDialectSQL = `
+IF NOT EXISTS (select * from information_schema.tables where table_schema = '%v' and table_name = '%v')
+BEGIN
+  create table [%v].%v (
+    id int identity (1,1) primary key,
+    operation varchar(200) not null,
+    name varchar(200) not null,
+    status varchar(20) not null,
+    applied int not null default 0,
+    total int not null default 0,
+    summary text,
+    error text,
+    owner varchar(200),
+    heartbeat datetime,
+    created datetime default CURRENT_TIMESTAMP,
+    updated datetime default CURRENT_TIMESTAMP
+  );
+END
 `
 	createSchemaMSSQLDialectSQL = `
 IF NOT EXISTS (select * from information_schema.schemata where schema_name = '%v')
@@ -75,6 +172,26 @@ begin
   select @cn = name from sys.default_constraints where parent_object_id = object_id('[%v].%v') and name like '%%ver%%';
   EXEC ('alter table [%v].%v drop constraint ' + @cn);
 end
+`
+	acquireLockMSSQLDialectSQL = `
+declare @result int;
+exec @result = sp_getapplock @Resource = '%v', @LockMode = 'Exclusive', @LockOwner = 'Transaction', @LockTimeout = %d;
+select case when @result >= 0 then 1 else 0 end;
+`
+
+	// system-generated constraint names are random, such constraints are identified by their type
+	selectSchemaObjectsMSSQLDialectSQL = `
+select 'table', t.name, 'BASE TABLE' from sys.tables t join sys.schemas s on s.schema_id = t.schema_id where s.name = @p1
+union all
+select 'column', table_name + '.' + column_name, data_type + coalesce('(' + cast(character_maximum_length as varchar(10)) + ')', '') + case when is_nullable = 'NO' then ' not null' else '' end + coalesce(' default ' + column_default, '') from information_schema.columns where table_schema = @p1
+union all
+select 'index', t.name + '.' + i.name, lower(i.type_desc) + case when i.is_unique = 1 then ' unique' else '' end + ' (' + (select string_agg(c.name, ',') within group (order by ic.key_ordinal) from sys.index_columns ic join sys.columns c on c.object_id = ic.object_id and c.column_id = ic.column_id where ic.object_id = i.object_id and ic.index_id = i.index_id) + ')' from sys.indexes i join sys.tables t on t.object_id = i.object_id join sys.schemas s on s.schema_id = t.schema_id where s.name = @p1 and i.name is not null and i.is_primary_key = 0 and i.is_unique_constraint = 0
+union all
+select 'constraint', t.name + '.' + case when k.is_system_named = 1 then lower(k.type_desc) else k.name end, lower(k.type_desc) from sys.key_constraints k join sys.tables t on t.object_id = k.parent_object_id join sys.schemas s on s.schema_id = t.schema_id where s.name = @p1
+union all
+select 'constraint', t.name + '.' + case when f.is_system_named = 1 then lower(f.type_desc) else f.name end, lower(f.type_desc) from sys.foreign_keys f join sys.tables t on t.object_id = f.parent_object_id join sys.schemas s on s.schema_id = t.schema_id where s.name = @p1
+union all
+select 'constraint', t.name + '.' + case when c.is_system_named = 1 then lower(c.type_desc) else c.name end, c.definition from sys.check_constraints c join sys.tables t on t.object_id = c.parent_object_id join sys.schemas s on s.schema_id = t.schema_id where s.name = @p1
 `
 )
 
@@ -133,3 +250,172 @@ func (md *msSQLDialect) GetVersionByIDSQL() string {
 func (md *msSQLDialect) GetMigrationByIDSQL() string {
 	return fmt.Sprintf(selectMigrationByIDMSSQLDialectSQL, migratorSchema, migratorMigrationsTable)
 }
+
+// GetVersionDeleteSQL returns MS SQL-specific SQL statement which deletes version by ID
+func (md *msSQLDialect) GetVersionDeleteSQL() string {
+	return fmt.Sprintf(deleteVersionMSSQLDialectSQL, migratorSchema, migratorVersionsTable)
+}
+
+// GetMigrationsDeleteByVersionIDSQL returns MS SQL-specific SQL statement which deletes all migrations recorded in a given version
+func (md *msSQLDialect) GetMigrationsDeleteByVersionIDSQL() string {
+	return fmt.Sprintf(deleteMigrationsByVersionIDMSSQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetAcquireLockSQL returns MS SQL-specific SQL statement which waits up to timeout for transaction-level application lock
+// the statement returns 1 if the lock was acquired and 0 otherwise
+func (md *msSQLDialect) GetAcquireLockSQL(timeout time.Duration) string {
+	return fmt.Sprintf(acquireLockMSSQLDialectSQL, migratorLockName, timeout.Milliseconds())
+}
+
+// GetCreateChecksumRepairsTableSQL returns migrator's create checksum repairs (audit) table SQL statement.
+// This SQL is used by MS SQL.
+func (md *msSQLDialect) GetCreateChecksumRepairsTableSQL() string {
+	return fmt.Sprintf(createChecksumRepairsTableMSSQLDialectSQL, migratorSchema, migratorChecksumRepairsTable, migratorSchema, migratorChecksumRepairsTable)
+}
+
+// GetChecksumRepairInsertSQL returns MS SQL-specific SQL statement which records checksum repair
+func (md *msSQLDialect) GetChecksumRepairInsertSQL() string {
+	return fmt.Sprintf(insertChecksumRepairMSSQLDialectSQL, migratorSchema, migratorChecksumRepairsTable)
+}
+
+// GetMigrationChecksumUpdateSQL returns MS SQL-specific SQL statement which updates contents and checksum of a migration in all schemas
+func (md *msSQLDialect) GetMigrationChecksumUpdateSQL() string {
+	return fmt.Sprintf(updateMigrationChecksumMSSQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetTenantLabelsDeleteSQL returns MS SQL-specific SQL statement which deletes all labels of a tenant
+func (md *msSQLDialect) GetTenantLabelsDeleteSQL() string {
+	return fmt.Sprintf(deleteTenantLabelsMSSQLDialectSQL, migratorSchema, migratorTenantLabelsTable)
+}
+
+// GetTenantLabelInsertSQL returns MS SQL-specific SQL statement which inserts a tenant label
+func (md *msSQLDialect) GetTenantLabelInsertSQL() string {
+	return fmt.Sprintf(insertTenantLabelMSSQLDialectSQL, migratorSchema, migratorTenantLabelsTable)
+}
+
+// GetCreateTenantLabelsTableSQL returns migrator's create tenant labels table SQL statement.
+// This SQL is used by MS SQL.
+func (md *msSQLDialect) GetCreateTenantLabelsTableSQL() string {
+	return fmt.Sprintf(createTenantLabelsTableMSSQLDialectSQL, migratorSchema, migratorTenantLabelsTable, migratorSchema, migratorTenantLabelsTable)
+}
+
+// GetTenantLabelsRenameSQL returns MS SQL-specific SQL statement which renames tenant in tenant labels
+func (md *msSQLDialect) GetTenantLabelsRenameSQL() string {
+	return fmt.Sprintf(renameTenantLabelsMSSQLDialectSQL, migratorSchema, migratorTenantLabelsTable)
+}
+
+// GetArchivedTenantInsertSQL returns MS SQL-specific SQL statement which archives a tenant
+func (md *msSQLDialect) GetArchivedTenantInsertSQL() string {
+	return fmt.Sprintf(insertArchivedTenantMSSQLDialectSQL, migratorSchema, migratorArchivedTenantsTable)
+}
+
+// GetArchivedTenantDeleteSQL returns MS SQL-specific SQL statement which removes a tenant from archived tenants
+func (md *msSQLDialect) GetArchivedTenantDeleteSQL() string {
+	return fmt.Sprintf(deleteArchivedTenantMSSQLDialectSQL, migratorSchema, migratorArchivedTenantsTable)
+}
+
+// GetArchivedTenantRenameSQL returns MS SQL-specific SQL statement which renames an archived tenant
+func (md *msSQLDialect) GetArchivedTenantRenameSQL() string {
+	return fmt.Sprintf(renameArchivedTenantMSSQLDialectSQL, migratorSchema, migratorArchivedTenantsTable)
+}
+
+// GetTenantDeleteSQL returns MS SQL-specific SQL statement which deletes a tenant from migrator's default tenants table
+func (md *msSQLDialect) GetTenantDeleteSQL() string {
+	return fmt.Sprintf(deleteTenantMSSQLDialectSQL, migratorSchema, migratorTenantsTable)
+}
+
+// GetTenantRenameSQL returns MS SQL-specific SQL statement which renames a tenant in migrator's default tenants table
+func (md *msSQLDialect) GetTenantRenameSQL() string {
+	return fmt.Sprintf(renameTenantMSSQLDialectSQL, migratorSchema, migratorTenantsTable)
+}
+
+// GetMigrationsDeleteBySchemaSQL returns MS SQL-specific SQL statement which deletes all migrations applied to a given schema
+func (md *msSQLDialect) GetMigrationsDeleteBySchemaSQL() string {
+	return fmt.Sprintf(deleteMigrationsBySchemaMSSQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetMigrationsSchemaRenameSQL returns MS SQL-specific SQL statement which renames schema of all migrations applied to it
+func (md *msSQLDialect) GetMigrationsSchemaRenameSQL() string {
+	return fmt.Sprintf(renameMigrationsSchemaMSSQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetSchemaTablesSQL returns MS SQL-specific SQL query which returns names of all tables of a given schema
+func (md *msSQLDialect) GetSchemaTablesSQL() string {
+	return selectSchemaTablesMSSQLDialectSQL
+}
+
+// GetSchemaObjectsSQL returns MS SQL-specific SQL query which returns tables, columns, indexes, and constraints of a given schema
+func (md *msSQLDialect) GetSchemaObjectsSQL() string {
+	return selectSchemaObjectsMSSQLDialectSQL
+}
+
+// GetVersionSchemaSnapshotsSelectSQL returns MS SQL-specific SQL query which returns schema snapshots of a given version
+func (md *msSQLDialect) GetVersionSchemaSnapshotsSelectSQL() string {
+	return fmt.Sprintf(selectVersionSnapshotsMSSQLDialectSQL, migratorSchema, migratorSchemaSnapshotsTable)
+}
+
+// GetSchemaSnapshotInsertSQL returns MS SQL-specific SQL statement which records schema snapshot
+func (md *msSQLDialect) GetSchemaSnapshotInsertSQL() string {
+	return fmt.Sprintf(insertSchemaSnapshotMSSQLDialectSQL, migratorSchema, migratorSchemaSnapshotsTable)
+}
+
+// GetVersionSchemaSnapshotsDeleteSQL returns MS SQL-specific SQL statement which deletes schema snapshots of a given version
+func (md *msSQLDialect) GetVersionSchemaSnapshotsDeleteSQL() string {
+	return fmt.Sprintf(deleteVersionSnapshotsMSSQLDialectSQL, migratorSchema, migratorSchemaSnapshotsTable)
+}
+
+// GetCreateArchivedTenantsTableSQL returns migrator's create archived tenants table SQL statement.
+// This SQL is used by MS SQL.
+func (md *msSQLDialect) GetCreateArchivedTenantsTableSQL() string {
+	return fmt.Sprintf(createArchivedTenantsTableMSSQLDialectSQL, migratorSchema, migratorArchivedTenantsTable, migratorSchema, migratorArchivedTenantsTable)
+}
+
+// GetCreateSchemaSnapshotsTableSQL returns MS SQL-specific create schema snapshots table SQL statement
+func (md *msSQLDialect) GetCreateSchemaSnapshotsTableSQL() string {
+	return fmt.Sprintf(createSchemaSnapshotsTableMSSQLDialectSQL, migratorSchema, migratorSchemaSnapshotsTable, migratorSchema, migratorSchemaSnapshotsTable)
+}
+
+// GetDropSchemaSQL returns MS SQL-specific SQL statements which drop a schema
+// MS SQL cannot drop a schema which contains objects, all tables are dropped first
+func (md *msSQLDialect) GetDropSchemaSQL(schema string, tables []string) []string {
+	sqls := []string{}
+	for _, table := range tables {
+		sqls = append(sqls, fmt.Sprintf(dropTableMSSQLDialectSQL, schema, table))
+	}
+	return append(sqls, fmt.Sprintf(dropSchemaMSSQLDialectSQL, schema))
+}
+
+// GetRenameSchemaSQL returns MS SQL-specific SQL statements which rename a schema
+// MS SQL cannot rename a schema, new schema is created, all tables are transferred to it and the old schema is dropped
+func (md *msSQLDialect) GetRenameSchemaSQL(from string, to string, tables []string) []string {
+	sqls := []string{md.GetCreateSchemaSQL(to)}
+	for _, table := range tables {
+		sqls = append(sqls, fmt.Sprintf(transferTableMSSQLDialectSQL, to, from, table))
+	}
+	return append(sqls, fmt.Sprintf(dropSchemaMSSQLDialectSQL, from))
+}
+
+// GetCreateJobsTableSQL returns MS SQL-specific create jobs table SQL statement
+func (md *msSQLDialect) GetCreateJobsTableSQL() string {
+	return fmt.Sprintf(createJobsTableMSSQLDialectSQL, migratorSchema, migratorJobsTable, migratorSchema, migratorJobsTable)
+}
+
+// GetJobInsertSQL returns MS SQL-specific SQL statement which records a new job
+func (md *msSQLDialect) GetJobInsertSQL() string {
+	return fmt.Sprintf(insertJobMSSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobUpdateSQL returns MS SQL-specific SQL statement which updates status, progress, and results of a job
+func (md *msSQLDialect) GetJobUpdateSQL() string {
+	return fmt.Sprintf(updateJobMSSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobByIDSQL returns MS SQL-specific SQL query which returns a job by its ID
+func (md *msSQLDialect) GetJobByIDSQL() string {
+	return fmt.Sprintf(selectJobByIDMSSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobFailStaleSQL returns MS SQL-specific SQL statement which marks a running job as failed if its heartbeat is older than a given time
+func (md *msSQLDialect) GetJobFailStaleSQL() string {
+	return fmt.Sprintf(failStaleJobMSSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/stretchr/testify/assert"
@@ -227,3 +228,71 @@ func TestMSSQLGetMigrationByIDSQL(t *testing.T) {
 
 	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from migrator.migrator_migrations where id = @p1", migrationByID)
 }
+
+func TestMSSQLGetAcquireAndReleaseLockSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mssql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	acquireLockSQL := dialect.GetAcquireLockSQL(30 * time.Second)
+
+	assert.Contains(t, acquireLockSQL, "exec @result = sp_getapplock @Resource = 'migrator', @LockMode = 'Exclusive', @LockOwner = 'Transaction', @LockTimeout = 30000;")
+	// transaction-level application lock is released on commit/rollback
+	assert.Equal(t, "", dialect.GetReleaseLockSQL())
+}
+
+func TestMSSQLGetChecksumRepairSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mssql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "insert into migrator.migrator_checksum_repairs (filename, old_checksum, new_checksum, old_contents, new_contents, reason) values (@p1, @p2, @p3, @p4, @p5, @p6)", dialect.GetChecksumRepairInsertSQL())
+	assert.Equal(t, "update migrator.migrator_migrations set contents = @p1, checksum = @p2 where filename = @p3", dialect.GetMigrationChecksumUpdateSQL())
+}
+
+func TestMSSQLGetTenantLabelsSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mssql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "select tenant, label_key, label_value from migrator.migrator_tenant_labels order by tenant, label_key", dialect.GetTenantLabelsSelectSQL())
+	assert.Equal(t, "delete from migrator.migrator_tenant_labels where tenant = @p1", dialect.GetTenantLabelsDeleteSQL())
+	assert.Equal(t, "insert into migrator.migrator_tenant_labels (tenant, label_key, label_value) values (@p1, @p2, @p3)", dialect.GetTenantLabelInsertSQL())
+}
+
+func TestMSSQLGetTenantLifecycleSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mssql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "insert into migrator.migrator_archived_tenants (name) values (@p1)", dialect.GetArchivedTenantInsertSQL())
+	assert.Equal(t, "update migrator.migrator_tenants set name = @p1 where name = @p2", dialect.GetTenantRenameSQL())
+	assert.Equal(t, "delete from migrator.migrator_migrations where db_schema = @p1", dialect.GetMigrationsDeleteBySchemaSQL())
+	assert.Equal(t, []string{"drop table [abc].[settings]", "drop schema [abc]"}, dialect.GetDropSchemaSQL("abc", []string{"settings"}))
+	renameSQL := dialect.GetRenameSchemaSQL("abc", "def", []string{"settings"})
+	assert.Len(t, renameSQL, 3)
+	assert.Contains(t, renameSQL[0], "create schema def")
+	assert.Equal(t, []string{"alter schema [def] transfer [abc].[settings]", "drop schema [abc]"}, renameSQL[1:])
+}
+
+func TestMSSQLGetJobSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mssql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	assert.Contains(t, dialect.GetCreateJobsTableSQL(), "create table [migrator].migrator_jobs")
+	assert.Equal(t, "insert into migrator.migrator_jobs (operation, name, status) output inserted.id values (@p1, @p2, @p3)", dialect.GetJobInsertSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set status = @p1, applied = @p2, total = @p3, summary = @p4, error = @p5, owner = @p6, heartbeat = @p7, updated = current_timestamp where id = @p8", dialect.GetJobUpdateSQL())
+	assert.Equal(t, "select id, operation, name, status, applied, total, summary, error, owner, heartbeat, created, updated from migrator.migrator_jobs where id = @p1", dialect.GetJobByIDSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set status = @p1, error = @p2, updated = current_timestamp where id = @p3 and status = @p4 and heartbeat < @p5", dialect.GetJobFailStaleSQL())
+}
@@ -2,6 +2,9 @@ package db
 
 import (
 	"fmt"
+	"math"
+	"time"
+
 	// blank import for MySQL driver
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -17,6 +20,32 @@ const (
 	selectVersionsByFileMySQLDialectSQL        = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = ?) order by vid desc, mid asc"
 	selectVersionByIDMySQLDialectSQL           = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = ? order by mid asc"
 	selectMigrationByIDMySQLDialectSQL         = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from %v.%v where id = ?"
+	deleteVersionMySQLDialectSQL               = "delete from %v.%v where id = ?"
+	deleteMigrationsByVersionIDMySQLDialectSQL = "delete from %v.%v where version_id = ?"
+	dropSchemaMySQLDialectSQL                  = "drop database if exists %v"
+	renameTableMySQLDialectSQL                 = "rename table `%v`.`%v` to `%v`.`%v`"
+	acquireLockMySQLDialectSQL                 = "select get_lock('%v', %d)"
+	releaseLockMySQLDialectSQL                 = "select release_lock('%v')"
+	insertChecksumRepairMySQLDialectSQL        = "insert into %v.%v (filename, old_checksum, new_checksum, old_contents, new_contents, reason) values (?, ?, ?, ?, ?, ?)"
+	updateMigrationChecksumMySQLDialectSQL     = "update %v.%v set contents = ?, checksum = ? where filename = ?"
+	deleteTenantLabelsMySQLDialectSQL          = "delete from %v.%v where tenant = ?"
+	insertTenantLabelMySQLDialectSQL           = "insert into %v.%v (tenant, label_key, label_value) values (?, ?, ?)"
+	renameTenantLabelsMySQLDialectSQL          = "update %v.%v set tenant = ? where tenant = ?"
+	insertArchivedTenantMySQLDialectSQL        = "insert into %v.%v (name) values (?)"
+	deleteArchivedTenantMySQLDialectSQL        = "delete from %v.%v where name = ?"
+	renameArchivedTenantMySQLDialectSQL        = "update %v.%v set name = ? where name = ?"
+	deleteTenantMySQLDialectSQL                = "delete from %v.%v where name = ?"
+	renameTenantMySQLDialectSQL                = "update %v.%v set name = ? where name = ?"
+	deleteMigrationsBySchemaMySQLDialectSQL    = "delete from %v.%v where db_schema = ?"
+	renameMigrationsSchemaMySQLDialectSQL      = "update %v.%v set db_schema = ? where db_schema = ?"
+	selectVersionSnapshotsMySQLDialectSQL      = "select version_id, db_schema, type, fingerprint, objects from %v.%v where version_id = ? order by type, db_schema"
+	insertSchemaSnapshotMySQLDialectSQL        = "insert into %v.%v (version_id, db_schema, type, fingerprint, objects) values (?, ?, ?, ?, ?)"
+	deleteVersionSnapshotsMySQLDialectSQL      = "delete from %v.%v where version_id = ?"
+	insertJobMySQLDialectSQL                   = "insert into %v.%v (operation, name, status) values (?, ?, ?)"
+	updateJobMySQLDialectSQL                   = "update %v.%v set status = ?, applied = ?, total = ?, summary = ?, error = ?, owner = ?, heartbeat = ?, updated = current_timestamp where id = ?"
+	selectJobByIDMySQLDialectSQL               = "select id, operation, name, status, applied, total, summary, error, owner, heartbeat, created, updated from %v.%v where id = ?"
+	failStaleJobMySQLDialectSQL                = "update %v.%v set status = ?, error = ?, updated = current_timestamp where id = ? and status = ? and heartbeat < ?"
+	selectSchemaTablesMySQLDialectSQL          = "select table_name from information_schema.tables where table_schema = ?"
 	versionsTableSetupMySQLDropDialectSQL      = `drop procedure if exists migrator_create_versions`
 	versionsTableSetupMySQLCallDialectSQL      = `call migrator_create_versions()`
 	versionsTableSetupMySQLProcedureDialectSQL = `
@@ -41,6 +70,19 @@ if not exists (select * from information_schema.tables where table_schema = '%v'
     add constraint migrator_versions_version_id_fk foreign key (version_id) references %v.%v (id) on delete cascade;
 end if;
 end;
+`
+
+	// schema objects are filtered in the outer query so that the schema is passed only once
+	selectSchemaObjectsMySQLDialectSQL = `
+select object_type, object_name, definition from (
+  select 'table' as object_type, table_schema as schema_name, table_name as object_name, table_type as definition from information_schema.tables
+  union all
+  select 'column', table_schema, concat(table_name, '.', column_name), concat(column_type, if(is_nullable = 'NO', ' not null', ''), coalesce(concat(' default ', column_default), ''), if(extra = '', '', concat(' ', extra))) from information_schema.columns
+  union all
+  select 'index', table_schema, concat(table_name, '.', index_name), concat(if(non_unique = 0, 'unique ', ''), index_type, ' (', group_concat(column_name order by seq_in_index), ')') from information_schema.statistics group by table_schema, table_name, index_name, non_unique, index_type
+  union all
+  select 'constraint', table_schema, concat(table_name, '.', constraint_name), constraint_type from information_schema.table_constraints
+) o where schema_name = ?
 `
 )
 
@@ -87,3 +129,145 @@ func (md *mySQLDialect) GetVersionByIDSQL() string {
 func (md *mySQLDialect) GetMigrationByIDSQL() string {
 	return fmt.Sprintf(selectMigrationByIDMySQLDialectSQL, migratorSchema, migratorMigrationsTable)
 }
+
+// GetVersionDeleteSQL returns MySQL-specific SQL statement which deletes version by ID
+func (md *mySQLDialect) GetVersionDeleteSQL() string {
+	return fmt.Sprintf(deleteVersionMySQLDialectSQL, migratorSchema, migratorVersionsTable)
+}
+
+// GetMigrationsDeleteByVersionIDSQL returns MySQL-specific SQL statement which deletes all migrations recorded in a given version
+func (md *mySQLDialect) GetMigrationsDeleteByVersionIDSQL() string {
+	return fmt.Sprintf(deleteMigrationsByVersionIDMySQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetAcquireLockSQL returns MySQL-specific SQL statement which waits up to timeout (in whole seconds) for a named lock
+// the statement returns 1 if the lock was acquired and 0 otherwise
+func (md *mySQLDialect) GetAcquireLockSQL(timeout time.Duration) string {
+	return fmt.Sprintf(acquireLockMySQLDialectSQL, migratorLockName, int(math.Ceil(timeout.Seconds())))
+}
+
+// GetReleaseLockSQL returns MySQL-specific SQL statement which releases named lock
+// named locks are owned by the session and are not released on commit/rollback
+func (md *mySQLDialect) GetReleaseLockSQL() string {
+	return fmt.Sprintf(releaseLockMySQLDialectSQL, migratorLockName)
+}
+
+// GetChecksumRepairInsertSQL returns MySQL-specific SQL statement which records checksum repair
+func (md *mySQLDialect) GetChecksumRepairInsertSQL() string {
+	return fmt.Sprintf(insertChecksumRepairMySQLDialectSQL, migratorSchema, migratorChecksumRepairsTable)
+}
+
+// GetMigrationChecksumUpdateSQL returns MySQL-specific SQL statement which updates contents and checksum of a migration in all schemas
+func (md *mySQLDialect) GetMigrationChecksumUpdateSQL() string {
+	return fmt.Sprintf(updateMigrationChecksumMySQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetTenantLabelsDeleteSQL returns MySQL-specific SQL statement which deletes all labels of a tenant
+func (md *mySQLDialect) GetTenantLabelsDeleteSQL() string {
+	return fmt.Sprintf(deleteTenantLabelsMySQLDialectSQL, migratorSchema, migratorTenantLabelsTable)
+}
+
+// GetTenantLabelInsertSQL returns MySQL-specific SQL statement which inserts a tenant label
+func (md *mySQLDialect) GetTenantLabelInsertSQL() string {
+	return fmt.Sprintf(insertTenantLabelMySQLDialectSQL, migratorSchema, migratorTenantLabelsTable)
+}
+
+// GetTenantLabelsRenameSQL returns MySQL-specific SQL statement which renames tenant in tenant labels
+func (md *mySQLDialect) GetTenantLabelsRenameSQL() string {
+	return fmt.Sprintf(renameTenantLabelsMySQLDialectSQL, migratorSchema, migratorTenantLabelsTable)
+}
+
+// GetArchivedTenantInsertSQL returns MySQL-specific SQL statement which archives a tenant
+func (md *mySQLDialect) GetArchivedTenantInsertSQL() string {
+	return fmt.Sprintf(insertArchivedTenantMySQLDialectSQL, migratorSchema, migratorArchivedTenantsTable)
+}
+
+// GetArchivedTenantDeleteSQL returns MySQL-specific SQL statement which removes a tenant from archived tenants
+func (md *mySQLDialect) GetArchivedTenantDeleteSQL() string {
+	return fmt.Sprintf(deleteArchivedTenantMySQLDialectSQL, migratorSchema, migratorArchivedTenantsTable)
+}
+
+// GetArchivedTenantRenameSQL returns MySQL-specific SQL statement which renames an archived tenant
+func (md *mySQLDialect) GetArchivedTenantRenameSQL() string {
+	return fmt.Sprintf(renameArchivedTenantMySQLDialectSQL, migratorSchema, migratorArchivedTenantsTable)
+}
+
+// GetTenantDeleteSQL returns MySQL-specific SQL statement which deletes a tenant from migrator's default tenants table
+func (md *mySQLDialect) GetTenantDeleteSQL() string {
+	return fmt.Sprintf(deleteTenantMySQLDialectSQL, migratorSchema, migratorTenantsTable)
+}
+
+// GetTenantRenameSQL returns MySQL-specific SQL statement which renames a tenant in migrator's default tenants table
+func (md *mySQLDialect) GetTenantRenameSQL() string {
+	return fmt.Sprintf(renameTenantMySQLDialectSQL, migratorSchema, migratorTenantsTable)
+}
+
+// GetMigrationsDeleteBySchemaSQL returns MySQL-specific SQL statement which deletes all migrations applied to a given schema
+func (md *mySQLDialect) GetMigrationsDeleteBySchemaSQL() string {
+	return fmt.Sprintf(deleteMigrationsBySchemaMySQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetMigrationsSchemaRenameSQL returns MySQL-specific SQL statement which renames schema of all migrations applied to it
+func (md *mySQLDialect) GetMigrationsSchemaRenameSQL() string {
+	return fmt.Sprintf(renameMigrationsSchemaMySQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetSchemaTablesSQL returns MySQL-specific SQL query which returns names of all tables of a given schema
+func (md *mySQLDialect) GetSchemaTablesSQL() string {
+	return selectSchemaTablesMySQLDialectSQL
+}
+
+// GetSchemaObjectsSQL returns MySQL-specific SQL query which returns tables, columns, indexes, and constraints of a given schema
+func (md *mySQLDialect) GetSchemaObjectsSQL() string {
+	return selectSchemaObjectsMySQLDialectSQL
+}
+
+// GetVersionSchemaSnapshotsSelectSQL returns MySQL-specific SQL query which returns schema snapshots of a given version
+func (md *mySQLDialect) GetVersionSchemaSnapshotsSelectSQL() string {
+	return fmt.Sprintf(selectVersionSnapshotsMySQLDialectSQL, migratorSchema, migratorSchemaSnapshotsTable)
+}
+
+// GetSchemaSnapshotInsertSQL returns MySQL-specific SQL statement which records schema snapshot
+func (md *mySQLDialect) GetSchemaSnapshotInsertSQL() string {
+	return fmt.Sprintf(insertSchemaSnapshotMySQLDialectSQL, migratorSchema, migratorSchemaSnapshotsTable)
+}
+
+// GetVersionSchemaSnapshotsDeleteSQL returns MySQL-specific SQL statement which deletes schema snapshots of a given version
+func (md *mySQLDialect) GetVersionSchemaSnapshotsDeleteSQL() string {
+	return fmt.Sprintf(deleteVersionSnapshotsMySQLDialectSQL, migratorSchema, migratorSchemaSnapshotsTable)
+}
+
+// GetDropSchemaSQL returns MySQL-specific SQL statements which drop a schema (database) together with all its tables
+func (md *mySQLDialect) GetDropSchemaSQL(schema string, tables []string) []string {
+	return []string{fmt.Sprintf(dropSchemaMySQLDialectSQL, schema)}
+}
+
+// GetRenameSchemaSQL returns MySQL-specific SQL statements which rename a schema
+// MySQL cannot rename a database, new database is created, all tables are moved to it and the old database is dropped
+func (md *mySQLDialect) GetRenameSchemaSQL(from string, to string, tables []string) []string {
+	sqls := []string{md.GetCreateSchemaSQL(to)}
+	for _, table := range tables {
+		sqls = append(sqls, fmt.Sprintf(renameTableMySQLDialectSQL, from, table, to, table))
+	}
+	return append(sqls, fmt.Sprintf(dropSchemaMySQLDialectSQL, from))
+}
+
+// GetJobInsertSQL returns MySQL-specific SQL statement which records a new job
+func (md *mySQLDialect) GetJobInsertSQL() string {
+	return fmt.Sprintf(insertJobMySQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobUpdateSQL returns MySQL-specific SQL statement which updates status, progress, and results of a job
+func (md *mySQLDialect) GetJobUpdateSQL() string {
+	return fmt.Sprintf(updateJobMySQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobByIDSQL returns MySQL-specific SQL query which returns a job by its ID
+func (md *mySQLDialect) GetJobByIDSQL() string {
+	return fmt.Sprintf(selectJobByIDMySQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobFailStaleSQL returns MySQL-specific SQL statement which marks a running job as failed if its heartbeat is older than a given time
+func (md *mySQLDialect) GetJobFailStaleSQL() string {
+	return fmt.Sprintf(failStaleJobMySQLDialectSQL, migratorSchema, migratorJobsTable)
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"testing"
+	"time"
 
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/stretchr/testify/assert"
@@ -139,3 +140,51 @@ func TestMySQLGetMigrationByIDSQL(t *testing.T) {
 
 	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from migrator.migrator_migrations where id = ?", migrationByID)
 }
+
+func TestMySQLGetAcquireAndReleaseLockSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mysql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "select get_lock('migrator', 2)", dialect.GetAcquireLockSQL(1500*time.Millisecond))
+	assert.Equal(t, "select release_lock('migrator')", dialect.GetReleaseLockSQL())
+}
+
+func TestMySQLGetChecksumRepairSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mysql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "insert into migrator.migrator_checksum_repairs (filename, old_checksum, new_checksum, old_contents, new_contents, reason) values (?, ?, ?, ?, ?, ?)", dialect.GetChecksumRepairInsertSQL())
+	assert.Equal(t, "update migrator.migrator_migrations set contents = ?, checksum = ? where filename = ?", dialect.GetMigrationChecksumUpdateSQL())
+}
+
+func TestMySQLGetTenantLabelsSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mysql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "select tenant, label_key, label_value from migrator.migrator_tenant_labels order by tenant, label_key", dialect.GetTenantLabelsSelectSQL())
+	assert.Equal(t, "delete from migrator.migrator_tenant_labels where tenant = ?", dialect.GetTenantLabelsDeleteSQL())
+	assert.Equal(t, "insert into migrator.migrator_tenant_labels (tenant, label_key, label_value) values (?, ?, ?)", dialect.GetTenantLabelInsertSQL())
+}
+
+func TestMySQLGetTenantLifecycleSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mysql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "insert into migrator.migrator_archived_tenants (name) values (?)", dialect.GetArchivedTenantInsertSQL())
+	assert.Equal(t, "update migrator.migrator_tenants set name = ? where name = ?", dialect.GetTenantRenameSQL())
+	assert.Equal(t, "delete from migrator.migrator_migrations where db_schema = ?", dialect.GetMigrationsDeleteBySchemaSQL())
+	assert.Equal(t, []string{"drop database if exists abc"}, dialect.GetDropSchemaSQL("abc", []string{"settings"}))
+	assert.Equal(t, []string{"create schema if not exists def", "rename table `abc`.`settings` to `def`.`settings`", "drop database if exists abc"}, dialect.GetRenameSchemaSQL("abc", "def", []string{"settings"}))
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/config"
+)
+
+// pool is a connection pool shared by all connectors created for the same driver, data source, and pool settings,
+// connectors are created per request while the pool lives as long as the process
+type pool struct {
+	db    *sql.DB
+	mutex sync.Mutex
+	// setups contains keys of target configs for which setup already succeeded
+	setups map[string]bool
+}
+
+var (
+	poolsMutex sync.Mutex
+	pools      = map[string]*pool{}
+)
+
+var (
+	connectGuardsMutex sync.Mutex
+	connectGuards      = map[string]*sync.Mutex{}
+)
+
+// connectGuard returns a mutex which serializes connecting to a data source (identified by pool key for database/sql drivers),
+// connecting (together with retries) does not block lookups of pools and clients of other data sources
+func connectGuard(dataSource string) *sync.Mutex {
+	connectGuardsMutex.Lock()
+	defer connectGuardsMutex.Unlock()
+	guard, ok := connectGuards[dataSource]
+	if !ok {
+		guard = &sync.Mutex{}
+		connectGuards[dataSource] = guard
+	}
+	return guard
+}
+
+// poolKey identifies shared connection pool, targets share a pool only when they use the same driver, data source, and pool settings
+func poolKey(config *config.Config) string {
+	return fmt.Sprintf("%v|%v|%v|%v|%v", sqlDriverName(config.Driver), config.DataSource, config.MaxOpenConns, config.MaxIdleConns, config.GetConnMaxLifetime())
+}
+
+// lookupPool returns shared connection pool for the passed pool key if it is already opened
+func lookupPool(key string) (*pool, bool) {
+	poolsMutex.Lock()
+	defer poolsMutex.Unlock()
+	p, ok := pools[key]
+	return p, ok
+}
+
+// getPool returns shared connection pool for the passed config, the pool is opened on first use
+func getPool(ctx context.Context, config *config.Config) (*pool, error) {
+	key := poolKey(config)
+	if p, ok := lookupPool(key); ok {
+		return p, nil
+	}
+
+	guard := connectGuard(key)
+	guard.Lock()
+	defer guard.Unlock()
+
+	// pool could have been opened while waiting for the guard
+	if p, ok := lookupPool(key); ok {
+		return p, nil
+	}
+
+	db, err := sql.Open(sqlDriverName(config.Driver), config.DataSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection to DB: %v", err.Error())
+	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	if config.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(config.GetConnMaxLifetime())
+
+	if err := pingWithRetries(ctx, config, db.PingContext); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+
+	p := &pool{db: db, setups: map[string]bool{}}
+	poolsMutex.Lock()
+	pools[key] = p
+	poolsMutex.Unlock()
+	return p, nil
+}
+
+// setup runs fn once per pool and target config identified by key, fn is run again on next call if it failed
+func (p *pool) setup(key string, fn func() error) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.setups[key] {
+		return nil
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	p.setups[key] = true
+	return nil
+}
+
+// pingWithRetries calls ping and retries it config.ConnectRetries times, the delay between retries doubles every time
+func pingWithRetries(ctx context.Context, config *config.Config, ping func(context.Context) error) error {
+	backoff := config.GetConnectRetryBackoff()
+	err := ping(ctx)
+	for attempt := 1; err != nil && attempt <= config.ConnectRetries; attempt++ {
+		common.LogWarn(ctx, "Could not connect to database, retry %v of %v in %v: %v", attempt, config.ConnectRetries, backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		err = ping(ctx)
+	}
+	return err
+}
+
+// Connect opens shared connection pool for the passed config, it is used at startup to fail fast when database is not available
+func Connect(ctx context.Context, config *config.Config) error {
+	if config.Driver == "mongodb" {
+		_, err := getMongoDBClient(ctx, config)
+		return err
+	}
+	_, err := getPool(ctx, config)
+	return err
+}
+
+// ConnectTargets opens shared connection pools of all targets at startup
+// only a failure of the default target is returned, a named target which cannot be connected is logged
+// and connected on its first request so that one unavailable database does not stop the whole service
+func ConnectTargets(ctx context.Context, cfg *config.Config) error {
+	if cfg.HasDefaultTarget() {
+		if err := Connect(ctx, cfg); err != nil {
+			return err
+		}
+	}
+	for _, name := range cfg.GetTargetNames() {
+		targetConfig, _ := cfg.GetTarget(name)
+		if err := Connect(ctx, targetConfig); err != nil {
+			common.LogError(ctx, "Error connecting to database of target %v, it will be connected on first request: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Stats returns statistics of the shared connection pool for the passed config,
+// false is returned when the pool has not been opened yet or the driver does not use database/sql
+func Stats(config *config.Config) (sql.DBStats, bool) {
+	p, ok := lookupPool(poolKey(config))
+	if !ok {
+		return sql.DBStats{}, false
+	}
+	return p.db.Stats(), true
+}
+
+// isPooled returns true if db is a shared connection pool
+func isPooled(db *sql.DB) bool {
+	poolsMutex.Lock()
+	defer poolsMutex.Unlock()
+	for _, p := range pools {
+		if p.db == db {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedPool(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	config.MaxOpenConns = 4
+	config.MaxIdleConns = 2
+
+	_, ok := Stats(config)
+	assert.False(t, ok)
+
+	first := New(newTestContext(), config)
+	_, err := first.GetTenants()
+	assert.Nil(t, err)
+	first.Dispose()
+
+	second := New(newTestContext(), config)
+	_, err = second.GetTenants()
+	assert.Nil(t, err)
+	second.Dispose()
+
+	// both connectors use the same pool which stays open after Dispose
+	assert.Same(t, first.(*baseConnector).db, second.(*baseConnector).db)
+	assert.Nil(t, second.(*baseConnector).db.Ping())
+
+	stats, ok := Stats(config)
+	assert.True(t, ok)
+	assert.Equal(t, 4, stats.MaxOpenConnections)
+}
+
+func TestSharedPoolSettings(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	config.MaxOpenConns = 4
+	other := *config
+	other.MaxOpenConns = 8
+
+	first := New(newTestContext(), config)
+	_, err := first.GetTenants()
+	assert.Nil(t, err)
+	defer first.Dispose()
+
+	second := New(newTestContext(), &other)
+	_, err = second.GetTenants()
+	assert.Nil(t, err)
+	defer second.Dispose()
+
+	// the same data source with different pool settings uses a separate pool
+	assert.NotSame(t, first.(*baseConnector).db, second.(*baseConnector).db)
+	stats, _ := Stats(config)
+	assert.Equal(t, 4, stats.MaxOpenConnections)
+	stats, _ = Stats(&other)
+	assert.Equal(t, 8, stats.MaxOpenConnections)
+}
+
+func TestPoolKey(t *testing.T) {
+	// postgres is an alias of pgx driver
+	assert.Equal(t, poolKey(&config.Config{Driver: "postgres", DataSource: "abc"}), poolKey(&config.Config{Driver: "pgx", DataSource: "abc"}))
+	assert.NotEqual(t, poolKey(&config.Config{Driver: "mysql", DataSource: "abc"}), poolKey(&config.Config{Driver: "pgx", DataSource: "abc"}))
+}
+
+func TestSharedPoolSetupPerTarget(t *testing.T) {
+	// first target uses a custom tenants table and migrator does not create the default one
+	config := newSQLiteTestConfig(t)
+	config.TenantSelectSQL = "select 'abc'"
+	first := New(newTestContext(), config)
+	tenants, err := first.GetTenants()
+	assert.Nil(t, err)
+	assert.Len(t, tenants, 1)
+	defer first.Dispose()
+
+	// second target shares the pool but uses the default tenants table which has to be created for it
+	other := *config
+	other.TenantSelectSQL = ""
+	second := New(newTestContext(), &other)
+	tenants, err = second.GetTenants()
+	assert.Nil(t, err)
+	assert.Len(t, tenants, 0)
+	defer second.Dispose()
+
+	assert.Same(t, first.(*baseConnector).db, second.(*baseConnector).db)
+}
+
+func TestSharedPoolConcurrentConnectors(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			connector := New(newTestContext(), config)
+			defer connector.Dispose()
+			_, err := connector.GetTenants()
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.Nil(t, err)
+	}
+}
+
+func TestPingWithRetries(t *testing.T) {
+	config := &config.Config{ConnectRetries: 3, ConnectRetryBackoff: "1ms"}
+
+	attempts := 0
+	ping := func(context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	err := pingWithRetries(context.TODO(), config, ping)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestPingWithRetriesExhausted(t *testing.T) {
+	config := &config.Config{ConnectRetries: 2, ConnectRetryBackoff: "1ms"}
+
+	attempts := 0
+	ping := func(context.Context) error {
+		attempts++
+		return errors.New("connection refused")
+	}
+
+	err := pingWithRetries(context.TODO(), config, ping)
+	assert.Equal(t, "connection refused", err.Error())
+	// first attempt and 2 retries
+	assert.Equal(t, 3, attempts)
+}
+
+func TestPingWithRetriesCancelled(t *testing.T) {
+	config := &config.Config{ConnectRetries: 5, ConnectRetryBackoff: "1m"}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+
+	ping := func(context.Context) error {
+		return errors.New("connection refused")
+	}
+
+	err := pingWithRetries(ctx, config, ping)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestConnectError(t *testing.T) {
+	config := &config.Config{Driver: "abcxyz", DataSource: "cba"}
+
+	err := Connect(context.TODO(), config)
+	assert.Contains(t, err.Error(), "failed to open connection to DB")
+}
+
+func TestGetPoolNotBlockedByConnectingDataSource(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+
+	// another data source is being connected (with retries) and holds its guard
+	guard := connectGuard("slow-data-source")
+	guard.Lock()
+	defer guard.Unlock()
+
+	done := make(chan error)
+	go func() {
+		_, err := getPool(context.TODO(), config)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("getPool blocked by connecting another data source")
+	}
+}
+
+func TestConnectTargets(t *testing.T) {
+	cfg := newSQLiteTestConfig(t)
+	cfg.Targets = map[string]*config.Target{
+		"unavailable": {Driver: "abcxyz", DataSource: "cba", BaseLocation: "test/migrations"},
+	}
+
+	// named target which cannot be connected does not fail startup
+	err := ConnectTargets(context.TODO(), cfg)
+	assert.Nil(t, err)
+	_, ok := Stats(cfg)
+	assert.True(t, ok)
+
+	// default target is required
+	cfg.Driver = "abcxyz"
+	cfg.DataSource = "xyz"
+	err = ConnectTargets(context.TODO(), cfg)
+	assert.Contains(t, err.Error(), "failed to open connection to DB")
+}
@@ -2,6 +2,8 @@ package db
 
 import (
 	"fmt"
+	"time"
+
 	// blank import for PostgreSQL driver
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
@@ -11,13 +13,38 @@ type postgreSQLDialect struct {
 }
 
 const (
-	insertMigrationPostgreSQLDialectSQL      = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values ($1, $2, $3, $4, $5, $6, $7, $8)"
-	insertTenantPostgreSQLDialectSQL         = "insert into %v.%v (name) values ($1)"
-	insertVersionPostgreSQLDialectSQL        = "insert into %v.%v (name) values ($1) returning id"
-	selectVersionsByFilePostgreSQLDialectSQL = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = $1) order by vid desc, mid asc"
-	selectVersionByIDPostgreSQLDialectSQL    = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = $1 order by mid asc"
-	selectMigrationByIDPostgreSQLDialectSQL  = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from %v.%v where id = $1"
-	versionsTableSetupPostgreSQLDialectSQL   = `
+	insertMigrationPostgreSQLDialectSQL             = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values ($1, $2, $3, $4, $5, $6, $7, $8)"
+	insertTenantPostgreSQLDialectSQL                = "insert into %v.%v (name) values ($1)"
+	insertVersionPostgreSQLDialectSQL               = "insert into %v.%v (name) values ($1) returning id"
+	selectVersionsByFilePostgreSQLDialectSQL        = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = $1) order by vid desc, mid asc"
+	selectVersionByIDPostgreSQLDialectSQL           = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = $1 order by mid asc"
+	selectMigrationByIDPostgreSQLDialectSQL         = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from %v.%v where id = $1"
+	deleteVersionPostgreSQLDialectSQL               = "delete from %v.%v where id = $1"
+	deleteMigrationsByVersionIDPostgreSQLDialectSQL = "delete from %v.%v where version_id = $1"
+	dropSchemaPostgreSQLDialectSQL                  = "drop schema if exists %v cascade"
+	renameSchemaPostgreSQLDialectSQL                = "alter schema %v rename to %v"
+	acquireLockPostgreSQLDialectSQL                 = "select pg_try_advisory_xact_lock(hashtext('%v'))::int"
+	insertChecksumRepairPostgreSQLDialectSQL        = "insert into %v.%v (filename, old_checksum, new_checksum, old_contents, new_contents, reason) values ($1, $2, $3, $4, $5, $6)"
+	updateMigrationChecksumPostgreSQLDialectSQL     = "update %v.%v set contents = $1, checksum = $2 where filename = $3"
+	deleteTenantLabelsPostgreSQLDialectSQL          = "delete from %v.%v where tenant = $1"
+	insertTenantLabelPostgreSQLDialectSQL           = "insert into %v.%v (tenant, label_key, label_value) values ($1, $2, $3)"
+	renameTenantLabelsPostgreSQLDialectSQL          = "update %v.%v set tenant = $1 where tenant = $2"
+	insertArchivedTenantPostgreSQLDialectSQL        = "insert into %v.%v (name) values ($1)"
+	deleteArchivedTenantPostgreSQLDialectSQL        = "delete from %v.%v where name = $1"
+	renameArchivedTenantPostgreSQLDialectSQL        = "update %v.%v set name = $1 where name = $2"
+	deleteTenantPostgreSQLDialectSQL                = "delete from %v.%v where name = $1"
+	renameTenantPostgreSQLDialectSQL                = "update %v.%v set name = $1 where name = $2"
+	deleteMigrationsBySchemaPostgreSQLDialectSQL    = "delete from %v.%v where db_schema = $1"
+	renameMigrationsSchemaPostgreSQLDialectSQL      = "update %v.%v set db_schema = $1 where db_schema = $2"
+	selectVersionSnapshotsPostgreSQLDialectSQL      = "select version_id, db_schema, type, fingerprint, objects from %v.%v where version_id = $1 order by type, db_schema"
+	insertSchemaSnapshotPostgreSQLDialectSQL        = "insert into %v.%v (version_id, db_schema, type, fingerprint, objects) values ($1, $2, $3, $4, $5)"
+	deleteVersionSnapshotsPostgreSQLDialectSQL      = "delete from %v.%v where version_id = $1"
+	insertJobPostgreSQLDialectSQL                   = "insert into %v.%v (operation, name, status) values ($1, $2, $3) returning id"
+	updateJobPostgreSQLDialectSQL                   = "update %v.%v set status = $1, applied = $2, total = $3, summary = $4, error = $5, owner = $6, heartbeat = $7, updated = current_timestamp where id = $8"
+	selectJobByIDPostgreSQLDialectSQL               = "select id, operation, name, status, applied, total, summary, error, owner, heartbeat, created, updated from %v.%v where id = $1"
+	failStaleJobPostgreSQLDialectSQL                = "update %v.%v set status = $1, error = $2, updated = current_timestamp where id = $3 and status = $4 and heartbeat < $5"
+	selectSchemaTablesPostgreSQLDialectSQL          = "select table_name from information_schema.tables where table_schema = $1"
+	versionsTableSetupPostgreSQLDialectSQL          = `
 do $$
 begin
 if not exists (select * from information_schema.tables where table_schema = '%v' and table_name = '%v') then
@@ -39,6 +66,25 @@ if not exists (select * from information_schema.tables where table_schema = '%v'
 end if;
 end $$;
 `
+
+	selectSchemaObjectsPostgreSQLDialectSQL = `
+select 'table', table_name::text, table_type::text from information_schema.tables where table_schema = $1
+union all
+select 'column', table_name || '.' || column_name, data_type || coalesce('(' || character_maximum_length || ')', '') || case when is_nullable = 'NO' then ' not null' else '' end || coalesce(' default ' || column_default, '') from information_schema.columns where table_schema = $1
+union all
+select 'index', tablename || '.' || indexname, indexdef from pg_catalog.pg_indexes where schemaname = $1
+union all
+select 'constraint', c.relname || '.' || co.conname, pg_catalog.pg_get_constraintdef(co.oid) from pg_catalog.pg_constraint co join pg_catalog.pg_class c on c.oid = co.conrelid join pg_catalog.pg_namespace n on n.oid = co.connamespace where n.nspname = $1
+`
+
+	setLockTimeoutPostgreSQLDialectSQL        = "set local lock_timeout = %d"
+	setStatementTimeoutPostgreSQLDialectSQL   = "set local statement_timeout = %d"
+	resetStatementTimeoutPostgreSQLDialectSQL = "set local statement_timeout to default"
+	// non-transactional migrations cannot use set local, session settings are restored after the migration
+	setSessionLockTimeoutPostgreSQLDialectSQL        = "set lock_timeout = %d"
+	resetSessionLockTimeoutPostgreSQLDialectSQL      = "set lock_timeout to default"
+	setSessionStatementTimeoutPostgreSQLDialectSQL   = "set statement_timeout = %d"
+	resetSessionStatementTimeoutPostgreSQLDialectSQL = "set statement_timeout to default"
 )
 
 // LastInsertIDSupported instructs migrator if Result.LastInsertId() is supported by the DB driver
@@ -80,3 +126,166 @@ func (pd *postgreSQLDialect) GetVersionByIDSQL() string {
 func (pd *postgreSQLDialect) GetMigrationByIDSQL() string {
 	return fmt.Sprintf(selectMigrationByIDPostgreSQLDialectSQL, migratorSchema, migratorMigrationsTable)
 }
+
+// GetVersionDeleteSQL returns PostgreSQL-specific SQL statement which deletes version by ID
+func (pd *postgreSQLDialect) GetVersionDeleteSQL() string {
+	return fmt.Sprintf(deleteVersionPostgreSQLDialectSQL, migratorSchema, migratorVersionsTable)
+}
+
+// GetMigrationsDeleteByVersionIDSQL returns PostgreSQL-specific SQL statement which deletes all migrations recorded in a given version
+func (pd *postgreSQLDialect) GetMigrationsDeleteByVersionIDSQL() string {
+	return fmt.Sprintf(deleteMigrationsByVersionIDPostgreSQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetAcquireLockSQL returns PostgreSQL-specific SQL statement which tries to acquire transaction-level advisory lock
+// the statement does not wait for the lock, it returns 1 if the lock was acquired and 0 otherwise
+func (pd *postgreSQLDialect) GetAcquireLockSQL(timeout time.Duration) string {
+	return fmt.Sprintf(acquireLockPostgreSQLDialectSQL, migratorLockName)
+}
+
+// GetDBLockTimeoutSQL returns PostgreSQL-specific SQL statement which sets lock_timeout (in milliseconds) for the current transaction
+func (pd *postgreSQLDialect) GetDBLockTimeoutSQL(timeout time.Duration) string {
+	return fmt.Sprintf(setLockTimeoutPostgreSQLDialectSQL, timeout.Milliseconds())
+}
+
+// GetStatementTimeoutSQL returns PostgreSQL-specific SQL statement which sets statement_timeout (in milliseconds) for the current transaction
+// zero timeout restores the session default
+func (pd *postgreSQLDialect) GetStatementTimeoutSQL(timeout time.Duration) string {
+	if timeout == 0 {
+		return resetStatementTimeoutPostgreSQLDialectSQL
+	}
+	return fmt.Sprintf(setStatementTimeoutPostgreSQLDialectSQL, timeout.Milliseconds())
+}
+
+// GetSessionDBLockTimeoutSQL returns PostgreSQL-specific SQL statement which sets lock_timeout (in milliseconds) for the current session
+// zero timeout restores the default
+func (pd *postgreSQLDialect) GetSessionDBLockTimeoutSQL(timeout time.Duration) string {
+	if timeout == 0 {
+		return resetSessionLockTimeoutPostgreSQLDialectSQL
+	}
+	return fmt.Sprintf(setSessionLockTimeoutPostgreSQLDialectSQL, timeout.Milliseconds())
+}
+
+// GetSessionStatementTimeoutSQL returns PostgreSQL-specific SQL statement which sets statement_timeout (in milliseconds) for the current session
+// zero timeout restores the default
+func (pd *postgreSQLDialect) GetSessionStatementTimeoutSQL(timeout time.Duration) string {
+	if timeout == 0 {
+		return resetSessionStatementTimeoutPostgreSQLDialectSQL
+	}
+	return fmt.Sprintf(setSessionStatementTimeoutPostgreSQLDialectSQL, timeout.Milliseconds())
+}
+
+// GetChecksumRepairInsertSQL returns PostgreSQL-specific SQL statement which records checksum repair
+func (pd *postgreSQLDialect) GetChecksumRepairInsertSQL() string {
+	return fmt.Sprintf(insertChecksumRepairPostgreSQLDialectSQL, migratorSchema, migratorChecksumRepairsTable)
+}
+
+// GetMigrationChecksumUpdateSQL returns PostgreSQL-specific SQL statement which updates contents and checksum of a migration in all schemas
+func (pd *postgreSQLDialect) GetMigrationChecksumUpdateSQL() string {
+	return fmt.Sprintf(updateMigrationChecksumPostgreSQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetTenantLabelsDeleteSQL returns PostgreSQL-specific SQL statement which deletes all labels of a tenant
+func (pd *postgreSQLDialect) GetTenantLabelsDeleteSQL() string {
+	return fmt.Sprintf(deleteTenantLabelsPostgreSQLDialectSQL, migratorSchema, migratorTenantLabelsTable)
+}
+
+// GetTenantLabelInsertSQL returns PostgreSQL-specific SQL statement which inserts a tenant label
+func (pd *postgreSQLDialect) GetTenantLabelInsertSQL() string {
+	return fmt.Sprintf(insertTenantLabelPostgreSQLDialectSQL, migratorSchema, migratorTenantLabelsTable)
+}
+
+// GetTenantLabelsRenameSQL returns PostgreSQL-specific SQL statement which renames tenant in tenant labels
+func (pd *postgreSQLDialect) GetTenantLabelsRenameSQL() string {
+	return fmt.Sprintf(renameTenantLabelsPostgreSQLDialectSQL, migratorSchema, migratorTenantLabelsTable)
+}
+
+// GetArchivedTenantInsertSQL returns PostgreSQL-specific SQL statement which archives a tenant
+func (pd *postgreSQLDialect) GetArchivedTenantInsertSQL() string {
+	return fmt.Sprintf(insertArchivedTenantPostgreSQLDialectSQL, migratorSchema, migratorArchivedTenantsTable)
+}
+
+// GetArchivedTenantDeleteSQL returns PostgreSQL-specific SQL statement which removes a tenant from archived tenants
+func (pd *postgreSQLDialect) GetArchivedTenantDeleteSQL() string {
+	return fmt.Sprintf(deleteArchivedTenantPostgreSQLDialectSQL, migratorSchema, migratorArchivedTenantsTable)
+}
+
+// GetArchivedTenantRenameSQL returns PostgreSQL-specific SQL statement which renames an archived tenant
+func (pd *postgreSQLDialect) GetArchivedTenantRenameSQL() string {
+	return fmt.Sprintf(renameArchivedTenantPostgreSQLDialectSQL, migratorSchema, migratorArchivedTenantsTable)
+}
+
+// GetTenantDeleteSQL returns PostgreSQL-specific SQL statement which deletes a tenant from migrator's default tenants table
+func (pd *postgreSQLDialect) GetTenantDeleteSQL() string {
+	return fmt.Sprintf(deleteTenantPostgreSQLDialectSQL, migratorSchema, migratorTenantsTable)
+}
+
+// GetTenantRenameSQL returns PostgreSQL-specific SQL statement which renames a tenant in migrator's default tenants table
+func (pd *postgreSQLDialect) GetTenantRenameSQL() string {
+	return fmt.Sprintf(renameTenantPostgreSQLDialectSQL, migratorSchema, migratorTenantsTable)
+}
+
+// GetMigrationsDeleteBySchemaSQL returns PostgreSQL-specific SQL statement which deletes all migrations applied to a given schema
+func (pd *postgreSQLDialect) GetMigrationsDeleteBySchemaSQL() string {
+	return fmt.Sprintf(deleteMigrationsBySchemaPostgreSQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetMigrationsSchemaRenameSQL returns PostgreSQL-specific SQL statement which renames schema of all migrations applied to it
+func (pd *postgreSQLDialect) GetMigrationsSchemaRenameSQL() string {
+	return fmt.Sprintf(renameMigrationsSchemaPostgreSQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetSchemaTablesSQL returns PostgreSQL-specific SQL query which returns names of all tables of a given schema
+func (pd *postgreSQLDialect) GetSchemaTablesSQL() string {
+	return selectSchemaTablesPostgreSQLDialectSQL
+}
+
+// GetSchemaObjectsSQL returns PostgreSQL-specific SQL query which returns tables, columns, indexes, and constraints of a given schema
+func (pd *postgreSQLDialect) GetSchemaObjectsSQL() string {
+	return selectSchemaObjectsPostgreSQLDialectSQL
+}
+
+// GetVersionSchemaSnapshotsSelectSQL returns PostgreSQL-specific SQL query which returns schema snapshots of a given version
+func (pd *postgreSQLDialect) GetVersionSchemaSnapshotsSelectSQL() string {
+	return fmt.Sprintf(selectVersionSnapshotsPostgreSQLDialectSQL, migratorSchema, migratorSchemaSnapshotsTable)
+}
+
+// GetSchemaSnapshotInsertSQL returns PostgreSQL-specific SQL statement which records schema snapshot
+func (pd *postgreSQLDialect) GetSchemaSnapshotInsertSQL() string {
+	return fmt.Sprintf(insertSchemaSnapshotPostgreSQLDialectSQL, migratorSchema, migratorSchemaSnapshotsTable)
+}
+
+// GetVersionSchemaSnapshotsDeleteSQL returns PostgreSQL-specific SQL statement which deletes schema snapshots of a given version
+func (pd *postgreSQLDialect) GetVersionSchemaSnapshotsDeleteSQL() string {
+	return fmt.Sprintf(deleteVersionSnapshotsPostgreSQLDialectSQL, migratorSchema, migratorSchemaSnapshotsTable)
+}
+
+// GetDropSchemaSQL returns PostgreSQL-specific SQL statements which drop a schema together with all its objects
+func (pd *postgreSQLDialect) GetDropSchemaSQL(schema string, tables []string) []string {
+	return []string{fmt.Sprintf(dropSchemaPostgreSQLDialectSQL, schema)}
+}
+
+// GetRenameSchemaSQL returns PostgreSQL-specific SQL statements which rename a schema
+func (pd *postgreSQLDialect) GetRenameSchemaSQL(from string, to string, tables []string) []string {
+	return []string{fmt.Sprintf(renameSchemaPostgreSQLDialectSQL, from, to)}
+}
+
+// GetJobInsertSQL returns PostgreSQL-specific SQL statement which records a new job
+func (pd *postgreSQLDialect) GetJobInsertSQL() string {
+	return fmt.Sprintf(insertJobPostgreSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobUpdateSQL returns PostgreSQL-specific SQL statement which updates status, progress, and results of a job
+func (pd *postgreSQLDialect) GetJobUpdateSQL() string {
+	return fmt.Sprintf(updateJobPostgreSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobByIDSQL returns PostgreSQL-specific SQL query which returns a job by its ID
+func (pd *postgreSQLDialect) GetJobByIDSQL() string {
+	return fmt.Sprintf(selectJobByIDPostgreSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobFailStaleSQL returns PostgreSQL-specific SQL statement which marks a running job as failed if its heartbeat is older than a given time
+func (pd *postgreSQLDialect) GetJobFailStaleSQL() string {
+	return fmt.Sprintf(failStaleJobPostgreSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
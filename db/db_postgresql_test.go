@@ -2,6 +2,7 @@ package db
 
 import (
 	"testing"
+	"time"
 
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/stretchr/testify/assert"
@@ -135,3 +136,65 @@ func TestPostgreSQLGetMigrationByIDSQL(t *testing.T) {
 
 	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from migrator.migrator_migrations where id = $1", migrationByID)
 }
+
+func TestPostgreSQLGetAcquireAndReleaseLockSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-postgresql.yaml")
+	assert.Nil(t, err)
+
+	dialect := newDialect(config)
+
+	assert.Equal(t, "select pg_try_advisory_xact_lock(hashtext('migrator'))::int", dialect.GetAcquireLockSQL(time.Minute))
+	// transaction-level advisory lock is released on commit/rollback
+	assert.Equal(t, "", dialect.GetReleaseLockSQL())
+}
+
+func TestPostgreSQLGetChecksumRepairSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-postgresql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "insert into migrator.migrator_checksum_repairs (filename, old_checksum, new_checksum, old_contents, new_contents, reason) values ($1, $2, $3, $4, $5, $6)", dialect.GetChecksumRepairInsertSQL())
+	assert.Equal(t, "update migrator.migrator_migrations set contents = $1, checksum = $2 where filename = $3", dialect.GetMigrationChecksumUpdateSQL())
+}
+
+func TestPostgreSQLGetTenantLabelsSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-postgresql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "select tenant, label_key, label_value from migrator.migrator_tenant_labels order by tenant, label_key", dialect.GetTenantLabelsSelectSQL())
+	assert.Equal(t, "delete from migrator.migrator_tenant_labels where tenant = $1", dialect.GetTenantLabelsDeleteSQL())
+	assert.Equal(t, "insert into migrator.migrator_tenant_labels (tenant, label_key, label_value) values ($1, $2, $3)", dialect.GetTenantLabelInsertSQL())
+}
+
+func TestPostgreSQLGetTenantLifecycleSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-postgresql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "insert into migrator.migrator_archived_tenants (name) values ($1)", dialect.GetArchivedTenantInsertSQL())
+	assert.Equal(t, "update migrator.migrator_tenants set name = $1 where name = $2", dialect.GetTenantRenameSQL())
+	assert.Equal(t, "delete from migrator.migrator_migrations where db_schema = $1", dialect.GetMigrationsDeleteBySchemaSQL())
+	assert.Equal(t, []string{"drop schema if exists abc cascade"}, dialect.GetDropSchemaSQL("abc", []string{"settings"}))
+	assert.Equal(t, []string{"alter schema abc rename to def"}, dialect.GetRenameSchemaSQL("abc", "def", []string{"settings"}))
+}
+
+func TestPostgreSQLGetJobSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-postgresql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	assert.Contains(t, dialect.GetCreateJobsTableSQL(), "create table if not exists migrator.migrator_jobs")
+	assert.Equal(t, "insert into migrator.migrator_jobs (operation, name, status) values ($1, $2, $3) returning id", dialect.GetJobInsertSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set status = $1, applied = $2, total = $3, summary = $4, error = $5, owner = $6, heartbeat = $7, updated = current_timestamp where id = $8", dialect.GetJobUpdateSQL())
+	assert.Equal(t, "select id, operation, name, status, applied, total, summary, error, owner, heartbeat, created, updated from migrator.migrator_jobs where id = $1", dialect.GetJobByIDSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set status = $1, error = $2, updated = current_timestamp where id = $3 and status = $4 and heartbeat < $5", dialect.GetJobFailStaleSQL())
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"sync"
+)
+
+// ProgressFunc is notified when migrations are applied, applied is the number of migrations applied so far out of total
+// a migration applied to N schemas counts N times, ProgressFunc can be called concurrently when tenants are migrated in parallel
+type ProgressFunc func(applied, total int32)
+
+type progressKey struct{}
+
+// WithProgress returns a copy of ctx which carries fn, connectors created with the returned context
+// report progress of CreateVersion and CreateTenant to fn
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, &progress{fn: fn})
+}
+
+// progress counts applied migrations, all methods are no-op on nil progress
+type progress struct {
+	fn      ProgressFunc
+	mutex   sync.Mutex
+	applied int32
+	total   int32
+}
+
+// progressFromContext returns progress set by WithProgress or nil
+func progressFromContext(ctx context.Context) *progress {
+	p, _ := ctx.Value(progressKey{}).(*progress)
+	return p
+}
+
+// start resets progress with total number of migrations to apply computed from schemasToApply
+func (p *progress) start(schemasToApply map[string][]string) {
+	if p == nil {
+		return
+	}
+	var total int32
+	for _, schemas := range schemasToApply {
+		total += int32(len(schemas))
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.applied = 0
+	p.total = total
+	p.fn(p.applied, p.total)
+}
+
+// step records a migration applied to a schema
+func (p *progress) step() {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.applied++
+	p.fn(p.applied, p.total)
+}
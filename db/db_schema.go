@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// GetSchemaFingerprints reads tables, columns, indexes, and constraints of passed schemas from DB catalog
+// and returns their normalized fingerprints, schemas with identical objects have identical fingerprints
+func (bc *baseConnector) GetSchemaFingerprints(schemas []string) ([]types.SchemaFingerprint, error) {
+	if err := bc.init(); err != nil {
+		return nil, err
+	}
+
+	fingerprints := []types.SchemaFingerprint{}
+	for _, schema := range schemas {
+		objects, err := bc.getSchemaObjects(bc.db, schema)
+		if err != nil {
+			return nil, err
+		}
+		fingerprints = append(fingerprints, types.NewSchemaFingerprint(schema, objects))
+	}
+
+	return fingerprints, nil
+}
+
+// getSchemaObjects returns normalized objects of a given schema
+// when called in a transaction objects created by the transaction are returned too
+func (bc *baseConnector) getSchemaObjects(q queryer, schema string) ([]types.SchemaObject, error) {
+	rows, err := q.QueryContext(bc.ctx, bc.dialect.GetSchemaObjectsSQL(), schema)
+	if err != nil {
+		return nil, fmt.Errorf("could not query schema objects: %v", err)
+	}
+	defer rows.Close()
+
+	objects := []types.SchemaObject{}
+	for rows.Next() {
+		var objectType, name string
+		var definition sql.NullString
+		if err := rows.Scan(&objectType, &name, &definition); err != nil {
+			return nil, fmt.Errorf("could not read schema objects: %v", err)
+		}
+		objects = append(objects, types.SchemaObject{Type: objectType, Name: name, Definition: definition.String})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read schema objects: %v", err)
+	}
+
+	if bc.dialect.SchemasMappedToTablePrefixes() {
+		schemas, err := bc.getSchemaNames(q)
+		if err != nil {
+			return nil, err
+		}
+		ownObjects := []types.SchemaObject{}
+		for _, o := range objects {
+			// names of columns, indexes, and constraints start with table name followed by "."
+			table := strings.SplitN(o.Name, ".", 2)[0]
+			if ownsPrefixedTable(schema, table, schemas) {
+				ownObjects = append(ownObjects, o)
+			}
+		}
+		objects = ownObjects
+	}
+
+	bc.dialect.NormalizeSchemaObjects(schema, objects)
+
+	return objects, nil
+}
+
+// insertSchemaSnapshotsInTx captures objects of all single schemas and of one representative tenant and records them in a given version
+// the first tenant which did not fail is the representative tenant
+func (bc *baseConnector) insertSchemaSnapshotsInTx(tx *sql.Tx, versionID int32, tenants []types.Tenant, results *types.Summary) error {
+	failed := map[string]bool{}
+	for _, f := range results.FailedTenants {
+		failed[f.Tenant] = true
+	}
+
+	schemas := map[string]types.MigrationType{}
+	names := []string{}
+	for _, schema := range bc.config.SingleMigrations {
+		schemas[schema] = types.MigrationTypeSingleMigration
+		names = append(names, schema)
+	}
+	for _, t := range tenants {
+		if _, ok := schemas[t.Name]; !ok && !failed[t.Name] {
+			schemas[t.Name] = types.MigrationTypeTenantMigration
+			names = append(names, t.Name)
+			break
+		}
+	}
+
+	for _, schema := range names {
+		objects, err := bc.getSchemaObjects(tx, schema)
+		if err != nil {
+			return err
+		}
+		fingerprint := types.NewSchemaFingerprint(schema, objects)
+		contents, err := json.Marshal(fingerprint.Objects)
+		if err != nil {
+			return fmt.Errorf("could not serialise schema snapshot: %v", err)
+		}
+		if _, err := tx.ExecContext(bc.ctx, bc.dialect.GetSchemaSnapshotInsertSQL(), versionID, schema, schemas[schema], fingerprint.Fingerprint, string(contents)); err != nil {
+			return fmt.Errorf("failed to add schema snapshot: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// attachSchemaSnapshots reads schema snapshots using passed query and attaches them to versions
+func (bc *baseConnector) attachSchemaSnapshots(q queryer, versions []types.Version, query string, args ...interface{}) error {
+	rows, err := q.QueryContext(bc.ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("could not query schema snapshots: %v", err)
+	}
+	defer rows.Close()
+
+	snapshots := map[int32][]types.SchemaSnapshot{}
+	for rows.Next() {
+		var (
+			versionID     int32
+			snapshot      types.SchemaSnapshot
+			migrationType int64
+			contents      string
+		)
+		if err := rows.Scan(&versionID, &snapshot.Schema, &migrationType, &snapshot.Fingerprint, &contents); err != nil {
+			return fmt.Errorf("could not read schema snapshots: %v", err)
+		}
+		snapshot.MigrationType = types.MigrationType(migrationType)
+		if err := json.Unmarshal([]byte(contents), &snapshot.Objects); err != nil {
+			return fmt.Errorf("could not read schema snapshots: %v", err)
+		}
+		snapshots[versionID] = append(snapshots[versionID], snapshot)
+	}
+
+	for i := range versions {
+		if s, ok := snapshots[versions[i].ID]; ok {
+			versions[i].SchemaSnapshot = s
+		}
+	}
+
+	return nil
+}
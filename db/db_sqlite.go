@@ -0,0 +1,437 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/types"
+
+	// blank import for pure Go SQLite driver
+	_ "modernc.org/sqlite"
+)
+
+// sqliteDialect implements dialect interface for SQLite
+// SQLite does not support schemas, migrator tables are created without schema prefix
+// and tenants are mapped to prefixed table names, for example tenant migration:
+// create table {schema}_orders (id integer primary key)
+// creates table abc_orders for tenant abc and table def_orders for tenant def
+type sqliteDialect struct {
+	baseDialect
+}
+
+const (
+	insertMigrationSQLiteDialectSQL             = "insert into %v (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values (?, ?, ?, ?, ?, ?, ?, ?)"
+	insertTenantSQLiteDialectSQL                = "insert into %v (name) values (?)"
+	insertVersionSQLiteDialectSQL               = "insert into %v (name) values (?)"
+	selectTenantsSQLiteDialectSQL               = "select name from %v"
+	selectTenantLabelsSQLiteDialectSQL          = "select tenant, label_key, label_value from %v order by tenant, label_key"
+	selectArchivedTenantsSQLiteDialectSQL       = "select name from %v"
+	selectSchemaSnapshotsSQLiteDialectSQL       = "select version_id, db_schema, type, fingerprint, objects from %v order by version_id, type, db_schema"
+	dropTableSQLiteDialectSQL                   = "drop table if exists \"%v\""
+	renameTableSQLiteDialectSQL                 = "alter table \"%v\" rename to \"%v\""
+	selectMigrationsSQLiteDialectSQL            = "select name, source_dir as sd, filename, type, db_schema, created, contents, checksum from %v order by name, source_dir, id"
+	selectVersionsSQLiteDialectSQL              = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v mv left join %v mm on mv.id = mm.version_id order by vid desc, mid asc"
+	selectVersionsByFileSQLiteDialectSQL        = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v mv left join %v mm on mv.id = mm.version_id where mv.id in (select version_id from %v where filename = ?) order by vid desc, mid asc"
+	selectVersionByIDSQLiteDialectSQL           = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v mv left join %v mm on mv.id = mm.version_id where mv.id = ? order by mid asc"
+	selectMigrationByIDSQLiteDialectSQL         = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from %v where id = ?"
+	deleteVersionSQLiteDialectSQL               = "delete from %v where id = ?"
+	selectLatestVersionIDSQLiteDialectSQL       = "select max(id) from %v"
+	deleteMigrationsByVersionIDSQLiteDialectSQL = "delete from %v where version_id = ?"
+	insertChecksumRepairSQLiteDialectSQL        = "insert into %v (filename, old_checksum, new_checksum, old_contents, new_contents, reason) values (?, ?, ?, ?, ?, ?)"
+	updateMigrationChecksumSQLiteDialectSQL     = "update %v set contents = ?, checksum = ? where filename = ?"
+	deleteTenantLabelsSQLiteDialectSQL          = "delete from %v where tenant = ?"
+	insertTenantLabelSQLiteDialectSQL           = "insert into %v (tenant, label_key, label_value) values (?, ?, ?)"
+	renameTenantLabelsSQLiteDialectSQL          = "update %v set tenant = ? where tenant = ?"
+	insertArchivedTenantSQLiteDialectSQL        = "insert into %v (name) values (?)"
+	deleteArchivedTenantSQLiteDialectSQL        = "delete from %v where name = ?"
+	renameArchivedTenantSQLiteDialectSQL        = "update %v set name = ? where name = ?"
+	deleteTenantSQLiteDialectSQL                = "delete from %v where name = ?"
+	renameTenantSQLiteDialectSQL                = "update %v set name = ? where name = ?"
+	deleteMigrationsBySchemaSQLiteDialectSQL    = "delete from %v where db_schema = ?"
+	renameMigrationsSchemaSQLiteDialectSQL      = "update %v set db_schema = ? where db_schema = ?"
+	selectVersionSnapshotsSQLiteDialectSQL      = "select version_id, db_schema, type, fingerprint, objects from %v where version_id = ? order by type, db_schema"
+	insertSchemaSnapshotSQLiteDialectSQL        = "insert into %v (version_id, db_schema, type, fingerprint, objects) values (?, ?, ?, ?, ?)"
+	deleteVersionSnapshotsSQLiteDialectSQL      = "delete from %v where version_id = ?"
+	insertJobSQLiteDialectSQL                   = "insert into %v (operation, name, status) values (?, ?, ?)"
+	updateJobSQLiteDialectSQL                   = "update %v set status = ?, applied = ?, total = ?, summary = ?, error = ?, owner = ?, heartbeat = ?, updated = current_timestamp where id = ?"
+	selectJobByIDSQLiteDialectSQL               = "select id, operation, name, status, applied, total, summary, error, owner, heartbeat, created, updated from %v where id = ?"
+	failStaleJobSQLiteDialectSQL                = "update %v set status = ?, error = ?, updated = current_timestamp where id = ? and status = ? and heartbeat < ?"
+	selectSchemaTablesSQLiteDialectSQL          = "select name from sqlite_master where type = 'table' and substr(name, 1, length(?1) + 1) = ?1 || '_'"
+	// SQLite database is a local file which cannot be shared by migrator replicas, writes are serialised by SQLite itself
+	acquireLockSQLiteDialectSQL = "select 1"
+	// SQLite does not support schemas, tenants are mapped to prefixed table names and there is nothing to create
+	createSchemaSQLiteDialectSQL       = "select '%v'"
+	createTenantsTableSQLiteDialectSQL = `
+create table if not exists %v (
+  id integer primary key autoincrement,
+  name varchar(200) not null,
+  created timestamp default current_timestamp
+)
+`
+	// SQLite support was added after migrator_versions table was introduced
+	// there are no legacy migrations tables without version_id column and version_id is created together with the table
+	createMigrationsTableSQLiteDialectSQL = `
+create table if not exists %v (
+  id integer primary key autoincrement,
+  name varchar(200) not null,
+  source_dir varchar(200) not null,
+  filename varchar(200) not null,
+  type int not null,
+  db_schema varchar(200) not null,
+  created timestamp default current_timestamp,
+  contents text,
+  checksum varchar(64),
+  version_id integer not null references %v (id) on delete cascade
+)
+`
+	createVersionsTableSQLiteDialectSQL = `
+create table if not exists %v (
+  id integer primary key autoincrement,
+  name varchar(200) not null,
+  created timestamp default current_timestamp
+)
+`
+	createVersionsIndexSQLiteDialectSQL        = "create index if not exists migrator_versions_version_id_idx on %v (version_id)"
+	createChecksumRepairsTableSQLiteDialectSQL = `
+create table if not exists %v (
+  id integer primary key autoincrement,
+  filename varchar(200) not null,
+  old_checksum varchar(64),
+  new_checksum varchar(64),
+  old_contents text,
+  new_contents text,
+  reason text not null,
+  created timestamp default current_timestamp
+)
+`
+	createArchivedTenantsTableSQLiteDialectSQL = `
+create table if not exists %v (
+  id integer primary key autoincrement,
+  name varchar(200) not null,
+  created timestamp default current_timestamp
+)
+`
+	createSchemaSnapshotsTableSQLiteDialectSQL = `
+create table if not exists %v (
+  id integer primary key autoincrement,
+  version_id int not null,
+  db_schema varchar(200) not null,
+  type int not null,
+  fingerprint varchar(64) not null,
+  objects text not null,
+  created timestamp default current_timestamp
+)
+`
+	createJobsTableSQLiteDialectSQL = `
+create table if not exists %v (
+  id integer primary key autoincrement,
+  operation varchar(200) not null,
+  name varchar(200) not null,
+  status varchar(20) not null,
+  applied int not null default 0,
+  total int not null default 0,
+  summary text,
+  error text,
+  owner varchar(200),
+  heartbeat timestamp,
+  created timestamp default current_timestamp,
+  updated timestamp default current_timestamp
+)
+`
+	createTenantLabelsTableSQLiteDialectSQL = `
+create table if not exists %v (
+  id integer primary key autoincrement,
+  tenant varchar(200) not null,
+  label_key varchar(200) not null,
+  label_value varchar(200) not null,
+  created timestamp default current_timestamp
+)
+`
+
+	selectSchemaObjectsSQLiteDialectSQL = `
+select 'table', m.name, m.type from sqlite_master m where m.type = 'table' and substr(m.name, 1, length(?1) + 1) = ?1 || '_'
+union all
+select 'column', m.name || '.' || c.name, lower(c.type) || case when c."notnull" = 1 then ' not null' else '' end || coalesce(' default ' || c.dflt_value, '') || case when c.pk > 0 then ' primary key' else '' end from sqlite_master m join pragma_table_info(m.name) c where m.type = 'table' and substr(m.name, 1, length(?1) + 1) = ?1 || '_'
+union all
+select 'index', m.tbl_name || '.' || m.name, coalesce(m.sql, 'auto') from sqlite_master m where m.type = 'index' and substr(m.tbl_name, 1, length(?1) + 1) = ?1 || '_'
+union all
+select 'constraint', m.name || '.fk' || f.id || '_' || f.seq, 'foreign key (' || f."from" || ') references ' || f."table" || '(' || coalesce(f."to", '') || ')' from sqlite_master m join pragma_foreign_key_list(m.name) f where m.type = 'table' and substr(m.name, 1, length(?1) + 1) = ?1 || '_'
+`
+)
+
+// LastInsertIDSupported instructs migrator if Result.LastInsertId() is supported by the DB driver
+func (sd *sqliteDialect) LastInsertIDSupported() bool {
+	return true
+}
+
+// SchemasMappedToTablePrefixes instructs migrator that tables of a tenant are prefixed with tenant name
+// tables returned by schema queries are matched by prefix and can belong to a tenant with a longer name, see ownsPrefixedTable
+func (sd *sqliteDialect) SchemasMappedToTablePrefixes() bool {
+	return true
+}
+
+// GetMigrationInsertSQL returns SQLite-specific migration insert SQL statement
+func (sd *sqliteDialect) GetMigrationInsertSQL() string {
+	return fmt.Sprintf(insertMigrationSQLiteDialectSQL, migratorMigrationsTable)
+}
+
+// GetTenantInsertSQL returns SQLite-specific migrator's default tenant insert SQL statement
+func (sd *sqliteDialect) GetTenantInsertSQL() string {
+	return fmt.Sprintf(insertTenantSQLiteDialectSQL, migratorTenantsTable)
+}
+
+// GetTenantSelectSQL returns SQLite-specific migrator's default tenant select SQL statement
+func (sd *sqliteDialect) GetTenantSelectSQL() string {
+	return fmt.Sprintf(selectTenantsSQLiteDialectSQL, migratorTenantsTable)
+}
+
+// GetMigrationSelectSQL returns SQLite-specific migrations select SQL statement
+func (sd *sqliteDialect) GetMigrationSelectSQL() string {
+	return fmt.Sprintf(selectMigrationsSQLiteDialectSQL, migratorMigrationsTable)
+}
+
+// GetCreateTenantsTableSQL returns SQLite-specific migrator's default create tenants table SQL statement
+func (sd *sqliteDialect) GetCreateTenantsTableSQL() string {
+	return fmt.Sprintf(createTenantsTableSQLiteDialectSQL, migratorTenantsTable)
+}
+
+// GetCreateMigrationsTableSQL returns SQLite-specific migrator's create migrations table SQL statement
+func (sd *sqliteDialect) GetCreateMigrationsTableSQL() string {
+	return fmt.Sprintf(createMigrationsTableSQLiteDialectSQL, migratorMigrationsTable, migratorVersionsTable)
+}
+
+// GetCreateSchemaSQL returns SQLite-specific no-op statement, the schema name is still validated
+// as it is used as a table name prefix by tenant migrations
+func (sd *sqliteDialect) GetCreateSchemaSQL(schema string) string {
+	if !isValidIdentifier(schema) {
+		panic(fmt.Sprintf("Schema name contains invalid characters: %v", schema))
+	}
+	return fmt.Sprintf(createSchemaSQLiteDialectSQL, schema)
+}
+
+func (sd *sqliteDialect) GetVersionInsertSQL() string {
+	return fmt.Sprintf(insertVersionSQLiteDialectSQL, migratorVersionsTable)
+}
+
+// GetCreateVersionsTableSQL returns SQLite-specific SQLs which do:
+// 1. create versions table
+// 2. create index on version_id column in migrations table
+// SQLite does not support the execution of anonymous blocks of code, both statements are idempotent
+func (sd *sqliteDialect) GetCreateVersionsTableSQL() []string {
+	return []string{
+		fmt.Sprintf(createVersionsTableSQLiteDialectSQL, migratorVersionsTable),
+		fmt.Sprintf(createVersionsIndexSQLiteDialectSQL, migratorMigrationsTable),
+	}
+}
+
+// GetVersionsSelectSQL returns SQLite-specific select SQL statement that returns all versions
+func (sd *sqliteDialect) GetVersionsSelectSQL() string {
+	return fmt.Sprintf(selectVersionsSQLiteDialectSQL, migratorVersionsTable, migratorMigrationsTable)
+}
+
+func (sd *sqliteDialect) GetVersionsByFileSQL() string {
+	return fmt.Sprintf(selectVersionsByFileSQLiteDialectSQL, migratorVersionsTable, migratorMigrationsTable, migratorMigrationsTable)
+}
+
+func (sd *sqliteDialect) GetVersionByIDSQL() string {
+	return fmt.Sprintf(selectVersionByIDSQLiteDialectSQL, migratorVersionsTable, migratorMigrationsTable)
+}
+
+func (sd *sqliteDialect) GetMigrationByIDSQL() string {
+	return fmt.Sprintf(selectMigrationByIDSQLiteDialectSQL, migratorMigrationsTable)
+}
+
+// GetVersionDeleteSQL returns SQLite-specific SQL statement which deletes version by ID
+func (sd *sqliteDialect) GetVersionDeleteSQL() string {
+	return fmt.Sprintf(deleteVersionSQLiteDialectSQL, migratorVersionsTable)
+}
+
+// GetLatestVersionIDSQL returns SQLite-specific select SQL statement that returns ID of the latest version
+func (sd *sqliteDialect) GetLatestVersionIDSQL() string {
+	return fmt.Sprintf(selectLatestVersionIDSQLiteDialectSQL, migratorVersionsTable)
+}
+
+// GetMigrationsDeleteByVersionIDSQL returns SQLite-specific SQL statement which deletes all migrations recorded in a given version
+func (sd *sqliteDialect) GetMigrationsDeleteByVersionIDSQL() string {
+	return fmt.Sprintf(deleteMigrationsByVersionIDSQLiteDialectSQL, migratorMigrationsTable)
+}
+
+// GetAcquireLockSQL returns SQLite-specific statement which always acquires the lock
+func (sd *sqliteDialect) GetAcquireLockSQL(timeout time.Duration) string {
+	return acquireLockSQLiteDialectSQL
+}
+
+// GetCreateChecksumRepairsTableSQL returns SQLite-specific create checksum repairs (audit) table SQL statement
+func (sd *sqliteDialect) GetCreateChecksumRepairsTableSQL() string {
+	return fmt.Sprintf(createChecksumRepairsTableSQLiteDialectSQL, migratorChecksumRepairsTable)
+}
+
+// GetChecksumRepairInsertSQL returns SQLite-specific SQL statement which records checksum repair
+func (sd *sqliteDialect) GetChecksumRepairInsertSQL() string {
+	return fmt.Sprintf(insertChecksumRepairSQLiteDialectSQL, migratorChecksumRepairsTable)
+}
+
+// GetMigrationChecksumUpdateSQL returns SQLite-specific SQL statement which updates contents and checksum of a migration in all schemas
+func (sd *sqliteDialect) GetMigrationChecksumUpdateSQL() string {
+	return fmt.Sprintf(updateMigrationChecksumSQLiteDialectSQL, migratorMigrationsTable)
+}
+
+// GetTenantLabelsDeleteSQL returns SQLite-specific SQL statement which deletes all labels of a tenant
+func (sd *sqliteDialect) GetTenantLabelsDeleteSQL() string {
+	return fmt.Sprintf(deleteTenantLabelsSQLiteDialectSQL, migratorTenantLabelsTable)
+}
+
+// GetTenantLabelInsertSQL returns SQLite-specific SQL statement which inserts a tenant label
+func (sd *sqliteDialect) GetTenantLabelInsertSQL() string {
+	return fmt.Sprintf(insertTenantLabelSQLiteDialectSQL, migratorTenantLabelsTable)
+}
+
+// GetCreateTenantLabelsTableSQL returns SQLite-specific create tenant labels table SQL statement
+func (sd *sqliteDialect) GetCreateTenantLabelsTableSQL() string {
+	return fmt.Sprintf(createTenantLabelsTableSQLiteDialectSQL, migratorTenantLabelsTable)
+}
+
+// GetTenantLabelsSelectSQL returns SQLite-specific tenant labels select SQL statement
+func (sd *sqliteDialect) GetTenantLabelsSelectSQL() string {
+	return fmt.Sprintf(selectTenantLabelsSQLiteDialectSQL, migratorTenantLabelsTable)
+}
+
+// GetTenantLabelsRenameSQL returns SQLite-specific SQL statement which renames tenant in tenant labels
+func (sd *sqliteDialect) GetTenantLabelsRenameSQL() string {
+	return fmt.Sprintf(renameTenantLabelsSQLiteDialectSQL, migratorTenantLabelsTable)
+}
+
+// GetArchivedTenantInsertSQL returns SQLite-specific SQL statement which archives a tenant
+func (sd *sqliteDialect) GetArchivedTenantInsertSQL() string {
+	return fmt.Sprintf(insertArchivedTenantSQLiteDialectSQL, migratorArchivedTenantsTable)
+}
+
+// GetArchivedTenantDeleteSQL returns SQLite-specific SQL statement which removes a tenant from archived tenants
+func (sd *sqliteDialect) GetArchivedTenantDeleteSQL() string {
+	return fmt.Sprintf(deleteArchivedTenantSQLiteDialectSQL, migratorArchivedTenantsTable)
+}
+
+// GetArchivedTenantRenameSQL returns SQLite-specific SQL statement which renames an archived tenant
+func (sd *sqliteDialect) GetArchivedTenantRenameSQL() string {
+	return fmt.Sprintf(renameArchivedTenantSQLiteDialectSQL, migratorArchivedTenantsTable)
+}
+
+// GetTenantDeleteSQL returns SQLite-specific SQL statement which deletes a tenant from migrator's default tenants table
+func (sd *sqliteDialect) GetTenantDeleteSQL() string {
+	return fmt.Sprintf(deleteTenantSQLiteDialectSQL, migratorTenantsTable)
+}
+
+// GetTenantRenameSQL returns SQLite-specific SQL statement which renames a tenant in migrator's default tenants table
+func (sd *sqliteDialect) GetTenantRenameSQL() string {
+	return fmt.Sprintf(renameTenantSQLiteDialectSQL, migratorTenantsTable)
+}
+
+// GetMigrationsDeleteBySchemaSQL returns SQLite-specific SQL statement which deletes all migrations applied to a given schema
+func (sd *sqliteDialect) GetMigrationsDeleteBySchemaSQL() string {
+	return fmt.Sprintf(deleteMigrationsBySchemaSQLiteDialectSQL, migratorMigrationsTable)
+}
+
+// GetMigrationsSchemaRenameSQL returns SQLite-specific SQL statement which renames schema of all migrations applied to it
+func (sd *sqliteDialect) GetMigrationsSchemaRenameSQL() string {
+	return fmt.Sprintf(renameMigrationsSchemaSQLiteDialectSQL, migratorMigrationsTable)
+}
+
+// GetSchemaTablesSQL returns SQLite-specific SQL query which returns names of all tables of a given schema
+func (sd *sqliteDialect) GetSchemaTablesSQL() string {
+	return selectSchemaTablesSQLiteDialectSQL
+}
+
+// GetSchemaObjectsSQL returns SQLite-specific SQL query which returns tables, columns, indexes, and foreign keys of a given schema
+func (sd *sqliteDialect) GetSchemaObjectsSQL() string {
+	return selectSchemaObjectsSQLiteDialectSQL
+}
+
+// GetVersionSchemaSnapshotsSelectSQL returns SQLite-specific SQL query which returns schema snapshots of a given version
+func (sd *sqliteDialect) GetVersionSchemaSnapshotsSelectSQL() string {
+	return fmt.Sprintf(selectVersionSnapshotsSQLiteDialectSQL, migratorSchemaSnapshotsTable)
+}
+
+// GetSchemaSnapshotInsertSQL returns SQLite-specific SQL statement which records schema snapshot
+func (sd *sqliteDialect) GetSchemaSnapshotInsertSQL() string {
+	return fmt.Sprintf(insertSchemaSnapshotSQLiteDialectSQL, migratorSchemaSnapshotsTable)
+}
+
+// GetVersionSchemaSnapshotsDeleteSQL returns SQLite-specific SQL statement which deletes schema snapshots of a given version
+func (sd *sqliteDialect) GetVersionSchemaSnapshotsDeleteSQL() string {
+	return fmt.Sprintf(deleteVersionSnapshotsSQLiteDialectSQL, migratorSchemaSnapshotsTable)
+}
+
+// NormalizeSchemaObjects removes schema prefix from table and index names
+// sqlite_autoindex_abc_orders_1 becomes sqlite_autoindex_orders_1 and "abc_orders" becomes "orders"
+func (sd *sqliteDialect) NormalizeSchemaObjects(schema string, objects []types.SchemaObject) {
+	prefix := regexp.MustCompile(`(^|[^A-Za-z0-9])` + regexp.QuoteMeta(schema) + `_`)
+	for i := range objects {
+		objects[i].Name = prefix.ReplaceAllString(objects[i].Name, "$1")
+		objects[i].Definition = prefix.ReplaceAllString(objects[i].Definition, "$1")
+	}
+}
+
+// GetCreateArchivedTenantsTableSQL returns SQLite-specific create archived tenants table SQL statement
+func (sd *sqliteDialect) GetCreateArchivedTenantsTableSQL() string {
+	return fmt.Sprintf(createArchivedTenantsTableSQLiteDialectSQL, migratorArchivedTenantsTable)
+}
+
+// GetArchivedTenantsSelectSQL returns SQLite-specific archived tenants select SQL statement
+func (sd *sqliteDialect) GetArchivedTenantsSelectSQL() string {
+	return fmt.Sprintf(selectArchivedTenantsSQLiteDialectSQL, migratorArchivedTenantsTable)
+}
+
+// GetCreateSchemaSnapshotsTableSQL returns SQLite-specific create schema snapshots table SQL statement
+func (sd *sqliteDialect) GetCreateSchemaSnapshotsTableSQL() string {
+	return fmt.Sprintf(createSchemaSnapshotsTableSQLiteDialectSQL, migratorSchemaSnapshotsTable)
+}
+
+// GetSchemaSnapshotsSelectSQL returns SQLite-specific schema snapshots select SQL statement
+func (sd *sqliteDialect) GetSchemaSnapshotsSelectSQL() string {
+	return fmt.Sprintf(selectSchemaSnapshotsSQLiteDialectSQL, migratorSchemaSnapshotsTable)
+}
+
+// GetDropSchemaSQL returns SQLite-specific SQL statements which drop all tables of a tenant (tables prefixed with tenant name)
+func (sd *sqliteDialect) GetDropSchemaSQL(schema string, tables []string) []string {
+	sqls := []string{}
+	for _, table := range tables {
+		sqls = append(sqls, fmt.Sprintf(dropTableSQLiteDialectSQL, table))
+	}
+	return sqls
+}
+
+// GetRenameSchemaSQL returns SQLite-specific SQL statements which rename all tables of a tenant (tables prefixed with tenant name)
+func (sd *sqliteDialect) GetRenameSchemaSQL(from string, to string, tables []string) []string {
+	sqls := []string{}
+	for _, table := range tables {
+		sqls = append(sqls, fmt.Sprintf(renameTableSQLiteDialectSQL, table, to+strings.TrimPrefix(table, from)))
+	}
+	return sqls
+}
+
+// GetCreateJobsTableSQL returns SQLite-specific create jobs table SQL statement
+func (sd *sqliteDialect) GetCreateJobsTableSQL() string {
+	return fmt.Sprintf(createJobsTableSQLiteDialectSQL, migratorJobsTable)
+}
+
+// GetJobInsertSQL returns SQLite-specific SQL statement which records a new job
+func (sd *sqliteDialect) GetJobInsertSQL() string {
+	return fmt.Sprintf(insertJobSQLiteDialectSQL, migratorJobsTable)
+}
+
+// GetJobUpdateSQL returns SQLite-specific SQL statement which updates status, progress, and results of a job
+func (sd *sqliteDialect) GetJobUpdateSQL() string {
+	return fmt.Sprintf(updateJobSQLiteDialectSQL, migratorJobsTable)
+}
+
+// GetJobByIDSQL returns SQLite-specific SQL query which returns a job by its ID
+func (sd *sqliteDialect) GetJobByIDSQL() string {
+	return fmt.Sprintf(selectJobByIDSQLiteDialectSQL, migratorJobsTable)
+}
+
+// GetJobFailStaleSQL returns SQLite-specific SQL statement which marks a running job as failed if its heartbeat is older than a given time
+func (sd *sqliteDialect) GetJobFailStaleSQL() string {
+	return fmt.Sprintf(failStaleJobSQLiteDialectSQL, migratorJobsTable)
+}
@@ -0,0 +1,894 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSQLiteTestConfig(t *testing.T) *config.Config {
+	return &config.Config{
+		Driver:     "sqlite",
+		DataSource: filepath.Join(t.TempDir(), "migrator.db"),
+	}
+}
+
+func TestDBCreateDialectSQLiteDriver(t *testing.T) {
+	config := &config.Config{Driver: "sqlite"}
+	dialect := newDialect(config)
+	assert.IsType(t, &sqliteDialect{}, dialect)
+	assert.Equal(t, "sqlite", config.Driver)
+}
+
+func TestSQLiteGetCreateSchemaSQL(t *testing.T) {
+	dialect := &sqliteDialect{}
+	assert.Equal(t, "select 'abc'", dialect.GetCreateSchemaSQL("abc"))
+	assert.PanicsWithValue(t, "Schema name contains invalid characters: abc;drop", func() {
+		dialect.GetCreateSchemaSQL("abc;drop")
+	})
+}
+
+func TestSQLiteGetVersionsByFileSQL(t *testing.T) {
+	dialect := &sqliteDialect{}
+	expected := "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator_versions mv left join migrator_migrations mm on mv.id = mm.version_id where mv.id in (select version_id from migrator_migrations where filename = ?) order by vid desc, mid asc"
+	assert.Equal(t, expected, dialect.GetVersionsByFileSQL())
+}
+
+func TestSQLiteCreateTenantAndVersion(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	assert.Nil(t, connector.HealthCheck())
+	tenants, err := connector.GetTenants()
+	assert.Nil(t, err)
+	assert.Empty(t, tenants)
+
+	tenantMigration := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_settings (k int, v text)", Down: "drop table {schema}_settings"}
+	results, version, err := connector.CreateTenant("abc", "create-abc", types.ActionApply, []types.Migration{tenantMigration}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), results.TenantMigrationsTotal)
+	assert.Equal(t, "create-abc", version.Name)
+	assert.Len(t, version.DBMigrations, 1)
+
+	results, version, err = connector.CreateTenant("def", "create-def", types.ActionApply, []types.Migration{tenantMigration}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), results.TenantMigrationsTotal)
+
+	tenants, err = connector.GetTenants()
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Tenant{{Name: "abc"}, {Name: "def"}}, tenants)
+
+	singleMigration := types.Migration{Name: "201602160002.sql", SourceDir: "config", File: "config/201602160002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}_params (k int)"}
+	tenantMigration2 := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}_settings values (1, '{schema}')"}
+	results, version, err = connector.CreateVersion("commit-sha", types.ActionApply, []types.Migration{singleMigration, tenantMigration2}, nil, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), results.Tenants)
+	assert.Equal(t, int32(1), results.SingleMigrations)
+	assert.Equal(t, int32(2), results.TenantMigrationsTotal)
+	assert.Equal(t, "commit-sha", version.Name)
+	assert.Len(t, version.DBMigrations, 3)
+
+	versions, err := connector.GetVersions()
+	assert.Nil(t, err)
+	assert.Len(t, versions, 3)
+	assert.Equal(t, "commit-sha", versions[0].Name)
+	assert.False(t, versions[0].Created.IsZero())
+
+	versionsByFile, err := connector.GetVersionsByFile(tenantMigration.File)
+	assert.Nil(t, err)
+	assert.Len(t, versionsByFile, 2)
+
+	dbMigration, err := connector.GetDBMigrationByID(version.DBMigrations[0].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, singleMigration.File, dbMigration.File)
+
+	applied, err := connector.GetAppliedMigrations()
+	assert.Nil(t, err)
+	assert.Len(t, applied, 5)
+
+	// only the latest version can be rolled back
+	migrationsToRollback := []types.DBMigration{{Migration: tenantMigration, Schema: "abc"}}
+	_, err = connector.RollbackVersion(&versions[2], migrationsToRollback, false)
+	assert.Equal(t, fmt.Sprintf("invalid ID: version %v is not the latest version, roll back version %v first", versions[2].ID, versions[0].ID), err.Error())
+
+	singleMigration.Down = "drop table {schema}_params"
+	tenantMigration2.Down = "delete from {schema}_settings"
+	migrationsToRollback = []types.DBMigration{{Migration: tenantMigration2, Schema: "def"}, {Migration: tenantMigration2, Schema: "abc"}, {Migration: singleMigration, Schema: "config"}}
+	results, err = connector.RollbackVersion(&versions[0], migrationsToRollback, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), results.TenantMigrationsTotal)
+	_, err = connector.GetVersionByID(versions[0].ID)
+	assert.Equal(t, fmt.Sprintf("version not found: %v", versions[0].ID), err.Error())
+}
+
+func TestSQLiteNoTransaction(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	createMigration := types.Migration{Name: "201602160001.sql", SourceDir: "config", File: "config/201602160001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}_settings (k int)"}
+	// VACUUM cannot be executed inside a transaction
+	vacuumMigration := types.Migration{Name: "201602160002.sql", SourceDir: "config", File: "config/201602160002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "-- migrator: transaction=false\nvacuum", NoTransaction: true}
+	insertMigration := types.Migration{Name: "201602160003.sql", SourceDir: "config", File: "config/201602160003.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "insert into {schema}_settings values (1)"}
+
+	results, version, err := connector.CreateVersion("commit-sha", types.ActionApply, []types.Migration{createMigration, vacuumMigration, insertMigration}, nil, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{vacuumMigration.File}, results.NonTransactional)
+	assert.Equal(t, int32(3), results.SingleMigrations)
+	assert.Len(t, version.DBMigrations, 3)
+
+	var count int
+	err = connector.(*baseConnector).db.QueryRow("select count(*) from config_settings").Scan(&count)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestSQLitePerTenantTransactions(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	config.PerTenantTransactions = true
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	tenantMigration := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_settings (k int, v text)"}
+	for _, tenant := range []string{"abc", "def", "ghi"} {
+		_, _, err := connector.CreateTenant(tenant, "create-"+tenant, types.ActionApply, []types.Migration{tenantMigration}, false)
+		assert.Nil(t, err)
+	}
+
+	// break tenant def
+	_, err := connector.(*baseConnector).db.Exec("drop table def_settings")
+	assert.Nil(t, err)
+
+	singleMigration := types.Migration{Name: "201602160002.sql", SourceDir: "config", File: "config/201602160002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}_params (k int)"}
+	tenantMigration2 := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}_settings values (1, '{schema}')"}
+	results, version, err := connector.CreateVersion("commit-sha", types.ActionApply, []types.Migration{singleMigration, tenantMigration2}, nil, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), results.Tenants)
+	assert.Equal(t, int32(1), results.SingleMigrations)
+	assert.Equal(t, int32(1), results.TenantMigrations)
+	assert.Equal(t, int32(2), results.TenantMigrationsTotal)
+	assert.Equal(t, []string{"abc", "ghi"}, results.SucceededTenants)
+	assert.Len(t, results.FailedTenants, 1)
+	assert.Equal(t, "def", results.FailedTenants[0].Tenant)
+	assert.Contains(t, results.FailedTenants[0].Error, "SQL migration tenants/201602160002.sql failed for schema def with error")
+	assert.Len(t, version.DBMigrations, 3)
+
+	// fix tenant def and retry, the tenant migration is applied only to def
+	_, err = connector.(*baseConnector).db.Exec("create table def_settings (k int, v text)")
+	assert.Nil(t, err)
+
+	results, version, err = connector.CreateVersion("commit-sha-retry", types.ActionApply, []types.Migration{tenantMigration2}, nil, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"def"}, results.SucceededTenants)
+	assert.Empty(t, results.FailedTenants)
+	assert.Equal(t, int32(1), results.TenantMigrationsTotal)
+	assert.Len(t, version.DBMigrations, 1)
+	assert.Equal(t, "def", version.DBMigrations[0].Schema)
+
+	// everything applied, another instance must have done it
+	_, _, err = connector.CreateVersion("commit-sha-again", types.ActionApply, []types.Migration{tenantMigration2}, nil, false, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "another migration is in progress or has just finished, migration tenants/201602160002.sql has already been applied", err.Error())
+}
+
+func TestSQLiteTenantConcurrency(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	// concurrent writers wait for each other
+	config.DataSource += "?_pragma=busy_timeout(10000)"
+	config.TenantConcurrency = 4
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	tenantMigration := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_settings (k int, v text)"}
+	tenants := []string{}
+	for i := 0; i < 10; i++ {
+		tenant := fmt.Sprintf("tenant%v", i)
+		tenants = append(tenants, tenant)
+		_, _, err := connector.CreateTenant(tenant, "create-"+tenant, types.ActionApply, []types.Migration{tenantMigration}, false)
+		assert.Nil(t, err)
+	}
+
+	// break tenant5
+	_, err := connector.(*baseConnector).db.Exec("drop table tenant5_settings")
+	assert.Nil(t, err)
+
+	singleMigration := types.Migration{Name: "201602160002.sql", SourceDir: "config", File: "config/201602160002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}_params (k int)"}
+	tenantMigration2 := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}_settings values (1, '{schema}')"}
+	tenantScript := types.Migration{Name: "recalculate.sql", SourceDir: "tenants-scripts", File: "tenants-scripts/recalculate.sql", MigrationType: types.MigrationTypeTenantScript, Contents: "update {schema}_settings set k = k + 1"}
+	results, version, err := connector.CreateVersion("commit-sha", types.ActionApply, []types.Migration{singleMigration, tenantMigration2, tenantScript}, nil, false, nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, int32(1), results.SingleMigrations)
+	assert.Equal(t, int32(9), results.TenantMigrationsTotal)
+	assert.Equal(t, int32(9), results.TenantScriptsTotal)
+	// results are reported in tenants order
+	assert.Equal(t, append(append([]string{}, tenants[:5]...), tenants[6:]...), results.SucceededTenants)
+	assert.Len(t, results.FailedTenants, 1)
+	assert.Equal(t, "tenant5", results.FailedTenants[0].Tenant)
+	assert.Len(t, results.TenantDurations, 10)
+	for i, d := range results.TenantDurations {
+		assert.Equal(t, tenants[i], d.Tenant)
+		assert.True(t, d.Duration > 0)
+	}
+	assert.Len(t, version.DBMigrations, 19)
+}
+
+func TestSQLiteRepairChecksums(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	tenantMigration := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_settings (k int)", CheckSum: "sha256-1"}
+	for _, tenant := range []string{"abc", "def"} {
+		_, _, err := connector.CreateTenant(tenant, "create-"+tenant, types.ActionApply, []types.Migration{tenantMigration}, false)
+		assert.Nil(t, err)
+	}
+
+	tenantMigration.Contents = "-- settings\ncreate table {schema}_settings (k int)"
+	tenantMigration.CheckSum = "sha256-2"
+	repairs, err := connector.RepairChecksums([]types.Migration{tenantMigration}, "comment added")
+	assert.Nil(t, err)
+	assert.Equal(t, []types.ChecksumRepair{{File: tenantMigration.File, OldCheckSum: "sha256-1", NewCheckSum: "sha256-2", OldContents: "create table {schema}_settings (k int)", NewContents: tenantMigration.Contents, Reason: "comment added", Schemas: 2}}, repairs)
+
+	applied, err := connector.GetAppliedMigrations()
+	assert.Nil(t, err)
+	assert.Len(t, applied, 2)
+	for _, a := range applied {
+		assert.Equal(t, "sha256-2", a.CheckSum)
+		assert.Equal(t, tenantMigration.Contents, a.Contents)
+	}
+
+	var reason string
+	err = connector.(*baseConnector).db.QueryRow("select reason from migrator_checksum_repairs where filename = ?", tenantMigration.File).Scan(&reason)
+	assert.Nil(t, err)
+	assert.Equal(t, "comment added", reason)
+
+	// already repaired
+	repairs, err = connector.RepairChecksums([]types.Migration{tenantMigration}, "comment added")
+	assert.Nil(t, err)
+	assert.Empty(t, repairs)
+
+	_, err = connector.RepairChecksums([]types.Migration{{File: "tenants/201602160002.sql"}}, "not applied")
+	assert.Equal(t, "DB migration not found: tenants/201602160002.sql", err.Error())
+}
+
+func TestSQLiteTemplates(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	config.Templates = true
+	config.Variables = map[string]string{"default": "42"}
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	tenantMigration := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_settings (k int default {{.Vars.default}}, v text default '{{.Tenant}}')"}
+	_, _, err := connector.CreateTenant("abc", "create-abc", types.ActionApply, []types.Migration{tenantMigration}, false)
+	assert.Nil(t, err)
+
+	// raw contents are recorded
+	applied, err := connector.GetAppliedMigrations()
+	assert.Nil(t, err)
+	assert.Equal(t, tenantMigration.Contents, applied[0].Contents)
+
+	_, err = connector.(*baseConnector).db.Exec("insert into abc_settings default values")
+	assert.Nil(t, err)
+	var k int
+	var v string
+	err = connector.(*baseConnector).db.QueryRow("select k, v from abc_settings").Scan(&k, &v)
+	assert.Nil(t, err)
+	assert.Equal(t, 42, k)
+	assert.Equal(t, "abc", v)
+
+	// template error in the second migration is reported before the first one is executed
+	tenantMigration2 := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_params (k int)"}
+	tenantMigration3 := types.Migration{Name: "201602160003.sql", SourceDir: "tenants", File: "tenants/201602160003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_{{.Vars.missing}} (k int)"}
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, []types.Migration{tenantMigration2, tenantMigration3}, nil, false, nil)
+	assert.Contains(t, err.Error(), "template tenants/201602160003.sql failed for schema abc")
+	versions, err := connector.GetVersions()
+	assert.Nil(t, err)
+	assert.Len(t, versions, 1)
+	_, err = connector.(*baseConnector).db.Exec("select * from abc_params")
+	assert.NotNil(t, err)
+}
+
+func TestSQLiteTemplatesDisabled(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	// migrations with literal "{{" are applied unchanged when templates are not enabled
+	tenantMigration := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_matrix (v text default '{{1,2},{3,4}}')"}
+	_, _, err := connector.CreateTenant("abc", "create-abc", types.ActionApply, []types.Migration{tenantMigration}, false)
+	assert.Nil(t, err)
+
+	_, err = connector.(*baseConnector).db.Exec("insert into abc_matrix default values")
+	assert.Nil(t, err)
+	var v string
+	err = connector.(*baseConnector).db.QueryRow("select v from abc_matrix").Scan(&v)
+	assert.Nil(t, err)
+	assert.Equal(t, "{{1,2},{3,4}}", v)
+}
+
+func TestSQLiteTenantLabels(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	baseMigration := types.Migration{Name: "201602160000.sql", SourceDir: "tenants", File: "tenants/201602160000.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_base (k int)"}
+	for _, tenant := range []string{"abc", "def", "ghi"} {
+		_, _, err := connector.CreateTenant(tenant, "create-"+tenant, types.ActionApply, []types.Migration{baseMigration}, false)
+		assert.Nil(t, err)
+	}
+
+	err := connector.SetTenantLabels("abc", []types.TenantLabel{{Key: "region", Value: "eu"}, {Key: "canary", Value: "true"}})
+	assert.Nil(t, err)
+	err = connector.SetTenantLabels("def", []types.TenantLabel{{Key: "region", Value: "us"}})
+	assert.Nil(t, err)
+	// labels are replaced
+	err = connector.SetTenantLabels("def", []types.TenantLabel{{Key: "region", Value: "eu"}})
+	assert.Nil(t, err)
+
+	labels, err := connector.GetTenantLabels()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]types.TenantLabel{
+		"abc": {{Key: "canary", Value: "true"}, {Key: "region", Value: "eu"}},
+		"def": {{Key: "region", Value: "eu"}},
+	}, labels)
+
+	tenantMigration := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_settings (k int)"}
+
+	selector, err := types.ParseLabelSelector("canary=true")
+	assert.Nil(t, err)
+	results, _, err := connector.CreateVersion("canary", types.ActionApply, []types.Migration{tenantMigration}, selector, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), results.Tenants)
+	assert.Equal(t, int32(1), results.TenantMigrations)
+
+	selector, err = types.ParseLabelSelector("region=eu")
+	assert.Nil(t, err)
+	results, _, err = connector.CreateVersion("eu", types.ActionApply, []types.Migration{tenantMigration}, selector, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), results.Tenants)
+	// abc already has the migration applied
+	assert.Equal(t, int32(1), results.TenantMigrations)
+
+	applied, err := connector.GetAppliedMigrations()
+	assert.Nil(t, err)
+	schemas := []string{}
+	for _, a := range applied {
+		if a.File == tenantMigration.File {
+			schemas = append(schemas, a.Schema)
+		}
+	}
+	assert.ElementsMatch(t, []string{"abc", "def"}, schemas)
+}
+
+func TestSQLiteTenantLifecycle(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	tenantMigration := types.Migration{Name: "201602160000.sql", SourceDir: "tenants", File: "tenants/201602160000.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_settings (k int)"}
+	for _, tenant := range []string{"abc", "def"} {
+		_, _, err := connector.CreateTenant(tenant, "create-"+tenant, types.ActionApply, []types.Migration{tenantMigration}, false)
+		assert.Nil(t, err)
+	}
+	err := connector.SetTenantLabels("def", []types.TenantLabel{{Key: "region", Value: "eu"}})
+	assert.Nil(t, err)
+
+	// archived tenant is skipped by CreateVersion but its history is kept
+	results, version, err := connector.ArchiveTenant("abc", "archive-abc")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), results.Tenants)
+	assert.Equal(t, "archive-abc", version.Name)
+	assert.Empty(t, version.DBMigrations)
+
+	tenants, err := connector.GetTenants()
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Tenant{{Name: "abc", Archived: true}, {Name: "def"}}, tenants)
+
+	tenantMigration2 := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_orders (id int)"}
+	results, _, err = connector.CreateVersion("orders", types.ActionApply, []types.Migration{tenantMigration2}, nil, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), results.Tenants)
+	assert.Equal(t, int32(1), results.TenantMigrationsTotal)
+
+	// rename moves tables, DB migrations, and labels
+	_, version, err = connector.RenameTenant("def", "ghi", "rename-def")
+	assert.Nil(t, err)
+	assert.Equal(t, "rename-def", version.Name)
+	_, err = connector.(*baseConnector).db.Exec("insert into ghi_orders (id) values (1)")
+	assert.Nil(t, err)
+	labels, err := connector.GetTenantLabels()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]types.TenantLabel{"ghi": {{Key: "region", Value: "eu"}}}, labels)
+
+	// dry-run does not drop anything
+	_, _, err = connector.DropTenant("ghi", "drop-ghi", true)
+	assert.Nil(t, err)
+	tenants, err = connector.GetTenants()
+	assert.Nil(t, err)
+	assert.Len(t, tenants, 2)
+
+	_, _, err = connector.DropTenant("ghi", "drop-ghi", false)
+	assert.Nil(t, err)
+	tenants, err = connector.GetTenants()
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Tenant{{Name: "abc", Archived: true}}, tenants)
+	_, err = connector.(*baseConnector).db.Exec("insert into ghi_orders (id) values (2)")
+	assert.NotNil(t, err)
+
+	applied, err := connector.GetAppliedMigrations()
+	assert.Nil(t, err)
+	for _, a := range applied {
+		assert.Equal(t, "abc", a.Schema)
+	}
+
+	versions, err := connector.GetVersions()
+	assert.Nil(t, err)
+	assert.Equal(t, "drop-ghi", versions[0].Name)
+	assert.Equal(t, "rename-def", versions[1].Name)
+}
+
+func TestSQLiteTenantPrefixCollision(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	config.SchemaSnapshots = true
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	// tables of tenant abc_def are prefixed with abc_ too
+	tenantMigration := types.Migration{Name: "201602160000.sql", SourceDir: "tenants", File: "tenants/201602160000.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_orders (id int)"}
+	for _, tenant := range []string{"abc", "abc_def"} {
+		_, _, err := connector.CreateTenant(tenant, "create-"+tenant, types.ActionApply, []types.Migration{tenantMigration}, false)
+		assert.Nil(t, err)
+	}
+	_, err := connector.(*baseConnector).db.Exec("insert into abc_def_orders (id) values (1)")
+	assert.Nil(t, err)
+
+	fingerprints, err := connector.GetSchemaFingerprints([]string{"abc", "abc_def"})
+	assert.Nil(t, err)
+	assert.Equal(t, fingerprints[0].Fingerprint, fingerprints[1].Fingerprint)
+	assert.Len(t, fingerprints[0].Objects, 2)
+
+	tenantMigration2 := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_items (id int)"}
+	_, version, err := connector.CreateVersion("items", types.ActionApply, []types.Migration{tenantMigration2}, nil, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", version.SchemaSnapshot[0].Schema)
+	assert.Len(t, version.SchemaSnapshot[0].Objects, 4)
+	assert.NotContains(t, version.SchemaSnapshot[0].Objects, types.SchemaObject{Type: "table", Name: "def_orders", Definition: "table"})
+
+	// rename and drop of abc leave tables of abc_def untouched
+	_, _, err = connector.RenameTenant("abc", "xyz", "rename-abc")
+	assert.Nil(t, err)
+	_, err = connector.(*baseConnector).db.Exec("insert into xyz_orders (id) values (1)")
+	assert.Nil(t, err)
+	_, _, err = connector.RenameTenant("xyz", "abc", "rename-xyz")
+	assert.Nil(t, err)
+
+	_, _, err = connector.DropTenant("abc", "drop-abc", false)
+	assert.Nil(t, err)
+	_, err = connector.(*baseConnector).db.Exec("insert into abc_orders (id) values (2)")
+	assert.NotNil(t, err)
+	var count int
+	err = connector.(*baseConnector).db.QueryRow("select count(*) from abc_def_orders").Scan(&count)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	_, err = connector.(*baseConnector).db.Exec("insert into abc_def_items (id) values (1)")
+	assert.Nil(t, err)
+
+	tenants, err := connector.GetTenants()
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Tenant{{Name: "abc_def"}}, tenants)
+}
+
+func TestOwnsPrefixedTable(t *testing.T) {
+	schemas := []string{"abc", "abc_def", "ghi"}
+	assert.True(t, ownsPrefixedTable("abc", "abc_orders", schemas))
+	assert.True(t, ownsPrefixedTable("abc", "abc_defs", schemas))
+	assert.False(t, ownsPrefixedTable("abc", "abc_def_orders", schemas))
+	assert.True(t, ownsPrefixedTable("abc_def", "abc_def_orders", schemas))
+	assert.False(t, ownsPrefixedTable("abc", "ghi_orders", schemas))
+}
+
+func TestSQLiteSchemaFingerprints(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	migration := types.Migration{Name: "201602160000.sql", SourceDir: "tenants", File: "tenants/201602160000.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_customers (id integer primary key, name varchar(100) not null); create table {schema}_orders (id integer primary key, customer_id integer references {schema}_customers(id), created timestamp default current_timestamp); create index {schema}_idx_orders_created on {schema}_orders (created)"}
+	for _, tenant := range []string{"abc", "def", "ghi"} {
+		_, _, err := connector.CreateTenant(tenant, "create-"+tenant, types.ActionApply, []types.Migration{migration}, false)
+		assert.Nil(t, err)
+	}
+
+	// hotfix run by hand
+	_, err := connector.(*baseConnector).db.Exec("alter table def_orders add column notes text")
+	assert.Nil(t, err)
+
+	fingerprints, err := connector.GetSchemaFingerprints([]string{"abc", "def", "ghi"})
+	assert.Nil(t, err)
+	assert.Len(t, fingerprints, 3)
+	assert.Equal(t, "abc", fingerprints[0].Schema)
+	assert.Equal(t, fingerprints[0].Fingerprint, fingerprints[2].Fingerprint)
+	assert.NotEqual(t, fingerprints[0].Fingerprint, fingerprints[1].Fingerprint)
+
+	// tenant prefix is removed from names and definitions
+	assert.Contains(t, fingerprints[0].Objects, types.SchemaObject{Type: "table", Name: "orders", Definition: "table"})
+	assert.Contains(t, fingerprints[0].Objects, types.SchemaObject{Type: "column", Name: "orders.customer_id", Definition: "integer"})
+	assert.Contains(t, fingerprints[0].Objects, types.SchemaObject{Type: "index", Name: "orders.idx_orders_created", Definition: "CREATE INDEX idx_orders_created on orders (created)"})
+	assert.Contains(t, fingerprints[0].Objects, types.SchemaObject{Type: "constraint", Name: "orders.fk0_0", Definition: "foreign key (customer_id) references customers(id)"})
+	assert.Contains(t, fingerprints[1].Objects, types.SchemaObject{Type: "column", Name: "orders.notes", Definition: "text"})
+	assert.NotContains(t, fingerprints[0].Objects, types.SchemaObject{Type: "column", Name: "orders.notes", Definition: "text"})
+}
+
+func TestSQLiteSchemaSnapshots(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	config.SingleMigrations = []string{"ref"}
+	config.SchemaSnapshots = true
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	for _, tenant := range []string{"abc", "def"} {
+		_, _, err := connector.CreateTenant(tenant, "create-"+tenant, types.ActionApply, []types.Migration{}, false)
+		assert.Nil(t, err)
+	}
+
+	singleMigration := types.Migration{Name: "201602160001.sql", SourceDir: "ref", File: "ref/201602160001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}_countries (code char(2) primary key)"}
+	tenantMigration := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_orders (id integer primary key)"}
+	_, version, err := connector.CreateVersion("v1", types.ActionApply, []types.Migration{singleMigration, tenantMigration}, nil, false, nil)
+	assert.Nil(t, err)
+
+	// single schemas and the first tenant are captured
+	assert.Len(t, version.SchemaSnapshot, 2)
+	assert.Equal(t, "ref", version.SchemaSnapshot[0].Schema)
+	assert.Equal(t, types.MigrationTypeSingleMigration, version.SchemaSnapshot[0].MigrationType)
+	assert.Contains(t, version.SchemaSnapshot[0].Objects, types.SchemaObject{Type: "table", Name: "countries", Definition: "table"})
+	assert.Equal(t, "abc", version.SchemaSnapshot[1].Schema)
+	assert.Equal(t, types.MigrationTypeTenantMigration, version.SchemaSnapshot[1].MigrationType)
+	assert.Contains(t, version.SchemaSnapshot[1].Objects, types.SchemaObject{Type: "column", Name: "orders.id", Definition: "integer primary key"})
+
+	// dry-run does not capture snapshots
+	alterMigration := types.Migration{Name: "201602160003.sql", SourceDir: "tenants", File: "tenants/201602160003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "alter table {schema}_orders add column total int"}
+	_, dryRunVersion, err := connector.CreateVersion("v2", types.ActionApply, []types.Migration{alterMigration}, nil, true, nil)
+	assert.Nil(t, err)
+	assert.Empty(t, dryRunVersion.SchemaSnapshot)
+
+	_, version, err = connector.CreateVersion("v2", types.ActionApply, []types.Migration{alterMigration}, nil, false, nil)
+	assert.Nil(t, err)
+	assert.Contains(t, version.SchemaSnapshot[1].Objects, types.SchemaObject{Type: "column", Name: "orders.total", Definition: "int"})
+
+	versions, err := connector.GetVersions()
+	assert.Nil(t, err)
+	assert.Len(t, versions[0].SchemaSnapshot, 2)
+	assert.Len(t, versions[1].SchemaSnapshot, 2)
+	// versions created by createTenant have no snapshots
+	assert.Empty(t, versions[2].SchemaSnapshot)
+	assert.NotEqual(t, versions[0].SchemaSnapshot[1].Fingerprint, versions[1].SchemaSnapshot[1].Fingerprint)
+	assert.Equal(t, versions[0].SchemaSnapshot[0].Fingerprint, versions[1].SchemaSnapshot[0].Fingerprint)
+
+	// snapshots are removed together with rolled back version
+	alterMigration.Down = "alter table {schema}_orders drop column total"
+	_, err = connector.RollbackVersion(&versions[0], []types.DBMigration{{Migration: alterMigration, Schema: "def"}, {Migration: alterMigration, Schema: "abc"}}, false)
+	assert.Nil(t, err)
+	var count int
+	err = connector.(*baseConnector).db.QueryRow("select count(*) from migrator_schema_snapshots where version_id = ?", versions[0].ID).Scan(&count)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestSQLiteBaseline(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	for _, tenant := range []string{"abc", "def"} {
+		_, _, err := connector.CreateTenant(tenant, "create-"+tenant, types.ActionApply, []types.Migration{}, false)
+		assert.Nil(t, err)
+	}
+	// existing database, table was created by a legacy tool
+	_, err := connector.(*baseConnector).db.Exec("create table abc_orders (id integer primary key)")
+	assert.Nil(t, err)
+
+	tenantMigration := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_orders (id integer primary key)"}
+	abc := types.Tenant{Name: "abc"}
+
+	// dry-run does not record anything
+	summary, _, err := connector.Baseline("Baseline up to 201602160001.sql", []types.Migration{tenantMigration}, []types.Tenant{abc}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), summary.TenantMigrationsTotal)
+	applied, err := connector.GetAppliedMigrations()
+	assert.Nil(t, err)
+	assert.Empty(t, applied)
+
+	// migration is only recorded, executing it would fail as the table already exists
+	summary, version, err := connector.Baseline("Baseline up to 201602160001.sql", []types.Migration{tenantMigration}, []types.Tenant{abc}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), summary.Tenants)
+	assert.Equal(t, "Baseline up to 201602160001.sql", version.Name)
+	assert.Len(t, version.DBMigrations, 1)
+	assert.Equal(t, "abc", version.DBMigrations[0].Schema)
+
+	// migration stays pending for tenant def
+	_, _, err = connector.CreateVersion("v1", types.ActionApply, []types.Migration{tenantMigration}, nil, false, nil)
+	assert.Nil(t, err)
+	applied, err = connector.GetAppliedMigrations()
+	assert.Nil(t, err)
+	assert.Len(t, applied, 2)
+}
+
+func TestSQLiteOnChangeScripts(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	tenantMigration := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_log (v text)"}
+	for _, tenant := range []string{"abc", "def"} {
+		_, _, err := connector.CreateTenant(tenant, "create-"+tenant, types.ActionApply, []types.Migration{tenantMigration}, false)
+		assert.Nil(t, err)
+	}
+
+	script := types.Migration{Name: "refresh.sql", SourceDir: "tenants-scripts", File: "tenants-scripts/refresh.sql", MigrationType: types.MigrationTypeTenantScript, Contents: "insert into {schema}_log values ('v1')", CheckSum: "sha256-1", OnChange: true}
+	results, version, err := connector.CreateVersion("v1", types.ActionApply, []types.Migration{script}, nil, false, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(2), results.TenantScriptsTotal)
+	assert.Equal(t, int32(0), results.ScriptsSkipped)
+
+	// unchanged script is skipped and no version is created
+	results, version, err = connector.CreateVersion("v2", types.ActionApply, []types.Migration{script}, nil, false, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, version)
+	assert.Equal(t, int32(0), results.TenantScriptsTotal)
+	assert.Equal(t, int32(2), results.ScriptsSkipped)
+
+	// new tenant has never run the script
+	_, _, err = connector.CreateTenant("ghi", "create-ghi", types.ActionApply, []types.Migration{tenantMigration}, false)
+	assert.Nil(t, err)
+	results, version, err = connector.CreateVersion("v3", types.ActionApply, []types.Migration{script}, nil, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), results.TenantScriptsTotal)
+	assert.Equal(t, int32(2), results.ScriptsSkipped)
+	assert.Len(t, version.DBMigrations, 1)
+	assert.Equal(t, "ghi", version.DBMigrations[0].Schema)
+
+	// changed script is applied to all tenants
+	script.Contents = "insert into {schema}_log values ('v2')"
+	script.CheckSum = "sha256-2"
+	results, _, err = connector.CreateVersion("v4", types.ActionApply, []types.Migration{script}, nil, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), results.TenantScriptsTotal)
+	assert.Equal(t, int32(0), results.ScriptsSkipped)
+
+	var count int
+	err = connector.(*baseConnector).db.QueryRow("select count(*) from abc_log").Scan(&count)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestSQLiteMigrationTimeout(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	config.MigrationTimeout = "10s"
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	// timeout directive overrides migrationTimeout
+	slowMigration := types.Migration{Name: "201602160001.sql", SourceDir: "ref", File: "ref/201602160001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}_numbers as with recursive n(i) as (select 1 union all select i + 1 from n) select i from n where i = 0", Timeout: 100 * time.Millisecond}
+	_, _, err := connector.CreateVersion("slow", types.ActionApply, []types.Migration{slowMigration}, nil, false, nil)
+	assert.NotNil(t, err)
+	var sqlError *types.SQLError
+	assert.True(t, errors.As(err, &sqlError))
+	assert.Equal(t, "ref/201602160001.sql", sqlError.File)
+	assert.Contains(t, err.Error(), "migration timed out after 100ms")
+
+	// failed version was rolled back
+	versions, err := connector.GetVersions()
+	assert.Nil(t, err)
+	assert.Empty(t, versions)
+}
+
+func TestSQLiteJobs(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	job, err := connector.CreateJob(types.JobOperationCreateVersion, "commit-sha")
+	assert.Nil(t, err)
+	assert.True(t, job.ID > 0)
+	assert.Equal(t, types.JobStatusQueued, job.Status)
+	assert.False(t, job.Created.IsZero())
+	assert.Nil(t, job.Summary)
+	assert.Nil(t, job.Error)
+
+	job.Status = types.JobStatusSucceeded
+	job.Applied = 3
+	job.Total = 3
+	job.Summary = &types.Summary{VersionID: 12, TenantMigrationsTotal: 2, FailedTenants: []types.TenantFailure{{Tenant: "abc", Error: "trouble maker"}}}
+	assert.Nil(t, connector.UpdateJob(job))
+
+	stored, err := connector.GetJobByID(job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStatusSucceeded, stored.Status)
+	assert.Equal(t, int32(3), stored.Applied)
+	assert.Equal(t, int32(3), stored.Total)
+	assert.Equal(t, int32(12), stored.Summary.VersionID)
+	assert.Equal(t, job.Summary.FailedTenants, stored.Summary.FailedTenants)
+
+	_, err = connector.GetJobByID(job.ID + 1)
+	assert.Equal(t, fmt.Sprintf("job not found: %v", job.ID+1), err.Error())
+}
+
+func TestSQLiteFailStaleJob(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	job, err := connector.CreateJob(types.JobOperationCreateVersion, "commit-sha")
+	assert.Nil(t, err)
+	owner := "migrator-0:1"
+	heartbeat := time.Now().UTC().Add(-time.Minute)
+	job.Status = types.JobStatusRunning
+	job.Owner = &owner
+	job.Heartbeat = &graphql.Time{Time: heartbeat}
+	assert.Nil(t, connector.UpdateJob(job))
+
+	stored, err := connector.GetJobByID(job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, owner, *stored.Owner)
+	assert.True(t, heartbeat.Equal(stored.Heartbeat.Time))
+
+	// heartbeat is newer than the cutoff
+	assert.Nil(t, connector.FailStaleJob(job.ID, heartbeat.Add(-time.Second), "abandoned"))
+	stored, err = connector.GetJobByID(job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStatusRunning, stored.Status)
+
+	assert.Nil(t, connector.FailStaleJob(job.ID, heartbeat.Add(time.Second), "abandoned"))
+	stored, err = connector.GetJobByID(job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStatusFailed, stored.Status)
+	assert.Equal(t, "abandoned", *stored.Error)
+}
+
+func TestSQLiteProgress(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+
+	var reported [][2]int32
+	ctx := WithProgress(newTestContext(), func(applied, total int32) {
+		reported = append(reported, [2]int32{applied, total})
+	})
+	connector := New(ctx, config)
+	defer connector.Dispose()
+
+	tenantMigration := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_settings (k int, v text)"}
+	_, _, err := connector.CreateTenant("abc", "create-abc", types.ActionApply, []types.Migration{tenantMigration}, false)
+	assert.Nil(t, err)
+	_, _, err = connector.CreateTenant("def", "create-def", types.ActionApply, []types.Migration{tenantMigration}, false)
+	assert.Nil(t, err)
+
+	reported = nil
+	singleMigration := types.Migration{Name: "201602160002.sql", SourceDir: "config", File: "config/201602160002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}_params (k int)"}
+	tenantMigration2 := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}_settings values (1, '{schema}')"}
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, []types.Migration{singleMigration, tenantMigration2}, nil, false, nil)
+	assert.Nil(t, err)
+
+	// 1 single migration and 1 tenant migration applied to 2 tenants
+	assert.Equal(t, [][2]int32{{0, 3}, {1, 3}, {2, 3}, {3, 3}}, reported)
+}
+
+func TestSQLitePlanMigrations(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	tenantMigration := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_settings (k int, v text)"}
+	onChangeScript := types.Migration{Name: "views.sql", SourceDir: "tenants-views", File: "tenants-views/views.sql", MigrationType: types.MigrationTypeTenantScript, Contents: "select 1", CheckSum: "abc", OnChange: true}
+	_, _, err := connector.CreateTenant("abc", "create-abc", types.ActionApply, []types.Migration{tenantMigration, onChangeScript}, false)
+	assert.Nil(t, err)
+
+	tenants := []types.Tenant{{Name: "abc"}, {Name: "def"}}
+	singleMigration := types.Migration{Name: "201602160002.sql", SourceDir: "config", File: "config/201602160002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}_params (k int)"}
+	schemas, err := connector.PlanMigrations([]types.Migration{tenantMigration, onChangeScript, singleMigration}, tenants)
+	assert.Nil(t, err)
+
+	// tenant abc already has the tenant migration and the unchanged on-change script
+	assert.Equal(t, []string{"def"}, schemas[tenantMigration.File])
+	assert.Equal(t, []string{"def"}, schemas[onChangeScript.File])
+	assert.Equal(t, []string{"config"}, schemas[singleMigration.File])
+
+	// nothing is applied when planning
+	applied, err := connector.GetAppliedMigrations()
+	assert.Nil(t, err)
+	assert.Len(t, applied, 2)
+}
+
+func TestSQLiteCreateVersionPlanChanged(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	tenantMigration := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_settings (k int, v text)"}
+	_, _, err := connector.CreateTenant("abc", "create-abc", types.ActionApply, []types.Migration{tenantMigration}, false)
+	assert.Nil(t, err)
+
+	singleMigration := types.Migration{Name: "201602160002.sql", SourceDir: "config", File: "config/201602160002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}_params (k int)"}
+	tenantMigration2 := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}_settings values (1, '{schema}')"}
+	sourceMigrations := []types.Migration{tenantMigration, singleMigration, tenantMigration2}
+	migrations := []types.Migration{singleMigration, tenantMigration2}
+	tenants := []types.Tenant{{Name: "abc"}}
+
+	schemas, err := connector.PlanMigrations(migrations, tenants)
+	assert.Nil(t, err)
+	plan := types.NewPlan(sourceMigrations, migrations, schemas, tenants)
+
+	// another migrator instance applies the single migration after the plan was made
+	_, _, err = connector.CreateVersion("other-sha", types.ActionApply, []types.Migration{singleMigration}, nil, false, nil)
+	assert.Nil(t, err)
+
+	results, version, err := connector.CreateVersion("commit-sha", types.ActionApply, migrations, nil, false, &types.PlanCheck{Hash: plan.Hash, SourceMigrations: sourceMigrations})
+	assert.Nil(t, results)
+	assert.Nil(t, version)
+	var planChanged *types.PlanChangedError
+	assert.True(t, errors.As(err, &planChanged))
+	assert.Equal(t, plan.Hash, planChanged.Expected)
+	assert.NotEqual(t, plan.Hash, planChanged.Actual)
+
+	// nothing was applied
+	applied, err := connector.GetAppliedMigrations()
+	assert.Nil(t, err)
+	assert.Len(t, applied, 2)
+
+	// plan made after the other version was applied is accepted
+	migrations = []types.Migration{tenantMigration2}
+	schemas, err = connector.PlanMigrations(migrations, tenants)
+	assert.Nil(t, err)
+	plan = types.NewPlan(sourceMigrations, migrations, schemas, tenants)
+	assert.Equal(t, planChanged.Actual, plan.Hash)
+	results, version, err = connector.CreateVersion("commit-sha", types.ActionApply, migrations, nil, false, &types.PlanCheck{Hash: plan.Hash, SourceMigrations: sourceMigrations})
+	assert.Nil(t, err)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(0), results.SingleMigrations)
+	assert.Equal(t, int32(1), results.TenantMigrationsTotal)
+}
+
+func TestSQLiteMigrationEvents(t *testing.T) {
+	config := newSQLiteTestConfig(t)
+
+	var events []types.MigrationEvent
+	ctx := WithMigrationEvents(newTestContext(), func(event types.MigrationEvent) {
+		events = append(events, event)
+	})
+	connector := New(ctx, config)
+	defer connector.Dispose()
+
+	tenantMigration := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}_settings (k int, v text)"}
+	_, version, err := connector.CreateTenant("abc", "create-abc", types.ActionApply, []types.Migration{tenantMigration}, false)
+	assert.Nil(t, err)
+
+	assert.Len(t, events, 2)
+	assert.Equal(t, types.MigrationEventStarted, events[0].Type)
+	assert.Equal(t, types.MigrationEventFinished, events[1].Type)
+	for _, event := range events {
+		assert.Equal(t, version.ID, event.VersionID)
+		assert.Equal(t, tenantMigration.File, event.File)
+		assert.Equal(t, "abc", event.Schema)
+		assert.Nil(t, event.Error)
+	}
+	assert.True(t, events[1].Duration > 0)
+
+	events = nil
+	brokenMigration := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}_missing values (1)"}
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, []types.Migration{brokenMigration}, nil, false, nil)
+	assert.NotNil(t, err)
+
+	assert.Len(t, events, 2)
+	assert.Equal(t, types.MigrationEventFinished, events[1].Type)
+	assert.Equal(t, brokenMigration.File, events[1].File)
+	assert.Contains(t, *events[1].Error, "abc_missing")
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// templateData is passed to text/template when contents of a migration are rendered
+type templateData struct {
+	// Tenant is the schema to which the migration is applied: tenant name or single schema name
+	Tenant string
+	// Version is the name of the version which applies (or rolls back) the migration
+	Version string
+	// Driver is the DB driver from the configuration file
+	Driver string
+	// Vars are variables defined in the configuration file
+	Vars map[string]string
+	// Env are environment variables of migrator process
+	Env map[string]string
+}
+
+// renderedContents contains rendered contents of migrations, key is Migration.File, second key is schema
+type renderedContents map[string]map[string]string
+
+// contentsRenderer renders contents of migrations for a given version
+// templates are rendered first and then schema placeholder is replaced with the schema name
+type contentsRenderer struct {
+	config            *config.Config
+	schemaPlaceHolder string
+	versionName       string
+	env               map[string]string
+}
+
+func newContentsRenderer(config *config.Config, schemaPlaceHolder string, versionName string) *contentsRenderer {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	return &contentsRenderer{config, schemaPlaceHolder, versionName, env}
+}
+
+// render renders contents of a migration file for a given schema
+func (r *contentsRenderer) render(file string, contents string, schema string) (string, error) {
+	// templates are opt-in, contents without actions are not parsed
+	if r.config.Templates && strings.Contains(contents, "{{") {
+		tmpl, err := template.New(file).Option("missingkey=error").Parse(contents)
+		if err != nil {
+			return "", &types.TemplateError{File: file, Schema: schema, Err: err}
+		}
+		data := templateData{
+			Tenant:  schema,
+			Version: r.versionName,
+			Driver:  r.config.Driver,
+			Vars:    r.config.Variables,
+			Env:     r.env,
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", &types.TemplateError{File: file, Schema: schema, Err: err}
+		}
+		contents = buf.String()
+	}
+	return strings.Replace(contents, r.schemaPlaceHolder, schema, -1), nil
+}
+
+// renderMigrations renders contents of migrations for all their target schemas
+// migrations are rendered before any of them is executed so that a template error does not leave DB partially migrated
+func (r *contentsRenderer) renderMigrations(migrations []types.Migration, tenants []types.Tenant, targetSchemas func(types.Migration, []types.Tenant) []string) (renderedContents, error) {
+	rendered := renderedContents{}
+	for _, m := range migrations {
+		rendered[m.File] = map[string]string{}
+		for _, s := range targetSchemas(m, tenants) {
+			contents, err := r.render(m.File, m.Contents, s)
+			if err != nil {
+				return nil, err
+			}
+			rendered[m.File][s] = contents
+		}
+	}
+	return rendered, nil
+}
+
+// renderDownMigrations renders down migrations in the order in which they are passed
+func (r *contentsRenderer) renderDownMigrations(migrations []types.DBMigration) ([]string, error) {
+	rendered := []string{}
+	for _, m := range migrations {
+		contents, err := r.render(m.File, m.Down, m.Schema)
+		if err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, contents)
+	}
+	return rendered, nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentsRendererRender(t *testing.T) {
+	t.Setenv("MIGRATOR_TEST_ROLE", "app_user")
+	config := &config.Config{Driver: "postgres", Templates: true, Variables: map[string]string{"tablespace": "fast_ssd"}}
+	renderer := newContentsRenderer(config, defaultSchemaPlaceHolder, "commit-sha")
+
+	contents, err := renderer.render("tenants/001.sql", "create table {schema}.t (k int) tablespace {{.Vars.tablespace}}; grant select on {schema}.t to {{.Env.MIGRATOR_TEST_ROLE}}; -- {{.Tenant}} {{.Version}} {{.Driver}}", "abc")
+	assert.Nil(t, err)
+	assert.Equal(t, "create table abc.t (k int) tablespace fast_ssd; grant select on abc.t to app_user; -- abc commit-sha postgres", contents)
+
+	// contents without template actions are only rendered with schema
+	contents, err = renderer.render("tenants/002.sql", "insert into {schema}.t values (1)", "def")
+	assert.Nil(t, err)
+	assert.Equal(t, "insert into def.t values (1)", contents)
+}
+
+func TestContentsRendererRenderTemplatesDisabled(t *testing.T) {
+	config := &config.Config{Driver: "postgres"}
+	renderer := newContentsRenderer(config, defaultSchemaPlaceHolder, "commit-sha")
+
+	// literal "{{" is not parsed when templates are not enabled
+	contents, err := renderer.render("tenants/001.sql", "insert into {schema}.matrix values ('{{1,2},{3,4}}', '{\"a\": {\"b\": 1}}')", "abc")
+	assert.Nil(t, err)
+	assert.Equal(t, "insert into abc.matrix values ('{{1,2},{3,4}}', '{\"a\": {\"b\": 1}}')", contents)
+
+	contents, err = renderer.render("tenants/002.sql", "-- {{.Vars.missing}}", "abc")
+	assert.Nil(t, err)
+	assert.Equal(t, "-- {{.Vars.missing}}", contents)
+}
+
+func TestContentsRendererRenderErrors(t *testing.T) {
+	config := &config.Config{Driver: "postgres", Templates: true}
+	renderer := newContentsRenderer(config, defaultSchemaPlaceHolder, "commit-sha")
+
+	_, err := renderer.render("tenants/001.sql", "create table {schema}.t (k int) tablespace {{.Vars.tablespace}}", "abc")
+	var templateError *types.TemplateError
+	assert.True(t, errors.As(err, &templateError))
+	assert.Equal(t, "tenants/001.sql", templateError.File)
+	assert.Equal(t, "abc", templateError.Schema)
+	assert.Contains(t, err.Error(), `map has no entry for key "tablespace"`)
+
+	_, err = renderer.render("tenants/002.sql", "create table {schema}.t (k int) {{.Vars.tablespace", "abc")
+	assert.True(t, errors.As(err, &templateError))
+	assert.Equal(t, "tenants/002.sql", templateError.File)
+}
+
+func TestContentsRendererRenderMigrations(t *testing.T) {
+	config := &config.Config{Driver: "postgres", Templates: true}
+	renderer := newContentsRenderer(config, defaultSchemaPlaceHolder, "commit-sha")
+	connector := &baseConnector{config: config}
+
+	m1 := types.Migration{Name: "001.sql", SourceDir: "config", File: "config/001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "-- {{.Tenant}}"}
+	m2 := types.Migration{Name: "001.sql", SourceDir: "tenants", File: "tenants/001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "-- {{.Tenant}}"}
+	tenants := []types.Tenant{{Name: "abc"}, {Name: "def"}}
+
+	rendered, err := renderer.renderMigrations([]types.Migration{m1, m2}, tenants, connector.targetSchemas)
+	assert.Nil(t, err)
+	assert.Equal(t, renderedContents{"config/001.sql": {"config": "-- config"}, "tenants/001.sql": {"abc": "-- abc", "def": "-- def"}}, rendered)
+
+	downs, err := renderer.renderDownMigrations([]types.DBMigration{{Migration: types.Migration{File: "tenants/001.sql", Down: "-- {{.Version}} {schema}"}, Schema: "def"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-- commit-sha def"}, downs)
+}
@@ -0,0 +1,276 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// ArchiveTenant marks tenant as archived, archived tenants are skipped by CreateVersion
+// tenant schema and its DB migrations are kept, the operation is recorded as a new version
+func (bc *baseConnector) ArchiveTenant(tenant string, versionName string) (*types.Summary, *types.Version, error) {
+	if err := bc.init(); err != nil {
+		return nil, nil, err
+	}
+
+	return bc.applyTenantOperation("ArchiveTenant", versionName, false, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(bc.ctx, bc.dialect.GetArchivedTenantInsertSQL(), tenant); err != nil {
+			return fmt.Errorf("failed to archive tenant: %v", err)
+		}
+		return nil
+	})
+}
+
+// DropTenant drops tenant schema and removes tenant together with its DB migrations, labels, and archived entry
+// the operation is recorded as a new version, in dry-run mode schema is not dropped and the transaction is rolled back
+func (bc *baseConnector) DropTenant(tenant string, versionName string, dryRun bool) (*types.Summary, *types.Version, error) {
+	if err := bc.init(); err != nil {
+		return nil, nil, err
+	}
+
+	if !isValidIdentifier(tenant) {
+		return nil, nil, fmt.Errorf("tenant name contains invalid characters: %v", tenant)
+	}
+
+	tenantDeleteSQL, err := bc.getTenantDeleteSQL()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bc.applyTenantOperation("DropTenant", versionName, dryRun, func(tx *sql.Tx) error {
+		tables, err := bc.getSchemaTablesInTx(tx, tenant)
+		if err != nil {
+			return err
+		}
+		// DDL statements are not executed in dry-run mode, MySQL commits them implicitly
+		if !dryRun {
+			for _, dropSchema := range bc.dialect.GetDropSchemaSQL(tenant, tables) {
+				common.LogDebug(bc.ctx, "Dropping tenant %v: %v", tenant, dropSchema)
+				if _, err := tx.ExecContext(bc.ctx, dropSchema); err != nil {
+					return fmt.Errorf("drop schema failed: %v", err)
+				}
+			}
+		}
+		if _, err := tx.ExecContext(bc.ctx, bc.dialect.GetMigrationsDeleteBySchemaSQL(), tenant); err != nil {
+			return fmt.Errorf("failed to delete migration entries: %v", err)
+		}
+		if _, err := tx.ExecContext(bc.ctx, bc.dialect.GetTenantLabelsDeleteSQL(), tenant); err != nil {
+			return fmt.Errorf("could not delete tenant labels: %v", err)
+		}
+		if _, err := tx.ExecContext(bc.ctx, bc.dialect.GetArchivedTenantDeleteSQL(), tenant); err != nil {
+			return fmt.Errorf("failed to delete archived tenant entry: %v", err)
+		}
+		if _, err := tx.ExecContext(bc.ctx, tenantDeleteSQL, tenant); err != nil {
+			return fmt.Errorf("failed to delete tenant entry: %v", err)
+		}
+		return nil
+	})
+}
+
+// RenameTenant renames tenant schema and updates tenant name in tenants, DB migrations, labels, and archived tenants
+// the operation is recorded as a new version
+func (bc *baseConnector) RenameTenant(from string, to string, versionName string) (*types.Summary, *types.Version, error) {
+	if err := bc.init(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, tenant := range []string{from, to} {
+		if !isValidIdentifier(tenant) {
+			return nil, nil, fmt.Errorf("tenant name contains invalid characters: %v", tenant)
+		}
+	}
+
+	tenantRenameSQL, err := bc.getTenantRenameSQL()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bc.applyTenantOperation("RenameTenant", versionName, false, func(tx *sql.Tx) error {
+		tables, err := bc.getSchemaTablesInTx(tx, from)
+		if err != nil {
+			return err
+		}
+		for _, renameSchema := range bc.dialect.GetRenameSchemaSQL(from, to, tables) {
+			common.LogDebug(bc.ctx, "Renaming tenant %v to %v: %v", from, to, renameSchema)
+			if _, err := tx.ExecContext(bc.ctx, renameSchema); err != nil {
+				return fmt.Errorf("rename schema failed: %v", err)
+			}
+		}
+		if _, err := tx.ExecContext(bc.ctx, bc.dialect.GetMigrationsSchemaRenameSQL(), to, from); err != nil {
+			return fmt.Errorf("failed to update migration entries: %v", err)
+		}
+		if _, err := tx.ExecContext(bc.ctx, bc.dialect.GetTenantLabelsRenameSQL(), to, from); err != nil {
+			return fmt.Errorf("could not update tenant labels: %v", err)
+		}
+		if _, err := tx.ExecContext(bc.ctx, bc.dialect.GetArchivedTenantRenameSQL(), to, from); err != nil {
+			return fmt.Errorf("failed to update archived tenant entry: %v", err)
+		}
+		if _, err := tx.ExecContext(bc.ctx, tenantRenameSQL, to, from); err != nil {
+			return fmt.Errorf("failed to update tenant entry: %v", err)
+		}
+		return nil
+	})
+}
+
+// applyTenantOperation executes tenant lifecycle operation in a transaction holding migrator lock
+// and records it as a new version without DB migrations
+func (bc *baseConnector) applyTenantOperation(operation string, versionName string, dryRun bool, apply func(*sql.Tx) error) (results *types.Summary, version *types.Version, err error) {
+	conn, tx, err := bc.beginTx()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer bc.releaseLock(conn)
+
+	defer func() {
+		if err = bc.endTx(tx, operation, types.ActionApply, dryRun, err); err != nil {
+			results, version = nil, nil
+		}
+	}()
+
+	if err := bc.acquireLock(tx); err != nil {
+		return nil, nil, err
+	}
+
+	results = &types.Summary{
+		StartedAt: graphql.Time{Time: time.Now()},
+		Tenants:   1,
+	}
+
+	if err := apply(tx); err != nil {
+		return nil, nil, err
+	}
+
+	results.VersionID, err = bc.insertVersionInTx(tx, versionName)
+	if err != nil {
+		return nil, nil, err
+	}
+	version, err = bc.getVersionByIDInTx(tx, results.VersionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results.Duration = time.Since(results.StartedAt.Time).Seconds()
+
+	return results, version, nil
+}
+
+// getSchemaTablesInTx returns names of all tables of a given schema
+func (bc *baseConnector) getSchemaTablesInTx(tx *sql.Tx, schema string) ([]string, error) {
+	rows, err := tx.QueryContext(bc.ctx, bc.dialect.GetSchemaTablesSQL(), schema)
+	if err != nil {
+		return nil, fmt.Errorf("could not query schema tables: %v", err)
+	}
+	defer rows.Close()
+
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, fmt.Errorf("could not read schema tables: %v", err)
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read schema tables: %v", err)
+	}
+
+	if !bc.dialect.SchemasMappedToTablePrefixes() {
+		return tables, nil
+	}
+	schemas, err := bc.getSchemaNames(tx)
+	if err != nil {
+		return nil, err
+	}
+	ownTables := []string{}
+	for _, table := range tables {
+		if ownsPrefixedTable(schema, table, schemas) {
+			ownTables = append(ownTables, table)
+		}
+	}
+	return ownTables, nil
+}
+
+// getSchemaNames returns names of all tenants (including archived ones) and all single schemas
+func (bc *baseConnector) getSchemaNames(q queryer) ([]string, error) {
+	rows, err := q.QueryContext(bc.ctx, bc.getTenantSelectSQL())
+	if err != nil {
+		return nil, fmt.Errorf("could not query tenants: %v", err)
+	}
+	defer rows.Close()
+
+	schemas := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("could not read tenants: %v", err)
+		}
+		schemas = append(schemas, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read tenants: %v", err)
+	}
+
+	for _, dir := range append(append([]string{}, bc.config.SingleMigrations...), bc.config.SingleScripts...) {
+		schemas = appendUnique(schemas, filepath.Base(dir))
+	}
+	return schemas, nil
+}
+
+// ownsPrefixedTable returns true if table mapped to schema by its name prefix does not belong to another schema with a longer name,
+// for example when tenants abc and abc_def exist table abc_def_orders belongs to abc_def and not to abc
+func ownsPrefixedTable(schema string, table string, schemas []string) bool {
+	if !strings.HasPrefix(table, schema+"_") {
+		return false
+	}
+	for _, s := range schemas {
+		if len(s) > len(schema) && strings.HasPrefix(table, s+"_") {
+			return false
+		}
+	}
+	return true
+}
+
+// getTenantDeleteSQL returns tenant delete SQL statement from configuration file
+// or, if absent, returns default Dialect-specific migrator tenant delete SQL
+// custom tenants table (tenantSelect) requires tenantDelete to be configured
+func (bc *baseConnector) getTenantDeleteSQL() (string, error) {
+	if bc.config.TenantDelete != "" {
+		return bc.config.TenantDelete, nil
+	}
+	if bc.config.GetTenantSelect() != "" {
+		return "", errors.New("tenantDelete must be configured when custom tenantSelect is used")
+	}
+	return bc.dialect.GetTenantDeleteSQL(), nil
+}
+
+// getTenantRenameSQL returns tenant rename SQL statement from configuration file
+// or, if absent, returns default Dialect-specific migrator tenant rename SQL
+// custom tenants table (tenantSelect) requires tenantRename to be configured
+func (bc *baseConnector) getTenantRenameSQL() (string, error) {
+	if bc.config.TenantRename != "" {
+		return bc.config.TenantRename, nil
+	}
+	if bc.config.GetTenantSelect() != "" {
+		return "", errors.New("tenantRename must be configured when custom tenantSelect is used")
+	}
+	return bc.dialect.GetTenantRenameSQL(), nil
+}
+
+// activeTenants returns tenants which are not archived
+func activeTenants(tenants []types.Tenant) []types.Tenant {
+	active := []types.Tenant{}
+	for _, t := range tenants {
+		if !t.Archived {
+			active = append(active, t)
+		}
+	}
+	return active
+}
@@ -30,28 +30,16 @@ func TestDBCreateConnectorPanicUnknownDriver(t *testing.T) {
 	})
 }
 
-func TestConnectorInitPanicConnectionError(t *testing.T) {
+func TestConnectorInitConnectionError(t *testing.T) {
 	config, err := config.FromFile("../test/migrator-postgresql.yaml")
 	assert.Nil(t, err)
 
 	config.DataSource = strings.Replace(config.DataSource, "127.0.0.1", "1.0.0.1", -1)
 
-	didPanic := false
-	var message interface{}
-	func() {
-
-		defer func() {
-			if message = recover(); message != nil {
-				didPanic = true
-			}
-		}()
-
-		db := New(newTestContext(), config)
-		db.GetTenants()
-
-	}()
-	assert.True(t, didPanic)
-	assert.Contains(t, message, "Error initialising migrator: failed to connect to database")
+	db := New(newTestContext(), config)
+	_, err = db.GetTenants()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to connect to database")
 }
 
 func TestCreateVersionDryRunMode(t *testing.T) {
@@ -70,10 +58,13 @@ func TestCreateVersionDryRunMode(t *testing.T) {
 	tenant := "tenantname"
 	tenants := sqlmock.NewRows([]string{"name"}).AddRow(tenant)
 	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
@@ -81,11 +72,13 @@ func TestCreateVersionDryRunMode(t *testing.T) {
 	// get version
 	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
 	mock.ExpectQuery("select").WillReturnRows(rows)
+	expectNoSchemaSnapshots(mock)
 	// dry-run mode calls rollback instead of commit
 	mock.ExpectRollback()
 
 	// however the results contain correct dry-run data like number of applied migrations/scripts
-	results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, true)
+	results, version, err := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, true, nil)
+	assert.Nil(t, err)
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
 	assert.Equal(t, results.MigrationsGrandTotal+results.ScriptsGrandTotal, int32(len(version.DBMigrations)))
@@ -112,20 +105,25 @@ func TestCreateVersionSyncMode(t *testing.T) {
 	tenant := "tenantname"
 	tenants := sqlmock.NewRows([]string{"name"}).AddRow(tenant)
 	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
 	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
 	mock.ExpectQuery("select").WillReturnRows(rows)
+	expectNoSchemaSnapshots(mock)
 	mock.ExpectCommit()
 
 	// sync the results contain correct data like number of applied migrations/scripts
-	results, version := connector.CreateVersion("commit-sha", types.ActionSync, migrationsToApply, false)
+	results, version, err := connector.CreateVersion("commit-sha", types.ActionSync, migrationsToApply, nil, false, nil)
+	assert.Nil(t, err)
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
 	assert.Equal(t, results.MigrationsGrandTotal+results.ScriptsGrandTotal, int32(len(version.DBMigrations)))
@@ -136,6 +134,289 @@ func TestCreateVersionSyncMode(t *testing.T) {
 	}
 }
 
+func TestCreateVersionNoTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn), MigrationType: types.MigrationTypeTenantMigration, Contents: "-- migrator: transaction=false\ncreate index concurrently if not exists abc_idx on {schema}.abc (id)", NoTransaction: true}
+	migrationsToApply := []types.Migration{m}
+
+	tenant := "tenantname"
+	tenants := sqlmock.NewRows([]string{"name"}).AddRow(tenant)
+	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
+	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
+	// version is committed in its own transaction, the version transaction only holds migrator lock
+	mock.ExpectBegin()
+	expectVersionInsert(mock)
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectCommit()
+	// migration is executed outside of any transaction and then recorded straight away
+	insert := mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create index concurrently if not exists abc_idx on tenantname.abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	insert.ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	expectNoSchemaSnapshots(mock)
+	mock.ExpectCommit()
+
+	results, version, err := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(1), results.MigrationsGrandTotal)
+	assert.Equal(t, []string{m.File}, results.NonTransactional)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionNoTransactionAfterTransactionalMigration(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m1 := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn), MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.abc (id int)"}
+	m2 := types.Migration{Name: fmt.Sprintf("%v.sql", tn+1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn+1), MigrationType: types.MigrationTypeTenantMigration, Contents: "-- migrator: transaction=false\ncreate index concurrently if not exists abc_idx on {schema}.abc (id)", NoTransaction: true}
+	migrationsToApply := []types.Migration{m1, m2}
+
+	tenant := "tenantname"
+	tenants := sqlmock.NewRows([]string{"name"}).AddRow(tenant)
+	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
+	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
+	// table created by the preceding migration of the same version is committed before the index is created
+	mock.ExpectBegin()
+	expectVersionInsert(mock)
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create table tenantname.abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m1.Name, m1.SourceDir, m1.File, m1.MigrationType, tenant, m1.Contents, m1.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	insert := mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create index concurrently if not exists abc_idx on tenantname.abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	insert.ExpectExec().WithArgs(m2.Name, m2.SourceDir, m2.File, m2.MigrationType, tenant, m2.Contents, m2.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m1.Name, m1.SourceDir, m1.File, m1.MigrationType, tenant, time.Now(), m1.Contents, m1.CheckSum)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	expectNoSchemaSnapshots(mock)
+	mock.ExpectCommit()
+
+	results, version, err := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(2), results.MigrationsGrandTotal)
+	assert.Equal(t, []string{m2.File}, results.NonTransactional)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionFailureAfterNonTransactionalMigration(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m1 := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn), MigrationType: types.MigrationTypeTenantMigration, Contents: "-- migrator: transaction=false\ncreate index concurrently if not exists abc_idx on {schema}.abc (id)", NoTransaction: true}
+	m2 := types.Migration{Name: fmt.Sprintf("%v.sql", tn+1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn+1), MigrationType: types.MigrationTypeTenantMigration, Contents: "alter table {schema}.abc add column def int"}
+	migrationsToApply := []types.Migration{m1, m2}
+
+	tenant := "tenantname"
+	tenants := sqlmock.NewRows([]string{"name"}).AddRow(tenant)
+	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
+	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
+	mock.ExpectBegin()
+	expectVersionInsert(mock)
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectCommit()
+	// non-transactional migration is recorded as soon as it succeeds
+	insert := mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create index concurrently if not exists abc_idx on tenantname.abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	insert.ExpectExec().WithArgs(m1.Name, m1.SourceDir, m1.File, m1.MigrationType, tenant, m1.Contents, m1.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	// failure of the next migration rolls back only its own transaction
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("alter table tenantname.abc add column def int").WillReturnError(errors.New("column def already exists"))
+	mock.ExpectRollback()
+	mock.ExpectRollback()
+
+	_, _, err = connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	var sqlError *types.SQLError
+	assert.True(t, errors.As(err, &sqlError))
+	assert.Equal(t, m2.File, sqlError.File)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionTimeouts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.MigrationTimeout = "1m"
+	config.DBLockTimeout = "5s"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn), MigrationType: types.MigrationTypeTenantMigration, Contents: "-- migrator: timeout=90s\nalter table {schema}.abc add column def int", Timeout: 90 * time.Second}
+	migrationsToApply := []types.Migration{m}
+
+	tenant := "tenantname"
+	tenants := sqlmock.NewRows([]string{"name"}).AddRow(tenant)
+	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec("set local lock_timeout = 5000").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
+	// timeout directive overrides migrationTimeout, statement timeout is restored after the migration
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("set local statement_timeout = 90000").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("alter table tenantname.abc add column def int").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set local statement_timeout to default").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	expectNoSchemaSnapshots(mock)
+	mock.ExpectCommit()
+
+	results, version, err := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(1), results.MigrationsGrandTotal)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionNoTransactionTimeouts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.MigrationTimeout = "1m"
+	config.DBLockTimeout = "5s"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn), MigrationType: types.MigrationTypeTenantMigration, Contents: "-- migrator: transaction=false\ncreate index concurrently if not exists abc_idx on {schema}.abc (id)", NoTransaction: true}
+	migrationsToApply := []types.Migration{m}
+
+	tenant := "tenantname"
+	tenants := sqlmock.NewRows([]string{"name"}).AddRow(tenant)
+	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec("set local lock_timeout = 5000").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec("set local lock_timeout = 5000").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectVersionInsert(mock)
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectCommit()
+	// set local has no effect outside of a transaction, timeouts are set for the session and restored after the migration
+	insert := mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("set lock_timeout = 5000").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set statement_timeout = 60000").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create index concurrently if not exists abc_idx on tenantname.abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set statement_timeout to default").WillReturnResult(sqlmock.NewResult(0, 0))
+	insert.ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set lock_timeout to default").WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	expectNoSchemaSnapshots(mock)
+	mock.ExpectCommit()
+
+	results, version, err := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, version)
+	assert.Equal(t, []string{m.File}, results.NonTransactional)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionNoTransactionDryRunMode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn), MigrationType: types.MigrationTypeTenantMigration, Contents: "-- migrator: transaction=false\ncreate index concurrently if not exists abc_idx on {schema}.abc (id)", NoTransaction: true}
+	migrationsToApply := []types.Migration{m}
+
+	tenant := "tenantname"
+	tenants := sqlmock.NewRows([]string{"name"}).AddRow(tenant)
+	mock.ExpectQuery("select").WillReturnRows(tenants)
+	expectNoArchivedTenants(mock)
+	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
+	// non-transactional migration cannot be rolled back so it is not executed in dry-run mode
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	expectNoSchemaSnapshots(mock)
+	mock.ExpectRollback()
+
+	results, version, err := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, true, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(1), results.MigrationsGrandTotal)
+	assert.Equal(t, []string{m.File}, results.NonTransactional)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestGetTenantsSQLOverride(t *testing.T) {
 	config, err := config.FromFile("../test/migrator-overrides.yaml")
 	assert.Nil(t, err)
@@ -191,13 +472,14 @@ func TestCreateTenantDryRunMode(t *testing.T) {
 	tenant := "tenantname"
 
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
 	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
 	// tenant
 	mock.ExpectPrepare("insert into")
 	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant).WillReturnResult(sqlmock.NewResult(1, 1))
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
@@ -205,11 +487,13 @@ func TestCreateTenantDryRunMode(t *testing.T) {
 	// get version
 	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
 	mock.ExpectQuery("select").WillReturnRows(rows)
+	expectNoSchemaSnapshots(mock)
 	// dry-run mode calls rollback instead of commit
 	mock.ExpectRollback()
 
 	// however the results contain correct dry-run data like number of applied migrations/scripts
-	results, version := connector.CreateTenant(tenant, "commit-sha", types.ActionApply, migrationsToApply, true)
+	results, version, err := connector.CreateTenant(tenant, "commit-sha", types.ActionApply, migrationsToApply, true)
+	assert.Nil(t, err)
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
 	assert.Equal(t, results.MigrationsGrandTotal+results.ScriptsGrandTotal, int32(len(version.DBMigrations)))
@@ -235,23 +519,26 @@ func TestCreateTenantSyncMode(t *testing.T) {
 
 	tenant := "tenantname"
 	mock.ExpectBegin()
+	expectAcquireLock(mock)
 	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
 	// tenant
 	mock.ExpectPrepare("insert into")
 	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant).WillReturnResult(sqlmock.NewResult(0, 0))
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
 	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
 	mock.ExpectQuery("select").WillReturnRows(rows)
+	expectNoSchemaSnapshots(mock)
 	mock.ExpectCommit()
 
 	// sync results contain correct data like number of applied migrations/scripts
-	results, version := connector.CreateTenant(tenant, "commit-sha", types.ActionSync, migrationsToApply, false)
+	results, version, err := connector.CreateTenant(tenant, "commit-sha", types.ActionSync, migrationsToApply, false)
+	assert.Nil(t, err)
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
 	assert.Equal(t, results.MigrationsGrandTotal+results.ScriptsGrandTotal, int32(len(version.DBMigrations)))
@@ -295,3 +582,218 @@ func TestHealthCheck(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestRollbackVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	m := types.Migration{Name: "201602160003.sql", SourceDir: "tenants", File: "tenants/201602160003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.settings (k int)", Down: "drop table {schema}.settings"}
+	migrationsToRollback := []types.DBMigration{{Migration: m, ID: 2, Schema: "def"}, {Migration: m, ID: 1, Schema: "abc"}}
+
+	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	mock.ExpectQuery("select max\\(id\\) from migrator.migrator_versions").WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(123))
+	mock.ExpectExec("drop table def.settings").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("drop table abc.settings").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("delete from migrator.migrator_migrations where version_id").WithArgs(123).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("delete from migrator.migrator_schema_snapshots where version_id").WithArgs(123).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("delete from migrator.migrator_versions where id").WithArgs(123).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	results, err := connector.RollbackVersion(&types.Version{ID: 123, Name: "commit-sha"}, migrationsToRollback, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(123), results.VersionID)
+	assert.Equal(t, int32(2), results.Tenants)
+	assert.Equal(t, int32(1), results.TenantMigrations)
+	assert.Equal(t, int32(2), results.TenantMigrationsTotal)
+	assert.Equal(t, int32(2), results.MigrationsGrandTotal)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRollbackVersionDryRunMode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	m := types.Migration{Name: "201602160001.sql", SourceDir: "config", File: "config/201602160001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}.settings (k int)", Down: "drop table {schema}.settings"}
+	migrationsToRollback := []types.DBMigration{{Migration: m, ID: 1, Schema: "config"}}
+
+	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	mock.ExpectQuery("select max\\(id\\) from migrator.migrator_versions").WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(123))
+	mock.ExpectExec("drop table config.settings").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("delete from migrator.migrator_migrations where version_id").WithArgs(123).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("delete from migrator.migrator_schema_snapshots where version_id").WithArgs(123).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("delete from migrator.migrator_versions where id").WithArgs(123).WillReturnResult(sqlmock.NewResult(0, 1))
+	// dry-run mode calls rollback instead of commit
+	mock.ExpectRollback()
+
+	results, err := connector.RollbackVersion(&types.Version{ID: 123, Name: "commit-sha"}, migrationsToRollback, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), results.SingleMigrations)
+	assert.Equal(t, int32(1), results.MigrationsGrandTotal)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRollbackVersionNotLatest(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	m := types.Migration{Name: "201602160001.sql", SourceDir: "config", File: "config/201602160001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}.settings (k int)", Down: "drop table {schema}.settings"}
+	migrationsToRollback := []types.DBMigration{{Migration: m, ID: 1, Schema: "config"}}
+
+	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	// version 124 was created by another replica after version 123 was read
+	mock.ExpectQuery("select max\\(id\\) from migrator.migrator_versions").WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(124))
+	mock.ExpectRollback()
+
+	results, err := connector.RollbackVersion(&types.Version{ID: 123, Name: "commit-sha"}, migrationsToRollback, false)
+	assert.Nil(t, results)
+	var invalidArgument *types.InvalidArgumentError
+	assert.True(t, errors.As(err, &invalidArgument))
+	assert.Equal(t, "invalid ID: version 123 is not the latest version, roll back version 124 first", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepairChecksums(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	m := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "-- comment\ncreate table {schema}.settings (k int)", CheckSum: "sha256-2"}
+	created := time.Now()
+
+	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	mock.ExpectQuery("select name, source_dir").WillReturnRows(sqlmock.NewRows([]string{"name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).
+		AddRow(m.Name, m.SourceDir, m.File, m.MigrationType, "abc", created, "create table {schema}.settings (k int)", "sha256-1").
+		AddRow(m.Name, m.SourceDir, m.File, m.MigrationType, "def", created, "create table {schema}.settings (k int)", "sha256-1"))
+	mock.ExpectExec("update migrator.migrator_migrations set contents").WithArgs(m.Contents, "sha256-2", m.File).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("insert into migrator.migrator_checksum_repairs").WithArgs(m.File, "sha256-1", "sha256-2", "create table {schema}.settings (k int)", m.Contents, "comment added").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	repairs, err := connector.RepairChecksums([]types.Migration{m}, "comment added")
+	assert.Nil(t, err)
+	assert.Len(t, repairs, 1)
+	assert.Equal(t, int32(2), repairs[0].Schemas)
+	assert.Equal(t, "sha256-1", repairs[0].OldCheckSum)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepairChecksumsNotApplied(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	m := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, CheckSum: "sha256-2"}
+
+	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	expectNoAppliedMigrations(mock)
+	mock.ExpectRollback()
+
+	_, err = connector.RepairChecksums([]types.Migration{m}, "comment added")
+	var notFound *types.NotFoundError
+	assert.True(t, errors.As(err, &notFound))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func expectAcquireLock(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("select pg_try_advisory_xact_lock").WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_xact_lock"}).AddRow(1))
+}
+
+func expectNoArchivedTenants(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("select name from migrator.migrator_archived_tenants").WillReturnRows(sqlmock.NewRows([]string{"name"}))
+}
+
+func expectNoSchemaSnapshots(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("select version_id, db_schema, type, fingerprint, objects from migrator.migrator_schema_snapshots").WillReturnRows(sqlmock.NewRows([]string{"version_id", "db_schema", "type", "fingerprint", "objects"}))
+}
+
+func expectVersionInsert(mock sqlmock.Sqlmock) {
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
+}
+
+func expectNoAppliedMigrations(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("select name, source_dir").WillReturnRows(sqlmock.NewRows([]string{"name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}))
+}
+
+func TestTenantLifecycleCustomTenantSelect(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.TenantSelect = "select somename from someschema.sometable"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	_, _, err = connector.DropTenant("abc", "drop-abc", false)
+	assert.Equal(t, "tenantDelete must be configured when custom tenantSelect is used", err.Error())
+	_, _, err = connector.RenameTenant("abc", "def", "rename-abc")
+	assert.Equal(t, "tenantRename must be configured when custom tenantSelect is used", err.Error())
+
+	config.TenantDelete = "delete from someschema.sometable where somename = $1"
+	mock.ExpectBegin()
+	expectAcquireLock(mock)
+	mock.ExpectQuery("select table_name from information_schema.tables").WithArgs("abc").WillReturnRows(sqlmock.NewRows([]string{"table_name"}).AddRow("settings"))
+	mock.ExpectExec("drop schema if exists abc cascade").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("delete from migrator.migrator_migrations").WithArgs("abc").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("delete from migrator.migrator_tenant_labels").WithArgs("abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("delete from migrator.migrator_archived_tenants").WithArgs("abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("delete from someschema.sometable").WithArgs("abc").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("drop-abc").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery("select").WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow(7, "drop-abc", time.Now(), nil, nil, nil, nil, nil, nil, nil, nil, nil))
+	expectNoSchemaSnapshots(mock)
+	mock.ExpectCommit()
+
+	results, version, err := connector.DropTenant("abc", "drop-abc", false)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(7), results.VersionID)
+	assert.Equal(t, "drop-abc", version.Name)
+	assert.Empty(t, version.DBMigrations)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -7,4 +7,5 @@ if [ -z "$MIGRATOR_YAML" ]; then
   MIGRATOR_YAML=$DEFAULT_YAML_LOCATION
 fi
 
-migrator -configFile "$MIGRATOR_YAML"
+# arguments are passed to migrator, for example: apply -json
+exec migrator -configFile "$MIGRATOR_YAML" "$@"
@@ -72,7 +72,7 @@ func (abl *azureBlobLoader) getClientFactory() AzureBlobClientFactory {
 }
 
 // GetSourceMigrations returns all migrations from Azure Blob location
-func (abl *azureBlobLoader) GetSourceMigrations() []types.Migration {
+func (abl *azureBlobLoader) GetSourceMigrations() ([]types.Migration, error) {
 	// migrator expects that container as a part of the service url
 	// the URL can contain optional prefixes like prod/artefacts
 	// for example:
@@ -80,41 +80,67 @@ func (abl *azureBlobLoader) GetSourceMigrations() []types.Migration {
 	// https://lukaszbudniktest.blob.core.windows.net/mycontainer/prod/artefacts/
 
 	// Parse URL to extract service URL and container name
-	serviceURL, containerName, optionalPrefixes := abl.parseBaseLocation()
+	serviceURL, containerName, optionalPrefixes, err := abl.parseBaseLocation()
+	if err != nil {
+		return nil, err
+	}
 
 	client, err := abl.getClientFactory().NewClient(abl.ctx, serviceURL, containerName)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
 
 	return abl.doGetSourceMigrations(client, containerName, optionalPrefixes)
 }
 
-func (abl *azureBlobLoader) doGetSourceMigrations(client AzureBlobClient, containerName, optionalPrefixes string) []types.Migration {
+func (abl *azureBlobLoader) doGetSourceMigrations(client AzureBlobClient, containerName, optionalPrefixes string) ([]types.Migration, error) {
 	migrations := []types.Migration{}
 
-	singleMigrationsObjects := abl.getObjectList(client, containerName, optionalPrefixes, abl.config.SingleMigrations)
-	tenantMigrationsObjects := abl.getObjectList(client, containerName, optionalPrefixes, abl.config.TenantMigrations)
-	singleScriptsObjects := abl.getObjectList(client, containerName, optionalPrefixes, abl.config.SingleScripts)
-	tenantScriptsObjects := abl.getObjectList(client, containerName, optionalPrefixes, abl.config.TenantScripts)
+	singleMigrationsObjects, err := abl.getObjectList(client, containerName, optionalPrefixes, abl.config.SingleMigrations)
+	if err != nil {
+		return nil, err
+	}
+	tenantMigrationsObjects, err := abl.getObjectList(client, containerName, optionalPrefixes, abl.config.TenantMigrations)
+	if err != nil {
+		return nil, err
+	}
+	singleScriptsObjects, err := abl.getObjectList(client, containerName, optionalPrefixes, abl.config.SingleScripts)
+	if err != nil {
+		return nil, err
+	}
+	tenantScriptsObjects, err := abl.getObjectList(client, containerName, optionalPrefixes, abl.config.TenantScripts)
+	if err != nil {
+		return nil, err
+	}
 
 	migrationsMap := make(map[string][]types.Migration)
-	abl.getObjects(client, containerName, migrationsMap, singleMigrationsObjects, types.MigrationTypeSingleMigration)
-	abl.getObjects(client, containerName, migrationsMap, tenantMigrationsObjects, types.MigrationTypeTenantMigration)
+	if err := abl.getObjects(client, containerName, migrationsMap, singleMigrationsObjects, types.MigrationTypeSingleMigration); err != nil {
+		return nil, err
+	}
+	if err := abl.getObjects(client, containerName, migrationsMap, tenantMigrationsObjects, types.MigrationTypeTenantMigration); err != nil {
+		return nil, err
+	}
+	abl.pairDownMigrations(migrationsMap)
 	abl.sortMigrations(migrationsMap, &migrations)
 
 	migrationsMap = make(map[string][]types.Migration)
-	abl.getObjects(client, containerName, migrationsMap, singleScriptsObjects, types.MigrationTypeSingleScript)
+	if err := abl.getObjects(client, containerName, migrationsMap, singleScriptsObjects, types.MigrationTypeSingleScript); err != nil {
+		return nil, err
+	}
+	abl.pairDownMigrations(migrationsMap)
 	abl.sortMigrations(migrationsMap, &migrations)
 
 	migrationsMap = make(map[string][]types.Migration)
-	abl.getObjects(client, containerName, migrationsMap, tenantScriptsObjects, types.MigrationTypeTenantScript)
+	if err := abl.getObjects(client, containerName, migrationsMap, tenantScriptsObjects, types.MigrationTypeTenantScript); err != nil {
+		return nil, err
+	}
+	abl.pairDownMigrations(migrationsMap)
 	abl.sortMigrations(migrationsMap, &migrations)
 
-	return migrations
+	return migrations, nil
 }
 
-func (abl *azureBlobLoader) getObjectList(client AzureBlobClient, containerName, optionalPrefixes string, prefixes []string) []string {
+func (abl *azureBlobLoader) getObjectList(client AzureBlobClient, containerName, optionalPrefixes string, prefixes []string) ([]string, error) {
 	objects := []string{}
 
 	for _, prefix := range prefixes {
@@ -132,7 +158,7 @@ func (abl *azureBlobLoader) getObjectList(client AzureBlobClient, containerName,
 		for pager.More() {
 			page, err := pager.NextPage(abl.ctx)
 			if err != nil {
-				panic(err.Error())
+				return nil, err
 			}
 
 			for _, blob := range page.Segment.BlobItems {
@@ -143,21 +169,21 @@ func (abl *azureBlobLoader) getObjectList(client AzureBlobClient, containerName,
 		}
 	}
 
-	return objects
+	return objects, nil
 }
 
-func (abl *azureBlobLoader) getObjects(client AzureBlobClient, containerName string, migrationsMap map[string][]types.Migration, objects []string, migrationType types.MigrationType) {
+func (abl *azureBlobLoader) getObjects(client AzureBlobClient, containerName string, migrationsMap map[string][]types.Migration, objects []string, migrationType types.MigrationType) error {
 	for _, o := range objects {
 		response, err := client.DownloadStream(abl.ctx, containerName, o, nil)
 		if err != nil {
-			panic(err.Error())
+			return err
 		}
 
 		contents, err := io.ReadAll(response.Body)
+		response.Body.Close()
 		if err != nil {
-			panic(err.Error())
+			return err
 		}
-		response.Body.Close()
 
 		hasher := sha256.New()
 		hasher.Write(contents)
@@ -166,6 +192,8 @@ func (abl *azureBlobLoader) getObjects(client AzureBlobClient, containerName str
 		sourceDir := file[0:from]
 		name := file[from+1:]
 		m := types.Migration{Name: name, SourceDir: sourceDir, File: file, MigrationType: migrationType, Contents: string(contents), CheckSum: hex.EncodeToString(hasher.Sum(nil))}
+		abl.parseDirectives(&m)
+		abl.markOnChangeScript(&m)
 
 		e, ok := migrationsMap[m.Name]
 		if ok {
@@ -175,10 +203,14 @@ func (abl *azureBlobLoader) getObjects(client AzureBlobClient, containerName str
 		}
 		migrationsMap[m.Name] = e
 	}
+	return nil
 }
 
 func (abl *azureBlobLoader) HealthCheck() error {
-	serviceURL, containerName, prefix := abl.parseBaseLocation()
+	serviceURL, containerName, prefix, err := abl.parseBaseLocation()
+	if err != nil {
+		return err
+	}
 
 	client, err := abl.getClientFactory().NewClient(abl.ctx, serviceURL, containerName)
 	if err != nil {
@@ -197,11 +229,11 @@ func (abl *azureBlobLoader) HealthCheck() error {
 	return nil
 }
 
-func (abl *azureBlobLoader) parseBaseLocation() (string, string, string) {
+func (abl *azureBlobLoader) parseBaseLocation() (string, string, string, error) {
 	baseLocation := strings.TrimSpace(abl.config.BaseLocation)
 	u, err := url.Parse(baseLocation)
 	if err != nil {
-		panic(err)
+		return "", "", "", err
 	}
 
 	serviceURL := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
@@ -218,5 +250,5 @@ func (abl *azureBlobLoader) parseBaseLocation() (string, string, string) {
 		optionalPrefixes = strings.Join(pathComponents[1:], "/")
 	}
 
-	return serviceURL, containerName, optionalPrefixes
+	return serviceURL, containerName, optionalPrefixes, nil
 }
@@ -35,7 +35,8 @@ func TestAzureGetSourceMigrationsIntegration(t *testing.T) {
 		baseLoader:    baseLoader{context.TODO(), config},
 		clientFactory: &defaultAzureBlobClientFactory{},
 	}
-	migrations := loader.GetSourceMigrations()
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
 
 	assert.Len(t, migrations, 12)
 
@@ -74,7 +75,8 @@ func TestAzureGetSourceMigrationsWithOptionalPrefixIntegration(t *testing.T) {
 		baseLoader:    baseLoader{context.TODO(), config},
 		clientFactory: &defaultAzureBlobClientFactory{},
 	}
-	migrations := loader.GetSourceMigrations()
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
 
 	assert.Len(t, migrations, 12)
 
@@ -17,12 +17,12 @@ type diskLoader struct {
 }
 
 // GetSourceMigrations returns all migrations from disk
-func (dl *diskLoader) GetSourceMigrations() []types.Migration {
+func (dl *diskLoader) GetSourceMigrations() ([]types.Migration, error) {
 	migrations := []types.Migration{}
 
 	absBaseDir, err := filepath.Abs(dl.config.BaseLocation)
 	if err != nil {
-		panic(fmt.Sprintf("Could not convert baseLocation to absolute path: %v", err.Error()))
+		return nil, fmt.Errorf("could not convert baseLocation to absolute path: %v", err.Error())
 	}
 
 	singleMigrationsDirs := dl.getDirs(absBaseDir, dl.config.SingleMigrations)
@@ -31,19 +31,30 @@ func (dl *diskLoader) GetSourceMigrations() []types.Migration {
 	tenantScriptsDirs := dl.getDirs(absBaseDir, dl.config.TenantScripts)
 
 	migrationsMap := make(map[string][]types.Migration)
-	dl.readFromDirs(migrationsMap, singleMigrationsDirs, types.MigrationTypeSingleMigration)
-	dl.readFromDirs(migrationsMap, tenantMigrationsDirs, types.MigrationTypeTenantMigration)
+	if err := dl.readFromDirs(migrationsMap, singleMigrationsDirs, types.MigrationTypeSingleMigration); err != nil {
+		return nil, err
+	}
+	if err := dl.readFromDirs(migrationsMap, tenantMigrationsDirs, types.MigrationTypeTenantMigration); err != nil {
+		return nil, err
+	}
+	dl.pairDownMigrations(migrationsMap)
 	dl.sortMigrations(migrationsMap, &migrations)
 
 	migrationsMap = make(map[string][]types.Migration)
-	dl.readFromDirs(migrationsMap, singleScriptsDirs, types.MigrationTypeSingleScript)
+	if err := dl.readFromDirs(migrationsMap, singleScriptsDirs, types.MigrationTypeSingleScript); err != nil {
+		return nil, err
+	}
+	dl.pairDownMigrations(migrationsMap)
 	dl.sortMigrations(migrationsMap, &migrations)
 
 	migrationsMap = make(map[string][]types.Migration)
-	dl.readFromDirs(migrationsMap, tenantScriptsDirs, types.MigrationTypeTenantScript)
+	if err := dl.readFromDirs(migrationsMap, tenantScriptsDirs, types.MigrationTypeTenantScript); err != nil {
+		return nil, err
+	}
+	dl.pairDownMigrations(migrationsMap)
 	dl.sortMigrations(migrationsMap, &migrations)
 
-	return migrations
+	return migrations, nil
 }
 
 func (dl *diskLoader) HealthCheck() error {
@@ -63,23 +74,29 @@ func (dl *diskLoader) getDirs(baseDir string, migrationsDirs []string) []string
 	return filteredDirs
 }
 
-func (dl *diskLoader) readFromDirs(migrations map[string][]types.Migration, sourceDirs []string, migrationType types.MigrationType) {
+func (dl *diskLoader) readFromDirs(migrations map[string][]types.Migration, sourceDirs []string, migrationType types.MigrationType) error {
 	for _, sourceDir := range sourceDirs {
+		// request could be cancelled while reading large directories
+		if err := dl.ctx.Err(); err != nil {
+			return err
+		}
 		files, err := os.ReadDir(sourceDir)
 		if err != nil {
-			panic(fmt.Sprintf("Could not read source dir %v: %v", sourceDir, err.Error()))
+			return fmt.Errorf("could not read source dir %v: %v", sourceDir, err.Error())
 		}
 		for _, file := range files {
 			if !file.IsDir() {
 				fullPath := filepath.Join(sourceDir, file.Name())
 				contents, err := os.ReadFile(fullPath)
 				if err != nil {
-					panic(fmt.Sprintf("Could not read file %v: %v", fullPath, err.Error()))
+					return fmt.Errorf("could not read file %v: %v", fullPath, err.Error())
 				}
 				hasher := sha256.New()
 				hasher.Write([]byte(contents))
 				name := strings.Replace(file.Name(), dl.config.BaseLocation, "", 1)
 				m := types.Migration{Name: name, SourceDir: sourceDir, File: filepath.Join(sourceDir, file.Name()), MigrationType: migrationType, Contents: string(contents), CheckSum: hex.EncodeToString(hasher.Sum(nil))}
+				dl.parseDirectives(&m)
+				dl.markOnChangeScript(&m)
 
 				e, ok := migrations[m.Name]
 				if ok {
@@ -91,4 +108,5 @@ func (dl *diskLoader) readFromDirs(migrations map[string][]types.Migration, sour
 			}
 		}
 	}
+	return nil
 }
@@ -2,6 +2,8 @@ package loader
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/lukaszbudnik/migrator/config"
@@ -15,21 +17,9 @@ func TestDiskReadDiskMigrationsNonExistingBaseLocationError(t *testing.T) {
 
 	loader := New(context.TODO(), &config)
 
-	didPanic := false
-	var message interface{}
-	func() {
-
-		defer func() {
-			if message = recover(); message != nil {
-				didPanic = true
-			}
-		}()
-
-		loader.GetSourceMigrations()
-
-	}()
-	assert.True(t, didPanic)
-	assert.Contains(t, message, "xyzabc/migrations/config: no such file or directory")
+	_, err := loader.GetSourceMigrations()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "xyzabc/migrations/config: no such file or directory")
 }
 
 func TestDiskReadDiskMigrationsNonExistingMigrationsDirError(t *testing.T) {
@@ -39,21 +29,22 @@ func TestDiskReadDiskMigrationsNonExistingMigrationsDirError(t *testing.T) {
 
 	loader := New(context.TODO(), &config)
 
-	didPanic := false
-	var message interface{}
-	func() {
+	_, err := loader.GetSourceMigrations()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "test/migrations/abcdef: no such file or directory")
+}
 
-		defer func() {
-			if message = recover(); message != nil {
-				didPanic = true
-			}
-		}()
+func TestDiskReadDiskMigrationsCancelledContext(t *testing.T) {
+	var config config.Config
+	config.BaseLocation = "../test"
+	config.SingleMigrations = []string{"migrations/config"}
 
-		loader.GetSourceMigrations()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	loader := New(ctx, &config)
 
-	}()
-	assert.True(t, didPanic)
-	assert.Contains(t, message, "test/migrations/abcdef: no such file or directory")
+	_, err := loader.GetSourceMigrations()
+	assert.Equal(t, context.Canceled, err)
 }
 
 func TestDiskGetDiskMigrations(t *testing.T) {
@@ -65,7 +56,8 @@ func TestDiskGetDiskMigrations(t *testing.T) {
 	config.TenantScripts = []string{"migrations/tenants-scripts"}
 
 	loader := New(context.TODO(), &config)
-	migrations := loader.GetSourceMigrations()
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
 
 	assert.Len(t, migrations, 12)
 
@@ -93,3 +85,51 @@ func TestDiskHealthCheck(t *testing.T) {
 	err := loader.HealthCheck()
 	assert.NotNil(t, err)
 }
+
+func TestDiskGetDiskMigrationsWithDownMigrations(t *testing.T) {
+	baseDir := t.TempDir()
+	tenantsDir := filepath.Join(baseDir, "tenants")
+	assert.Nil(t, os.Mkdir(tenantsDir, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(tenantsDir, "201602160001.sql"), []byte("create table {schema}.abc (id int)"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(tenantsDir, "201602160001.down.sql"), []byte("drop table {schema}.abc"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(tenantsDir, "201602160002.sql"), []byte("create table {schema}.def (id int)"), 0644))
+	// orphaned down migration is skipped
+	assert.Nil(t, os.WriteFile(filepath.Join(tenantsDir, "201602160003.down.sql"), []byte("drop table {schema}.xyz"), 0644))
+
+	var config config.Config
+	config.BaseLocation = baseDir
+	config.TenantMigrations = []string{"tenants"}
+
+	loader := New(context.TODO(), &config)
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
+
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, "201602160001.sql", migrations[0].Name)
+	assert.Equal(t, "drop table {schema}.abc", migrations[0].Down)
+	assert.Equal(t, "201602160002.sql", migrations[1].Name)
+	assert.Equal(t, "", migrations[1].Down)
+}
+
+func TestDiskGetDiskMigrationsWithNoTransactionDirective(t *testing.T) {
+	baseDir := t.TempDir()
+	tenantsDir := filepath.Join(baseDir, "tenants")
+	assert.Nil(t, os.Mkdir(tenantsDir, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(tenantsDir, "201602160001.sql"), []byte("-- migrator: transaction=false\ncreate index concurrently if not exists abc_idx on {schema}.abc (id)"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(tenantsDir, "201602160002.sql"), []byte("-- migrator: transaction=true\ncreate table {schema}.def (id int)"), 0644))
+	// directive is read only from the leading comment lines
+	assert.Nil(t, os.WriteFile(filepath.Join(tenantsDir, "201602160003.sql"), []byte("create table {schema}.ghi (id int);\n-- migrator: transaction=false"), 0644))
+
+	var config config.Config
+	config.BaseLocation = baseDir
+	config.TenantMigrations = []string{"tenants"}
+
+	loader := New(context.TODO(), &config)
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
+
+	assert.Len(t, migrations, 3)
+	assert.True(t, migrations[0].NoTransaction)
+	assert.False(t, migrations[1].NoTransaction)
+	assert.False(t, migrations[2].NoTransaction)
+}
@@ -0,0 +1,105 @@
+package loader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// fsLoader is struct used for implementing Loader interface for loading migrations from fs.FS, for example embed.FS
+type fsLoader struct {
+	baseLoader
+	fsys fs.FS
+}
+
+// NewFS returns Factory which creates Loader reading migrations from fsys
+// baseLocation is a slash-separated directory inside fsys, empty baseLocation means the root of fsys
+func NewFS(fsys fs.FS) Factory {
+	return func(ctx context.Context, config *config.Config) Loader {
+		return &fsLoader{baseLoader{ctx, config}, fsys}
+	}
+}
+
+// GetSourceMigrations returns all migrations from fs.FS
+func (fl *fsLoader) GetSourceMigrations() ([]types.Migration, error) {
+	migrations := []types.Migration{}
+
+	migrationsMap := make(map[string][]types.Migration)
+	if err := fl.readFromDirs(migrationsMap, fl.config.SingleMigrations, types.MigrationTypeSingleMigration); err != nil {
+		return nil, err
+	}
+	if err := fl.readFromDirs(migrationsMap, fl.config.TenantMigrations, types.MigrationTypeTenantMigration); err != nil {
+		return nil, err
+	}
+	fl.pairDownMigrations(migrationsMap)
+	fl.sortMigrations(migrationsMap, &migrations)
+
+	migrationsMap = make(map[string][]types.Migration)
+	if err := fl.readFromDirs(migrationsMap, fl.config.SingleScripts, types.MigrationTypeSingleScript); err != nil {
+		return nil, err
+	}
+	fl.pairDownMigrations(migrationsMap)
+	fl.sortMigrations(migrationsMap, &migrations)
+
+	migrationsMap = make(map[string][]types.Migration)
+	if err := fl.readFromDirs(migrationsMap, fl.config.TenantScripts, types.MigrationTypeTenantScript); err != nil {
+		return nil, err
+	}
+	fl.pairDownMigrations(migrationsMap)
+	fl.sortMigrations(migrationsMap, &migrations)
+
+	return migrations, nil
+}
+
+func (fl *fsLoader) HealthCheck() error {
+	_, err := fs.ReadDir(fl.fsys, fl.baseDir())
+	return err
+}
+
+// baseDir returns baseLocation as a valid fs.FS path
+func (fl *fsLoader) baseDir() string {
+	baseDir := strings.Trim(fl.config.BaseLocation, "/")
+	if baseDir == "" {
+		return "."
+	}
+	return path.Clean(baseDir)
+}
+
+func (fl *fsLoader) readFromDirs(migrations map[string][]types.Migration, dirs []string, migrationType types.MigrationType) error {
+	for _, dir := range dirs {
+		// request could be cancelled while reading large directories
+		if err := fl.ctx.Err(); err != nil {
+			return err
+		}
+		sourceDir := path.Join(fl.baseDir(), dir)
+		files, err := fs.ReadDir(fl.fsys, sourceDir)
+		if err != nil {
+			return fmt.Errorf("could not read source dir %v: %v", sourceDir, err.Error())
+		}
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			file := path.Join(sourceDir, file.Name())
+			contents, err := fs.ReadFile(fl.fsys, file)
+			if err != nil {
+				return fmt.Errorf("could not read file %v: %v", file, err.Error())
+			}
+			hasher := sha256.New()
+			hasher.Write(contents)
+			m := types.Migration{Name: path.Base(file), SourceDir: sourceDir, File: file, MigrationType: migrationType, Contents: string(contents), CheckSum: hex.EncodeToString(hasher.Sum(nil))}
+			fl.parseDirectives(&m)
+			fl.markOnChangeScript(&m)
+
+			migrations[m.Name] = append(migrations[m.Name], m)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package loader
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+func newTestFS() fstest.MapFS {
+	return fstest.MapFS{
+		"migrations/config/201602160002.sql":       {Data: []byte("create table {schema}.config (id integer)")},
+		"migrations/config/201602160001.sql":       {Data: []byte("create schema config")},
+		"migrations/tenants/201602160002.sql":      {Data: []byte("-- migrator: timeout=5m\ncreate table {schema}.orders (id integer)")},
+		"migrations/tenants/201602160002.down.sql": {Data: []byte("drop table {schema}.orders")},
+		"migrations/tenants-scripts/views.sql":     {Data: []byte("create or replace view {schema}.v as select 1")},
+		"migrations/tenants/nested/ignored.sql":    {Data: []byte("select 1")},
+	}
+}
+
+func TestFSGetSourceMigrations(t *testing.T) {
+	config := &config.Config{
+		BaseLocation:     "migrations",
+		SingleMigrations: []string{"config"},
+		TenantMigrations: []string{"tenants"},
+		TenantScripts:    []string{"tenants-scripts"},
+		OnChangeScripts:  []string{"tenants-scripts"},
+	}
+
+	loader := NewFS(newTestFS())(context.TODO(), config)
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
+
+	assert.Len(t, migrations, 4)
+	assert.Equal(t, "migrations/config/201602160001.sql", migrations[0].File)
+	assert.Equal(t, "migrations/config/201602160002.sql", migrations[1].File)
+	assert.Equal(t, "migrations/tenants/201602160002.sql", migrations[2].File)
+	assert.Equal(t, "migrations/tenants-scripts/views.sql", migrations[3].File)
+
+	assert.Equal(t, "201602160001.sql", migrations[0].Name)
+	assert.Equal(t, "migrations/config", migrations[0].SourceDir)
+	assert.Equal(t, types.MigrationTypeSingleMigration, migrations[0].MigrationType)
+	assert.Equal(t, "create schema config", migrations[0].Contents)
+	assert.Equal(t, "1baa1e3901f6af430eea9b8f13410ffd65adf5603733962d339fe8987fa560d3", migrations[0].CheckSum)
+
+	assert.Equal(t, types.MigrationTypeTenantMigration, migrations[2].MigrationType)
+	assert.Equal(t, "drop table {schema}.orders", migrations[2].Down)
+	assert.Equal(t, "5m0s", migrations[2].Timeout.String())
+
+	assert.Equal(t, types.MigrationTypeTenantScript, migrations[3].MigrationType)
+	assert.True(t, migrations[3].OnChange)
+
+	assert.Nil(t, loader.HealthCheck())
+}
+
+func TestFSGetSourceMigrationsRootBaseLocation(t *testing.T) {
+	config := &config.Config{SingleMigrations: []string{"migrations/config"}}
+
+	loader := NewFS(newTestFS())(context.TODO(), config)
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, "migrations/config", migrations[0].SourceDir)
+	assert.Nil(t, loader.HealthCheck())
+}
+
+func TestFSGetSourceMigrationsNonExistingDirError(t *testing.T) {
+	config := &config.Config{BaseLocation: "migrations", SingleMigrations: []string{"abcdef"}}
+
+	loader := NewFS(newTestFS())(context.TODO(), config)
+	_, err := loader.GetSourceMigrations()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "could not read source dir migrations/abcdef")
+
+	config.BaseLocation = "xyzabc"
+	assert.NotNil(t, loader.HealthCheck())
+}
+
+func TestFSGetSourceMigrationsCancelledContext(t *testing.T) {
+	config := &config.Config{BaseLocation: "migrations", SingleMigrations: []string{"config"}}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	loader := NewFS(newTestFS())(ctx, config)
+	_, err := loader.GetSourceMigrations()
+	assert.Equal(t, context.Canceled, err)
+}
@@ -2,17 +2,22 @@ package loader
 
 import (
 	"context"
+	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
+	"github.com/lukaszbudnik/migrator/common"
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
 // Loader interface abstracts all loading operations performed by migrator
 type Loader interface {
-	GetSourceMigrations() []types.Migration
+	GetSourceMigrations() ([]types.Migration, error)
 	HealthCheck() error
 }
 
@@ -37,6 +42,13 @@ func New(ctx context.Context, config *config.Config) Loader {
 	return &diskLoader{baseLoader{ctx, config}}
 }
 
+// downMigrationInfix marks down migrations, for example 201602160003.down.sql is a down migration of 201602160003.sql
+const downMigrationInfix = ".down."
+
+// directivePrefix marks migrator directives in the leading comment lines of a migration, for example:
+// -- migrator: transaction=false, timeout=5m
+const directivePrefix = "-- migrator:"
+
 // baseLoader is the base struct for implementing Loader interface
 type baseLoader struct {
 	ctx    context.Context
@@ -55,3 +67,84 @@ func (bl *baseLoader) sortMigrations(migrationsMap map[string][]types.Migration,
 		*migrations = append(*migrations, ms...)
 	}
 }
+
+// pairDownMigrations removes down migrations from migrationsMap and stores their contents
+// in the Down field of the up migration with the same name and source dir
+// down migrations without matching up migration are skipped
+func (bl *baseLoader) pairDownMigrations(migrationsMap map[string][]types.Migration) {
+	for key, ms := range migrationsMap {
+		if !strings.Contains(key, downMigrationInfix) {
+			continue
+		}
+		upKey := strings.Replace(key, downMigrationInfix, ".", 1)
+		for _, down := range ms {
+			paired := false
+			for i := range migrationsMap[upKey] {
+				if migrationsMap[upKey][i].SourceDir == down.SourceDir {
+					migrationsMap[upKey][i].Down = down.Contents
+					paired = true
+				}
+			}
+			if !paired {
+				common.LogWarn(bl.ctx, "Down migration without matching up migration skipped: %v", down.File)
+			}
+		}
+		delete(migrationsMap, key)
+	}
+}
+
+// parseDirectives reads directives from the leading comment lines of the migration and sets corresponding Migration fields
+// unknown directives and invalid values are skipped
+func (bl *baseLoader) parseDirectives(m *types.Migration) {
+	for _, line := range strings.Split(m.Contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		if !strings.HasPrefix(line, directivePrefix) {
+			continue
+		}
+		directives := strings.FieldsFunc(strings.TrimPrefix(line, directivePrefix), func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})
+		for _, directive := range directives {
+			key, value, _ := strings.Cut(directive, "=")
+			switch key {
+			case "transaction":
+				transaction, err := strconv.ParseBool(value)
+				if err != nil {
+					common.LogWarn(bl.ctx, "Invalid directive %v in migration %v skipped", directive, m.File)
+					continue
+				}
+				m.NoTransaction = !transaction
+			case "timeout":
+				timeout, err := time.ParseDuration(value)
+				if err != nil || timeout <= 0 {
+					common.LogWarn(bl.ctx, "Invalid directive %v in migration %v skipped", directive, m.File)
+					continue
+				}
+				m.Timeout = timeout
+			default:
+				common.LogWarn(bl.ctx, "Unknown directive %v in migration %v skipped", directive, m.File)
+			}
+		}
+	}
+}
+
+// markOnChangeScript sets OnChange for scripts loaded from directories listed in onChangeScripts
+func (bl *baseLoader) markOnChangeScript(m *types.Migration) {
+	if m.MigrationType != types.MigrationTypeSingleScript && m.MigrationType != types.MigrationTypeTenantScript {
+		return
+	}
+	sourceDir := strings.TrimSuffix(filepath.ToSlash(m.SourceDir), "/")
+	for _, dir := range bl.config.OnChangeScripts {
+		dir = strings.Trim(filepath.ToSlash(dir), "/")
+		if sourceDir == dir || strings.HasSuffix(sourceDir, "/"+dir) {
+			m.OnChange = true
+			return
+		}
+	}
+}
@@ -3,8 +3,10 @@ package loader
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -31,3 +33,50 @@ func TestNewS3Loader(t *testing.T) {
 	loader := New(context.TODO(), config)
 	assert.IsType(t, &s3Loader{}, loader)
 }
+
+func TestParseDirectives(t *testing.T) {
+	bl := &baseLoader{ctx: context.TODO(), config: &config.Config{}}
+
+	m := types.Migration{File: "tenants/201602160001.sql", Contents: "\n-- add index without locking the table\n-- migrator: transaction=false, unknown=1\ncreate index concurrently abc_idx on {schema}.abc (id)"}
+	bl.parseDirectives(&m)
+	assert.True(t, m.NoTransaction)
+
+	m = types.Migration{File: "tenants/201602160002.sql", Contents: "-- migrator: transaction=maybe\ncreate table {schema}.abc (id int)"}
+	bl.parseDirectives(&m)
+	assert.False(t, m.NoTransaction)
+
+	m = types.Migration{File: "tenants/201602160003.sql", Contents: "-- migrator:transaction=false\n-- migrator: transaction=true\ncreate table {schema}.abc (id int)"}
+	bl.parseDirectives(&m)
+	assert.False(t, m.NoTransaction)
+
+	m = types.Migration{File: "tenants/201602160004.sql", Contents: "-- migrator: transaction=false, timeout=5m\ncreate index concurrently abc_idx on {schema}.abc (id)"}
+	bl.parseDirectives(&m)
+	assert.True(t, m.NoTransaction)
+	assert.Equal(t, 5*time.Minute, m.Timeout)
+
+	m = types.Migration{File: "tenants/201602160005.sql", Contents: "-- migrator: timeout=forever\ncreate table {schema}.abc (id int)"}
+	bl.parseDirectives(&m)
+	assert.Equal(t, time.Duration(0), m.Timeout)
+}
+
+func TestMarkOnChangeScript(t *testing.T) {
+	bl := &baseLoader{ctx: context.TODO(), config: &config.Config{OnChangeScripts: []string{"migrations/tenants-scripts/"}}}
+
+	m := types.Migration{SourceDir: "/opt/app/test/migrations/tenants-scripts", MigrationType: types.MigrationTypeTenantScript}
+	bl.markOnChangeScript(&m)
+	assert.True(t, m.OnChange)
+
+	m = types.Migration{SourceDir: "s3://bucket/migrations/tenants-scripts", MigrationType: types.MigrationTypeTenantScript}
+	bl.markOnChangeScript(&m)
+	assert.True(t, m.OnChange)
+
+	// directory name must match as a whole
+	m = types.Migration{SourceDir: "/opt/app/test/migrations/other-tenants-scripts", MigrationType: types.MigrationTypeTenantScript}
+	bl.markOnChangeScript(&m)
+	assert.False(t, m.OnChange)
+
+	// migrations are never on-change
+	m = types.Migration{SourceDir: "/opt/app/test/migrations/tenants-scripts", MigrationType: types.MigrationTypeTenantMigration}
+	bl.markOnChangeScript(&m)
+	assert.False(t, m.OnChange)
+}
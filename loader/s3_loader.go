@@ -28,7 +28,7 @@ type S3ListObjectsV2Paginator interface {
 
 // S3ClientFactory creates S3 clients
 type S3ClientFactory interface {
-	NewClient(ctx context.Context) S3APIClient
+	NewClient(ctx context.Context) (S3APIClient, error)
 }
 
 // S3PaginatorFactory creates paginators
@@ -46,12 +46,12 @@ type s3Loader struct {
 // defaultS3ClientFactory implements S3ClientFactory
 type defaultS3ClientFactory struct{}
 
-func (f *defaultS3ClientFactory) NewClient(ctx context.Context) S3APIClient {
+func (f *defaultS3ClientFactory) NewClient(ctx context.Context) (S3APIClient, error) {
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
-	return s3.NewFromConfig(cfg)
+	return s3.NewFromConfig(cfg), nil
 }
 
 // defaultS3PaginatorFactory implements S3PaginatorFactory
@@ -76,13 +76,19 @@ func (s3l *s3Loader) getClientFactory() S3ClientFactory {
 }
 
 // GetSourceMigrations returns all migrations from AWS S3 location
-func (s3l *s3Loader) GetSourceMigrations() []types.Migration {
-	client := s3l.getClientFactory().NewClient(s3l.ctx)
+func (s3l *s3Loader) GetSourceMigrations() ([]types.Migration, error) {
+	client, err := s3l.getClientFactory().NewClient(s3l.ctx)
+	if err != nil {
+		return nil, err
+	}
 	return s3l.doGetSourceMigrations(client)
 }
 
 func (s3l *s3Loader) HealthCheck() error {
-	client := s3l.getClientFactory().NewClient(s3l.ctx)
+	client, err := s3l.getClientFactory().NewClient(s3l.ctx)
+	if err != nil {
+		return err
+	}
 	return s3l.doHealthCheck(client)
 }
 
@@ -106,7 +112,7 @@ func (s3l *s3Loader) doHealthCheck(client S3APIClient) error {
 	return err
 }
 
-func (s3l *s3Loader) doGetSourceMigrations(client S3APIClient) []types.Migration {
+func (s3l *s3Loader) doGetSourceMigrations(client S3APIClient) ([]types.Migration, error) {
 	migrations := []types.Migration{}
 
 	bucketWithPrefixes := strings.Split(strings.Replace(strings.TrimRight(s3l.config.BaseLocation, "/"), "s3://", "", 1), "/")
@@ -117,28 +123,51 @@ func (s3l *s3Loader) doGetSourceMigrations(client S3APIClient) []types.Migration
 		optionalPrefixes = strings.Join(bucketWithPrefixes[1:], "/")
 	}
 
-	singleMigrationsObjects := s3l.getObjectList(client, bucket, optionalPrefixes, s3l.config.SingleMigrations)
-	tenantMigrationsObjects := s3l.getObjectList(client, bucket, optionalPrefixes, s3l.config.TenantMigrations)
-	singleScriptsObjects := s3l.getObjectList(client, bucket, optionalPrefixes, s3l.config.SingleScripts)
-	tenantScriptsObjects := s3l.getObjectList(client, bucket, optionalPrefixes, s3l.config.TenantScripts)
+	singleMigrationsObjects, err := s3l.getObjectList(client, bucket, optionalPrefixes, s3l.config.SingleMigrations)
+	if err != nil {
+		return nil, err
+	}
+	tenantMigrationsObjects, err := s3l.getObjectList(client, bucket, optionalPrefixes, s3l.config.TenantMigrations)
+	if err != nil {
+		return nil, err
+	}
+	singleScriptsObjects, err := s3l.getObjectList(client, bucket, optionalPrefixes, s3l.config.SingleScripts)
+	if err != nil {
+		return nil, err
+	}
+	tenantScriptsObjects, err := s3l.getObjectList(client, bucket, optionalPrefixes, s3l.config.TenantScripts)
+	if err != nil {
+		return nil, err
+	}
 
 	migrationsMap := make(map[string][]types.Migration)
-	s3l.getObjects(client, bucket, migrationsMap, singleMigrationsObjects, types.MigrationTypeSingleMigration)
-	s3l.getObjects(client, bucket, migrationsMap, tenantMigrationsObjects, types.MigrationTypeTenantMigration)
+	if err := s3l.getObjects(client, bucket, migrationsMap, singleMigrationsObjects, types.MigrationTypeSingleMigration); err != nil {
+		return nil, err
+	}
+	if err := s3l.getObjects(client, bucket, migrationsMap, tenantMigrationsObjects, types.MigrationTypeTenantMigration); err != nil {
+		return nil, err
+	}
+	s3l.pairDownMigrations(migrationsMap)
 	s3l.sortMigrations(migrationsMap, &migrations)
 
 	migrationsMap = make(map[string][]types.Migration)
-	s3l.getObjects(client, bucket, migrationsMap, singleScriptsObjects, types.MigrationTypeSingleScript)
+	if err := s3l.getObjects(client, bucket, migrationsMap, singleScriptsObjects, types.MigrationTypeSingleScript); err != nil {
+		return nil, err
+	}
+	s3l.pairDownMigrations(migrationsMap)
 	s3l.sortMigrations(migrationsMap, &migrations)
 
 	migrationsMap = make(map[string][]types.Migration)
-	s3l.getObjects(client, bucket, migrationsMap, tenantScriptsObjects, types.MigrationTypeTenantScript)
+	if err := s3l.getObjects(client, bucket, migrationsMap, tenantScriptsObjects, types.MigrationTypeTenantScript); err != nil {
+		return nil, err
+	}
+	s3l.pairDownMigrations(migrationsMap)
 	s3l.sortMigrations(migrationsMap, &migrations)
 
-	return migrations
+	return migrations, nil
 }
 
-func (s3l *s3Loader) getObjectList(client S3APIClient, bucket, optionalPrefixes string, prefixes []string) []*string {
+func (s3l *s3Loader) getObjectList(client S3APIClient, bucket, optionalPrefixes string, prefixes []string) ([]*string, error) {
 	objects := []*string{}
 
 	for _, prefix := range prefixes {
@@ -160,7 +189,7 @@ func (s3l *s3Loader) getObjectList(client S3APIClient, bucket, optionalPrefixes
 		for paginator.HasMorePages() {
 			page, err := paginator.NextPage(s3l.ctx)
 			if err != nil {
-				panic(err.Error())
+				return nil, err
 			}
 			for _, obj := range page.Contents {
 				objects = append(objects, obj.Key)
@@ -168,10 +197,10 @@ func (s3l *s3Loader) getObjectList(client S3APIClient, bucket, optionalPrefixes
 		}
 	}
 
-	return objects
+	return objects, nil
 }
 
-func (s3l *s3Loader) getObjects(client S3APIClient, bucket string, migrationsMap map[string][]types.Migration, objects []*string, migrationType types.MigrationType) {
+func (s3l *s3Loader) getObjects(client S3APIClient, bucket string, migrationsMap map[string][]types.Migration, objects []*string, migrationType types.MigrationType) error {
 
 	for _, o := range objects {
 		input := &s3.GetObjectInput{
@@ -180,12 +209,13 @@ func (s3l *s3Loader) getObjects(client S3APIClient, bucket string, migrationsMap
 		}
 		object, err := client.GetObject(s3l.ctx, input)
 		if err != nil {
-			panic(err.Error())
+			return err
 		}
 
 		contents, err := io.ReadAll(object.Body)
+		object.Body.Close()
 		if err != nil {
-			panic(err.Error())
+			return err
 		}
 
 		hasher := sha256.New()
@@ -195,6 +225,8 @@ func (s3l *s3Loader) getObjects(client S3APIClient, bucket string, migrationsMap
 		sourceDir := file[0:from]
 		name := file[from+1:]
 		m := types.Migration{Name: name, SourceDir: sourceDir, File: file, MigrationType: migrationType, Contents: string(contents), CheckSum: hex.EncodeToString(hasher.Sum(nil))}
+		s3l.parseDirectives(&m)
+		s3l.markOnChangeScript(&m)
 
 		e, ok := migrationsMap[m.Name]
 		if ok {
@@ -204,4 +236,5 @@ func (s3l *s3Loader) getObjects(client S3APIClient, bucket string, migrationsMap
 		}
 		migrationsMap[m.Name] = e
 	}
+	return nil
 }
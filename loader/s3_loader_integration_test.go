@@ -33,7 +33,8 @@ func TestS3GetSourceMigrationsIntegration(t *testing.T) {
 		paginatorFactory: &defaultS3PaginatorFactory{},
 	}
 
-	migrations := loader.GetSourceMigrations()
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
 
 	assert.Len(t, migrations, 16)
 
@@ -78,7 +79,8 @@ func TestS3GetSourceMigrationsBucketWithPrefixIntegration(t *testing.T) {
 		paginatorFactory: &defaultS3PaginatorFactory{},
 	}
 
-	migrations := loader.GetSourceMigrations()
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
 
 	assert.Len(t, migrations, 16)
 
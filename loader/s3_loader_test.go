@@ -29,8 +29,8 @@ type mockS3ClientFactory struct {
 	client S3APIClient
 }
 
-func (f *mockS3ClientFactory) NewClient(ctx context.Context) S3APIClient {
-	return f.client
+func (f *mockS3ClientFactory) NewClient(ctx context.Context) (S3APIClient, error) {
+	return f.client, nil
 }
 
 type mockS3PaginatorFactory struct{}
@@ -129,7 +129,8 @@ func TestS3GetSourceMigrations(t *testing.T) {
 		paginatorFactory: &mockS3PaginatorFactory{},
 	}
 
-	migrations := loader.doGetSourceMigrations(loader.getClientFactory().NewClient(context.TODO()))
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
 
 	assert.Len(t, migrations, 12)
 
@@ -164,7 +165,8 @@ func TestS3GetSourceMigrationsBucketWithPrefix(t *testing.T) {
 		clientFactory:    &mockS3ClientFactory{client: mock},
 		paginatorFactory: &mockS3PaginatorFactory{},
 	}
-	migrations := loader.doGetSourceMigrations(loader.getClientFactory().NewClient(context.TODO()))
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
 
 	assert.Len(t, migrations, 12)
 
@@ -198,7 +200,7 @@ func TestS3HealthCheck(t *testing.T) {
 		clientFactory:    &mockS3ClientFactory{client: mock},
 		paginatorFactory: &mockS3PaginatorFactory{},
 	}
-	err := loader.doHealthCheck(loader.getClientFactory().NewClient(context.TODO()))
+	err := loader.HealthCheck()
 
 	assert.Nil(t, err)
 }
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DBStatsFunc returns statistics of connection pools keyed by target name, targets without a pool are not returned
+type DBStatsFunc func() map[string]sql.DBStats
+
+// dbStatsCollector publishes sql.DBStats, statistics are read on every scrape
+type dbStatsCollector struct {
+	stats DBStatsFunc
+
+	maxOpenConnections *prometheus.Desc
+	openConnections    *prometheus.Desc
+	inUse              *prometheus.Desc
+	idle               *prometheus.Desc
+	waitCount          *prometheus.Desc
+	waitDuration       *prometheus.Desc
+	maxIdleClosed      *prometheus.Desc
+	maxIdleTimeClosed  *prometheus.Desc
+	maxLifetimeClosed  *prometheus.Desc
+}
+
+// NewDBStatsCollector returns Prometheus collector which publishes connection pool statistics as migrator_db_* metrics labeled with target
+func NewDBStatsCollector(stats DBStatsFunc) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("migrator", "db", name), help, []string{"target"}, nil)
+	}
+	return &dbStatsCollector{
+		stats:              stats,
+		maxOpenConnections: desc("max_open_connections", "Maximum number of open connections to the database"),
+		openConnections:    desc("open_connections", "The number of established connections both in use and idle"),
+		inUse:              desc("in_use_connections", "The number of connections currently in use"),
+		idle:               desc("idle_connections", "The number of idle connections"),
+		waitCount:          desc("wait_count_total", "The total number of connections waited for"),
+		waitDuration:       desc("wait_duration_seconds_total", "The total time blocked waiting for a new connection"),
+		maxIdleClosed:      desc("max_idle_closed_total", "The total number of connections closed due to maxIdleConns"),
+		maxIdleTimeClosed:  desc("max_idle_time_closed_total", "The total number of connections closed due to max idle time"),
+		maxLifetimeClosed:  desc("max_lifetime_closed_total", "The total number of connections closed due to connMaxLifetime"),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpenConnections
+	ch <- c.openConnections
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxIdleTimeClosed
+	ch <- c.maxLifetimeClosed
+}
+
+// Collect implements prometheus.Collector
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	for target, stats := range c.stats() {
+		ch <- prometheus.MustNewConstMetric(c.maxOpenConnections, prometheus.GaugeValue, float64(stats.MaxOpenConnections), target)
+		ch <- prometheus.MustNewConstMetric(c.openConnections, prometheus.GaugeValue, float64(stats.OpenConnections), target)
+		ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse), target)
+		ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle), target)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount), target)
+		ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds(), target)
+		ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed), target)
+		ch <- prometheus.MustNewConstMetric(c.maxIdleTimeClosed, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed), target)
+		ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed), target)
+	}
+}
@@ -35,3 +35,27 @@ func (m *prometheusMetrics) AddGaugeValue(name string, labelValues []string, val
 func (m *prometheusMetrics) IncrementGaugeValue(name string, labelValues []string) error {
 	return m.prometheus.IncrementGaugeValue(name, labelValues)
 }
+
+// NewNoop returns Metrics which discard all values, it is used when migrator runs a command without starting the HTTP server
+func NewNoop() Metrics {
+	return &noopMetrics{}
+}
+
+// noopMetrics is struct for discarding metrics
+type noopMetrics struct {
+}
+
+// SetGaugeValue does nothing
+func (m *noopMetrics) SetGaugeValue(name string, labelValues []string, value float64) error {
+	return nil
+}
+
+// AddGaugeValue does nothing
+func (m *noopMetrics) AddGaugeValue(name string, labelValues []string, value float64) error {
+	return nil
+}
+
+// IncrementGaugeValue does nothing
+func (m *noopMetrics) IncrementGaugeValue(name string, labelValues []string) error {
+	return nil
+}
@@ -1,12 +1,17 @@
 package metrics
 
 import (
+	"database/sql"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Depado/ginprom"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,3 +50,45 @@ func TestMetrics(t *testing.T) {
 	assert.Contains(t, w.Body.String(), `migrator_gin_gauge{type="first"} 2`)
 	assert.Contains(t, w.Body.String(), `migrator_gin_gauge{type="second"} 2`)
 }
+
+func TestDBStatsCollector(t *testing.T) {
+	stats := func() map[string]sql.DBStats {
+		return map[string]sql.DBStats{
+			"default": {MaxOpenConnections: 10, OpenConnections: 3, InUse: 1, Idle: 2, WaitCount: 5, WaitDuration: 2 * time.Second},
+			"orders":  {OpenConnections: 1, Idle: 1},
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewDBStatsCollector(stats))
+
+	expected := `
+# HELP migrator_db_in_use_connections The number of connections currently in use
+# TYPE migrator_db_in_use_connections gauge
+migrator_db_in_use_connections{target="default"} 1
+migrator_db_in_use_connections{target="orders"} 0
+# HELP migrator_db_open_connections The number of established connections both in use and idle
+# TYPE migrator_db_open_connections gauge
+migrator_db_open_connections{target="default"} 3
+migrator_db_open_connections{target="orders"} 1
+# HELP migrator_db_wait_duration_seconds_total The total time blocked waiting for a new connection
+# TYPE migrator_db_wait_duration_seconds_total counter
+migrator_db_wait_duration_seconds_total{target="default"} 2
+migrator_db_wait_duration_seconds_total{target="orders"} 0
+`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "migrator_db_in_use_connections", "migrator_db_open_connections", "migrator_db_wait_duration_seconds_total")
+	assert.Nil(t, err)
+}
+
+func TestDBStatsCollectorNoPool(t *testing.T) {
+	stats := func() map[string]sql.DBStats {
+		return map[string]sql.DBStats{}
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewDBStatsCollector(stats))
+
+	count, err := testutil.GatherAndCount(registry)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
@@ -5,8 +5,11 @@ import (
 	"context"
 	"flag"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lukaszbudnik/migrator/cli"
 	"github.com/lukaszbudnik/migrator/common"
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/lukaszbudnik/migrator/coordinator"
@@ -57,6 +60,24 @@ func main() {
 		return coordinator
 	}
 
+	// commands run a single operation and exit without starting the HTTP server
+	// interrupted command cancels its context and the version transaction is rolled back
+	if flag.NArg() > 0 {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		ctx = context.WithValue(ctx, common.LogLevelKey{}, cfg.LogLevel)
+		ctx = context.WithValue(ctx, common.RequestIDKey{}, flag.Arg(0))
+		code := cli.Run(ctx, flag.Args(), os.Stdout, os.Stderr, cfg, createCoordinator)
+		stop()
+		os.Exit(code)
+	}
+
+	// shared connection pools are opened at startup, connecting is retried connectRetries times
+	// only the default target is required, named targets which are not available are connected on first request
+	if err := db.ConnectTargets(context.Background(), cfg); err != nil {
+		common.Log("ERROR", "Error connecting to database: %v", err)
+		os.Exit(1)
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 	g := server.CreateRouterAndPrometheus(versionInfo, cfg, createCoordinator)
 	if err := g.Run(":" + server.GetPort(cfg)); err != nil {
@@ -27,6 +27,7 @@ type Notifier interface {
 
 // baseNotifier type is a base struct embedded by all implementations of Notifier interface
 type baseNotifier struct {
+	ctx    context.Context
 	config *config.Config
 }
 
@@ -58,7 +59,7 @@ func (bn *baseNotifier) Notify(summary *types.Summary) (string, error) {
 	reader := bytes.NewReader([]byte(payload))
 	url := bn.config.WebHookURL
 
-	req, err := http.NewRequest(http.MethodPost, url, reader)
+	req, err := http.NewRequestWithContext(bn.ctx, http.MethodPost, url, reader)
 	if err != nil {
 		return "", err
 	}
@@ -102,8 +103,8 @@ type Factory func(context.Context, *config.Config) Notifier
 func New(ctx context.Context, config *config.Config) Notifier {
 	// webhook URL is required
 	if len(config.WebHookURL) > 0 {
-		return &baseNotifier{config}
+		return &baseNotifier{ctx, config}
 	}
 	// otherwise return noop
-	return &noopNotifier{baseNotifier{config}}
+	return &noopNotifier{baseNotifier{ctx, config}}
 }
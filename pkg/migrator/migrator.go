@@ -0,0 +1,111 @@
+// Package migrator lets Go applications run migrations in-process, for example at startup, without the HTTP server and migrator.yaml
+//
+// Migrations can be shipped together with the application using embed.FS:
+//
+//	//go:embed migrations
+//	var migrations embed.FS
+//
+//	results, err := migrator.Run(ctx, migrator.Options{
+//		Config: &config.Config{
+//			BaseLocation:     "migrations",
+//			Driver:           "postgres",
+//			DataSource:       os.Getenv("DATABASE_URL"),
+//			SingleMigrations: []string{"ref"},
+//			TenantMigrations: []string{"tenants"},
+//		},
+//		FS:          migrations,
+//		VersionName: buildVersion,
+//	})
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/db"
+	"github.com/lukaszbudnik/migrator/loader"
+	"github.com/lukaszbudnik/migrator/metrics"
+	"github.com/lukaszbudnik/migrator/notifications"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// Options contains configuration and arguments of Run
+type Options struct {
+	// Config is the same configuration as the one read from migrator.yaml, only options related to migrations are used
+	Config *config.Config
+	// FS contains source migrations, Config.BaseLocation is a slash-separated directory inside FS
+	// when FS is nil migrations are loaded from Config.BaseLocation (disk, AWS S3, or Azure Blob Storage)
+	FS fs.FS
+	// Target is the name of a target defined in Config.Targets, the default target is used when empty
+	Target string
+	// VersionName is the name of the created version, required by Run
+	VersionName string
+	Action      types.Action
+	DryRun      bool
+	// Selector is a label selector, when not empty tenant migrations are applied only to matching tenants
+	Selector string
+	// PlanHash is optional, when set Run refuses to apply migrations if hash of the current plan differs from it
+	PlanHash string
+	// Metrics are optional, migrator metrics are discarded when nil
+	Metrics metrics.Metrics
+}
+
+// New validates config and returns Coordinator which uses migrator DB connectors, Coordinator must be disposed by the caller
+// panics raised while creating Coordinator (for example for unknown driver) are returned as errors
+func New(ctx context.Context, options Options) (c coordinator.Coordinator, err error) {
+	if options.Config == nil {
+		return nil, &types.InvalidArgumentError{Argument: "config", Err: fmt.Errorf("config is required")}
+	}
+	if err := options.Config.Validate(); err != nil {
+		return nil, &types.InvalidArgumentError{Argument: "config", Err: err}
+	}
+	targetConfig, err := options.Config.GetTarget(options.Target)
+	if err != nil {
+		return nil, &types.InvalidArgumentError{Argument: "target", Err: err}
+	}
+
+	if ctx.Value(common.LogLevelKey{}) == nil {
+		ctx = context.WithValue(ctx, common.LogLevelKey{}, targetConfig.LogLevel)
+	}
+	newLoader := loader.New
+	if options.FS != nil {
+		newLoader = loader.NewFS(options.FS)
+	}
+	collector := options.Metrics
+	if collector == nil {
+		collector = metrics.NewNoop()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			c, err = nil, fmt.Errorf("could not create coordinator: %v", r)
+		}
+	}()
+	return coordinator.New(ctx, targetConfig, collector, db.New, newLoader, notifications.New), nil
+}
+
+// Run applies pending migrations like createVersion and returns its results
+// tenants which failed in per-tenant transactions are reported in Summary.FailedTenants and do not cause an error
+// panics raised while applying migrations are returned as errors
+func Run(ctx context.Context, options Options) (results *types.CreateResults, err error) {
+	if options.VersionName == "" {
+		return nil, &types.InvalidArgumentError{Argument: "versionName", Err: fmt.Errorf("version name is required")}
+	}
+
+	c, err := New(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Dispose()
+
+	defer func() {
+		if r := recover(); r != nil {
+			results, err = nil, fmt.Errorf("migrator panicked: %v", r)
+		}
+	}()
+	return c.CreateVersion(options.VersionName, options.Action, options.DryRun, options.Selector, options.PlanHash)
+}
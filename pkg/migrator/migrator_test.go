@@ -0,0 +1,119 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+func newTestOptions(t *testing.T) Options {
+	return Options{
+		Config: &config.Config{
+			BaseLocation:     "migrations",
+			Driver:           "sqlite",
+			DataSource:       filepath.Join(t.TempDir(), "migrator.db"),
+			SingleMigrations: []string{"config"},
+			TenantMigrations: []string{"tenants"},
+		},
+		FS: fstest.MapFS{
+			"migrations/config/201602160001.sql":  {Data: []byte("create table {schema}_settings (k text, v text)")},
+			"migrations/tenants/201602160002.sql": {Data: []byte("create table {schema}_orders (id integer)")},
+		},
+		VersionName: "v1.0.0",
+	}
+}
+
+func TestRun(t *testing.T) {
+	options := newTestOptions(t)
+
+	results, err := Run(context.TODO(), options)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.0.0", results.Version.Name)
+	assert.Equal(t, int32(1), results.Summary.SingleMigrations)
+	assert.Len(t, results.Version.DBMigrations, 1)
+	assert.Equal(t, "migrations/config/201602160001.sql", results.Version.DBMigrations[0].File)
+
+	// tenant migrations are applied when tenant is created
+	c, err := New(context.TODO(), options)
+	assert.Nil(t, err)
+	defer c.Dispose()
+	created, err := c.CreateTenant("v1.0.0-abc", types.ActionApply, false, "abc", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), created.Summary.TenantMigrationsTotal)
+
+	// nothing to apply
+	options.VersionName = "v1.0.1"
+	results, err = Run(context.TODO(), options)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(0), results.Summary.MigrationsGrandTotal)
+
+	plan, err := c.Plan("")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(0), plan.Pending())
+}
+
+func TestRunDryRun(t *testing.T) {
+	options := newTestOptions(t)
+	options.DryRun = true
+
+	results, err := Run(context.TODO(), options)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), results.Summary.SingleMigrations)
+
+	c, err := New(context.TODO(), options)
+	assert.Nil(t, err)
+	defer c.Dispose()
+	versions, err := c.GetVersions()
+	assert.Nil(t, err)
+	assert.Len(t, versions, 0)
+}
+
+func TestRunInvalidOptions(t *testing.T) {
+	var invalidArgument *types.InvalidArgumentError
+
+	options := newTestOptions(t)
+	options.VersionName = ""
+	_, err := Run(context.TODO(), options)
+	assert.True(t, errors.As(err, &invalidArgument))
+	assert.Equal(t, "versionName", invalidArgument.Argument)
+
+	options = newTestOptions(t)
+	options.Config.SingleMigrations = nil
+	_, err = Run(context.TODO(), options)
+	assert.True(t, errors.As(err, &invalidArgument))
+	assert.Equal(t, "config", invalidArgument.Argument)
+
+	options = newTestOptions(t)
+	options.Target = "orders"
+	_, err = Run(context.TODO(), options)
+	assert.True(t, errors.As(err, &invalidArgument))
+	assert.Equal(t, "target", invalidArgument.Argument)
+
+	_, err = Run(context.TODO(), Options{VersionName: "v1.0.0"})
+	assert.True(t, errors.As(err, &invalidArgument))
+	assert.Equal(t, "config", invalidArgument.Argument)
+}
+
+func TestRunUnknownDriver(t *testing.T) {
+	options := newTestOptions(t)
+	options.Config.Driver = "abc"
+
+	results, err := Run(context.TODO(), options)
+	assert.Nil(t, results)
+	assert.Contains(t, err.Error(), "unknown driver: abc")
+}
+
+func TestRunSourceError(t *testing.T) {
+	options := newTestOptions(t)
+	options.Config.TenantMigrations = []string{"abcdef"}
+
+	_, err := Run(context.TODO(), options)
+	assert.Contains(t, err.Error(), "could not read source dir migrations/abcdef")
+}
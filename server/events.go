@@ -0,0 +1,98 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/db"
+	"github.com/lukaszbudnik/migrator/metrics"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+const (
+	// events are buffered per subscriber, events of slow subscribers are dropped so that migrations never wait for them
+	eventsBufferSize = 1000
+	// keep-alive comments stop proxies and load balancers from closing idle streams
+	eventsKeepAliveInterval = 15 * time.Second
+)
+
+// eventBroker fans out migration events published by connectors of this migrator instance to all subscribers
+type eventBroker struct {
+	mutex       sync.Mutex
+	subscribers map[chan types.MigrationEvent]struct{}
+}
+
+var migrationEvents = &eventBroker{subscribers: map[chan types.MigrationEvent]struct{}{}}
+
+// publisher returns db.MigrationEventFunc which sets target of every event and publishes it to all subscribers
+func (b *eventBroker) publisher(target string) db.MigrationEventFunc {
+	return func(event types.MigrationEvent) {
+		event.Target = target
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		for subscriber := range b.subscribers {
+			select {
+			case subscriber <- event:
+			default:
+			}
+		}
+	}
+}
+
+// subscribe returns a channel with published events and a func which must be called to unsubscribe
+func (b *eventBroker) subscribe() (<-chan types.MigrationEvent, func()) {
+	subscriber := make(chan types.MigrationEvent, eventsBufferSize)
+	b.mutex.Lock()
+	b.subscribers[subscriber] = struct{}{}
+	b.mutex.Unlock()
+	return subscriber, func() {
+		b.mutex.Lock()
+		delete(b.subscribers, subscriber)
+		b.mutex.Unlock()
+	}
+}
+
+// Server-Sent Events endpoint, streams events of migrations applied by this migrator instance
+// optional target query parameter streams only events of a given target, "default" is the default target
+func eventsHandler(c *gin.Context, cfg *config.Config, metrics metrics.Metrics, newCoordinator coordinator.Factory) {
+	target, filter := c.GetQuery("target")
+	if target == config.DefaultTarget {
+		target = ""
+	}
+
+	events, unsubscribe := migrationEvents.subscribe()
+	defer unsubscribe()
+
+	common.LogInfo(c.Request.Context(), "Streaming migration events")
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	// send headers straight away, clients should not wait for the first event
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case event := <-events:
+			if !filter || event.Target == target {
+				c.SSEvent(string(event.Type), event)
+			}
+			return true
+		}
+	})
+}
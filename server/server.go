@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"net/http"
 	"os"
@@ -13,12 +14,14 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/graph-gophers/graphql-go"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/lukaszbudnik/migrator/common"
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/lukaszbudnik/migrator/converter"
 	"github.com/lukaszbudnik/migrator/coordinator"
 	"github.com/lukaszbudnik/migrator/data"
+	"github.com/lukaszbudnik/migrator/db"
 	"github.com/lukaszbudnik/migrator/metrics"
 	"github.com/lukaszbudnik/migrator/types"
 )
@@ -72,7 +75,7 @@ func recovery() gin.HandlerFunc {
 				if gin.IsDebugging() {
 					debug.PrintStack()
 				}
-				errorMsg := errorMessage{err.(string)}
+				errorMsg := errorMessage{fmt.Sprintf("%v", err)}
 				c.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse{Errors: []errorMessage{errorMsg}})
 			}
 		}()
@@ -139,10 +142,23 @@ func serviceHandler(c *gin.Context, config *config.Config, metrics metrics.Metri
 		return
 	}
 
-	coordinator := newCoordinator(c.Request.Context(), config, metrics)
-	defer coordinator.Dispose()
+	resolver := &data.RootResolver{Targets: map[string]coordinator.Coordinator{}}
+	// migration events are streamed by /v2/events
+	if config.HasDefaultTarget() {
+		ctx := db.WithMigrationEvents(c.Request.Context(), migrationEvents.publisher(""))
+		resolver.Coordinator = newCoordinator(ctx, config, metrics)
+		defer resolver.Coordinator.Dispose()
+	}
+	// coordinators are cheap to create, DB connection pools are shared and opened on first use
+	for _, name := range config.GetTargetNames() {
+		targetConfig, _ := config.GetTarget(name)
+		ctx := db.WithMigrationEvents(c.Request.Context(), migrationEvents.publisher(name))
+		targetCoordinator := newCoordinator(ctx, targetConfig, metrics)
+		defer targetCoordinator.Dispose()
+		resolver.Targets[name] = targetCoordinator
+	}
 	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
-	schema := graphql.MustParseSchema(data.SchemaDefinition, &data.RootResolver{Coordinator: coordinator}, opts...)
+	schema := graphql.MustParseSchema(data.SchemaDefinition, resolver, opts...)
 
 	response := schema.Exec(c.Request.Context(), params.Query, params.OperationName, params.Variables)
 	if response.Errors == nil {
@@ -271,6 +287,14 @@ func CreateRouterAndPrometheus(versionInfo *types.VersionInfo, config *config.Co
 
 	p.SetGaugeValue("info", []string{versionInfo.Release + " @ " + versionInfo.Sha}, 1)
 
+	// statistics of the shared DB connection pools are read on every scrape
+	dbStats := func() map[string]sql.DBStats {
+		return poolStats(config)
+	}
+	if err := prometheus.Register(metrics.NewDBStatsCollector(dbStats)); err != nil {
+		common.Log("WARN", "Could not register DB connection pool metrics: %v", err)
+	}
+
 	r.Use(p.Instrument())
 
 	metrics := metrics.New(p)
@@ -278,6 +302,24 @@ func CreateRouterAndPrometheus(versionInfo *types.VersionInfo, config *config.Co
 	return SetupRouter(r, versionInfo, config, metrics, newCoordinator)
 }
 
+// poolStats returns statistics of the shared DB connection pools of all targets
+func poolStats(cfg *config.Config) map[string]sql.DBStats {
+	stats := map[string]sql.DBStats{}
+	if cfg.HasDefaultTarget() {
+		if s, ok := db.Stats(cfg); ok {
+			stats[config.DefaultTarget] = s
+		}
+	}
+	for _, name := range cfg.GetTargetNames() {
+		// target names come from config thus target config is always found
+		targetConfig, _ := cfg.GetTarget(name)
+		if s, ok := db.Stats(targetConfig); ok {
+			stats[name] = s
+		}
+	}
+	return stats
+}
+
 // SetupRouter setups router
 func SetupRouter(r *gin.Engine, versionInfo *types.VersionInfo, config *config.Config, metrics metrics.Metrics, newCoordinator coordinator.Factory) *gin.Engine {
 	r.HandleMethodNotAllowed = true
@@ -312,6 +354,7 @@ func SetupRouter(r *gin.Engine, versionInfo *types.VersionInfo, config *config.C
 	v2.GET("/config", makeHandler(config, metrics, newCoordinator, configHandler))
 	v2.GET("/schema", makeHandler(config, metrics, newCoordinator, schemaHandler))
 	v2.POST("/service", makeHandler(config, metrics, newCoordinator, serviceHandler))
+	v2.GET("/events", makeHandler(config, metrics, newCoordinator, eventsHandler))
 
 	return r
 }
\ No newline at end of file
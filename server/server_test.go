@@ -1,16 +1,20 @@
 package server
 
 import (
+	"bufio"
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/lukaszbudnik/migrator/coordinator"
 	"github.com/lukaszbudnik/migrator/data"
+	"github.com/lukaszbudnik/migrator/metrics"
 	"github.com/lukaszbudnik/migrator/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -212,6 +216,40 @@ func TestGraphQLQueryWithVariables(t *testing.T) {
 	assert.Equal(t, `{"data":{"sourceMigration":{"name":"201602220001.sql","migrationType":"SingleMigration","sourceDir":"source","file":"source/201602220001.sql"}}}`, strings.TrimSpace(w.Body.String()))
 }
 
+func TestGraphQLQueryWithTarget(t *testing.T) {
+	cfg, err := config.FromBytes([]byte(`
+targets:
+  orders:
+    baseLocation: test/migrations
+    driver: postgres
+    dataSource: orders
+    singleMigrations:
+      - source`))
+	assert.Nil(t, err)
+
+	var dataSources []string
+	newCoordinator := func(ctx context.Context, targetConfig *config.Config, metrics metrics.Metrics) coordinator.Coordinator {
+		dataSources = append(dataSources, targetConfig.DataSource)
+		return newMockedCoordinator(ctx, targetConfig, metrics)
+	}
+	router := testSetupRouter(cfg, newCoordinator)
+
+	w := httptest.NewRecorder()
+	req, _ := newTestRequestV2("POST", "/service", strings.NewReader(`
+    {
+      "query": "query SourceMigration($file: String!, $target: String) { sourceMigration(file: $file, target: $target) { file } }",
+      "operationName": "SourceMigration",
+      "variables": { "file": "source/201602220001.sql", "target": "orders" }
+    }
+  `))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"data":{"sourceMigration":{"file":"source/201602220001.sql"}}}`, strings.TrimSpace(w.Body.String()))
+	// default target is not configured so only coordinator of orders target is created
+	assert.Equal(t, []string{"orders"}, dataSources)
+}
+
 func TestGraphQLQueryError(t *testing.T) {
 	config, err := config.FromFile(configFile)
 	assert.Nil(t, err)
@@ -247,6 +285,21 @@ func TestPanicHandlerGlobal(t *testing.T) {
 	assert.Equal(t, `{"errors":[{"message":"Mocked Coordinator: threshold 0 reached"}]}`, strings.TrimSpace(w.Body.String()))
 }
 
+func TestPanicHandlerGlobalNonStringValue(t *testing.T) {
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	router := testSetupRouter(config, newMockedCoordinatorHealthCheckPanicError)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/health", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Result().Header.Get("Content-Type"))
+	assert.Equal(t, `{"errors":[{"message":"Mocked Coordinator: health check error"}]}`, strings.TrimSpace(w.Body.String()))
+}
+
 func TestPanicHandlerGraphql(t *testing.T) {
 	config, err := config.FromFile(configFile)
 	assert.Nil(t, err)
@@ -330,3 +383,45 @@ func TestDeprecationHeadersWithBothFields(t *testing.T) {
 	assert.Empty(t, w.Header().Get("Sunset"))
 	assert.Empty(t, w.Header().Get("Warning"))
 }
+
+func TestEvents(t *testing.T) {
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	server := httptest.NewServer(testSetupRouter(config, newMockedCoordinator))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/v2/events?target=orders", nil)
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// wait for the handler to subscribe
+	assert.Eventually(t, func() bool {
+		migrationEvents.mutex.Lock()
+		defer migrationEvents.mutex.Unlock()
+		return len(migrationEvents.subscribers) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	migrationEvents.publisher("")(types.MigrationEvent{Type: types.MigrationEventStarted, File: "tenants/001.sql", Schema: "abc"})
+	migrationEvents.publisher("orders")(types.MigrationEvent{Type: types.MigrationEventFinished, VersionID: 12, File: "tenants/001.sql", Schema: "abc", Duration: 0.5})
+
+	// event of the default target is filtered out
+	reader := bufio.NewReader(resp.Body)
+	event, _ := reader.ReadString('\n')
+	data, _ := reader.ReadString('\n')
+	assert.Equal(t, "event:finished\n", event)
+	assert.Equal(t, `data:{"type":"finished","target":"orders","versionId":12,"file":"tenants/001.sql","schema":"abc","duration":0.5,"time":"0001-01-01T00:00:00Z"}`+"\n", data)
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		migrationEvents.mutex.Lock()
+		defer migrationEvents.mutex.Unlock()
+		return len(migrationEvents.subscribers) == 0
+	}, time.Second, 10*time.Millisecond)
+}
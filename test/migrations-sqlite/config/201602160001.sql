@@ -0,0 +1 @@
+create table {schema}_settings (k integer primary key, v text);
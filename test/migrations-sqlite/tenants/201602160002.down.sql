@@ -0,0 +1 @@
+drop table {schema}_users;
@@ -0,0 +1 @@
+create table {schema}_users (id integer primary key autoincrement, name text not null);
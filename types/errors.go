@@ -0,0 +1,127 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NotFoundError is returned when requested version, DB migration, or source migration does not exist
+type NotFoundError struct {
+	// Resource is the kind of the missing object, for example "version"
+	Resource string
+	// ID is the identifier used to look up the object
+	ID string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%v not found: %v", e.Resource, e.ID)
+}
+
+// ChecksumMismatchError is returned when source migrations differ from already applied DB migrations
+type ChecksumMismatchError struct {
+	// Migrations contains modified source migrations
+	Migrations []Migration
+}
+
+// Files returns files of modified source migrations
+func (e *ChecksumMismatchError) Files() []string {
+	files := []string{}
+	for _, m := range e.Migrations {
+		files = append(files, m.File)
+	}
+	return files
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch, applied migrations were modified: %v", strings.Join(e.Files(), ", "))
+}
+
+// OutOfOrderError is returned when pending migrations sort before already applied migrations and out-of-order policy is reject
+type OutOfOrderError struct {
+	// Migrations contains out-of-order source migrations
+	Migrations []Migration
+}
+
+// Files returns files of out-of-order source migrations
+func (e *OutOfOrderError) Files() []string {
+	files := []string{}
+	for _, m := range e.Migrations {
+		files = append(files, m.File)
+	}
+	return files
+}
+
+func (e *OutOfOrderError) Error() string {
+	return fmt.Sprintf("out-of-order migrations, pending migrations sort before already applied migrations: %v", strings.Join(e.Files(), ", "))
+}
+
+// SQLError is returned when a migration fails, Schema is empty when the failing statement is not specific to a schema
+type SQLError struct {
+	File   string
+	Schema string
+	Err    error
+}
+
+func (e *SQLError) Error() string {
+	if e.Schema == "" {
+		return fmt.Sprintf("SQL migration %v failed with error: %v", e.File, e.Err.Error())
+	}
+	return fmt.Sprintf("SQL migration %v failed for schema %v with error: %v", e.File, e.Schema, e.Err.Error())
+}
+
+func (e *SQLError) Unwrap() error {
+	return e.Err
+}
+
+// TemplateError is returned when contents of a migration cannot be rendered, template errors are reported before any migration is executed
+type TemplateError struct {
+	File   string
+	Schema string
+	Err    error
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("template %v failed for schema %v with error: %v", e.File, e.Schema, e.Err.Error())
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// LockTimeoutError is returned when migration lock held by another migrator instance was not acquired within lock timeout
+type LockTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *LockTimeoutError) Error() string {
+	return fmt.Sprintf("Another migration is in progress, could not acquire migration lock within %v", e.Timeout)
+}
+
+// InvalidArgumentError is returned when an argument passed to migrator is malformed, for example a label selector
+type InvalidArgumentError struct {
+	// Argument is the name of the malformed argument
+	Argument string
+	Err      error
+}
+
+func (e *InvalidArgumentError) Error() string {
+	return fmt.Sprintf("invalid %v: %v", e.Argument, e.Err.Error())
+}
+
+func (e *InvalidArgumentError) Unwrap() error {
+	return e.Err
+}
+
+// PlanChangedError is returned when createVersion is called with a plan hash and source migrations, tenants, or pending migrations
+// changed since the plan was made
+type PlanChangedError struct {
+	// Expected is the plan hash passed to createVersion
+	Expected string
+	// Actual is the hash of the current plan
+	Actual string
+}
+
+func (e *PlanChangedError) Error() string {
+	return fmt.Sprintf("plan changed since it was made, expected plan hash %v, actual plan hash %v", e.Expected, e.Actual)
+}
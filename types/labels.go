@@ -0,0 +1,136 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	isValidLabelKey   = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`).MatchString
+	isValidLabelValue = regexp.MustCompile(`^[A-Za-z0-9_.-]*$`).MatchString
+)
+
+// TenantLabel is a key/value pair attached to a tenant, for example region=eu or canary=true
+type TenantLabel struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ValidateTenantLabels returns an error if any label has invalid key or value or if a key is duplicated
+func ValidateTenantLabels(labels []TenantLabel) error {
+	keys := map[string]bool{}
+	for _, l := range labels {
+		if !isValidLabelKey(l.Key) {
+			return fmt.Errorf("label key contains invalid characters: %v", l.Key)
+		}
+		if !isValidLabelValue(l.Value) {
+			return fmt.Errorf("label value contains invalid characters: %v", l.Value)
+		}
+		if keys[l.Key] {
+			return fmt.Errorf("duplicated label key: %v", l.Key)
+		}
+		keys[l.Key] = true
+	}
+	return nil
+}
+
+// LabelOperator is an operator used in label selector requirements
+type LabelOperator string
+
+const (
+	// LabelOperatorEquals matches tenants with label key set to value
+	LabelOperatorEquals LabelOperator = "="
+	// LabelOperatorNotEquals matches tenants without label key or with label key set to a different value
+	LabelOperatorNotEquals LabelOperator = "!="
+	// LabelOperatorExists matches tenants with label key
+	LabelOperatorExists LabelOperator = ""
+	// LabelOperatorNotExists matches tenants without label key
+	LabelOperatorNotExists LabelOperator = "!"
+)
+
+// LabelRequirement is a single requirement of label selector
+type LabelRequirement struct {
+	Key      string
+	Operator LabelOperator
+	Value    string
+}
+
+// LabelSelector selects tenants by their labels, tenant is selected when it matches all requirements
+// empty (nil) selector selects all tenants
+type LabelSelector []LabelRequirement
+
+// ParseLabelSelector parses comma-separated requirements: key=value, key!=value, key (label exists), !key (label does not exist)
+func ParseLabelSelector(selector string) (LabelSelector, error) {
+	var requirements LabelSelector
+	if strings.TrimSpace(selector) == "" {
+		return requirements, nil
+	}
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+		var r LabelRequirement
+		switch {
+		case strings.Contains(part, "!="):
+			kv := strings.SplitN(part, "!=", 2)
+			r = LabelRequirement{Key: strings.TrimSpace(kv[0]), Operator: LabelOperatorNotEquals, Value: strings.TrimSpace(kv[1])}
+		case strings.Contains(part, "="):
+			kv := strings.SplitN(part, "=", 2)
+			r = LabelRequirement{Key: strings.TrimSpace(kv[0]), Operator: LabelOperatorEquals, Value: strings.TrimSpace(kv[1])}
+		case strings.HasPrefix(part, "!"):
+			r = LabelRequirement{Key: strings.TrimSpace(part[1:]), Operator: LabelOperatorNotExists}
+		default:
+			r = LabelRequirement{Key: part, Operator: LabelOperatorExists}
+		}
+		if !isValidLabelKey(r.Key) || !isValidLabelValue(r.Value) {
+			return nil, fmt.Errorf("invalid label selector requirement: %v", part)
+		}
+		requirements = append(requirements, r)
+	}
+	return requirements, nil
+}
+
+// Matches returns true if passed labels match all requirements of the selector
+func (s LabelSelector) Matches(labels []TenantLabel) bool {
+	values := map[string]string{}
+	for _, l := range labels {
+		values[l.Key] = l.Value
+	}
+	for _, r := range s {
+		value, ok := values[r.Key]
+		switch r.Operator {
+		case LabelOperatorEquals:
+			if !ok || value != r.Value {
+				return false
+			}
+		case LabelOperatorNotEquals:
+			if ok && value == r.Value {
+				return false
+			}
+		case LabelOperatorExists:
+			if !ok {
+				return false
+			}
+		case LabelOperatorNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SelectTenants returns tenants which labels match the selector, labels are attached to the returned tenants
+// key of labels is tenant name
+func (s LabelSelector) SelectTenants(tenants []Tenant, labels map[string][]TenantLabel) []Tenant {
+	selected := []Tenant{}
+	for _, t := range tenants {
+		t.Labels = labels[t.Name]
+		if t.Labels == nil {
+			t.Labels = []TenantLabel{}
+		}
+		if s.Matches(t.Labels) {
+			selected = append(selected, t)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,73 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// PlanCheck is passed to connector's CreateVersion which recomputes the plan under migrator lock
+// and returns PlanChangedError when its hash differs from the expected one
+type PlanCheck struct {
+	// Hash is the plan hash passed to createVersion
+	Hash string
+	// SourceMigrations are source migrations for which the plan was made, they are part of the plan hash
+	SourceMigrations []Migration
+}
+
+// NewPlan groups migrations by schemas and computes the plan hash
+// single schemas are ordered by their first migration, tenants are ordered like passed tenants
+func NewPlan(sourceMigrations []Migration, migrations []Migration, schemasToApply map[string][]string, tenants []Tenant) *Plan {
+	singleSchemas := []string{}
+	// key is schema, tenant may have the same name as a single schema thus they are kept separately
+	plannedSingle := map[string][]PlannedMigration{}
+	plannedTenant := map[string][]PlannedMigration{}
+	for _, m := range migrations {
+		single := m.MigrationType == MigrationTypeSingleMigration || m.MigrationType == MigrationTypeSingleScript
+		planned := plannedTenant
+		if single {
+			planned = plannedSingle
+		}
+		for _, schema := range schemasToApply[m.File] {
+			if _, ok := planned[schema]; !ok && single {
+				singleSchemas = append(singleSchemas, schema)
+			}
+			planned[schema] = append(planned[schema], PlannedMigration{File: m.File, MigrationType: m.MigrationType, CheckSum: m.CheckSum, OnChange: m.OnChange})
+		}
+	}
+
+	plan := &Plan{SingleSchemas: []SchemaPlan{}, Tenants: []SchemaPlan{}}
+	for _, schema := range singleSchemas {
+		plan.SingleSchemas = append(plan.SingleSchemas, SchemaPlan{Schema: schema, Migrations: plannedSingle[schema]})
+	}
+	for _, t := range tenants {
+		if migrations, ok := plannedTenant[t.Name]; ok {
+			plan.Tenants = append(plan.Tenants, SchemaPlan{Schema: t.Name, Migrations: migrations})
+		}
+	}
+	plan.Hash = plan.computeHash(sourceMigrations, tenants)
+	return plan
+}
+
+// computeHash returns SHA-256 of source migrations, tenants, and planned migrations
+// hash changes when a source migration is added or modified, when a tenant is added or removed, or when another version was applied
+func (p *Plan) computeHash(sourceMigrations []Migration, tenants []Tenant) string {
+	hasher := sha256.New()
+	for _, m := range sourceMigrations {
+		fmt.Fprintf(hasher, "source %v %v\n", m.File, m.CheckSum)
+	}
+	for _, t := range tenants {
+		fmt.Fprintf(hasher, "tenant %v\n", t.Name)
+	}
+	for _, s := range p.SingleSchemas {
+		for _, m := range s.Migrations {
+			fmt.Fprintf(hasher, "single %v %v %v\n", s.Schema, m.File, m.CheckSum)
+		}
+	}
+	for _, s := range p.Tenants {
+		for _, m := range s.Migrations {
+			fmt.Fprintf(hasher, "tenant %v %v %v\n", s.Schema, m.File, m.CheckSum)
+		}
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
@@ -0,0 +1,82 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// SchemaObject is a normalized description of a DB object of a schema: table, column, index, or constraint
+// name is qualified with table name for columns, indexes, and constraints, schema name is never included
+type SchemaObject struct {
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+// SchemaFingerprint contains sorted objects of a schema together with their fingerprint
+type SchemaFingerprint struct {
+	Schema      string         `json:"schema"`
+	Fingerprint string         `json:"fingerprint"`
+	Objects     []SchemaObject `json:"objects"`
+}
+
+// NewSchemaFingerprint sorts objects and computes SHA-256 fingerprint of them
+// schemas with identical objects have identical fingerprints
+func NewSchemaFingerprint(schema string, objects []SchemaObject) SchemaFingerprint {
+	sorted := append([]SchemaObject{}, objects...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Type != sorted[j].Type {
+			return sorted[i].Type < sorted[j].Type
+		}
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].Definition < sorted[j].Definition
+	})
+	hash := sha256.New()
+	for _, o := range sorted {
+		hash.Write([]byte(strings.Join([]string{o.Type, o.Name, o.Definition}, "\t")))
+		hash.Write([]byte("\n"))
+	}
+	return SchemaFingerprint{Schema: schema, Fingerprint: hex.EncodeToString(hash.Sum(nil)), Objects: sorted}
+}
+
+// SchemaObjectDiff describes a schema object which differs from the majority of tenants
+// expected is nil when the object exists only in the drifted schemas, actual is nil when the object is missing
+type SchemaObjectDiff struct {
+	Type     string  `json:"type"`
+	Name     string  `json:"name"`
+	Expected *string `json:"expected,omitempty"`
+	Actual   *string `json:"actual,omitempty"`
+}
+
+// SchemaDrift groups tenants which have the same schema fingerprint
+// differences are computed against the group with the most tenants (majority), majority group has no differences
+type SchemaDrift struct {
+	Fingerprint string             `json:"fingerprint"`
+	Tenants     []string           `json:"tenants"`
+	Majority    bool               `json:"majority"`
+	Objects     int32              `json:"objects"`
+	Differences []SchemaObjectDiff `json:"differences"`
+}
+
+// SchemaSnapshot contains objects of a schema captured right after a version was applied
+// single schemas are captured with MigrationTypeSingleMigration, one representative tenant with MigrationTypeTenantMigration
+type SchemaSnapshot struct {
+	Schema        string         `json:"schema"`
+	MigrationType MigrationType  `json:"migrationType"`
+	Fingerprint   string         `json:"fingerprint"`
+	Objects       []SchemaObject `json:"objects"`
+}
+
+// SchemaSnapshotDiff contains structural changes of a schema between two versions
+// expected definitions come from the from version and actual definitions from the to version
+// schemas are nil when a snapshot was not captured in the from or to version
+type SchemaSnapshotDiff struct {
+	MigrationType MigrationType      `json:"migrationType"`
+	FromSchema    *string            `json:"fromSchema,omitempty"`
+	ToSchema      *string            `json:"toSchema,omitempty"`
+	Differences   []SchemaObjectDiff `json:"differences"`
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/graph-gophers/graphql-go"
 )
@@ -64,7 +65,10 @@ func (t *MigrationType) UnmarshalGraphQL(input interface{}) error {
 
 // Tenant contains basic information about tenant
 type Tenant struct {
-	Name string `json:"name"`
+	Name   string        `json:"name"`
+	Labels []TenantLabel `json:"labels,omitempty"`
+	// Archived tenants are skipped by createVersion, their schemas and history are kept
+	Archived bool `json:"archived,omitempty"`
 }
 
 // Version contains information about migrator versions
@@ -73,6 +77,8 @@ type Version struct {
 	Name         string        `json:"name"`
 	Created      graphql.Time  `json:"created"`
 	DBMigrations []DBMigration `json:"dbMigrations"`
+	// captured only when schemaSnapshots config option is enabled
+	SchemaSnapshot []SchemaSnapshot `json:"schemaSnapshot"`
 }
 
 // Migration contains basic information about migration
@@ -83,6 +89,17 @@ type Migration struct {
 	MigrationType MigrationType `json:"migrationType"`
 	Contents      string        `json:"contents,omitempty"`
 	CheckSum      string        `json:"checkSum"`
+	// Down contains contents of the paired down migration (for example 201602160003.down.sql), empty if not present
+	Down string `json:"down,omitempty"`
+	// NoTransaction is set by the "-- migrator: transaction=false" directive, such migration is executed outside of the version transaction
+	NoTransaction bool `json:"noTransaction,omitempty"`
+	// Timeout is set by the "-- migrator: timeout=5m" directive, it overrides migrationTimeout config option
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// OnChange is set for scripts loaded from onChangeScripts directories, such script is applied to a schema only when its checksum
+	// differs from the checksum of the script last applied to that schema
+	OnChange bool `json:"onChange,omitempty"`
+	// OutOfOrder is set for pending source migrations which sort before already applied migrations
+	OutOfOrder bool `json:"outOfOrder,omitempty"`
 }
 
 // DBMigration embeds Migration and adds DB-specific fields
@@ -107,12 +124,158 @@ type Summary struct {
 	TenantScripts         int32        `json:"tenantScripts"`
 	TenantScriptsTotal    int32        `json:"tenantScriptsTotal"` // tenant scripts for all tenants
 	ScriptsGrandTotal     int32        `json:"scriptsGrandTotal"`  // total number of all scripts applied
+	// ScriptsSkipped is the number of on-change scripts (for all schemas) which were not applied because their checksums did not change
+	ScriptsSkipped int32 `json:"scriptsSkipped"`
+	// SucceededTenants and FailedTenants are only set when tenants are committed in separate transactions
+	SucceededTenants []string        `json:"succeededTenants,omitempty"`
+	FailedTenants    []TenantFailure `json:"failedTenants,omitempty"`
+	// TenantDurations is only set when tenants are committed in separate transactions
+	TenantDurations []TenantDuration `json:"tenantDurations,omitempty"`
+	// NonTransactional contains files executed outside of the version transaction, changes made by them cannot be rolled back
+	NonTransactional []string `json:"nonTransactional,omitempty"`
+}
+
+// TenantDuration contains tenant name and how long (in seconds) its migrations took
+type TenantDuration struct {
+	Tenant   string  `json:"tenant"`
+	Duration float64 `json:"duration"`
+}
+
+// TenantFailure contains tenant name and the error which caused its transaction to be rolled back
+type TenantFailure struct {
+	Tenant string `json:"tenant"`
+	Error  string `json:"error"`
+}
+
+// ChecksumMismatch contains a source migration which was modified after it had been applied
+type ChecksumMismatch struct {
+	File            string    `json:"file"`
+	SourceCheckSum  string    `json:"sourceCheckSum"`
+	AppliedCheckSum string    `json:"appliedCheckSum"`
+	Versions        []Version `json:"versions"`
+	// Diff is a unified diff between applied and source contents
+	Diff string `json:"diff"`
+}
+
+// ChecksumRepair contains audit record of contents and checksum of an applied migration replaced with the source ones
+type ChecksumRepair struct {
+	File        string `json:"file"`
+	OldCheckSum string `json:"oldCheckSum"`
+	NewCheckSum string `json:"newCheckSum"`
+	OldContents string `json:"oldContents,omitempty"`
+	NewContents string `json:"newContents,omitempty"`
+	Reason      string `json:"reason"`
+	// Schemas is the number of schemas in which the migration was repaired
+	Schemas int32 `json:"schemas"`
+}
+
+// PlannedMigration is a source migration which createVersion would apply to a schema
+type PlannedMigration struct {
+	File          string        `json:"file"`
+	MigrationType MigrationType `json:"migrationType"`
+	CheckSum      string        `json:"checkSum"`
+	OnChange      bool          `json:"onChange,omitempty"`
+}
+
+// SchemaPlan contains migrations which createVersion would apply to a schema, in the order in which they would be applied
+type SchemaPlan struct {
+	Schema     string             `json:"schema"`
+	Migrations []PlannedMigration `json:"migrations"`
+}
+
+// Plan contains migrations which createVersion would apply to single schemas and to tenants
+type Plan struct {
+	// Hash identifies source migrations, tenants, and planned migrations, createVersion called with it refuses to run when any of them changed
+	Hash          string       `json:"hash"`
+	SingleSchemas []SchemaPlan `json:"singleSchemas"`
+	Tenants       []SchemaPlan `json:"tenants"`
+}
+
+// Pending returns the number of planned migrations and changed on-change scripts (for all schemas)
+// scripts are applied by every version and are not counted as pending
+func (p *Plan) Pending() int32 {
+	var pending int32
+	for _, schemas := range [][]SchemaPlan{p.SingleSchemas, p.Tenants} {
+		for _, s := range schemas {
+			for _, m := range s.Migrations {
+				if m.OnChange || (m.MigrationType != MigrationTypeSingleScript && m.MigrationType != MigrationTypeTenantScript) {
+					pending++
+				}
+			}
+		}
+	}
+	return pending
 }
 
 // CreateResults contains results of CreateVersion or CreateTenant
+// when operation is run asynchronously Job is set, Summary is empty and Version is nil
 type CreateResults struct {
 	Summary *Summary
 	Version *Version
+	Job     *Job
+}
+
+// JobStatus represents state of an asynchronous job
+type JobStatus string
+
+const (
+	// JobStatusQueued means job was recorded and has not started yet
+	JobStatusQueued JobStatus = "Queued"
+	// JobStatusRunning means job is running
+	JobStatusRunning JobStatus = "Running"
+	// JobStatusSucceeded means job finished and its summary is available
+	JobStatusSucceeded JobStatus = "Succeeded"
+	// JobStatusFailed means job finished with an error
+	JobStatusFailed JobStatus = "Failed"
+)
+
+// asynchronous operations, see Job.Operation
+const (
+	JobOperationCreateVersion = "createVersion"
+	JobOperationCreateTenant  = "createTenant"
+)
+
+// Job represents createVersion or createTenant operation run asynchronously, jobs are stored in DB so that they can be read by any migrator instance
+type Job struct {
+	ID        int32     `json:"id"`
+	Operation string    `json:"operation"`
+	Name      string    `json:"name"`
+	Status    JobStatus `json:"status"`
+	// Applied is the number of migrations applied so far out of Total, a migration applied to N schemas counts N times
+	Applied int32    `json:"applied"`
+	Total   int32    `json:"total"`
+	Summary *Summary `json:"summary,omitempty"`
+	Error   *string  `json:"error,omitempty"`
+	// Owner is the migrator instance which runs the job, it stores Heartbeat while the job is running
+	Owner     *string       `json:"owner,omitempty"`
+	Heartbeat *graphql.Time `json:"heartbeat,omitempty"`
+	Created   graphql.Time  `json:"created"`
+	Updated   graphql.Time  `json:"updated"`
+}
+
+// MigrationEventType is the type of MigrationEvent
+type MigrationEventType string
+
+const (
+	// MigrationEventStarted is published before a migration is applied to a schema
+	MigrationEventStarted MigrationEventType = "started"
+	// MigrationEventFinished is published after a migration was applied to a schema or failed
+	MigrationEventFinished MigrationEventType = "finished"
+)
+
+// MigrationEvent is published when a migration starts and finishes in a schema, it is used to stream progress of a version
+type MigrationEvent struct {
+	Type MigrationEventType `json:"type"`
+	// Target is the name of the target, empty for the default target
+	Target    string `json:"target,omitempty"`
+	VersionID int32  `json:"versionId"`
+	File      string `json:"file"`
+	Schema    string `json:"schema"`
+	// Duration in seconds, set only when migration finished
+	Duration float64 `json:"duration,omitempty"`
+	// Error is set only when migration failed
+	Error *string      `json:"error,omitempty"`
+	Time  graphql.Time `json:"time"`
 }
 
 // Action stores information about migrator action
@@ -164,6 +327,9 @@ type VersionInput struct {
 	VersionName string
 	Action      Action
 	DryRun      bool
+	Selector    *string
+	Async       bool
+	PlanHash    *string
 }
 
 // TenantInput is used by GraphQL to create a new tenant in DB
@@ -172,6 +338,8 @@ type TenantInput struct {
 	Action      Action
 	DryRun      bool
 	TenantName  string
+	Labels      *[]TenantLabel
+	Async       bool
 }
 
 // APIVersion represents migrator API versions